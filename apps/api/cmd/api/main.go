@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
@@ -12,14 +13,28 @@ import (
 	"github.com/gofiber/fiber/v3/middleware/session"
 	"github.com/gofiber/storage/redis/v3"
 	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/blobstore"
+	"github.com/ted-too/logsicle/internal/cardinality"
+	"github.com/ted-too/logsicle/internal/catalog"
 	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/forward"
 	"github.com/ted-too/logsicle/internal/handlers"
+	"github.com/ted-too/logsicle/internal/issues"
+	"github.com/ted-too/logsicle/internal/mailer"
+	"github.com/ted-too/logsicle/internal/pipeline"
 	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/redaction"
+	"github.com/ted-too/logsicle/internal/rollup"
+	"github.com/ted-too/logsicle/internal/sampling"
 	"github.com/ted-too/logsicle/internal/server"
+	"github.com/ted-too/logsicle/internal/sourcemap"
+	"github.com/ted-too/logsicle/internal/spanmetrics"
+	"github.com/ted-too/logsicle/internal/statsd"
 	"github.com/ted-too/logsicle/internal/storage"
 	database "github.com/ted-too/logsicle/internal/storage"
 	"github.com/ted-too/logsicle/internal/storage/models"
 	"github.com/ted-too/logsicle/internal/storage/timescale"
+	"github.com/ted-too/logsicle/internal/syslog"
 )
 
 func generateSessionID() string {
@@ -41,7 +56,8 @@ func main() {
 
 	log.SetLevel(log.LevelDebug)
 
-	// Initialize Fiber app
+	// Initialize Fiber app, ingest routes raise the default body limit in
+	// SetupRoutes
 	app := fiber.New()
 
 	app.Use(recoverer.New())
@@ -63,9 +79,15 @@ func main() {
 		KeyGenerator:   generateSessionID,
 		CookieSecure:   !cfg.Dev, // For HTTPS
 		CookieHTTPOnly: true,
+		// Enforced per session by the auth middleware, these expire the
+		// session data
+		IdleTimeout:     cfg.SessionIdleTimeout(),
+		AbsoluteTimeout: cfg.SessionAbsoluteTimeout(),
 	})
 
 	sessionStore.RegisterType(storage.Session{})
+	sessionStore.RegisterType(storage.OAuthState{})
+	sessionStore.RegisterType(storage.PendingTwoFactor{})
 
 	app.Use(sessionMiddleware)
 
@@ -83,9 +105,49 @@ func main() {
 	}
 	defer queueService.Close()
 
+	// Run project ingest pipelines on app logs before they are queued
+	pipelineRunner := pipeline.NewRunner(db)
+	queueService.UseAppLogProcessor(pipelineRunner)
+
+	// Symbolicate minified stack frames with uploaded source maps
+	artifactStore, err := blobstore.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize artifact store: %v", err)
+	}
+	symbolicator := sourcemap.NewSymbolicator(db, artifactStore, cfg.Artifacts.MaxSize)
+	queueService.UseAppLogProcessor(symbolicator)
+
+	// Redact request and app logs before they are queued, app logs after
+	// pipelines and symbolication so nothing they add escapes redaction
+	redactionRunner := redaction.NewRunner(db, cfg.Ingest.RedactionHashKey)
+	queueService.UseRequestLogProcessor(redactionRunner)
+	queueService.UseAppLogProcessor(redactionRunner)
+
 	// Create processor with metrics
 	processor := queue.NewProcessor(queueService)
 
+	// Group app logs carrying exceptions into issues once they are inserted,
+	// so a failed insert that is retried does not count an occurrence twice
+	processor.UseIssueTracker(issues.NewTracker(db))
+
+	// Tail sample traces before they are inserted
+	decisionWait, err := time.ParseDuration(cfg.Sampling.DecisionWait)
+	if err != nil {
+		log.Fatalf("Invalid sampling decision wait: %v", err)
+	}
+	sampler := sampling.NewSampler(db, decisionWait, cfg.Sampling.MaxBufferedSpans)
+	processor.UseTraceSampler(sampler)
+
+	// Derive request rate, error rate and duration metrics from spans
+	processor.UseSpanMetrics(spanmetrics.NewAggregator())
+
+	// Limit active series per metric before metrics are inserted
+	metricLimiter := cardinality.NewLimiter(db)
+	processor.UseMetricLimiter(metricLimiter)
+
+	// Record inserted metrics in the metric catalog
+	processor.UseMetricCatalog(catalog.NewCatalog(db))
+
 	// Create a context with cancellation for graceful shutdown
 	processorCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -93,8 +155,44 @@ func main() {
 	// Start processor
 	processor.Start(processorCtx)
 
+	// Roll metrics up into 1 minute, 1 hour and 1 day resolutions
+	go rollup.NewRoller(ts.Pool).Run(processorCtx)
+
+	// Start syslog receiver
+	if cfg.Syslog.Enabled {
+		syslogServer := syslog.NewServer(cfg, queueService)
+		if err := syslogServer.Start(processorCtx); err != nil {
+			log.Fatalf("Failed to start syslog receiver: %v", err)
+		}
+		defer syslogServer.Close()
+	}
+
+	// Start Fluent Forward receiver
+	if cfg.Forward.Enabled {
+		forwardServer := forward.NewServer(cfg, queueService)
+		if err := forwardServer.Start(processorCtx); err != nil {
+			log.Fatalf("Failed to start forward receiver: %v", err)
+		}
+		defer forwardServer.Close()
+	}
+
+	// Start StatsD receiver
+	if cfg.StatsD.Enabled {
+		statsdServer := statsd.NewServer(cfg, db, queueService)
+		if err := statsdServer.Start(processorCtx); err != nil {
+			log.Fatalf("Failed to start statsd receiver: %v", err)
+		}
+		defer statsdServer.Close()
+	}
+
+	// Send verification and password reset emails
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+
 	// Setup routes
-	handlers.SetupRoutes(app, db, ts.Pool, processor, queueService, cfg)
+	handlers.SetupRoutes(app, db, ts.Pool, processor, queueService, pipelineRunner, redactionRunner, artifactStore, symbolicator, sampler, metricLimiter, mail, cfg)
 
 	// Initialize server with graceful shutdown
 	s := server.NewServer(app, cfg)
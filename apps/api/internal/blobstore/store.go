@@ -0,0 +1,37 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ted-too/logsicle/internal/config"
+)
+
+// Blob store backends
+const (
+	BackendLocal = "local"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps uploaded files such as source map artifacts. Keys are slash
+// separated paths chosen by the caller.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns ErrNotFound when the key does not exist
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds when the key does not exist
+	Delete(ctx context.Context, key string) error
+}
+
+// New creates the store configured for artifacts
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.Artifacts.Backend {
+	case BackendLocal:
+		return NewLocalStore(cfg.Artifacts.Dir)
+	default:
+		return nil, fmt.Errorf("unsupported blob store backend %q", cfg.Artifacts.Backend)
+	}
+}
@@ -0,0 +1,565 @@
+package cardinality
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// How long a project's limits are reused before reloading
+	cacheTTL = 30 * time.Second
+	// Series not seen for this long no longer count as active
+	ActiveWindow = time.Hour
+	// How often inactive series are expired
+	expireInterval = time.Minute
+	// Maximum number of warnings kept per project
+	maxWarnings = 100
+	// Stripped series may grow past the limit up to this multiple of it,
+	// points beyond are dropped
+	stripHeadroom = 2
+)
+
+// Limits are the compiled cardinality settings of a project
+type Limits struct {
+	maxSeries int64
+	action    string
+	perMetric map[string]int64
+}
+
+// Limit returns the series limit of a metric, 0 when unlimited
+func (l *Limits) Limit(name string) int64 {
+	if limit, ok := l.perMetric[name]; ok {
+		return limit
+	}
+	return l.maxSeries
+}
+
+// Compile validates settings and builds their limits
+func Compile(settings models.MetricCardinalitySettings) (*Limits, error) {
+	if err := ValidateAction(settings.Action); err != nil {
+		return nil, err
+	}
+
+	perMetric := make(map[string]int64)
+	if settings.MetricLimits != "" {
+		if err := json.Unmarshal([]byte(settings.MetricLimits), &perMetric); err != nil {
+			return nil, fmt.Errorf("invalid metric limits: %w", err)
+		}
+	}
+
+	return &Limits{
+		maxSeries: settings.MaxSeriesPerMetric,
+		action:    settings.Action,
+		perMetric: perMetric,
+	}, nil
+}
+
+// ValidateAction checks the action taken when a limit is exceeded
+func ValidateAction(action string) error {
+	switch action {
+	case models.CardinalityActionDrop, models.CardinalityActionStripAttribute:
+		return nil
+	}
+	return fmt.Errorf("action must be %q or %q", models.CardinalityActionDrop, models.CardinalityActionStripAttribute)
+}
+
+// Warning reports points of a metric that exceeded its series limit
+type Warning struct {
+	MetricName string    `json:"metric_name"`
+	Action     string    `json:"action"`
+	Attribute  string    `json:"attribute,omitempty"` // stripped attribute
+	Limit      int64     `json:"limit"`
+	Points     int64     `json:"points"` // points dropped or stripped
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type cacheEntry struct {
+	limits   *Limits
+	loadedAt time.Time
+}
+
+// metricSeries tracks the active series of one metric
+type metricSeries struct {
+	series map[uint64]time.Time // last seen by series hash
+	// Distinct values seen per attribute key, capped at the limit, used to
+	// find the attribute driving cardinality
+	values   map[string]map[uint64]struct{}
+	stripped map[string]struct{} // attributes removed from new series
+}
+
+// Limiter enforces per-metric active series limits. Series are tracked in
+// memory per process, so counts restart when the process does.
+type Limiter struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	cache    map[string]cacheEntry
+	metrics  map[string]*metricSeries // by project and metric name
+	warnings map[string][]*Warning    // by project
+
+	droppedPoints  int64
+	strippedPoints int64
+}
+
+func NewLimiter(db *gorm.DB) *Limiter {
+	return &Limiter{
+		db:       db,
+		cache:    make(map[string]cacheEntry),
+		metrics:  make(map[string]*metricSeries),
+		warnings: make(map[string][]*Warning),
+	}
+}
+
+// Load returns the compiled limits of a project, or the defaults when none
+// are stored
+func (l *Limiter) Load(ctx context.Context, projectID string) (*Limits, error) {
+	l.mu.Lock()
+	entry, ok := l.cache[projectID]
+	l.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.limits, nil
+	}
+
+	settings := models.DefaultMetricCardinalitySettings(projectID)
+	if err := l.db.WithContext(ctx).Where("project_id = ?", projectID).First(&settings).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	limits, err := Compile(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.cache[projectID] = cacheEntry{limits: limits, loadedAt: time.Now()}
+	l.mu.Unlock()
+
+	return limits, nil
+}
+
+// Invalidate drops the cached limits of a project
+func (l *Limiter) Invalidate(projectID string) {
+	l.mu.Lock()
+	delete(l.cache, projectID)
+	l.mu.Unlock()
+}
+
+func metricKey(projectID, name string) string {
+	return projectID + "\x00" + name
+}
+
+// seriesHash identifies a series by service and attributes. Attributes are
+// encoded from maps, so their keys are sorted.
+func seriesHash(serviceName string, attributes []byte) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(serviceName))
+	h.Write([]byte{0})
+	h.Write(attributes)
+	return h.Sum64()
+}
+
+func valueHash(value any) uint64 {
+	h := fnv.New64a()
+	fmt.Fprint(h, value)
+	return h.Sum64()
+}
+
+// pendingSeries stages the series a Limit call admits for one metric
+type pendingSeries struct {
+	series   map[uint64]struct{} // admitted series, new or already tracked
+	added    int64               // admitted series not tracked yet
+	values   map[string]map[uint64]struct{}
+	stripped map[string]struct{}
+}
+
+type pendingWarning struct {
+	projectID  string
+	metricName string
+	action     string
+	attribute  string
+	limit      int64
+}
+
+// admission holds everything a Limit call records until its metrics are
+// inserted
+type admission struct {
+	metrics  map[string]*pendingSeries // by project and metric name
+	warnings []pendingWarning
+	dropped  int64
+	stripped int64
+}
+
+func (a *admission) pending(key string) *pendingSeries {
+	p, ok := a.metrics[key]
+	if !ok {
+		p = &pendingSeries{
+			series:   make(map[uint64]struct{}),
+			values:   make(map[string]map[uint64]struct{}),
+			stripped: make(map[string]struct{}),
+		}
+		a.metrics[key] = p
+	}
+	return p
+}
+
+// seriesView reads a metric's tracked series together with the series
+// staged by a Limit call
+type seriesView struct {
+	ms *metricSeries // nil when the metric is not tracked yet
+	p  *pendingSeries
+}
+
+func (v seriesView) has(hash uint64) bool {
+	if _, ok := v.p.series[hash]; ok {
+		return true
+	}
+	if v.ms != nil {
+		_, ok := v.ms.series[hash]
+		return ok
+	}
+	return false
+}
+
+func (v seriesView) count() int64 {
+	n := v.p.added
+	if v.ms != nil {
+		n += int64(len(v.ms.series))
+	}
+	return n
+}
+
+func (v seriesView) admit(hash uint64) {
+	if !v.has(hash) {
+		v.p.added++
+	}
+	v.p.series[hash] = struct{}{}
+}
+
+func (v seriesView) hasValue(name string, hash uint64) bool {
+	if _, ok := v.p.values[name][hash]; ok {
+		return true
+	}
+	if v.ms != nil {
+		_, ok := v.ms.values[name][hash]
+		return ok
+	}
+	return false
+}
+
+func (v seriesView) valueCount(name string) int {
+	n := len(v.p.values[name])
+	if v.ms != nil {
+		n += len(v.ms.values[name])
+	}
+	return n
+}
+
+func (v seriesView) isStripped(name string) bool {
+	if _, ok := v.p.stripped[name]; ok {
+		return true
+	}
+	if v.ms != nil {
+		_, ok := v.ms.stripped[name]
+		return ok
+	}
+	return false
+}
+
+// Limit implements queue.MetricLimiter. It returns the metrics to insert,
+// dropping or stripping points of new series beyond their metric's limit.
+// The returned commit records the admitted series, drops and warnings, so
+// a batch that fails to insert and is limited again is not counted twice.
+func (l *Limiter) Limit(ctx context.Context, metrics []*tsmodels.Metric) ([]*tsmodels.Metric, func()) {
+	a := &admission{metrics: make(map[string]*pendingSeries)}
+	pass := make([]*tsmodels.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		limits, err := l.Load(ctx, metric.ProjectID)
+		if err != nil {
+			// Keep metrics rather than losing them to a settings error
+			log.Printf("Error loading cardinality limits for project %s: %v", metric.ProjectID, err)
+			pass = append(pass, metric)
+			continue
+		}
+
+		limit := limits.Limit(metric.Name)
+		if limit <= 0 {
+			pass = append(pass, metric)
+			continue
+		}
+
+		if l.admit(metric, limits, limit, a) {
+			pass = append(pass, metric)
+		}
+	}
+	return pass, func() { l.commit(a) }
+}
+
+// admit stages the series of a metric point, returning false when the
+// point is dropped
+func (l *Limiter) admit(metric *tsmodels.Metric, limits *Limits, limit int64, a *admission) bool {
+	var attributes map[string]any
+	if len(metric.Attributes) > 0 {
+		_ = json.Unmarshal(metric.Attributes, &attributes)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := metricKey(metric.ProjectID, metric.Name)
+	v := seriesView{ms: l.metrics[key], p: a.pending(key)}
+
+	hash := seriesHash(metric.ServiceName, metric.Attributes)
+	if v.has(hash) {
+		v.admit(hash)
+		return true
+	}
+
+	if v.count() < limit {
+		v.admit(hash)
+		v.trackValues(attributes, limit)
+		return true
+	}
+
+	if limits.action == models.CardinalityActionStripAttribute && len(attributes) > 0 {
+		if offending := v.offendingAttribute(attributes); offending != "" {
+			v.p.stripped[offending] = struct{}{}
+		}
+
+		var stripped []string
+		for name := range attributes {
+			if v.isStripped(name) {
+				stripped = append(stripped, name)
+			}
+		}
+
+		if len(stripped) > 0 {
+			sort.Strings(stripped)
+			for _, name := range stripped {
+				delete(attributes, name)
+			}
+			metric.Attributes = tsmodels.ConvertToJSONB(attributes)
+			hash = seriesHash(metric.ServiceName, metric.Attributes)
+			if v.has(hash) || v.count() < limit*stripHeadroom {
+				v.admit(hash)
+				a.stripped++
+				for _, name := range stripped {
+					a.warnings = append(a.warnings, pendingWarning{metric.ProjectID, metric.Name, models.CardinalityActionStripAttribute, name, limit})
+				}
+				return true
+			}
+		}
+	}
+
+	a.dropped++
+	a.warnings = append(a.warnings, pendingWarning{metric.ProjectID, metric.Name, models.CardinalityActionDrop, "", limit})
+	return false
+}
+
+func (v seriesView) trackValues(attributes map[string]any, limit int64) {
+	for name, value := range attributes {
+		hash := valueHash(value)
+		if v.hasValue(name, hash) || int64(v.valueCount(name)) > limit {
+			continue
+		}
+		values, ok := v.p.values[name]
+		if !ok {
+			values = make(map[uint64]struct{})
+			v.p.values[name] = values
+		}
+		values[hash] = struct{}{}
+	}
+}
+
+// offendingAttribute returns the attribute of a point with the most
+// distinct values seen for its metric
+func (v seriesView) offendingAttribute(attributes map[string]any) string {
+	var offending string
+	most := 0
+	for name := range attributes {
+		if n := v.valueCount(name); n > most || (n == most && name < offending) {
+			offending, most = name, n
+		}
+	}
+	return offending
+}
+
+// commit records the series, drops and warnings staged by a Limit call
+func (l *Limiter) commit(a *admission) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, p := range a.metrics {
+		ms, ok := l.metrics[key]
+		if !ok {
+			ms = &metricSeries{
+				series:   make(map[uint64]time.Time),
+				values:   make(map[string]map[uint64]struct{}),
+				stripped: make(map[string]struct{}),
+			}
+			l.metrics[key] = ms
+		}
+		for hash := range p.series {
+			ms.series[hash] = now
+		}
+		for name, staged := range p.values {
+			values, ok := ms.values[name]
+			if !ok {
+				values = make(map[uint64]struct{})
+				ms.values[name] = values
+			}
+			for hash := range staged {
+				values[hash] = struct{}{}
+			}
+		}
+		for name := range p.stripped {
+			ms.stripped[name] = struct{}{}
+		}
+	}
+
+	l.droppedPoints += a.dropped
+	l.strippedPoints += a.stripped
+	for _, w := range a.warnings {
+		l.warn(w.projectID, w.metricName, w.action, w.attribute, w.limit, now)
+	}
+}
+
+// warn records a limit being exceeded, caller must hold the lock
+func (l *Limiter) warn(projectID, metricName, action, attribute string, limit int64, now time.Time) {
+	warnings := l.warnings[projectID]
+	for _, w := range warnings {
+		if w.MetricName == metricName && w.Action == action && w.Attribute == attribute {
+			w.Points++
+			w.Limit = limit
+			w.LastSeen = now
+			return
+		}
+	}
+
+	if len(warnings) >= maxWarnings {
+		// Replace the warning seen least recently
+		sort.Slice(warnings, func(i, j int) bool { return warnings[i].LastSeen.After(warnings[j].LastSeen) })
+		warnings = warnings[:maxWarnings-1]
+	}
+	l.warnings[projectID] = append(warnings, &Warning{
+		MetricName: metricName,
+		Action:     action,
+		Attribute:  attribute,
+		Limit:      limit,
+		Points:     1,
+		FirstSeen:  now,
+		LastSeen:   now,
+	})
+}
+
+// Warnings returns the limit warnings of a project seen within the active
+// window, most recent first
+func (l *Limiter) Warnings(projectID string) []Warning {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := time.Now().Add(-ActiveWindow)
+	warnings := []Warning{}
+	for _, w := range l.warnings[projectID] {
+		if w.LastSeen.After(cutoff) {
+			warnings = append(warnings, *w)
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].LastSeen.After(warnings[j].LastSeen) })
+	return warnings
+}
+
+// ActiveSeries returns the number of active series per metric of a
+// project. Only metrics with a limit are tracked.
+func (l *Limiter) ActiveSeries(projectID string) map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active := make(map[string]int)
+	prefix := metricKey(projectID, "")
+	for key, ms := range l.metrics {
+		if len(key) > len(prefix) && key[:len(prefix)] == prefix {
+			active[key[len(prefix):]] = len(ms.series)
+		}
+	}
+	return active
+}
+
+// expire removes series and warnings not seen within the active window
+func (l *Limiter) expire(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-ActiveWindow)
+	for key, ms := range l.metrics {
+		for hash, lastSeen := range ms.series {
+			if lastSeen.Before(cutoff) {
+				delete(ms.series, hash)
+			}
+		}
+		if len(ms.series) == 0 {
+			delete(l.metrics, key)
+		}
+	}
+
+	for projectID, warnings := range l.warnings {
+		kept := warnings[:0]
+		for _, w := range warnings {
+			if w.LastSeen.After(cutoff) {
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(l.warnings, projectID)
+		} else {
+			l.warnings[projectID] = kept
+		}
+	}
+}
+
+// Run implements queue.MetricLimiter. It expires inactive series until ctx
+// is done.
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.expire(now)
+		}
+	}
+}
+
+// Stats implements queue.MetricLimiter
+func (l *Limiter) Stats() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	series := 0
+	for _, ms := range l.metrics {
+		series += len(ms.series)
+	}
+
+	return map[string]interface{}{
+		"tracked_series":  series,
+		"dropped_points":  l.droppedPoints,
+		"stripped_points": l.strippedPoints,
+	}
+}
@@ -0,0 +1,249 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// How often observed metrics are written to the catalog
+	flushInterval = 30 * time.Second
+	// Number of sample values kept per attribute key
+	MaxSampleValues = 10
+	// Longer sample values are truncated
+	maxSampleValueLength = 200
+	// Attribute keys recorded per metric between flushes, further keys wait
+	// for a later flush
+	maxAttributeKeys = 200
+)
+
+// upsertEntrySQL records a metric, creating its entry on first sight
+const upsertEntrySQL = `
+	INSERT INTO metric_catalog_entries (
+		id, created_at, updated_at, project_id, name, type, unit, description,
+		services, first_seen, last_seen
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (project_id, name) DO UPDATE SET
+		updated_at = EXCLUDED.updated_at,
+		type = EXCLUDED.type,
+		unit = COALESCE(NULLIF(EXCLUDED.unit, ''), metric_catalog_entries.unit),
+		description = COALESCE(NULLIF(EXCLUDED.description, ''), metric_catalog_entries.description),
+		services = COALESCE((SELECT array_agg(DISTINCT s) FROM unnest(metric_catalog_entries.services || EXCLUDED.services) s), '{}'),
+		first_seen = LEAST(metric_catalog_entries.first_seen, EXCLUDED.first_seen),
+		last_seen = GREATEST(metric_catalog_entries.last_seen, EXCLUDED.last_seen)`
+
+// upsertAttributeSQL records an attribute key of a metric, keeping the
+// first sample values seen
+var upsertAttributeSQL = fmt.Sprintf(`
+	INSERT INTO metric_catalog_attributes (
+		id, created_at, updated_at, project_id, metric_name, key, sample_values, last_seen
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (project_id, metric_name, key) DO UPDATE SET
+		updated_at = EXCLUDED.updated_at,
+		sample_values = COALESCE((
+			SELECT array_agg(v ORDER BY n) FROM (
+				SELECT v, MIN(n) AS n
+				FROM unnest(metric_catalog_attributes.sample_values || EXCLUDED.sample_values) WITH ORDINALITY AS u(v, n)
+				GROUP BY v
+				ORDER BY n
+				LIMIT %d
+			) s
+		), '{}'),
+		last_seen = GREATEST(metric_catalog_attributes.last_seen, EXCLUDED.last_seen)`, MaxSampleValues)
+
+type entryKey struct {
+	projectID string
+	name      string
+}
+
+type pendingEntry struct {
+	metricType  string
+	unit        string
+	description string
+	firstSeen   time.Time
+	lastSeen    time.Time
+	services    map[string]struct{}
+	attributes  map[string][]string // key -> sample values
+}
+
+// Catalog maintains the metric catalog from ingested metrics. Metrics are
+// summarized in memory and written every flush interval, so the catalog
+// lags ingest by up to the interval.
+type Catalog struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	pending map[entryKey]*pendingEntry
+}
+
+func NewCatalog(db *gorm.DB) *Catalog {
+	return &Catalog{
+		db:      db,
+		pending: make(map[entryKey]*pendingEntry),
+	}
+}
+
+// sampleValue formats an attribute value for the catalog
+func sampleValue(value any) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case nil:
+		s = "null"
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if len(s) > maxSampleValueLength {
+		s = s[:maxSampleValueLength]
+	}
+	return s
+}
+
+// Observe implements queue.MetricCatalog. It records the metrics to be
+// written on the next flush.
+func (c *Catalog) Observe(metrics []*tsmodels.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, metric := range metrics {
+		key := entryKey{projectID: metric.ProjectID, name: metric.Name}
+		entry, ok := c.pending[key]
+		if !ok {
+			entry = &pendingEntry{
+				firstSeen:  metric.Timestamp,
+				lastSeen:   metric.Timestamp,
+				services:   make(map[string]struct{}),
+				attributes: make(map[string][]string),
+			}
+			c.pending[key] = entry
+		}
+
+		entry.metricType = string(metric.Type)
+		if metric.Unit != "" {
+			entry.unit = metric.Unit
+		}
+		if metric.Description != "" {
+			entry.description = metric.Description
+		}
+		if metric.Timestamp.Before(entry.firstSeen) {
+			entry.firstSeen = metric.Timestamp
+		}
+		if metric.Timestamp.After(entry.lastSeen) {
+			entry.lastSeen = metric.Timestamp
+		}
+		entry.services[metric.ServiceName] = struct{}{}
+
+		var attributes map[string]any
+		if len(metric.Attributes) == 0 || json.Unmarshal(metric.Attributes, &attributes) != nil {
+			continue
+		}
+		for name, value := range attributes {
+			samples, ok := entry.attributes[name]
+			if !ok && len(entry.attributes) >= maxAttributeKeys {
+				continue
+			}
+			if len(samples) >= MaxSampleValues {
+				continue
+			}
+			sample := sampleValue(value)
+			if !contains(samples, sample) {
+				entry.attributes[name] = append(samples, sample)
+			}
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flush writes the pending entries to the catalog
+func (c *Catalog) flush(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[entryKey]*pendingEntry)
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for key, entry := range pending {
+			services := make(pq.StringArray, 0, len(entry.services))
+			for service := range entry.services {
+				services = append(services, service)
+			}
+			sort.Strings(services)
+
+			id, err := typeid.New[models.MetricCatalogEntryID]()
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec(upsertEntrySQL,
+				id.String(), now, now, key.projectID, key.name, entry.metricType,
+				entry.unit, entry.description, services, entry.firstSeen, entry.lastSeen,
+			).Error; err != nil {
+				return err
+			}
+
+			for name, samples := range entry.attributes {
+				id, err := typeid.New[models.MetricCatalogAttributeID]()
+				if err != nil {
+					return err
+				}
+				if err := tx.Exec(upsertAttributeSQL,
+					id.String(), now, now, key.projectID, key.name, name,
+					pq.StringArray(samples), entry.lastSeen,
+				).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Run implements queue.MetricCatalog. It writes the catalog every flush
+// interval and once more when ctx is done.
+func (c *Catalog) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := c.flush(flushCtx); err != nil {
+				log.Printf("Error writing metric catalog on shutdown: %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := c.flush(ctx); err != nil {
+				log.Printf("Error writing metric catalog: %v", err)
+			}
+		}
+	}
+}
@@ -34,6 +34,103 @@ type Config struct {
 		RedisQueueURL   string `toml:"redis_queue_url" env:"REDIS_QUEUE_URL"`
 		RedisSessionURL string `toml:"redis_session_url" env:"REDIS_SESSION_URL"`
 	} `toml:"storage"`
+	Session struct {
+		// Signed in sessions end after this long without requests
+		IdleTimeout string `toml:"idle_timeout" env:"SESSION_IDLE_TIMEOUT"`
+		// and this long after signing in regardless of activity
+		AbsoluteTimeout string `toml:"absolute_timeout" env:"SESSION_ABSOLUTE_TIMEOUT"`
+	} `toml:"session"`
+	Ingest struct {
+		// Maximum request body size in bytes of the ingest routes, applied
+		// to compressed bodies both before and after decoding. Other routes
+		// keep the default limit.
+		MaxBodySize int `toml:"max_body_size" env:"INGEST_MAX_BODY_SIZE"`
+		// Secret mixed into redaction hashes so hashed values cannot be
+		// recovered by hashing guesses
+		RedactionHashKey string `toml:"redaction_hash_key" env:"INGEST_REDACTION_HASH_KEY"`
+	} `toml:"ingest"`
+	Syslog struct {
+		Enabled     bool   `toml:"enabled" env:"SYSLOG_ENABLED"`
+		UDPAddr     string `toml:"udp_addr" env:"SYSLOG_UDP_ADDR"`
+		TCPAddr     string `toml:"tcp_addr" env:"SYSLOG_TCP_ADDR"`
+		TLSAddr     string `toml:"tls_addr" env:"SYSLOG_TLS_ADDR"`
+		TLSCertFile string `toml:"tls_cert_file" env:"SYSLOG_TLS_CERT_FILE"`
+		TLSKeyFile  string `toml:"tls_key_file" env:"SYSLOG_TLS_KEY_FILE"`
+		// Project used when neither a token nor a port mapping matches
+		DefaultProjectID string `toml:"default_project_id" env:"SYSLOG_DEFAULT_PROJECT_ID"`
+		// Local port -> project ID, e.g. "5514:proj_xxx,5515:proj_yyy"
+		PortProjects map[string]string `toml:"port_projects" env:"SYSLOG_PORT_PROJECTS"`
+		// Token (sent as a structured data "token" param) -> project ID
+		Tokens map[string]string `toml:"tokens" env:"SYSLOG_TOKENS"`
+		// Port mappings and the default project carry no credentials and UDP
+		// senders can be spoofed, so UDP messages without a token are
+		// dropped unless this is set. TCP and TLS are not affected.
+		AllowUnauthenticatedUDP bool `toml:"allow_unauthenticated_udp" env:"SYSLOG_ALLOW_UNAUTHENTICATED_UDP"`
+	} `toml:"syslog"`
+	Forward struct {
+		Enabled     bool   `toml:"enabled" env:"FORWARD_ENABLED"`
+		Addr        string `toml:"addr" env:"FORWARD_ADDR"`
+		TLSCertFile string `toml:"tls_cert_file" env:"FORWARD_TLS_CERT_FILE"`
+		TLSKeyFile  string `toml:"tls_key_file" env:"FORWARD_TLS_KEY_FILE"`
+		// Hostname sent to clients in the handshake PONG
+		SelfHostname string `toml:"self_hostname" env:"FORWARD_SELF_HOSTNAME"`
+		// Shared key -> project ID. When set, clients must complete the
+		// shared key handshake and logs go to the matching project.
+		SharedKeys map[string]string `toml:"shared_keys" env:"FORWARD_SHARED_KEYS"`
+		// Project used when no shared keys are configured
+		DefaultProjectID string `toml:"default_project_id" env:"FORWARD_DEFAULT_PROJECT_ID"`
+	} `toml:"forward"`
+	StatsD struct {
+		Enabled bool   `toml:"enabled" env:"STATSD_ENABLED"`
+		UDPAddr string `toml:"udp_addr" env:"STATSD_UDP_ADDR"`
+		TCPAddr string `toml:"tcp_addr" env:"STATSD_TCP_ADDR"`
+		// How often pre-aggregated metrics are written
+		FlushInterval string `toml:"flush_interval" env:"STATSD_FLUSH_INTERVAL"`
+		// Project every received metric is written to, bound through one of
+		// its API keys with the metrics:write scope
+		ProjectID string `toml:"project_id" env:"STATSD_PROJECT_ID"`
+		APIKey    string `toml:"api_key" env:"STATSD_API_KEY"`
+	} `toml:"statsd"`
+	OAuth struct {
+		// Social login providers, each enabled when its client ID is set.
+		// Register {api_base_url}/v1/auth/oauth/{google,github}/callback as
+		// the redirect URL.
+		Google struct {
+			ClientID     string `toml:"client_id" env:"OAUTH_GOOGLE_CLIENT_ID"`
+			ClientSecret string `toml:"client_secret" env:"OAUTH_GOOGLE_CLIENT_SECRET"`
+		} `toml:"google"`
+		GitHub struct {
+			ClientID     string `toml:"client_id" env:"OAUTH_GITHUB_CLIENT_ID"`
+			ClientSecret string `toml:"client_secret" env:"OAUTH_GITHUB_CLIENT_SECRET"`
+		} `toml:"github"`
+	} `toml:"oauth"`
+	Mail struct {
+		// Delivery backend, "log" prints emails to the console
+		Backend string `toml:"backend" env:"MAIL_BACKEND"`
+		From    string `toml:"from" env:"MAIL_FROM"`
+		SMTP    struct {
+			Host     string `toml:"host" env:"MAIL_SMTP_HOST"`
+			Port     int    `toml:"port" env:"MAIL_SMTP_PORT"`
+			Username string `toml:"username" env:"MAIL_SMTP_USERNAME"`
+			Password string `toml:"password" env:"MAIL_SMTP_PASSWORD"`
+		} `toml:"smtp"`
+	} `toml:"mail"`
+	Artifacts struct {
+		// Blob store for uploaded release artifacts such as source maps
+		Backend string `toml:"backend" env:"ARTIFACTS_BACKEND"`
+		// Directory used by the local backend
+		Dir string `toml:"dir" env:"ARTIFACTS_DIR"`
+		// Maximum size of a single artifact in bytes
+		MaxSize int `toml:"max_size" env:"ARTIFACTS_MAX_SIZE"`
+	} `toml:"artifacts"`
+	Sampling struct {
+		// How long spans of a trace are buffered before the tail sampling
+		// decision is made
+		DecisionWait string `toml:"decision_wait" env:"SAMPLING_DECISION_WAIT"`
+		// Maximum number of buffered spans, the oldest traces are decided
+		// early beyond it
+		MaxBufferedSpans int `toml:"max_buffered_spans" env:"SAMPLING_MAX_BUFFERED_SPANS"`
+	} `toml:"sampling"`
 }
 
 // GetAllowedOrigins returns the allowed origins as a slice
@@ -57,6 +154,18 @@ func (c *Config) GetAllowedOrigins() []string {
 	return []string{"http://localhost:3000"}
 }
 
+// SessionIdleTimeout returns the validated session idle timeout
+func (c *Config) SessionIdleTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Session.IdleTimeout)
+	return d
+}
+
+// SessionAbsoluteTimeout returns the validated session lifetime
+func (c *Config) SessionAbsoluteTimeout() time.Duration {
+	d, _ := time.ParseDuration(c.Session.AbsoluteTimeout)
+	return d
+}
+
 func validateDuration(value interface{}) error {
 	s, _ := value.(string)
 	_, err := time.ParseDuration(s)
@@ -101,6 +210,107 @@ func (c Config) Validate() error {
 		return fmt.Errorf("Storage config: %w", err)
 	}
 
+	// Validate Session fields
+	if err := validation.ValidateStruct(&c.Session,
+		validation.Field(&c.Session.IdleTimeout, validation.Required, validation.By(validateDuration)),
+		validation.Field(&c.Session.AbsoluteTimeout, validation.Required, validation.By(validateDuration)),
+	); err != nil {
+		return fmt.Errorf("Session config: %w", err)
+	}
+	if c.SessionIdleTimeout() > c.SessionAbsoluteTimeout() {
+		return fmt.Errorf("Session config: IdleTimeout: must not exceed absolute_timeout")
+	}
+
+	if err := validation.Validate(c.Ingest.MaxBodySize, validation.Min(1024)); err != nil {
+		return fmt.Errorf("Ingest config: MaxBodySize: %w", err)
+	}
+
+	// Validate Syslog fields
+	if c.Syslog.Enabled {
+		if c.Syslog.UDPAddr == "" && c.Syslog.TCPAddr == "" && c.Syslog.TLSAddr == "" {
+			return fmt.Errorf("Syslog config: at least one of udp_addr, tcp_addr or tls_addr is required")
+		}
+		if err := validation.ValidateStruct(&c.Syslog,
+			validation.Field(&c.Syslog.TLSCertFile, validation.When(c.Syslog.TLSAddr != "", validation.Required)),
+			validation.Field(&c.Syslog.TLSKeyFile, validation.When(c.Syslog.TLSAddr != "", validation.Required)),
+		); err != nil {
+			return fmt.Errorf("Syslog config: %w", err)
+		}
+	}
+
+	// Validate Forward fields
+	if c.Forward.Enabled {
+		if len(c.Forward.SharedKeys) == 0 && c.Forward.DefaultProjectID == "" {
+			return fmt.Errorf("Forward config: either shared_keys or default_project_id is required")
+		}
+		if err := validation.ValidateStruct(&c.Forward,
+			validation.Field(&c.Forward.Addr, validation.Required),
+			validation.Field(&c.Forward.TLSCertFile, validation.When(c.Forward.TLSKeyFile != "", validation.Required)),
+			validation.Field(&c.Forward.TLSKeyFile, validation.When(c.Forward.TLSCertFile != "", validation.Required)),
+		); err != nil {
+			return fmt.Errorf("Forward config: %w", err)
+		}
+	}
+
+	// Validate StatsD fields
+	if c.StatsD.Enabled {
+		if c.StatsD.UDPAddr == "" && c.StatsD.TCPAddr == "" {
+			return fmt.Errorf("StatsD config: at least one of udp_addr or tcp_addr is required")
+		}
+		if err := validation.ValidateStruct(&c.StatsD,
+			validation.Field(&c.StatsD.FlushInterval, validation.Required, validation.By(validateDuration)),
+			validation.Field(&c.StatsD.ProjectID, validation.Required),
+			validation.Field(&c.StatsD.APIKey, validation.Required),
+		); err != nil {
+			return fmt.Errorf("StatsD config: %w", err)
+		}
+	}
+
+	// Validate OAuth fields
+	if err := validation.ValidateStruct(&c.OAuth.Google,
+		validation.Field(&c.OAuth.Google.ClientSecret, validation.When(c.OAuth.Google.ClientID != "", validation.Required)),
+	); err != nil {
+		return fmt.Errorf("OAuth config: Google: %w", err)
+	}
+	if err := validation.ValidateStruct(&c.OAuth.GitHub,
+		validation.Field(&c.OAuth.GitHub.ClientSecret, validation.When(c.OAuth.GitHub.ClientID != "", validation.Required)),
+	); err != nil {
+		return fmt.Errorf("OAuth config: GitHub: %w", err)
+	}
+
+	// Validate Mail fields
+	if err := validation.ValidateStruct(&c.Mail,
+		validation.Field(&c.Mail.Backend, validation.In("log", "smtp")),
+		validation.Field(&c.Mail.From, validation.Required),
+	); err != nil {
+		return fmt.Errorf("Mail config: %w", err)
+	}
+	if c.Mail.Backend == "smtp" {
+		if err := validation.ValidateStruct(&c.Mail.SMTP,
+			validation.Field(&c.Mail.SMTP.Host, validation.Required),
+			validation.Field(&c.Mail.SMTP.Port, validation.Required, validation.Min(1), validation.Max(65535)),
+		); err != nil {
+			return fmt.Errorf("Mail config: SMTP: %w", err)
+		}
+	}
+
+	// Validate Artifacts fields
+	if err := validation.ValidateStruct(&c.Artifacts,
+		validation.Field(&c.Artifacts.Backend, validation.In("local")),
+		validation.Field(&c.Artifacts.Dir, validation.When(c.Artifacts.Backend == "local", validation.Required)),
+		validation.Field(&c.Artifacts.MaxSize, validation.Min(1024)),
+	); err != nil {
+		return fmt.Errorf("Artifacts config: %w", err)
+	}
+
+	// Validate Sampling fields
+	if err := validation.ValidateStruct(&c.Sampling,
+		validation.Field(&c.Sampling.DecisionWait, validation.Required, validation.By(validateDuration)),
+		validation.Field(&c.Sampling.MaxBufferedSpans, validation.Min(1)),
+	); err != nil {
+		return fmt.Errorf("Sampling config: %w", err)
+	}
+
 	return nil
 }
 
@@ -108,6 +318,45 @@ func (c *Config) SetDefaultValues() {
 	if c.ShutdownTimeout == "" {
 		c.ShutdownTimeout = "5s"
 	}
+	if c.Session.IdleTimeout == "" {
+		c.Session.IdleTimeout = "30m"
+	}
+	if c.Session.AbsoluteTimeout == "" {
+		c.Session.AbsoluteTimeout = "24h"
+	}
+	if c.Ingest.MaxBodySize == 0 {
+		c.Ingest.MaxBodySize = 32 * 1024 * 1024
+	}
+	if c.Forward.SelfHostname == "" {
+		c.Forward.SelfHostname = "logsicle"
+	}
+	if c.StatsD.FlushInterval == "" {
+		c.StatsD.FlushInterval = "10s"
+	}
+	if c.Mail.Backend == "" {
+		c.Mail.Backend = "log"
+	}
+	if c.Mail.From == "" {
+		c.Mail.From = "Logsicle <no-reply@localhost>"
+	}
+	if c.Mail.SMTP.Port == 0 {
+		c.Mail.SMTP.Port = 587
+	}
+	if c.Artifacts.Backend == "" {
+		c.Artifacts.Backend = "local"
+	}
+	if c.Artifacts.Dir == "" {
+		c.Artifacts.Dir = "data/artifacts"
+	}
+	if c.Artifacts.MaxSize == 0 {
+		c.Artifacts.MaxSize = 16 * 1024 * 1024
+	}
+	if c.Sampling.DecisionWait == "" {
+		c.Sampling.DecisionWait = "10s"
+	}
+	if c.Sampling.MaxBufferedSpans == 0 {
+		c.Sampling.MaxBufferedSpans = 100000
+	}
 }
 
 func LoadConfig(path string) (*Config, error) {
@@ -0,0 +1,388 @@
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Decoder for the Fluentd Forward protocol v1. Each message is one of:
+//
+//	Message:        [tag, time, record, option?]
+//	Forward:        [tag, [[time, record], ...], option?]
+//	PackedForward:  [tag, bin(msgpack stream of [time, record]), option?]
+//
+// PackedForward entries may be gzip compressed (option "compressed": "gzip").
+// Time is either an integer of unix seconds or the EventTime extension.
+
+const (
+	// Maximum size of a single string, binary or extension value, which
+	// bounds PackedForward payloads
+	maxValueSize = 64 * 1024 * 1024
+	// Maximum size of a decompressed PackedForward payload
+	maxDecompressedSize = 32 * 1024 * 1024
+	// Maximum number of elements in an array or map
+	maxElements = 1 << 20
+	// Maximum nesting of record values
+	maxDepth = 32
+	// Extension type of EventTime
+	eventTimeExtension = 0
+)
+
+// Entry is a single record of a Forward message
+type Entry struct {
+	Time   time.Time
+	Record map[string]any
+}
+
+// Message is a decoded Forward message in any mode
+type Message struct {
+	Tag     string
+	Entries []Entry
+	Option  map[string]any
+}
+
+// Chunk returns the chunk ID the client expects to be acknowledged
+func (m *Message) Chunk() string {
+	chunk, _ := m.Option["chunk"].(string)
+	return chunk
+}
+
+// checkSize rejects 32 bit length values before msgp allocates them
+func checkSize(r *msgp.Reader) error {
+	lead, err := r.R.PeekByte()
+	if err != nil {
+		return err
+	}
+	switch lead {
+	case 0xc6, 0xdb, 0xc9: // bin32, str32, ext32
+		p, err := r.R.Peek(5)
+		if err != nil {
+			return err
+		}
+		if size := binary.BigEndian.Uint32(p[1:]); size > maxValueSize {
+			return fmt.Errorf("value of %d bytes exceeds %d", size, maxValueSize)
+		}
+	}
+	return nil
+}
+
+// readString reads a str or bin value as a string
+func readString(r *msgp.Reader) (string, error) {
+	if err := checkSize(r); err != nil {
+		return "", err
+	}
+	t, err := r.NextType()
+	if err != nil {
+		return "", err
+	}
+	switch t {
+	case msgp.StrType:
+		return r.ReadString()
+	case msgp.BinType:
+		b, err := r.ReadBytes(nil)
+		return string(b), err
+	default:
+		return "", fmt.Errorf("expected string, got %s", t)
+	}
+}
+
+// eventTime decodes the EventTime extension payload, big endian seconds
+// followed by nanoseconds
+func eventTime(data []byte) time.Time {
+	sec := binary.BigEndian.Uint32(data[:4])
+	nsec := binary.BigEndian.Uint32(data[4:])
+	return time.Unix(int64(sec), int64(nsec))
+}
+
+// readTime reads an integer, float or EventTime timestamp
+func readTime(r *msgp.Reader) (time.Time, error) {
+	if err := checkSize(r); err != nil {
+		return time.Time{}, err
+	}
+	t, err := r.NextType()
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch t {
+	case msgp.IntType:
+		sec, err := r.ReadInt64()
+		return time.Unix(sec, 0), err
+	case msgp.UintType:
+		sec, err := r.ReadUint64()
+		return time.Unix(int64(sec), 0), err
+	case msgp.Float32Type, msgp.Float64Type:
+		f, err := r.ReadFloat64()
+		return time.Unix(0, int64(f*float64(time.Second))), err
+	case msgp.ExtensionType:
+		extType, data, err := r.ReadExtensionRaw()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if extType != eventTimeExtension || len(data) != 8 {
+			return time.Time{}, fmt.Errorf("unsupported time extension %d", extType)
+		}
+		return eventTime(data), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected time, got %s", t)
+	}
+}
+
+// readValue decodes an arbitrary value, converting binary data to strings
+// and bounding the size of arrays and maps
+func readValue(r *msgp.Reader, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("value nested deeper than %d", maxDepth)
+	}
+	if err := checkSize(r); err != nil {
+		return nil, err
+	}
+
+	t, err := r.NextType()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case msgp.BinType, msgp.StrType:
+		return readString(r)
+	case msgp.ExtensionType:
+		// EventTime may appear inside records, other extensions are opaque
+		extType, data, err := r.ReadExtensionRaw()
+		if err != nil {
+			return nil, err
+		}
+		if extType == eventTimeExtension && len(data) == 8 {
+			return eventTime(data).Format(time.RFC3339Nano), nil
+		}
+		// data is only valid until the next read
+		return append([]byte(nil), data...), nil
+	case msgp.ArrayType:
+		size, err := r.ReadArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		if size > maxElements {
+			return nil, fmt.Errorf("array of %d elements exceeds %d", size, maxElements)
+		}
+		values := make([]any, 0, min(size, 1024))
+		for i := uint32(0); i < size; i++ {
+			value, err := readValue(r, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case msgp.MapType:
+		return readMap(r, depth)
+	default:
+		return r.ReadIntf()
+	}
+}
+
+func readMap(r *msgp.Reader, depth int) (map[string]any, error) {
+	size, err := r.ReadMapHeader()
+	if err != nil {
+		return nil, err
+	}
+	if size > maxElements {
+		return nil, fmt.Errorf("map of %d entries exceeds %d", size, maxElements)
+	}
+
+	values := make(map[string]any, min(size, 1024))
+	for i := uint32(0); i < size; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// readEntry reads a [time, record] pair
+func readEntry(r *msgp.Reader) (Entry, error) {
+	size, err := r.ReadArrayHeader()
+	if err != nil {
+		return Entry{}, err
+	}
+	if size != 2 {
+		return Entry{}, fmt.Errorf("entry must have 2 elements, got %d", size)
+	}
+
+	ts, err := readTime(r)
+	if err != nil {
+		return Entry{}, err
+	}
+	record, err := readMap(r, 0)
+	if err != nil {
+		return Entry{}, err
+	}
+	return Entry{Time: ts, Record: record}, nil
+}
+
+// decodePackedEntries reads the msgpack stream of a PackedForward message
+func decodePackedEntries(payload []byte, compressed bool) ([]Entry, error) {
+	var src io.Reader = bytes.NewReader(payload)
+	if compressed {
+		// Fluent Bit concatenates gzip members, which gzip.Reader handles
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip payload: %w", err)
+		}
+		defer gz.Close()
+
+		// Entries are decoded straight from the gzip stream rather than a
+		// decompressed copy of the payload
+		src = &sizeLimitedReader{r: gz, remaining: maxDecompressedSize}
+	}
+
+	r := msgp.NewReaderSize(src, 64*1024)
+	var entries []Entry
+	for {
+		if _, err := r.R.PeekByte(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return entries, nil
+			}
+			return nil, err
+		}
+		if len(entries) >= maxElements {
+			return nil, fmt.Errorf("packed forward message exceeds %d entries", maxElements)
+		}
+		entry, err := readEntry(r)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// sizeLimitedReader fails once more than remaining bytes are read, unlike
+// io.LimitReader which silently truncates
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Reading exactly up to the limit is fine, anything beyond is not
+		var probe [1]byte
+		if n, err := l.r.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, fmt.Errorf("decompressed payload exceeds %d bytes", maxDecompressedSize)
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// ReadMessage reads the next Forward message in any mode
+func ReadMessage(r *msgp.Reader) (*Message, error) {
+	size, err := r.ReadArrayHeader()
+	if err != nil {
+		return nil, err
+	}
+	if size < 2 || size > 4 {
+		return nil, fmt.Errorf("message must have 2 to 4 elements, got %d", size)
+	}
+
+	tag, err := readString(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag: %w", err)
+	}
+	msg := &Message{Tag: tag}
+
+	t, err := r.NextType()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		payload []byte
+		rest    = size - 2
+	)
+	switch t {
+	case msgp.ArrayType:
+		// Forward mode
+		count, err := r.ReadArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		if count > maxElements {
+			return nil, fmt.Errorf("forward message of %d entries exceeds %d", count, maxElements)
+		}
+		msg.Entries = make([]Entry, 0, min(count, 1024))
+		for i := uint32(0); i < count; i++ {
+			entry, err := readEntry(r)
+			if err != nil {
+				return nil, err
+			}
+			msg.Entries = append(msg.Entries, entry)
+		}
+	case msgp.BinType, msgp.StrType:
+		// PackedForward mode, entries are decoded once the option is known
+		if err := checkSize(r); err != nil {
+			return nil, err
+		}
+		if t == msgp.BinType {
+			payload, err = r.ReadBytes(nil)
+		} else {
+			payload, err = r.ReadStringAsBytes(nil)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// Message mode
+		if size < 3 {
+			return nil, fmt.Errorf("message mode requires a record")
+		}
+		ts, err := readTime(r)
+		if err != nil {
+			return nil, err
+		}
+		record, err := readMap(r, 0)
+		if err != nil {
+			return nil, err
+		}
+		msg.Entries = []Entry{{Time: ts, Record: record}}
+		rest--
+	}
+
+	if rest > 1 {
+		return nil, fmt.Errorf("unexpected trailing elements")
+	}
+	if rest == 1 {
+		if t, err := r.NextType(); err == nil && t == msgp.NilType {
+			if err := r.ReadNil(); err != nil {
+				return nil, err
+			}
+		} else if msg.Option, err = readMap(r, 0); err != nil {
+			return nil, fmt.Errorf("invalid option: %w", err)
+		}
+	}
+
+	if payload != nil {
+		compressed := msg.Option["compressed"] == "gzip"
+		if msg.Entries, err = decodePackedEntries(payload, compressed); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
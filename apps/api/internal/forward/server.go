@@ -0,0 +1,380 @@
+package forward
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"github.com/tinylib/msgp/msgp"
+)
+
+const (
+	// Size of the per-connection read buffer
+	readBufferSize = 64 * 1024
+	// How long a client has to complete the handshake
+	handshakeTimeout = 30 * time.Second
+	// How long an idle connection is kept open
+	idleTimeout = 5 * time.Minute
+	// Longest message accepted by AppLogInput validation
+	maxAppLogMessageLength = 10000
+	// Longest service name accepted by AppLogInput validation
+	maxServiceNameLength = 255
+	// Service name used when the message has an empty tag
+	defaultServiceName = "fluent"
+)
+
+// Record keys checked, in order, for each AppLog field
+var (
+	messageKeys     = []string{"log", "message", "msg"}
+	levelKeys       = []string{"level", "severity", "log_level", "lvl"}
+	hostKeys        = []string{"host", "hostname"}
+	environmentKeys = []string{"environment", "env"}
+)
+
+type Server struct {
+	cfg      *config.Config
+	qs       *queue.QueueService
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+	conns  map[net.Conn]struct{}
+}
+
+func NewServer(cfg *config.Config, qs *queue.QueueService) *Server {
+	return &Server{
+		cfg:   cfg,
+		qs:    qs,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Start binds the forward listener and serves it until ctx is done
+func (s *Server) Start(ctx context.Context) error {
+	fc := s.cfg.Forward
+
+	var (
+		ln  net.Listener
+		err error
+	)
+	if fc.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(fc.TLSCertFile, fc.TLSKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load forward TLS certificate: %w", err)
+		}
+		ln, err = tls.Listen("tcp", fc.Addr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", fc.Addr, err)
+		}
+	} else {
+		ln, err = net.Listen("tcp", fc.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", fc.Addr, err)
+		}
+	}
+
+	s.listener = ln
+	s.wg.Add(1)
+	go s.serve(ctx)
+	log.Printf("Forward listening on %s", fc.Addr)
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	return nil
+}
+
+// Close stops the listener, closes open connections and waits for them to
+// exit
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// track registers an accepted connection so Close can close it, reporting
+// false when the server is already closing
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+}
+
+func (s *Server) serve(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error accepting forward connection: %v", err)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.handleConn(ctx, conn)
+	}
+}
+
+func (s *Server) handleConn(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	r := msgp.NewReaderSize(conn, readBufferSize)
+	w := msgp.NewWriter(conn)
+
+	projectID := s.cfg.Forward.DefaultProjectID
+	if len(s.cfg.Forward.SharedKeys) > 0 {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+		var err error
+		projectID, err = s.handshake(r, w)
+		if err != nil {
+			log.Printf("Forward handshake with %s failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		conn.SetDeadline(time.Time{})
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		msg, err := ReadMessage(r)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading forward message from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if err := s.handleMessage(ctx, projectID, msg); err != nil {
+			// Closing without an ack makes the client retry the chunk
+			log.Printf("Error enqueuing forward message: %v", err)
+			return
+		}
+
+		if chunk := msg.Chunk(); chunk != "" {
+			conn.SetWriteDeadline(time.Now().Add(idleTimeout))
+			if err := writeAck(w, chunk); err != nil {
+				log.Printf("Error sending forward ack to %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		}
+	}
+}
+
+func writeAck(w *msgp.Writer, chunk string) error {
+	if err := w.WriteMapHeader(1); err != nil {
+		return err
+	}
+	if err := w.WriteString("ack"); err != nil {
+		return err
+	}
+	if err := w.WriteString(chunk); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func sharedKeyDigest(salt, hostname string, nonce []byte, key string) string {
+	sum := sha512.Sum512([]byte(salt + hostname + string(nonce) + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// handshake runs the shared key authentication (HELO, PING, PONG) and returns
+// the project of the matching key
+func (s *Server) handshake(r *msgp.Reader, w *msgp.Writer) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	// ["HELO", {nonce, auth, keepalive}], an empty auth salt means no
+	// username/password authentication
+	w.WriteArrayHeader(2)
+	w.WriteString("HELO")
+	w.WriteMapHeader(3)
+	w.WriteString("nonce")
+	w.WriteBytes(nonce)
+	w.WriteString("auth")
+	w.WriteString("")
+	w.WriteString("keepalive")
+	w.WriteBool(true)
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+
+	// ["PING", client_hostname, shared_key_salt, digest, username, password]
+	size, err := r.ReadArrayHeader()
+	if err != nil {
+		return "", err
+	}
+	if size != 6 {
+		return "", fmt.Errorf("PING must have 6 elements, got %d", size)
+	}
+	ping := make([]string, size)
+	for i := range ping {
+		if ping[i], err = readString(r); err != nil {
+			return "", err
+		}
+	}
+	if ping[0] != "PING" {
+		return "", fmt.Errorf("expected PING, got %q", ping[0])
+	}
+	clientHostname, salt, digest := ping[1], ping[2], ping[3]
+
+	for key, projectID := range s.cfg.Forward.SharedKeys {
+		expected := sharedKeyDigest(salt, clientHostname, nonce, key)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(digest)) != 1 {
+			continue
+		}
+
+		selfHostname := s.cfg.Forward.SelfHostname
+		w.WriteArrayHeader(5)
+		w.WriteString("PONG")
+		w.WriteBool(true)
+		w.WriteString("")
+		w.WriteString(selfHostname)
+		w.WriteString(sharedKeyDigest(salt, selfHostname, nonce, key))
+		return projectID, w.Flush()
+	}
+
+	w.WriteArrayHeader(5)
+	w.WriteString("PONG")
+	w.WriteBool(false)
+	w.WriteString("shared_key mismatch")
+	w.WriteString("")
+	w.WriteString("")
+	w.Flush()
+	return "", fmt.Errorf("shared key mismatch from %q", clientHostname)
+}
+
+// handleMessage enqueues every entry of a message. Entries that fail
+// validation are dropped. The rest are queued in one transaction, so a
+// queue error stores nothing and the client's resend does not duplicate.
+func (s *Server) handleMessage(ctx context.Context, projectID string, msg *Message) error {
+	logs := make([]*models.AppLog, 0, len(msg.Entries))
+	for _, entry := range msg.Entries {
+		appLog, err := toAppLogInput(projectID, msg.Tag, entry).ValidateAndCreate()
+		if err != nil {
+			log.Printf("Error validating forward record: %v", err)
+			continue
+		}
+		logs = append(logs, appLog)
+	}
+
+	return s.qs.EnqueueAppLogs(ctx, logs)
+}
+
+// firstKey returns the first non-empty value of the given keys, removing it
+// from the record so it is not duplicated into Fields
+func firstKey(record map[string]any, keys []string) string {
+	for _, key := range keys {
+		value, ok := record[key]
+		if !ok || value == nil {
+			continue
+		}
+		str := fmt.Sprint(value)
+		if str == "" {
+			continue
+		}
+		delete(record, key)
+		return str
+	}
+	return ""
+}
+
+func toAppLogInput(projectID, tag string, entry Entry) models.AppLogInput {
+	record := entry.Record
+
+	message := strings.TrimRight(firstKey(record, messageKeys), "\r\n")
+	if message == "" {
+		// Structured records without a message key are kept whole
+		b, _ := json.Marshal(record)
+		message = string(b)
+	}
+	if runes := []rune(message); len(runes) > maxAppLogMessageLength {
+		message = string(runes[:maxAppLogMessageLength])
+	}
+
+	level := models.DetectLogLevel(message)
+	if value := firstKey(record, levelKeys); value != "" {
+		if normalized, ok := models.NormalizeLogLevel(value); ok {
+			level = normalized
+		}
+	}
+
+	serviceName := tag
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	if runes := []rune(serviceName); len(runes) > maxServiceNameLength {
+		serviceName = string(runes[:maxServiceNameLength])
+	}
+
+	var fields map[string]any
+	host := firstKey(record, hostKeys)
+	environment := firstKey(record, environmentKeys)
+	if len(record) > 0 {
+		fields = record
+	}
+
+	return models.AppLogInput{
+		ProjectID:   projectID,
+		Level:       string(level),
+		Message:     message,
+		Fields:      fields,
+		ServiceName: serviceName,
+		Environment: environment,
+		Host:        host,
+		Timestamp:   entry.Time.Format(time.RFC3339Nano),
+	}
+}
@@ -20,6 +20,8 @@ type Filter struct {
 	Caller      *string  `json:"caller,omitempty" query:"caller"`
 	Function    *string  `json:"function,omitempty" query:"function"`
 	Version     *string  `json:"version,omitempty" query:"version"`
+	IssueID     *string  `json:"issue_id,omitempty" query:"issueId"`
+	TraceID     *string  `json:"trace_id,omitempty" query:"traceId"`
 }
 
 // ProcessLevels splits comma-separated levels and returns the processed slice
@@ -156,6 +158,16 @@ func (h *AppLogsHandler) GetAppLogs(c fiber.Ctx) error {
 		baseParams = append(baseParams, *query.Version)
 		paramCount++
 	}
+	if query.IssueID != nil {
+		whereClause += fmt.Sprintf(" AND al.issue_id = $%d", paramCount)
+		baseParams = append(baseParams, *query.IssueID)
+		paramCount++
+	}
+	if query.TraceID != nil {
+		whereClause += fmt.Sprintf(" AND al.trace_id = $%d", paramCount)
+		baseParams = append(baseParams, strings.ToLower(*query.TraceID))
+		paramCount++
+	}
 	if query.Search != nil {
 		whereClause += fmt.Sprintf(`
 			AND (
@@ -200,7 +212,8 @@ func (h *AppLogsHandler) GetAppLogs(c fiber.Ctx) error {
 		SELECT 
 			al.id, al.project_id, al.level, al.message,
 			al.fields, al.timestamp, al.caller, al.function,
-			al.service_name, al.version, al.environment, al.host
+			al.service_name, al.version, al.environment, al.host,
+			al.exception, al.issue_id, al.trace_id, al.span_id
 	` + baseQuery + whereClause + `
 		ORDER BY al.timestamp DESC
 		LIMIT $` + fmt.Sprint(paramCount) + ` OFFSET $` + fmt.Sprint(paramCount+1)
@@ -224,6 +237,7 @@ func (h *AppLogsHandler) GetAppLogs(c fiber.Ctx) error {
 			&log.ID, &log.ProjectID, &log.Level, &log.Message,
 			&log.Fields, &log.Timestamp, &log.Caller, &log.Function,
 			&log.ServiceName, &log.Version, &log.Environment, &log.Host,
+			&log.Exception, &log.IssueID, &log.TraceID, &log.SpanID,
 		)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
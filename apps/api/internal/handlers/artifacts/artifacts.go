@@ -0,0 +1,208 @@
+package artifacts
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/url"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/sourcemap"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// releaseParam decodes the release path parameter, releases such as
+// "app@1.2.0+build" are usually escaped by clients
+func releaseParam(c fiber.Ctx) (string, error) {
+	release, err := url.PathUnescape(c.Params("release"))
+	if err != nil {
+		return "", err
+	}
+	return release, validation.Validate(release, validation.Required, validation.Length(1, 255))
+}
+
+func (h *ArtifactsHandler) ListArtifacts(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	release, err := releaseParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid release",
+			"error":   err.Error(),
+		})
+	}
+
+	artifacts := make([]models.ReleaseArtifact, 0)
+	if err := h.db.Where("project_id = ? AND release = ?", projectID, release).
+		Order("name ASC").
+		Find(&artifacts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch artifacts",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(artifacts)
+}
+
+// UploadArtifact stores a source map for a release from a multipart form
+// with a "file" and the "name" of the minified file it maps, e.g.
+// "~/static/js/main.js". Uploading an existing name replaces it.
+func (h *ArtifactsHandler) UploadArtifact(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	release, err := releaseParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid release",
+			"error":   err.Error(),
+		})
+	}
+
+	name := c.FormValue("name")
+	if err := validation.Validate(name, validation.Required, validation.Length(1, 1024)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   "name: " + err.Error(),
+		})
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Missing artifact file",
+			"error":   err.Error(),
+		})
+	}
+	if header.Size > h.maxSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"message": "Artifact is too large",
+		})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to read artifact file",
+			"error":   err.Error(),
+		})
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.maxSize))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Failed to read artifact file",
+			"error":   err.Error(),
+		})
+	}
+
+	// Reject files that could never be used for symbolication
+	if _, err := sourcemap.Parse(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid source map",
+			"error":   err.Error(),
+		})
+	}
+
+	sum := sha256.Sum256(data)
+	id, err := typeid.New[models.ReleaseArtifactID]()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create artifact",
+			"error":   err.Error(),
+		})
+	}
+	artifact := &models.ReleaseArtifact{
+		ProjectID:  projectID,
+		Release:    release,
+		Name:       name,
+		Size:       int64(len(data)),
+		Checksum:   hex.EncodeToString(sum[:]),
+		StorageKey: "artifacts/" + projectID + "/" + id.String(),
+	}
+	artifact.ID = id.String()
+
+	if err := h.store.Put(c.Context(), artifact.StorageKey, bytes.NewReader(data)); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to store artifact",
+			"error":   err.Error(),
+		})
+	}
+
+	var replaced models.ReleaseArtifact
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ? AND release = ? AND name = ?", projectID, release, name).
+			First(&replaced).Error; err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if replaced.ID != "" {
+			if err := tx.Unscoped().Delete(&replaced).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(artifact).Error
+	})
+	if err != nil {
+		if deleteErr := h.store.Delete(c.Context(), artifact.StorageKey); deleteErr != nil {
+			log.Printf("Failed to delete orphaned artifact %s: %v", artifact.StorageKey, deleteErr)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save artifact",
+			"error":   err.Error(),
+		})
+	}
+
+	if replaced.ID != "" {
+		if err := h.store.Delete(c.Context(), replaced.StorageKey); err != nil {
+			log.Printf("Failed to delete replaced artifact %s: %v", replaced.StorageKey, err)
+		}
+	}
+
+	h.symbolicator.Invalidate(projectID)
+
+	return c.Status(fiber.StatusCreated).JSON(artifact)
+}
+
+func (h *ArtifactsHandler) DeleteArtifact(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	artifactID := c.Params("artifactId")
+	release, err := releaseParam(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid release",
+			"error":   err.Error(),
+		})
+	}
+
+	var artifact models.ReleaseArtifact
+	if err := h.db.Where("id = ? AND project_id = ? AND release = ?", artifactID, projectID, release).First(&artifact).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Artifact not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch artifact",
+			"error":   err.Error(),
+		})
+	}
+
+	// Hard delete so the name can be uploaded again
+	if err := h.db.Unscoped().Delete(&artifact).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete artifact",
+			"error":   err.Error(),
+		})
+	}
+	if err := h.store.Delete(c.Context(), artifact.StorageKey); err != nil {
+		log.Printf("Failed to delete artifact %s: %v", artifact.StorageKey, err)
+	}
+
+	h.symbolicator.Invalidate(projectID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
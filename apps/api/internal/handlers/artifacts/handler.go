@@ -0,0 +1,23 @@
+package artifacts
+
+import (
+	"github.com/ted-too/logsicle/internal/blobstore"
+	"github.com/ted-too/logsicle/internal/sourcemap"
+	"gorm.io/gorm"
+)
+
+type ArtifactsHandler struct {
+	db           *gorm.DB
+	store        blobstore.Store
+	symbolicator *sourcemap.Symbolicator
+	maxSize      int64
+}
+
+func NewArtifactsHandler(db *gorm.DB, store blobstore.Store, symbolicator *sourcemap.Symbolicator, maxSize int) *ArtifactsHandler {
+	return &ArtifactsHandler{
+		db:           db,
+		store:        store,
+		symbolicator: symbolicator,
+		maxSize:      int64(maxSize),
+	}
+}
@@ -76,3 +76,50 @@ func (h *AuthHandler) UpdateUser(c fiber.Ctx) error {
 
 	return c.JSON(user)
 }
+
+// ListAccounts lists the sign in methods linked to the current user
+func (h *AuthHandler) ListAccounts(c fiber.Ctx) error {
+	session := c.Locals("session").(storage.Session)
+
+	var accounts []models.Account
+	if err := h.db.Where("user_id = ?", session.UserID).Order("created_at").Find(&accounts).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch accounts",
+		})
+	}
+
+	return c.JSON(accounts)
+}
+
+// UnlinkAccount removes a sign in method of the current user, keeping at
+// least one
+func (h *AuthHandler) UnlinkAccount(c fiber.Ctx) error {
+	session := c.Locals("session").(storage.Session)
+
+	var count int64
+	if err := h.db.Model(&models.Account{}).Where("user_id = ?", session.UserID).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch accounts",
+		})
+	}
+	if count <= 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Cannot unlink account",
+			"message": "At least one sign in method is required",
+		})
+	}
+
+	result := h.db.Unscoped().Where("id = ? AND user_id = ?", c.Params("accountId"), session.UserID).Delete(&models.Account{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlink account",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Account not found",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
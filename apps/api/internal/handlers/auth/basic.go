@@ -107,7 +107,7 @@ func (h *AuthHandler) Register(c fiber.Ctx) error {
 		}
 
 		account := models.Account{
-			ProviderID: "password",
+			ProviderID: models.ProviderPassword,
 			Password:   hashedPassword,
 		}
 
@@ -154,19 +154,21 @@ func (h *AuthHandler) Register(c fiber.Ctx) error {
 		})
 	}
 
-	sess := session.FromContext(c)
+	// Registration succeeds even when the email cannot be sent, users can
+	// ask for another one
+	if err := h.sendEmailVerification(c.Context(), &user); err != nil {
+		log.Printf("Failed to send email verification to user %s: %v", user.ID, err)
+	}
 
 	// Create session for the newly registered user
-	userSession := &storage.Session{
-		UserID:             user.ID,
-		IPAddress:          c.IP(),
-		UserAgent:          c.Get("User-Agent"),
-		ExpiresAt:          time.Now().Add(24 * time.Hour),
-		ActiveOrganization: user.Organizations[0].ID,
+	userSession, err := h.startSession(c, user.ID, user.Organizations[0].ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to create session",
+			"message": err.Error(),
+		})
 	}
 
-	sess.Set(storage.SessionDataKey, userSession)
-
 	return c.Status(fiber.StatusCreated).JSON(UserSession{
 		User:    user,
 		Session: *userSession,
@@ -203,7 +205,7 @@ func (h *AuthHandler) Login(c fiber.Ctx) error {
 
 	// Find password account
 	var account models.Account
-	if err := h.db.Where("user_id = ? AND provider_id = ?", user.ID, "password").First(&account).Error; err != nil {
+	if err := h.db.Where("user_id = ? AND provider_id = ?", user.ID, models.ProviderPassword).First(&account).Error; err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":   "Invalid credentials",
 			"message": "Email or password is incorrect",
@@ -219,18 +221,35 @@ func (h *AuthHandler) Login(c fiber.Ctx) error {
 		})
 	}
 
-	sess := session.FromContext(c)
+	// Users with two-factor authentication finish signing in with a code
+	if user.TwoFactorEnabled {
+		session.FromContext(c).Set(storage.TwoFactorDataKey, storage.PendingTwoFactor{
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(twoFactorLoginTTL),
+		})
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+		})
+	}
 
-	// Create session
-	userSession := &storage.Session{
-		UserID:             user.ID,
-		IPAddress:          c.IP(),
-		UserAgent:          c.Get("User-Agent"),
-		ExpiresAt:          time.Now().Add(24 * time.Hour),
-		ActiveOrganization: user.Organizations[0].ID,
+	return h.finishLogin(c, &user, "")
+}
+
+// finishLogin creates the session of a signed in user, in the given
+// organization or the first one the user belongs to
+func (h *AuthHandler) finishLogin(c fiber.Ctx, user *models.User, activeOrganization string) error {
+	if activeOrganization == "" {
+		activeOrganization = user.Organizations[0].ID
 	}
 
-	sess.Set(storage.SessionDataKey, userSession)
+	// Create session
+	userSession, err := h.startSession(c, user.ID, activeOrganization)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to create session",
+			"message": err.Error(),
+		})
+	}
 
 	if err := h.db.Model(&models.User{}).Where("id = ?", user.ID).Update("last_login_at", time.Now()).Error; err != nil {
 		// Non-critical error, just log it
@@ -253,7 +272,7 @@ func (h *AuthHandler) Login(c fiber.Ctx) error {
 	user.Organizations = organizations
 
 	return c.JSON(UserSession{
-		User:    user,
+		User:    *user,
 		Session: *userSession,
 	})
 }
@@ -261,7 +280,18 @@ func (h *AuthHandler) Login(c fiber.Ctx) error {
 // Logout handles user logout
 func (h *AuthHandler) Logout(c fiber.Ctx) error {
 	sess := session.FromContext(c)
-	sess.Delete(storage.SessionDataKey)
+	if err := h.db.Unscoped().Where("token_hash = ?", models.HashToken(sess.ID())).Delete(&models.Session{}).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to sign out",
+			"message": err.Error(),
+		})
+	}
+	if err := sess.Destroy(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to sign out",
+			"message": err.Error(),
+		})
+	}
 	return c.SendStatus(fiber.StatusOK)
 }
 
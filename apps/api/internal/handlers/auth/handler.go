@@ -1,15 +1,32 @@
 package auth
 
 import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/mailer"
+	"github.com/ted-too/logsicle/internal/oauth"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db         *gorm.DB
+	providers  *oauth.Registry
+	mailer     mailer.Mailer
+	webBaseURL string
+	sessionTTL time.Duration
+	lookupTXT  func(ctx context.Context, name string) ([]string, error) // resolves domain verification records
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, providers *oauth.Registry, mailer mailer.Mailer, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		db: db,
+		db:         db,
+		providers:  providers,
+		mailer:     mailer,
+		webBaseURL: cfg.WebBaseURL,
+		sessionTTL: cfg.SessionAbsoluteTimeout(),
+		lookupTXT:  net.DefaultResolver.LookupTXT,
 	}
 }
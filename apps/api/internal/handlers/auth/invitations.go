@@ -251,7 +251,7 @@ func (h *AuthHandler) AcceptInvitationWithRegistration(c fiber.Ctx) error {
 	// Create password account
 	account := models.Account{
 		UserID:     user.ID,
-		ProviderID: "password",
+		ProviderID: models.ProviderPassword,
 		Password:   hashedPassword,
 	}
 
@@ -299,15 +299,13 @@ func (h *AuthHandler) AcceptInvitationWithRegistration(c fiber.Ctx) error {
 	}
 
 	// Create session for the new user
-	sess := session.FromContext(c)
-	userSession := &storage.Session{
-		UserID:             user.ID,
-		IPAddress:          c.IP(),
-		UserAgent:          c.Get("User-Agent"),
-		ExpiresAt:          time.Now().Add(24 * time.Hour),
-		ActiveOrganization: invitation.OrganizationID,
+	userSession, err := h.startSession(c, user.ID, invitation.OrganizationID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to create session",
+			"message": err.Error(),
+		})
 	}
-	sess.Set(storage.SessionDataKey, userSession)
 
 	return c.Status(fiber.StatusOK).JSON(UserSession{
 		User:    user,
@@ -0,0 +1,397 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/ted-too/logsicle/internal/oauth"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// How long users have to complete a sign in at the provider
+const oauthStateTTL = 10 * time.Minute
+
+// Sign in errors, sent to the web app as the error query parameter
+var (
+	errOAuthFailed      = errors.New("oauth_failed")
+	errEmailNotVerified = errors.New("email_not_verified")
+	errEmailNotAllowed  = errors.New("email_domain_not_allowed")
+	errLinkRequired     = errors.New("account_link_required")
+	errAccountLinked    = errors.New("account_linked_to_other_user")
+	errNotMember        = errors.New("not_a_member")
+)
+
+// ListProviders lists the social login providers users can sign in with
+func (h *AuthHandler) ListProviders(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"providers": h.providers.SocialProviders(),
+	})
+}
+
+// StartOAuth redirects to a social login provider. With link=true the
+// account is linked to the signed in user instead.
+func (h *AuthHandler) StartOAuth(c fiber.Ctx) error {
+	name := c.Params("provider")
+	provider, err := h.providers.Social(c.Context(), name)
+	if err != nil {
+		if errors.Is(err, oauth.ErrUnknownProvider) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Provider not found",
+				"message": fmt.Sprintf("Sign in with %s is not enabled", name),
+			})
+		}
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "Provider unavailable",
+			"message": err.Error(),
+		})
+	}
+
+	return h.redirectToProvider(c, provider, name)
+}
+
+// OAuthCallback completes a social login
+func (h *AuthHandler) OAuthCallback(c fiber.Ctx) error {
+	name := c.Params("provider")
+	state, err := h.takeOAuthState(c, name)
+	if err != nil {
+		return h.redirectWithError(c, "/", err)
+	}
+
+	provider, err := h.providers.Social(c.Context(), name)
+	if err != nil {
+		log.Printf("Failed to get %s provider: %v", name, err)
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	identity, token, err := provider.Exchange(c.Context(), c.Query("code"), state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("Failed to complete %s sign in: %v", name, err)
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	return h.completeSignIn(c, state, name, identity, token, nil)
+}
+
+// redirectToProvider starts the authorization code flow, keeping its state
+// in the session
+func (h *AuthHandler) redirectToProvider(c fiber.Ctx, provider oauth.Provider, providerID string) error {
+	sess := session.FromContext(c)
+
+	state := storage.OAuthState{
+		Provider:   providerID,
+		State:      oauth2.GenerateVerifier(),
+		Nonce:      oauth2.GenerateVerifier(),
+		Verifier:   oauth2.GenerateVerifier(),
+		RedirectTo: safeRedirectPath(c.Query("redirect_to")),
+		ExpiresAt:  time.Now().Add(oauthStateTTL),
+	}
+
+	if c.Query("link") == "true" {
+		userSession, ok := sess.Get(storage.SessionDataKey).(storage.Session)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error":   "Not authenticated",
+				"message": "Sign in before linking an account",
+			})
+		}
+
+		// Linking an account to an unverified email would let whoever signed
+		// up with it keep access once the owner verifies it
+		var user models.User
+		if err := h.db.Select("email_verified").First(&user, "id = ?", userSession.UserID).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to get user",
+				"message": err.Error(),
+			})
+		}
+		if !user.EmailVerified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":   "Email not verified",
+				"message": "Verify your email before linking an account",
+			})
+		}
+		state.LinkUserID = userSession.UserID
+	}
+
+	sess.Set(storage.OAuthStateDataKey, state)
+
+	return c.Redirect().To(provider.AuthCodeURL(state.State, state.Nonce, state.Verifier))
+}
+
+// takeOAuthState removes the sign in state from the session and checks the
+// callback belongs to it
+func (h *AuthHandler) takeOAuthState(c fiber.Ctx, providerID string) (storage.OAuthState, error) {
+	sess := session.FromContext(c)
+	state, ok := sess.Get(storage.OAuthStateDataKey).(storage.OAuthState)
+	sess.Delete(storage.OAuthStateDataKey)
+
+	if !ok || state.State == "" || state.State != c.Query("state") || time.Now().After(state.ExpiresAt) {
+		return state, errOAuthFailed
+	}
+	if providerID != "" && state.Provider != providerID {
+		return state, errOAuthFailed
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		log.Printf("Identity provider returned error: %s %s", providerError, c.Query("error_description"))
+		return state, errOAuthFailed
+	}
+
+	return state, nil
+}
+
+// completeSignIn finds or creates the user of an identity, links the
+// account and signs the user in. SSO sign ins also join the organization.
+func (h *AuthHandler) completeSignIn(c fiber.Ctx, state storage.OAuthState, providerID string, identity *oauth.Identity, token *oauth2.Token, sso *models.SSOProvider) error {
+	identity.Email = strings.ToLower(identity.Email)
+
+	if sso != nil {
+		if !sso.AllowsEmail(identity.Email) {
+			return h.redirectWithError(c, state.RedirectTo, errEmailNotAllowed)
+		}
+		// An organization controls what its issuer asserts, so only social
+		// providers verify emails
+		identity.EmailVerified = false
+	}
+
+	var user models.User
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var account models.Account
+		err := tx.Where("provider_id = ? AND account_id = ?", providerID, identity.Subject).First(&account).Error
+		switch {
+		case err == nil:
+			if state.LinkUserID != "" && account.UserID != state.LinkUserID {
+				return errAccountLinked
+			}
+			if err := tx.First(&user, "id = ?", account.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := h.findOrCreateUser(tx, state, identity, sso, &user); err != nil {
+				return err
+			}
+			account = models.Account{
+				AccountID:  identity.Subject,
+				ProviderID: providerID,
+				UserID:     user.ID,
+			}
+		default:
+			return err
+		}
+
+		// Keep the latest tokens of the account
+		account.AccessToken = token.AccessToken
+		account.RefreshToken = token.RefreshToken
+		account.AccessTokenExpiresAt = token.Expiry
+		if idToken, ok := token.Extra("id_token").(string); ok {
+			account.IDToken = idToken
+		}
+		if scope, ok := token.Extra("scope").(string); ok {
+			account.Scope = scope
+		}
+		if err := tx.Save(&account).Error; err != nil {
+			return err
+		}
+
+		if sso != nil {
+			if err := joinSSOOrganization(tx, sso, user.ID); err != nil {
+				return err
+			}
+		}
+
+		if identity.EmailVerified && identity.Email == user.Email && !user.EmailVerified {
+			user.EmailVerified = true
+		}
+		user.LastLoginAt = time.Now()
+		return tx.Model(&user).Select("email_verified", "last_login_at").Updates(&user).Error
+	})
+	if err != nil {
+		if !isSignInError(err) {
+			log.Printf("Failed to sign in with %s: %v", providerID, err)
+			err = errOAuthFailed
+		}
+		return h.redirectWithError(c, state.RedirectTo, err)
+	}
+
+	// Linking keeps the current session
+	if state.LinkUserID != "" {
+		return c.Redirect().To(h.webBaseURL + state.RedirectTo)
+	}
+
+	var memberships []models.TeamMembership
+	if err := h.db.Where("user_id = ?", user.ID).Order("joined_at").Find(&memberships).Error; err != nil || len(memberships) == 0 {
+		return h.redirectWithError(c, state.RedirectTo, errNotMember)
+	}
+
+	activeOrganization := memberships[0].OrganizationID
+	if sso != nil {
+		activeOrganization = sso.OrganizationID
+	}
+
+	sess := session.FromContext(c)
+
+	// Users with two-factor authentication finish signing in with a code
+	if user.TwoFactorEnabled {
+		sess.Set(storage.TwoFactorDataKey, storage.PendingTwoFactor{
+			UserID:             user.ID,
+			ActiveOrganization: activeOrganization,
+			ExpiresAt:          time.Now().Add(twoFactorLoginTTL),
+		})
+		return c.Redirect().To(fmt.Sprintf("%s/two-factor?redirect_to=%s", h.webBaseURL, url.QueryEscape(state.RedirectTo)))
+	}
+
+	if _, err := h.startSession(c, user.ID, activeOrganization); err != nil {
+		log.Printf("Failed to create session for user %s: %v", user.ID, err)
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	return c.Redirect().To(h.webBaseURL + state.RedirectTo)
+}
+
+// findOrCreateUser resolves the user a new account is linked to. Existing
+// users are matched by email only when this app verified their email, so an
+// account created with someone else's email cannot be taken over. Social
+// providers must also have verified the email, and SSO users must already
+// belong to the organization.
+func (h *AuthHandler) findOrCreateUser(tx *gorm.DB, state storage.OAuthState, identity *oauth.Identity, sso *models.SSOProvider, user *models.User) error {
+	if state.LinkUserID != "" {
+		if err := tx.First(user, "id = ?", state.LinkUserID).Error; err != nil {
+			return err
+		}
+		if !user.EmailVerified {
+			return errEmailNotVerified
+		}
+		return nil
+	}
+
+	err := tx.Where("email = ?", identity.Email).First(user).Error
+	if err == nil {
+		if sso == nil && !identity.EmailVerified {
+			return errEmailNotVerified
+		}
+		if !user.EmailVerified {
+			return errLinkRequired
+		}
+		if sso != nil {
+			var count int64
+			if err := tx.Model(&models.TeamMembership{}).
+				Where("user_id = ? AND organization_id = ?", user.ID, sso.OrganizationID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return errLinkRequired
+			}
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if sso != nil && !sso.AutoJoin {
+		return errNotMember
+	}
+
+	*user = models.User{
+		Name:          identity.Name,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		LastLoginAt:   time.Now(),
+	}
+	if user.Name == "" {
+		user.Name = strings.Split(identity.Email, "@")[0]
+	}
+	if identity.Picture != "" {
+		user.Image.Valid = true
+		user.Image.String = identity.Picture
+	}
+	if err := tx.Create(user).Error; err != nil {
+		return err
+	}
+
+	// SSO users join the organization instead of getting their own
+	if sso != nil {
+		return nil
+	}
+
+	defaultOrg := models.Organization{
+		Name:        user.Name + "'s Organization",
+		Description: "Default organization",
+		CreatedByID: user.ID,
+	}
+	if err := tx.Create(&defaultOrg).Error; err != nil {
+		return err
+	}
+
+	membership := models.TeamMembership{
+		OrganizationID: defaultOrg.ID,
+		UserID:         user.ID,
+		Role:           models.RoleOwner,
+		JoinedAt:       time.Now(),
+	}
+	return tx.Create(&membership).Error
+}
+
+// joinSSOOrganization adds the user to the provider's organization when
+// auto join is enabled
+func joinSSOOrganization(tx *gorm.DB, sso *models.SSOProvider, userID string) error {
+	var count int64
+	if err := tx.Model(&models.TeamMembership{}).
+		Where("user_id = ? AND organization_id = ?", userID, sso.OrganizationID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	if !sso.AutoJoin {
+		return errNotMember
+	}
+
+	membership := models.TeamMembership{
+		OrganizationID: sso.OrganizationID,
+		UserID:         userID,
+		Role:           sso.DefaultRole,
+		JoinedAt:       time.Now(),
+	}
+	return tx.Create(&membership).Error
+}
+
+func isSignInError(err error) bool {
+	for _, signInErr := range []error{errOAuthFailed, errEmailNotVerified, errEmailNotAllowed, errLinkRequired, errAccountLinked, errNotMember} {
+		if errors.Is(err, signInErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectWithError sends the user back to the web app with the sign in
+// error
+func (h *AuthHandler) redirectWithError(c fiber.Ctx, redirectTo string, err error) error {
+	if redirectTo == "" {
+		redirectTo = "/"
+	}
+	separator := "?"
+	if strings.Contains(redirectTo, "?") {
+		separator = "&"
+	}
+	return c.Redirect().To(fmt.Sprintf("%s%s%serror=%s", h.webBaseURL, redirectTo, separator, url.QueryEscape(err.Error())))
+}
+
+// safeRedirectPath keeps redirects within the web app
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// startSession signs the user in on a new session ID, so an ID set before
+// signing in cannot be reused, and records the session
+func (h *AuthHandler) startSession(c fiber.Ctx, userID, activeOrganization string) (*storage.Session, error) {
+	sess := session.FromContext(c)
+	if err := sess.Reset(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	userSession := &storage.Session{
+		UserID:             userID,
+		IPAddress:          c.IP(),
+		UserAgent:          c.Get("User-Agent"),
+		ExpiresAt:          now.Add(h.sessionTTL),
+		CreatedAt:          now,
+		ActiveOrganization: activeOrganization,
+	}
+
+	if err := h.db.Create(&models.Session{
+		TokenHash:  models.HashToken(sess.ID()),
+		UserID:     userID,
+		IPAddress:  userSession.IPAddress,
+		UserAgent:  userSession.UserAgent,
+		ExpiresAt:  userSession.ExpiresAt,
+		LastSeenAt: now,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	sess.Set(storage.SessionDataKey, userSession)
+	return userSession, nil
+}
+
+// deleteSessions signs a user out of every recorded session except one,
+// which may be empty
+func deleteSessions(tx *gorm.DB, userID, exceptSessionID string) error {
+	query := tx.Unscoped().Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	return query.Delete(&models.Session{}).Error
+}
+
+// ListSessions lists the active sessions of the current user across
+// devices
+func (h *AuthHandler) ListSessions(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	currentID, _ := c.Locals("session_id").(string)
+
+	var sessions []models.Session
+	if err := h.db.
+		Where("user_id = ? AND expires_at > ?", userSession.UserID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to load sessions",
+			"message": err.Error(),
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, fiber.Map{
+			"session": s,
+			"current": s.ID == currentID,
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// RevokeSession signs out one session of the current user. Revoking the
+// current session signs out.
+func (h *AuthHandler) RevokeSession(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	currentID, _ := c.Locals("session_id").(string)
+	sessionID := c.Params("sessionId")
+
+	result := h.db.Unscoped().Where("id = ? AND user_id = ?", sessionID, userSession.UserID).Delete(&models.Session{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to revoke session",
+			"message": result.Error.Error(),
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	if sessionID == currentID {
+		if err := session.FromContext(c).Destroy(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to sign out",
+				"message": err.Error(),
+			})
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeOtherSessions signs the current user out everywhere else
+func (h *AuthHandler) RevokeOtherSessions(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	currentID, _ := c.Locals("session_id").(string)
+
+	if err := deleteSessions(h.db, userSession.UserID, currentID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to revoke sessions",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeMemberSessions signs a member of the active organization out of
+// every session. Sessions are not tied to an organization, so this signs
+// the member out of their other organizations too and is limited to owners.
+func (h *AuthHandler) RevokeMemberSessions(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	userID := c.Params("userId")
+
+	var member models.TeamMembership
+	if err := h.db.Where("user_id = ? AND organization_id = ?", userID, userSession.ActiveOrganization).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Member not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to load member",
+			"message": err.Error(),
+		})
+	}
+
+	if err := deleteSessions(h.db, userID, ""); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to revoke sessions",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
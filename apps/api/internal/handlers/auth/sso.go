@@ -0,0 +1,381 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gofiber/fiber/v3"
+	"github.com/lib/pq"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// FindSSO finds the organization to sign in to with SSO, by slug or by the
+// verified domain of an email
+func (h *AuthHandler) FindSSO(c fiber.Ctx) error {
+	query := h.db.Preload("Organization").Where("enabled = ?", true)
+
+	switch {
+	case c.Query("organization") != "":
+		query = query.Where("organization_id = (?)",
+			h.db.Model(&models.Organization{}).Select("id").Where("slug = ?", c.Query("organization")))
+	case strings.Contains(c.Query("email"), "@"):
+		email := strings.ToLower(c.Query("email"))
+		domain := email[strings.LastIndex(email, "@")+1:]
+		query = query.Where("? = ANY(verified_domains)", domain)
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request",
+			"message": "An organization slug or email is required",
+		})
+	}
+
+	var providers []models.SSOProvider
+	if err := query.Find(&providers).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to find SSO providers",
+			"message": err.Error(),
+		})
+	}
+
+	organizations := make([]fiber.Map, 0, len(providers))
+	for _, provider := range providers {
+		if provider.Organization == nil {
+			continue
+		}
+		organizations = append(organizations, fiber.Map{
+			"name": provider.Organization.Name,
+			"slug": provider.Organization.Slug,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"organizations": organizations,
+	})
+}
+
+// StartSSO redirects to the identity provider of an organization
+func (h *AuthHandler) StartSSO(c fiber.Ctx) error {
+	var provider models.SSOProvider
+	if err := h.db.
+		Joins("JOIN organizations ON organizations.id = sso_providers.organization_id").
+		Where("organizations.slug = ? AND sso_providers.enabled = ?", c.Params("slug"), true).
+		First(&provider).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "SSO not configured",
+			"message": "This organization has not configured single sign-on",
+		})
+	}
+
+	oidcProvider, err := h.providers.SSO(c.Context(), provider)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error":   "Provider unavailable",
+			"message": err.Error(),
+		})
+	}
+
+	return h.redirectToProvider(c, oidcProvider, provider.ID)
+}
+
+// SSOCallback completes an SSO sign in
+func (h *AuthHandler) SSOCallback(c fiber.Ctx) error {
+	state, err := h.takeOAuthState(c, "")
+	if err != nil {
+		return h.redirectWithError(c, "/", err)
+	}
+
+	var provider models.SSOProvider
+	if err := h.db.Where("id = ? AND enabled = ?", state.Provider, true).First(&provider).Error; err != nil {
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	oidcProvider, err := h.providers.SSO(c.Context(), provider)
+	if err != nil {
+		log.Printf("Failed to get SSO provider %s: %v", provider.ID, err)
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	identity, token, err := oidcProvider.Exchange(c.Context(), c.Query("code"), state.Nonce, state.Verifier)
+	if err != nil {
+		log.Printf("Failed to complete SSO sign in with %s: %v", provider.ID, err)
+		return h.redirectWithError(c, state.RedirectTo, errOAuthFailed)
+	}
+
+	return h.completeSignIn(c, state, provider.AccountProviderID(), identity, token, &provider)
+}
+
+// UpdateSSOProviderInput configures the identity provider of an organization
+type UpdateSSOProviderInput struct {
+	Issuer         *string      `json:"issuer,omitempty"`
+	ClientID       *string      `json:"client_id,omitempty"`
+	ClientSecret   *string      `json:"client_secret,omitempty"`
+	AllowedDomains *[]string    `json:"allowed_domains,omitempty"`
+	AutoJoin       *bool        `json:"auto_join,omitempty"`
+	DefaultRole    *models.Role `json:"default_role,omitempty"`
+	Enabled        *bool        `json:"enabled,omitempty"`
+}
+
+func (i UpdateSSOProviderInput) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Issuer, validation.NilOrNotEmpty, is.URL),
+		validation.Field(&i.ClientID, validation.NilOrNotEmpty),
+		validation.Field(&i.ClientSecret, validation.NilOrNotEmpty),
+		validation.Field(&i.AllowedDomains, validation.By(func(value interface{}) error {
+			domains, _ := value.(*[]string)
+			if domains == nil {
+				return nil
+			}
+			return validation.Validate(*domains, validation.Each(validation.Required, is.Domain))
+		})),
+		validation.Field(&i.DefaultRole, validation.NilOrNotEmpty, validation.In(models.RoleAdmin, models.RoleMember)),
+	)
+}
+
+// GetSSOProvider returns the identity provider of the active organization
+func (h *AuthHandler) GetSSOProvider(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+
+	var provider models.SSOProvider
+	if err := h.db.Where("organization_id = ?", userSession.ActiveOrganization).First(&provider).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "SSO not configured",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to get SSO provider",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(ssoProviderResponse(provider, h.providers.SSOCallbackURL()))
+}
+
+// ssoProviderResponse returns the provider with the DNS records that verify
+// its domains
+func ssoProviderResponse(provider models.SSOProvider, callbackURL string) fiber.Map {
+	domains := make([]fiber.Map, 0, len(provider.AllowedDomains))
+	for _, domain := range provider.AllowedDomains {
+		name, value := provider.DomainVerificationRecord(domain)
+		domains = append(domains, fiber.Map{
+			"domain":   domain,
+			"verified": slices.Contains(provider.VerifiedDomains, domain),
+			"record":   fiber.Map{"type": "TXT", "name": name, "value": value},
+		})
+	}
+
+	return fiber.Map{
+		"provider":     provider,
+		"domains":      domains,
+		"callback_url": callbackURL,
+	}
+}
+
+// UpdateSSOProvider creates or updates the identity provider of the active
+// organization. The issuer is discovered before the settings are saved.
+func (h *AuthHandler) UpdateSSOProvider(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+
+	var input UpdateSSOProviderInput
+	if err := c.Bind().Body(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	provider := models.SSOProvider{
+		OrganizationID:  userSession.ActiveOrganization,
+		AllowedDomains:  pq.StringArray{},
+		VerifiedDomains: pq.StringArray{},
+		AutoJoin:        true,
+		DefaultRole:     models.RoleMember,
+		Enabled:         true,
+	}
+	err := h.db.Where("organization_id = ?", userSession.ActiveOrganization).First(&provider).Error
+	exists := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to get SSO provider",
+			"message": err.Error(),
+		})
+	}
+
+	previousIssuer := provider.Issuer
+	if input.Issuer != nil {
+		provider.Issuer = strings.TrimSuffix(*input.Issuer, "/")
+	}
+	if input.ClientID != nil {
+		provider.ClientID = *input.ClientID
+	}
+	if input.ClientSecret != nil {
+		provider.ClientSecret = *input.ClientSecret
+	}
+	if input.AllowedDomains != nil {
+		provider.AllowedDomains = pq.StringArray{}
+		for _, domain := range *input.AllowedDomains {
+			provider.AllowedDomains = append(provider.AllowedDomains, strings.ToLower(domain))
+		}
+
+		// Domains stay verified only while they are allowed
+		verified := pq.StringArray{}
+		for _, domain := range provider.VerifiedDomains {
+			if slices.Contains(provider.AllowedDomains, domain) {
+				verified = append(verified, domain)
+			}
+		}
+		provider.VerifiedDomains = verified
+	}
+	if input.AutoJoin != nil {
+		provider.AutoJoin = *input.AutoJoin
+	}
+	if input.DefaultRole != nil {
+		provider.DefaultRole = *input.DefaultRole
+	}
+	if input.Enabled != nil {
+		provider.Enabled = *input.Enabled
+	}
+
+	if provider.Issuer == "" || provider.ClientID == "" || provider.ClientSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": "issuer, client_id and client_secret are required",
+		})
+	}
+
+	// Check the issuer before saving, without caching the unsaved settings
+	check := provider
+	check.ID = ""
+	if _, err := h.providers.SSO(c.Context(), check); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid issuer",
+			"message": err.Error(),
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if !exists {
+			return tx.Select("*").Create(&provider).Error
+		}
+
+		// Subjects are only unique per issuer, accounts of the previous one
+		// could otherwise sign in as whoever the new issuer assigns them to
+		if provider.Issuer != previousIssuer {
+			if err := tx.Unscoped().Where("provider_id = ?", provider.AccountProviderID()).Delete(&models.Account{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(&provider).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to save SSO provider",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(ssoProviderResponse(provider, h.providers.SSOCallbackURL()))
+}
+
+// VerifySSODomains checks the DNS records of the allowed domains that are
+// not verified yet. Users can only sign in with emails of verified domains,
+// and a domain is verified for one organization at most.
+func (h *AuthHandler) VerifySSODomains(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+
+	var provider models.SSOProvider
+	if err := h.db.Where("organization_id = ?", userSession.ActiveOrganization).First(&provider).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "SSO not configured",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to get SSO provider",
+			"message": err.Error(),
+		})
+	}
+
+	errs := fiber.Map{}
+	for _, domain := range provider.AllowedDomains {
+		if slices.Contains(provider.VerifiedDomains, domain) {
+			continue
+		}
+
+		var count int64
+		if err := h.db.Model(&models.SSOProvider{}).
+			Where("id <> ? AND ? = ANY(verified_domains)", provider.ID, domain).
+			Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to verify domains",
+				"message": err.Error(),
+			})
+		}
+		if count > 0 {
+			errs[domain] = "Domain is verified by another organization"
+			continue
+		}
+
+		name, value := provider.DomainVerificationRecord(domain)
+		records, err := h.lookupTXT(c.Context(), name)
+		if err != nil || !slices.Contains(records, value) {
+			errs[domain] = "Verification record not found"
+			continue
+		}
+		provider.VerifiedDomains = append(provider.VerifiedDomains, domain)
+	}
+
+	if err := h.db.Model(&provider).Update("verified_domains", provider.VerifiedDomains).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to save verified domains",
+			"message": err.Error(),
+		})
+	}
+
+	response := ssoProviderResponse(provider, h.providers.SSOCallbackURL())
+	response["errors"] = errs
+	return c.JSON(response)
+}
+
+// DeleteSSOProvider removes the identity provider of the active
+// organization along with the accounts linked through it
+func (h *AuthHandler) DeleteSSOProvider(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var provider models.SSOProvider
+		if err := tx.Where("organization_id = ?", userSession.ActiveOrganization).First(&provider).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("provider_id = ?", provider.AccountProviderID()).Delete(&models.Account{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&provider).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "SSO not configured",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to delete SSO provider",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
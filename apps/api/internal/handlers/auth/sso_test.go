@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/lib/pq"
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/oauth"
+	"github.com/ted-too/logsicle/internal/oauth/oauthtest"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	testAPIBaseURL = "http://api.test"
+	testWebBaseURL = "http://web.test"
+)
+
+type ssoTest struct {
+	t        *testing.T
+	app      *fiber.App
+	db       *gorm.DB
+	issuer   *oauthtest.Issuer
+	org      models.Organization
+	provider models.SSOProvider
+	cookies  []*http.Cookie
+}
+
+// newSSOTest serves the SSO routes of an organization whose provider is a
+// local issuer and allows the verified domain acme.com and the unverified
+// domain contoso.com
+func newSSOTest(t *testing.T) *ssoTest {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_pragma=busy_timeout(5000)"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Organization{}, &models.TeamMembership{}, &models.Account{}, &models.Session{}, &models.SSOProvider{}, &models.Verification{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	s := &ssoTest{t: t, db: db, issuer: oauthtest.NewIssuer(t)}
+
+	owner := s.createUser("owner@acme.com", true)
+	s.org = models.Organization{Name: "Acme", CreatedByID: owner.ID}
+	s.create(&s.org)
+	s.join(owner, models.RoleOwner)
+
+	s.provider = models.SSOProvider{
+		OrganizationID:  s.org.ID,
+		Issuer:          s.issuer.URL,
+		ClientID:        s.issuer.ClientID,
+		ClientSecret:    s.issuer.ClientSecret,
+		AllowedDomains:  pq.StringArray{"acme.com", "contoso.com"},
+		VerifiedDomains: pq.StringArray{"acme.com"},
+		AutoJoin:        true,
+		DefaultRole:     models.RoleMember,
+		Enabled:         true,
+	}
+	s.create(&s.provider)
+
+	h := &AuthHandler{
+		db:         db,
+		providers:  oauth.NewRegistry(&config.Config{ApiBaseURL: testAPIBaseURL}),
+		webBaseURL: testWebBaseURL,
+		sessionTTL: time.Hour,
+	}
+
+	sessionMiddleware, sessionStore := session.NewWithStore()
+	sessionStore.RegisterType(storage.Session{})
+	sessionStore.RegisterType(storage.OAuthState{})
+	sessionStore.RegisterType(storage.PendingTwoFactor{})
+
+	s.app = fiber.New()
+	s.app.Use(sessionMiddleware)
+	s.app.Get("/v1/auth/sso/callback", h.SSOCallback)
+	s.app.Get("/v1/auth/sso/:slug", h.StartSSO)
+	s.app.Post("/v1/auth/reset-password", h.ResetPassword)
+	s.app.Delete("/v1/organizations/sso", func(c fiber.Ctx) error {
+		c.Locals("session", storage.Session{ActiveOrganization: s.org.ID})
+		return h.DeleteSSOProvider(c)
+	})
+
+	// Signs a user in without a provider, to link accounts
+	s.app.Post("/sign-in/:userId", func(c fiber.Ctx) error {
+		if _, err := h.startSession(c, c.Params("userId"), s.org.ID); err != nil {
+			return err
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	// Completes a Google sign in with the identity Google asserted
+	s.app.Post("/google/:email", func(c fiber.Ctx) error {
+		identity := &oauth.Identity{Subject: "google-" + c.Params("email"), Email: c.Params("email"), EmailVerified: true}
+		return h.completeSignIn(c, storage.OAuthState{RedirectTo: "/"}, models.ProviderGoogle, identity, &oauth2.Token{}, nil)
+	})
+
+	return s
+}
+
+func (s *ssoTest) create(value any) {
+	s.t.Helper()
+	if err := s.db.Create(value).Error; err != nil {
+		s.t.Fatalf("failed to create %T: %v", value, err)
+	}
+}
+
+func (s *ssoTest) createUser(email string, verified bool) *models.User {
+	s.t.Helper()
+	user := &models.User{Name: email, Email: email, EmailVerified: verified}
+	s.create(user)
+	return user
+}
+
+func (s *ssoTest) join(user *models.User, role models.Role) {
+	s.t.Helper()
+	s.create(&models.TeamMembership{OrganizationID: s.org.ID, UserID: user.ID, Role: role, JoinedAt: time.Now()})
+}
+
+// request sends a request with the cookies of earlier responses
+func (s *ssoTest) request(method, target string) *http.Response {
+	s.t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	for _, cookie := range s.cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := s.app.Test(req)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, target, err)
+	}
+	resp.Body.Close()
+
+	for _, cookie := range resp.Cookies() {
+		s.cookies = append(s.cookies, cookie)
+	}
+	return resp
+}
+
+// signIn starts an SSO sign in as claims and returns the callback URL the
+// issuer redirects to
+func (s *ssoTest) signIn(query string, claims map[string]any) *url.URL {
+	s.t.Helper()
+
+	resp := s.request(http.MethodGet, "/v1/auth/sso/"+s.org.Slug+query)
+	if resp.StatusCode != fiber.StatusFound {
+		s.t.Fatalf("start status = %d, want %d", resp.StatusCode, fiber.StatusFound)
+	}
+
+	s.issuer.SignInAs(claims)
+	callback, err := s.issuer.Authorize(resp.Header.Get("Location"))
+	if err != nil {
+		s.t.Fatalf("Authorize: %v", err)
+	}
+	return callback
+}
+
+// callback completes the sign in and returns the sign in error sent to the
+// web app, empty on success
+func (s *ssoTest) callback(callback *url.URL) string {
+	s.t.Helper()
+
+	resp := s.request(http.MethodGet, callback.RequestURI())
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || location.Scheme+"://"+location.Host != testWebBaseURL {
+		s.t.Fatalf("callback redirected to %q, want the web app", resp.Header.Get("Location"))
+	}
+	return location.Query().Get("error")
+}
+
+func (s *ssoTest) user(email string) *models.User {
+	s.t.Helper()
+	var user models.User
+	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+		s.t.Fatalf("failed to get user %s: %v", email, err)
+	}
+	return &user
+}
+
+func (s *ssoTest) count(model any, query string, args ...any) int64 {
+	s.t.Helper()
+	var count int64
+	if err := s.db.Model(model).Where(query, args...).Count(&count).Error; err != nil {
+		s.t.Fatalf("failed to count %T: %v", model, err)
+	}
+	return count
+}
+
+func claims(subject, email string) map[string]any {
+	return map[string]any{"sub": subject, "email": email, "email_verified": true, "name": "Jane"}
+}
+
+func TestSSOSignInCreatesMember(t *testing.T) {
+	s := newSSOTest(t)
+
+	if err := s.callback(s.signIn("", claims("jane", "Jane@acme.com"))); err != "" {
+		t.Fatalf("sign in error = %q", err)
+	}
+
+	user := s.user("jane@acme.com")
+	if user.EmailVerified {
+		t.Error("email asserted by the organization's issuer was marked verified")
+	}
+	if n := s.count(&models.TeamMembership{}, "user_id = ? AND organization_id = ? AND role = ?", user.ID, s.org.ID, models.RoleMember); n != 1 {
+		t.Errorf("user has %d memberships of the organization, want 1", n)
+	}
+	if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ? AND account_id = ?", user.ID, s.provider.AccountProviderID(), "jane"); n != 1 {
+		t.Errorf("user has %d SSO accounts, want 1", n)
+	}
+	if n := s.count(&models.Session{}, "user_id = ?", user.ID); n != 1 {
+		t.Errorf("user has %d sessions, want 1", n)
+	}
+
+	// Signing in again uses the linked account
+	s.cookies = nil
+	if err := s.callback(s.signIn("", claims("jane", "jane@acme.com"))); err != "" {
+		t.Fatalf("second sign in error = %q", err)
+	}
+	if n := s.count(&models.User{}, "email = ?", "jane@acme.com"); n != 1 {
+		t.Errorf("%d users with the email, want 1", n)
+	}
+}
+
+func TestSSOSignInRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		tamper  func(callback *url.URL)
+		wantErr error
+	}{
+		{
+			name:    "domain not allowed",
+			claims:  claims("jane", "jane@example.com"),
+			wantErr: errEmailNotAllowed,
+		},
+		{
+			name:    "domain not verified",
+			claims:  claims("jane", "jane@contoso.com"),
+			wantErr: errEmailNotAllowed,
+		},
+		{
+			name: "wrong nonce",
+			claims: map[string]any{
+				"sub":   "jane",
+				"email": "jane@acme.com",
+				"nonce": "other",
+			},
+			wantErr: errOAuthFailed,
+		},
+		{
+			name:   "wrong state",
+			claims: claims("jane", "jane@acme.com"),
+			tamper: func(callback *url.URL) {
+				query := callback.Query()
+				query.Set("state", "other")
+				callback.RawQuery = query.Encode()
+			},
+			wantErr: errOAuthFailed,
+		},
+		{
+			name:   "provider error",
+			claims: claims("jane", "jane@acme.com"),
+			tamper: func(callback *url.URL) {
+				query := callback.Query()
+				query.Set("error", "access_denied")
+				callback.RawQuery = query.Encode()
+			},
+			wantErr: errOAuthFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSSOTest(t)
+
+			callback := s.signIn("", tt.claims)
+			if tt.tamper != nil {
+				tt.tamper(callback)
+			}
+			if err := s.callback(callback); err != tt.wantErr.Error() {
+				t.Fatalf("sign in error = %q, want %q", err, tt.wantErr)
+			}
+
+			if n := s.count(&models.Account{}, "provider_id = ?", s.provider.AccountProviderID()); n != 0 {
+				t.Errorf("%d SSO accounts created, want 0", n)
+			}
+			if n := s.count(&models.Session{}, "1 = 1"); n != 0 {
+				t.Errorf("%d sessions created, want 0", n)
+			}
+		})
+	}
+}
+
+func TestSSOSignInCallbackReplay(t *testing.T) {
+	s := newSSOTest(t)
+
+	callback := s.signIn("", claims("jane", "jane@acme.com"))
+	if err := s.callback(callback); err != "" {
+		t.Fatalf("sign in error = %q", err)
+	}
+	// The state is removed from the session once used
+	if err := s.callback(callback); err != errOAuthFailed.Error() {
+		t.Fatalf("replayed callback error = %q, want %q", err, errOAuthFailed)
+	}
+}
+
+func TestSSOSignInLinksExistingUsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		verified bool
+		member   bool
+		wantErr  string
+	}{
+		{name: "verified member", verified: true, member: true},
+		{name: "unverified member", verified: false, member: true, wantErr: errLinkRequired.Error()},
+		{name: "verified non member", verified: true, member: false, wantErr: errLinkRequired.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSSOTest(t)
+			user := s.createUser("jane@acme.com", tt.verified)
+			if tt.member {
+				s.join(user, models.RoleMember)
+			}
+
+			if err := s.callback(s.signIn("", claims("jane", "jane@acme.com"))); err != tt.wantErr {
+				t.Fatalf("sign in error = %q, want %q", err, tt.wantErr)
+			}
+
+			want := int64(0)
+			if tt.wantErr == "" {
+				want = 1
+			}
+			if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ?", user.ID, s.provider.AccountProviderID()); n != want {
+				t.Errorf("user has %d SSO accounts, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestSSOLinkAccount(t *testing.T) {
+	s := newSSOTest(t)
+	user := s.createUser("jane@gmail.com", true)
+
+	s.request(http.MethodPost, "/sign-in/"+user.ID)
+	if err := s.callback(s.signIn("?link=true", claims("jane", "jane@acme.com"))); err != "" {
+		t.Fatalf("link error = %q", err)
+	}
+	if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ? AND account_id = ?", user.ID, s.provider.AccountProviderID(), "jane"); n != 1 {
+		t.Errorf("user has %d SSO accounts, want 1", n)
+	}
+
+	// The account cannot be linked to another user
+	other := s.createUser("john@gmail.com", true)
+	s.cookies = nil
+	s.request(http.MethodPost, "/sign-in/"+other.ID)
+	if err := s.callback(s.signIn("?link=true", claims("jane", "jane@acme.com"))); err != errAccountLinked.Error() {
+		t.Fatalf("link error = %q, want %q", err, errAccountLinked)
+	}
+}
+
+func TestLinkAccountRequiresVerifiedEmail(t *testing.T) {
+	s := newSSOTest(t)
+	user := s.createUser("jane@gmail.com", false)
+
+	s.request(http.MethodPost, "/sign-in/"+user.ID)
+	resp := s.request(http.MethodGet, "/v1/auth/sso/"+s.org.Slug+"?link=true")
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("link status = %d, want %d", resp.StatusCode, fiber.StatusForbidden)
+	}
+	if n := s.count(&models.Account{}, "user_id = ?", user.ID); n != 0 {
+		t.Errorf("user has %d accounts, want 0", n)
+	}
+}
+
+func TestSocialSignInDoesNotLinkSSOUsers(t *testing.T) {
+	s := newSSOTest(t)
+
+	// An organization's issuer asserts an email it cannot prove
+	if err := s.callback(s.signIn("", claims("jane", "jane@acme.com"))); err != "" {
+		t.Fatalf("sign in error = %q", err)
+	}
+	user := s.user("jane@acme.com")
+
+	// The owner of the email signing in with Google is not linked to the
+	// user the issuer created
+	s.cookies = nil
+	resp := s.request(http.MethodPost, "/google/jane@acme.com")
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	if err := location.Query().Get("error"); err != errLinkRequired.Error() {
+		t.Fatalf("Google sign in error = %q, want %q", err, errLinkRequired)
+	}
+	if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ?", user.ID, models.ProviderGoogle); n != 0 {
+		t.Errorf("user has %d Google accounts, want 0", n)
+	}
+}
+
+func TestDeleteSSOProviderDeletesAccounts(t *testing.T) {
+	s := newSSOTest(t)
+
+	if err := s.callback(s.signIn("", claims("jane", "jane@acme.com"))); err != "" {
+		t.Fatalf("sign in error = %q", err)
+	}
+
+	resp := s.request(http.MethodDelete, "/v1/organizations/sso")
+	if resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("delete status = %d, want %d", resp.StatusCode, fiber.StatusNoContent)
+	}
+	if n := s.count(&models.Account{}, "provider_id = ?", s.provider.AccountProviderID()); n != 0 {
+		t.Errorf("%d SSO accounts left, want 0", n)
+	}
+	if n := s.count(&models.SSOProvider{}, "id = ?", s.provider.ID); n != 0 {
+		t.Errorf("%d SSO providers left, want 0", n)
+	}
+
+	resp = s.request(http.MethodDelete, "/v1/organizations/sso")
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Fatalf("second delete status = %d, want %d", resp.StatusCode, fiber.StatusNotFound)
+	}
+}
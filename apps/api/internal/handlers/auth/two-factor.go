@@ -0,0 +1,543 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/lib/pq"
+	"github.com/ted-too/logsicle/internal/crypto"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"github.com/ted-too/logsicle/internal/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	// Issuer shown by authenticator apps
+	totpIssuer = "Logsicle"
+
+	// How long users have to enter a code after their password
+	twoFactorLoginTTL = 5 * time.Minute
+	// How many wrong codes a user can enter before their second factor is
+	// locked, and for how long. Attempts are counted per user rather than
+	// per sign in, so signing in again does not reset them.
+	maxTwoFactorAttempts   = 5
+	twoFactorLockout       = 15 * time.Minute
+	recoveryCodeCount      = 10
+	recoveryCodeRandomSize = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// errTwoFactorLocked is returned while a user's second factor is locked
+// after too many wrong codes
+var errTwoFactorLocked = errors.New("two-factor authentication locked")
+
+// recordFailedAttemptSQL counts a wrong code, locking the second factor and
+// starting the count over once the limit is reached
+const recordFailedAttemptSQL = `
+	UPDATE two_factors SET
+		failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END,
+		locked_until = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END,
+		updated_at = ?
+	WHERE id = ?
+	RETURNING locked_until`
+
+// TwoFactorCodeRequest carries either a TOTP code or a recovery code
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (r TwoFactorCodeRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Code, validation.Required.When(r.RecoveryCode == "")),
+		validation.Field(&r.RecoveryCode, validation.Required.When(r.Code == "")),
+	)
+}
+
+// generateRecoveryCodes returns new recovery codes and their Argon2 hashes
+func generateRecoveryCodes() ([]string, pq.StringArray, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make(pq.StringArray, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		random := make([]byte, recoveryCodeRandomSize)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(random))[:10]
+
+		hash, err := crypto.HashPassword(code, crypto.DefaultParams)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hash)
+	}
+
+	return codes, hashes, nil
+}
+
+// verifySecondFactor checks a TOTP code or uses up a recovery code of a
+// confirmed enrollment. Wrong codes count towards locking the user's second
+// factor, and errTwoFactorLocked is returned while it is locked.
+func verifySecondFactor(tx *gorm.DB, twoFactor *models.TwoFactor, req TwoFactorCodeRequest) (bool, error) {
+	now := time.Now()
+	if twoFactor.LockedUntil.Valid && now.Before(twoFactor.LockedUntil.Time) {
+		return false, errTwoFactorLocked
+	}
+
+	valid, err := checkSecondFactor(tx, twoFactor, req, now)
+	if err != nil {
+		return false, err
+	}
+
+	if !valid {
+		var lockedUntil sql.NullTime
+		if err := tx.Raw(recordFailedAttemptSQL,
+			maxTwoFactorAttempts, maxTwoFactorAttempts, now.Add(twoFactorLockout), now, twoFactor.ID,
+		).Scan(&lockedUntil).Error; err != nil {
+			return false, err
+		}
+		if lockedUntil.Valid && now.Before(lockedUntil.Time) {
+			return false, errTwoFactorLocked
+		}
+		return false, nil
+	}
+
+	if twoFactor.FailedAttempts > 0 {
+		if err := tx.Model(twoFactor).Update("failed_attempts", 0).Error; err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// checkSecondFactor accepts a TOTP code once or uses up a recovery code.
+// Updates are conditional so concurrent requests cannot use the same code
+// twice.
+func checkSecondFactor(tx *gorm.DB, twoFactor *models.TwoFactor, req TwoFactorCodeRequest, now time.Time) (bool, error) {
+	if req.Code != "" {
+		step, ok := totp.Validate(twoFactor.Secret, req.Code, now)
+		if !ok || step <= twoFactor.LastUsedStep {
+			return false, nil
+		}
+		result := tx.Model(&models.TwoFactor{}).
+			Where("id = ? AND last_used_step < ?", twoFactor.ID, step).
+			Update("last_used_step", step)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+		twoFactor.LastUsedStep = step
+		return true, nil
+	}
+
+	code := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(req.RecoveryCode))
+	for i, hash := range twoFactor.RecoveryCodes {
+		if match, err := crypto.VerifyPassword(code, hash); err != nil || !match {
+			continue
+		}
+
+		result := tx.Model(&models.TwoFactor{}).
+			Where("id = ? AND ? = ANY(recovery_codes)", twoFactor.ID, hash).
+			Update("recovery_codes", gorm.Expr("array_remove(recovery_codes, ?)", hash))
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return false, nil
+		}
+
+		remaining := make(pq.StringArray, 0, len(twoFactor.RecoveryCodes)-1)
+		remaining = append(remaining, twoFactor.RecoveryCodes[:i]...)
+		remaining = append(remaining, twoFactor.RecoveryCodes[i+1:]...)
+		twoFactor.RecoveryCodes = remaining
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// confirmedTwoFactor loads the confirmed enrollment of a user
+func confirmedTwoFactor(tx *gorm.DB, userID string) (*models.TwoFactor, error) {
+	var twoFactor models.TwoFactor
+	if err := tx.Where("user_id = ? AND confirmed_at IS NOT NULL", userID).First(&twoFactor).Error; err != nil {
+		return nil, err
+	}
+	return &twoFactor, nil
+}
+
+// VerifyTwoFactorLogin completes a sign in waiting for a second factor
+func (h *AuthHandler) VerifyTwoFactorLogin(c fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	sess := session.FromContext(c)
+	pending, ok := sess.Get(storage.TwoFactorDataKey).(storage.PendingTwoFactor)
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		sess.Delete(storage.TwoFactorDataKey)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Not authenticated",
+			"message": "Sign in again to continue",
+		})
+	}
+
+	twoFactor, err := confirmedTwoFactor(h.db, pending.UserID)
+	if err != nil {
+		sess.Delete(storage.TwoFactorDataKey)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Not authenticated",
+			"message": "Sign in again to continue",
+		})
+	}
+
+	valid, err := verifySecondFactor(h.db, twoFactor, req)
+	if errors.Is(err, errTwoFactorLocked) {
+		sess.Delete(storage.TwoFactorDataKey)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":   "Too many attempts",
+			"message": "Too many incorrect codes, try again later",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to verify code",
+			"message": err.Error(),
+		})
+	}
+	if !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Invalid code",
+			"message": "The code is incorrect or has already been used",
+		})
+	}
+
+	sess.Delete(storage.TwoFactorDataKey)
+
+	var user models.User
+	if err := h.db.Preload("Organizations").First(&user, "id = ?", pending.UserID).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Not authenticated",
+			"message": "Sign in again to continue",
+		})
+	}
+
+	return h.finishLogin(c, &user, pending.ActiveOrganization)
+}
+
+// EnrollTwoFactor starts TOTP enrollment, returning the secret and the
+// provisioning URI to show as a QR code. It takes effect once confirmed.
+func (h *AuthHandler) EnrollTwoFactor(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":   "Two-factor authentication already enabled",
+			"message": "Disable two-factor authentication before enrolling again",
+		})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to generate secret",
+			"message": err.Error(),
+		})
+	}
+
+	// Replace any unconfirmed enrollment
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(&models.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TwoFactor{
+			UserID:        user.ID,
+			Secret:        secret,
+			RecoveryCodes: pq.StringArray{},
+		}).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to start enrollment",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor enables two-factor authentication with a code from the
+// authenticator app and returns the recovery codes, which are only shown
+// once
+func (h *AuthHandler) ConfirmTwoFactor(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": "code: cannot be blank.",
+		})
+	}
+
+	var twoFactor models.TwoFactor
+	if err := h.db.Where("user_id = ? AND confirmed_at IS NULL", user.ID).First(&twoFactor).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "No pending enrollment",
+			"message": "Start enrollment before confirming it",
+		})
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, req.Code, time.Now())
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid code",
+			"message": "The code is incorrect, check the time on your device",
+		})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to generate recovery codes",
+			"message": err.Error(),
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&twoFactor).Updates(map[string]interface{}{
+			"confirmed_at":   sql.NullTime{Time: time.Now(), Valid: true},
+			"last_used_step": step,
+			"recovery_codes": hashes,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("two_factor_enabled", true).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to enable two-factor authentication",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (h *AuthHandler) RegenerateRecoveryCodes(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	twoFactor, err := confirmedTwoFactor(h.db, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Two-factor authentication not enabled",
+			"message": "Enable two-factor authentication first",
+		})
+	}
+
+	if valid, err := verifySecondFactor(h.db, twoFactor, req); err != nil || !valid {
+		if errors.Is(err, errTwoFactorLocked) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":   "Too many attempts",
+				"message": "Too many incorrect codes, try again later",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Invalid code",
+			"message": "The code is incorrect or has already been used",
+		})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to generate recovery codes",
+			"message": err.Error(),
+		})
+	}
+
+	if err := h.db.Model(twoFactor).Update("recovery_codes", hashes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to save recovery codes",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off with a current code,
+// unless an organization of the user requires it
+func (h *AuthHandler) DisableTwoFactor(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	var req TwoFactorCodeRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	var required int64
+	if err := h.db.Model(&models.Organization{}).
+		Joins("JOIN team_memberships ON team_memberships.organization_id = organizations.id AND team_memberships.deleted_at IS NULL").
+		Where("team_memberships.user_id = ? AND organizations.require_two_factor = ?", user.ID, true).
+		Count(&required).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to check organization policies",
+			"message": err.Error(),
+		})
+	}
+	if required > 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "Two-factor authentication required",
+			"message": "An organization you belong to requires two-factor authentication",
+		})
+	}
+
+	twoFactor, err := confirmedTwoFactor(h.db, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error":   "Two-factor authentication not enabled",
+			"message": "Two-factor authentication is not enabled",
+		})
+	}
+
+	if valid, err := verifySecondFactor(h.db, twoFactor, req); err != nil || !valid {
+		if errors.Is(err, errTwoFactorLocked) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":   "Too many attempts",
+				"message": "Too many incorrect codes, try again later",
+			})
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Invalid code",
+			"message": "The code is incorrect or has already been used",
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(twoFactor).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).Update("two_factor_enabled", false).Error
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to disable two-factor authentication",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UpdateTwoFactorPolicyRequest sets whether the active organization
+// requires two-factor authentication
+type UpdateTwoFactorPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// UpdateTwoFactorPolicy requires or stops requiring two-factor
+// authentication for every member of the active organization. Admins must
+// have it enabled to require it, so they keep access.
+func (h *AuthHandler) UpdateTwoFactorPolicy(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+	userSession := c.Locals("session").(storage.Session)
+
+	var req UpdateTwoFactorPolicyRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if req.Required && !user.TwoFactorEnabled {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Two-factor authentication not enabled",
+			"message": "Enable two-factor authentication before requiring it",
+		})
+	}
+
+	result := h.db.Model(&models.Organization{}).
+		Where("id = ?", userSession.ActiveOrganization).
+		Update("require_two_factor", req.Required)
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to update organization",
+			"message": result.Error.Error(),
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Organization not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"require_two_factor": req.Required,
+	})
+}
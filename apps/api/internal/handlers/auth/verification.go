@@ -0,0 +1,420 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/session"
+	"github.com/ted-too/logsicle/internal/crypto"
+	"github.com/ted-too/logsicle/internal/mailer"
+	"github.com/ted-too/logsicle/internal/storage"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+
+	// Tokens of a purpose a user can be sent, at most one per interval and
+	// a limited number per hour
+	verificationInterval = time.Minute
+	verificationsPerHour = 5
+)
+
+var errVerificationRateLimited = errors.New("too many verification emails requested")
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (r VerifyEmailRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Token, validation.Required),
+	)
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (r ForgotPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Email, validation.Required, is.Email),
+	)
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (r ResetPasswordRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Token, validation.Required),
+		validation.Field(&r.Password, validation.Required, validation.Length(8, 0)),
+	)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (r ChangePasswordRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.CurrentPassword, validation.Required),
+		validation.Field(&r.NewPassword, validation.Required, validation.Length(8, 0)),
+	)
+}
+
+// issueVerification creates a single use token for a purpose, enforcing the
+// send rate limit. Used tokens are soft deleted so they still count.
+func issueVerification(tx *gorm.DB, purpose, userID string, ttl time.Duration) (string, error) {
+	identifier := models.VerificationIdentifier(purpose, userID)
+
+	var recent []models.Verification
+	if err := tx.Unscoped().
+		Where("identifier = ? AND created_at > ?", identifier, time.Now().Add(-time.Hour)).
+		Order("created_at DESC").
+		Find(&recent).Error; err != nil {
+		return "", err
+	}
+	if len(recent) >= verificationsPerHour ||
+		(len(recent) > 0 && time.Since(recent[0].CreatedAt) < verificationInterval) {
+		return "", errVerificationRateLimited
+	}
+
+	token := oauth2.GenerateVerifier()
+	verification := models.Verification{
+		Identifier: identifier,
+		Value:      models.HashToken(token),
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	if err := tx.Create(&verification).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// consumeVerification finds the user of an unexpired token and uses up every
+// token of the purpose for that user
+func consumeVerification(tx *gorm.DB, purpose, token string) (string, error) {
+	var verification models.Verification
+	if err := tx.
+		Where("value = ? AND identifier LIKE ? AND expires_at > ?", models.HashToken(token), purpose+":%", time.Now()).
+		First(&verification).Error; err != nil {
+		return "", err
+	}
+
+	if err := tx.Where("identifier = ?", verification.Identifier).Delete(&models.Verification{}).Error; err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(verification.Identifier, purpose+":"), nil
+}
+
+// sendEmailVerification emails a verification link to the user
+func (h *AuthHandler) sendEmailVerification(ctx context.Context, user *models.User) error {
+	token, err := issueVerification(h.db, models.VerificationEmail, user.ID, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.webBaseURL, url.QueryEscape(token))
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in 24 hours.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// sendPasswordReset emails a password reset link to the user
+func (h *AuthHandler) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := issueVerification(h.db, models.VerificationPasswordReset, user.ID, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.webBaseURL, url.QueryEscape(token))
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Hi %s,\n\nReset your password by opening the link below. It expires in 1 hour and can be used once.\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// revokeSessions signs the user out everywhere except one session, which
+// may be empty. Sessions created before now are rejected by the auth
+// middleware, and their records are deleted.
+func revokeSessions(tx *gorm.DB, userID, exceptSessionID string) error {
+	if err := tx.Model(&models.User{}).
+		Where("id = ?", userID).
+		Update("sessions_revoked_at", sql.NullTime{Time: time.Now(), Valid: true}).Error; err != nil {
+		return err
+	}
+	return deleteSessions(tx, userID, exceptSessionID)
+}
+
+// VerifyEmail marks the email of the token's user as verified
+func (h *AuthHandler) VerifyEmail(c fiber.Ctx) error {
+	var req VerifyEmailRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := consumeVerification(tx, models.VerificationEmail, req.Token)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("email_verified", true).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid token",
+				"message": "The verification link is invalid or has expired",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to verify email",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ResendEmailVerification sends the current user a new verification link
+func (h *AuthHandler) ResendEmailVerification(c fiber.Ctx) error {
+	user := c.Locals("user").(*models.User)
+
+	if user.EmailVerified {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Email already verified",
+			"message": "Your email address is already verified",
+		})
+	}
+
+	if err := h.sendEmailVerification(c.Context(), user); err != nil {
+		if errors.Is(err, errVerificationRateLimited) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":   "Too many requests",
+				"message": "Please wait before requesting another verification email",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to send verification email",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the email belongs to a user.
+func (h *AuthHandler) ForgotPassword(c fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ?", strings.ToLower(req.Email)).First(&user).Error; err == nil {
+		if err := h.sendPasswordReset(c.Context(), &user); err != nil && !errors.Is(err, errVerificationRateLimited) {
+			log.Printf("Failed to send password reset to user %s: %v", user.ID, err)
+		}
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// ResetPassword sets a new password with a reset token and signs the user
+// out of every session. Users who only signed in with a provider get a
+// password account. Resetting verifies the email, and when it was not
+// verified yet the provider accounts linked to the user are removed.
+func (h *AuthHandler) ResetPassword(c fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	hashedPassword, err := crypto.HashPassword(req.Password, crypto.DefaultParams)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to hash password",
+			"message": err.Error(),
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		userID, err := consumeVerification(tx, models.VerificationPasswordReset, req.Token)
+		if err != nil {
+			return err
+		}
+
+		if err := setPassword(tx, userID, hashedPassword); err != nil {
+			return err
+		}
+
+		// Following the link proves the user owns the email
+		result := tx.Model(&models.User{}).Where("id = ? AND email_verified = ?", userID, false).Update("email_verified", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		// Accounts linked before the email was verified may belong to
+		// whoever signed up with it, only the owner's new password is kept
+		if result.RowsAffected > 0 {
+			if err := tx.Unscoped().Where("user_id = ? AND provider_id <> ?", userID, models.ProviderPassword).Delete(&models.Account{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return revokeSessions(tx, userID, "")
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":   "Invalid token",
+				"message": "The password reset link is invalid or has expired",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to reset password",
+			"message": err.Error(),
+		})
+	}
+
+	session.FromContext(c).Delete(storage.SessionDataKey)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// ChangePassword changes the current user's password and signs out every
+// other session
+func (h *AuthHandler) ChangePassword(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	currentID, _ := c.Locals("session_id").(string)
+
+	var req ChangePasswordRequest
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	var account models.Account
+	if err := h.db.Where("user_id = ? AND provider_id = ?", userSession.UserID, models.ProviderPassword).First(&account).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "No password set",
+			"message": "Use forgot password to set a password for your account",
+		})
+	}
+
+	match, err := crypto.VerifyPassword(req.CurrentPassword, account.Password)
+	if err != nil || !match {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":   "Invalid credentials",
+			"message": "Current password is incorrect",
+		})
+	}
+
+	hashedPassword, err := crypto.HashPassword(req.NewPassword, crypto.DefaultParams)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to hash password",
+			"message": err.Error(),
+		})
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, userSession.UserID, hashedPassword); err != nil {
+			return err
+		}
+		return revokeSessions(tx, userSession.UserID, currentID)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to change password",
+			"message": err.Error(),
+		})
+	}
+
+	// Keep the current session, created after the revocation
+	userSession.CreatedAt = time.Now()
+	session.FromContext(c).Set(storage.SessionDataKey, userSession)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// setPassword updates the password account of a user, creating it when the
+// user has none
+func setPassword(tx *gorm.DB, userID, hashedPassword string) error {
+	var account models.Account
+	err := tx.Where("user_id = ? AND provider_id = ?", userID, models.ProviderPassword).First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.Account{
+			UserID:     userID,
+			ProviderID: models.ProviderPassword,
+			Password:   hashedPassword,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&account).Update("password", hashedPassword).Error
+}
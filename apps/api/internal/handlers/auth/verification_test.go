@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/storage/models"
+)
+
+func TestResetPasswordRemovesAccountsLinkedBeforeVerification(t *testing.T) {
+	tests := []struct {
+		name         string
+		verified     bool
+		wantAccounts int64
+	}{
+		// Someone signed up with the owner's email and linked their GitHub
+		// account, the owner resetting the password takes the user back
+		{name: "unverified email", verified: false, wantAccounts: 0},
+		{name: "verified email", verified: true, wantAccounts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSSOTest(t)
+			user := s.createUser("jane@gmail.com", tt.verified)
+			s.create(&models.Account{UserID: user.ID, ProviderID: models.ProviderPassword, Password: "hash"})
+			s.create(&models.Account{UserID: user.ID, ProviderID: models.ProviderGitHub, AccountID: "attacker"})
+
+			token, err := issueVerification(s.db, models.VerificationPasswordReset, user.ID, passwordResetTTL)
+			if err != nil {
+				t.Fatalf("issueVerification: %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/v1/auth/reset-password", strings.NewReader(`{"token": "`+token+`", "password": "new password"}`))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			resp, err := s.app.Test(req)
+			if err != nil {
+				t.Fatalf("reset password: %v", err)
+			}
+			if resp.StatusCode != fiber.StatusOK {
+				t.Fatalf("reset status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+			}
+
+			if !s.user("jane@gmail.com").EmailVerified {
+				t.Error("email not verified by the reset")
+			}
+			if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ?", user.ID, models.ProviderGitHub); n != tt.wantAccounts {
+				t.Errorf("user has %d GitHub accounts, want %d", n, tt.wantAccounts)
+			}
+			if n := s.count(&models.Account{}, "user_id = ? AND provider_id = ? AND password <> ?", user.ID, models.ProviderPassword, "hash"); n != 1 {
+				t.Errorf("user has %d reset password accounts, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	timescaleModels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// Maximum accepted size of a single NDJSON line
+	maxLineSize = 10 * 1024 * 1024
+	// Service name used when neither the document nor the index names one
+	defaultServiceName = "elasticsearch"
+	// Longest message accepted by AppLogInput validation
+	maxAppLogMessageLength = 10000
+)
+
+// bulkAction is the metadata line preceding each document, e.g.
+// {"index": {"_index": "filebeat", "_id": "1"}}
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+type bulkItemResult struct {
+	Index   string         `json:"_index"`
+	ID      string         `json:"_id,omitempty"`
+	Version int            `json:"_version,omitempty"`
+	Result  string         `json:"result,omitempty"`
+	Status  int            `json:"status"`
+	Error   *bulkItemError `json:"error,omitempty"`
+}
+
+func itemError(action bulkAction, status int, errType, reason string) bulkItemResult {
+	return bulkItemResult{
+		Index:  action.Index,
+		ID:     action.ID,
+		Status: status,
+		Error:  &bulkItemError{Type: errType, Reason: reason},
+	}
+}
+
+func bulkError(c fiber.Ctx, reason string) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error": fiber.Map{
+			"type":   "illegal_argument_exception",
+			"reason": reason,
+		},
+		"status": fiber.StatusBadRequest,
+	})
+}
+
+// lineReader iterates over the NDJSON lines of a body already in memory
+type lineReader struct {
+	buf []byte
+}
+
+// next returns the next non-empty line
+func (r *lineReader) next() ([]byte, error) {
+	for len(r.buf) > 0 {
+		line := r.buf
+		if i := bytes.IndexByte(r.buf, '\n'); i >= 0 {
+			line, r.buf = r.buf[:i], r.buf[i+1:]
+		} else {
+			r.buf = nil
+		}
+		if len(line) > maxLineSize {
+			return nil, fmt.Errorf("line exceeds %d bytes", maxLineSize)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// parseAction decodes an action line. The returned op is the action name,
+// used as the key of the matching response item.
+func parseAction(line []byte, defaultIndex string) (string, bulkAction, error) {
+	var raw map[string]bulkAction
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return "", bulkAction{}, fmt.Errorf("malformed action/metadata line: %w", err)
+	}
+	if len(raw) != 1 {
+		return "", bulkAction{}, fmt.Errorf("malformed action/metadata line, expected a single action")
+	}
+
+	for op, action := range raw {
+		if action.Index == "" {
+			action.Index = defaultIndex
+		}
+		return op, action, nil
+	}
+	return "", bulkAction{}, nil
+}
+
+// lookupField finds the value at a dotted path, checking flattened keys
+// ("log.level") before nested objects ({"log": {"level": ...}}). When remove
+// is set the value is deleted and emptied parent objects are pruned.
+func lookupField(doc map[string]any, path string, remove bool) (any, bool) {
+	if path == "" {
+		return nil, false
+	}
+	if value, ok := doc[path]; ok {
+		if remove {
+			delete(doc, path)
+		}
+		return value, true
+	}
+
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		child, ok := doc[path[:i]].(map[string]any)
+		if !ok {
+			continue
+		}
+		value, ok := lookupField(child, path[i+1:], remove)
+		if !ok {
+			continue
+		}
+		if remove && len(child) == 0 {
+			delete(doc, path[:i])
+		}
+		return value, true
+	}
+
+	return nil, false
+}
+
+func stringValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		// ECS allows arrays for most keyword fields, use the first value
+		if len(v) > 0 {
+			return stringValue(v[0])
+		}
+		return ""
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+func floatValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// timestampValue converts a document timestamp into a format accepted by
+// ParseTimestamp, keeping sub-second precision for epoch milliseconds
+func timestampValue(value any) any {
+	if f, ok := value.(float64); ok {
+		if f > 1e11 {
+			return time.UnixMilli(int64(f)).Format(time.RFC3339Nano)
+		}
+		return time.Unix(int64(f), 0).Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// durationMillis converts a duration in the configured unit to milliseconds.
+// Sub-millisecond requests are rounded up since a duration is required.
+func durationMillis(value float64, unit string) int64 {
+	switch unit {
+	case "ns":
+		value /= 1e6
+	case "us":
+		value /= 1e3
+	case "s":
+		value *= 1e3
+	}
+	return max(int64(math.Round(value)), 1)
+}
+
+func isAccessLog(doc map[string]any, mapping *models.ElasticsearchMapping) bool {
+	for _, path := range []string{mapping.MethodField, mapping.PathField, mapping.StatusCodeField} {
+		if _, ok := lookupField(doc, path, false); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func toRequestLogInput(projectID string, doc map[string]any, mapping *models.ElasticsearchMapping) (timescaleModels.RequestLogInput, error) {
+	method, _ := lookupField(doc, mapping.MethodField, false)
+	path, _ := lookupField(doc, mapping.PathField, false)
+	statusValue, _ := lookupField(doc, mapping.StatusCodeField, false)
+
+	statusCode, ok := floatValue(statusValue)
+	if !ok {
+		return timescaleModels.RequestLogInput{}, fmt.Errorf("field [%s] is not a number", mapping.StatusCodeField)
+	}
+
+	var duration int64
+	if value, ok := lookupField(doc, mapping.DurationField, false); ok {
+		d, ok := floatValue(value)
+		if !ok {
+			return timescaleModels.RequestLogInput{}, fmt.Errorf("field [%s] is not a number", mapping.DurationField)
+		}
+		duration = durationMillis(d, mapping.DurationUnit)
+	}
+
+	ip, _ := lookupField(doc, mapping.IPAddressField, false)
+	userAgent, _ := lookupField(doc, mapping.UserAgentField, false)
+	host, _ := lookupField(doc, mapping.HostField, false)
+	timestamp, _ := lookupField(doc, mapping.TimestampField, false)
+
+	return timescaleModels.RequestLogInput{
+		ProjectID:  projectID,
+		Method:     strings.ToUpper(stringValue(method)),
+		Path:       stringValue(path),
+		StatusCode: int(statusCode),
+		Duration:   duration,
+		UserAgent:  stringValue(userAgent),
+		IPAddress:  stringValue(ip),
+		Host:       stringValue(host),
+		Timestamp:  timestampValue(timestamp),
+	}, nil
+}
+
+func toAppLogInput(projectID, index string, doc map[string]any, mapping *models.ElasticsearchMapping) (timescaleModels.AppLogInput, error) {
+	messageValue, ok := lookupField(doc, mapping.MessageField, true)
+	if !ok {
+		return timescaleModels.AppLogInput{}, fmt.Errorf("field [%s] is missing", mapping.MessageField)
+	}
+	message := stringValue(messageValue)
+	if runes := []rune(message); len(runes) > maxAppLogMessageLength {
+		message = string(runes[:maxAppLogMessageLength])
+	}
+
+	level := timescaleModels.DetectLogLevel(message)
+	if value, ok := lookupField(doc, mapping.LevelField, true); ok {
+		if normalized, ok := timescaleModels.NormalizeLogLevel(stringValue(value)); ok {
+			level = normalized
+		}
+	}
+
+	serviceName := index
+	if value, ok := lookupField(doc, mapping.ServiceNameField, true); ok && stringValue(value) != "" {
+		serviceName = stringValue(value)
+	}
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	environment, _ := lookupField(doc, mapping.EnvironmentField, true)
+	host, _ := lookupField(doc, mapping.HostField, true)
+	timestamp, _ := lookupField(doc, mapping.TimestampField, true)
+
+	var fields map[string]any
+	if len(doc) > 0 {
+		fields = doc
+	}
+
+	return timescaleModels.AppLogInput{
+		ProjectID:   projectID,
+		Level:       string(level),
+		Message:     message,
+		Fields:      fields,
+		ServiceName: serviceName,
+		Environment: stringValue(environment),
+		Host:        stringValue(host),
+		Timestamp:   timestampValue(timestamp),
+	}, nil
+}
+
+func (h *ElasticsearchHandler) loadMapping(projectID string) (*models.ElasticsearchMapping, error) {
+	var mapping models.ElasticsearchMapping
+	err := h.db.Where("project_id = ?", projectID).First(&mapping).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		mapping = models.DefaultElasticsearchMapping(projectID)
+		return &mapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// indexDocument maps a single document and enqueues it as an app or request log
+func (h *ElasticsearchHandler) indexDocument(c fiber.Ctx, apiKey *models.APIKey, mapping *models.ElasticsearchMapping, action bulkAction, source []byte) bulkItemResult {
+	var doc map[string]any
+	if err := json.Unmarshal(source, &doc); err != nil {
+		return itemError(action, fiber.StatusBadRequest, "mapper_parsing_exception", "failed to parse document: "+err.Error())
+	}
+
+	var (
+		id         string
+		enqueueErr error
+	)
+	if isAccessLog(doc, mapping) {
+		if !slices.Contains(apiKey.Scopes, models.ScopeRequestWrite) {
+			return itemError(action, fiber.StatusForbidden, "security_exception", "API key is missing the "+models.ScopeRequestWrite+" scope")
+		}
+		input, err := toRequestLogInput(apiKey.ProjectID, doc, mapping)
+		if err != nil {
+			return itemError(action, fiber.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		}
+		log, err := input.ValidateAndCreate()
+		if err != nil {
+			return itemError(action, fiber.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		}
+		id = log.ID
+		enqueueErr = h.queue.EnqueueRequestLog(c.Context(), log)
+	} else {
+		if !slices.Contains(apiKey.Scopes, models.ScopeAppLogsWrite) {
+			return itemError(action, fiber.StatusForbidden, "security_exception", "API key is missing the "+models.ScopeAppLogsWrite+" scope")
+		}
+		input, err := toAppLogInput(apiKey.ProjectID, action.Index, doc, mapping)
+		if err != nil {
+			return itemError(action, fiber.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		}
+		log, err := input.ValidateAndCreate()
+		if err != nil {
+			return itemError(action, fiber.StatusBadRequest, "mapper_parsing_exception", err.Error())
+		}
+		id = log.ID
+		enqueueErr = h.queue.EnqueueAppLog(c.Context(), log)
+	}
+
+	if enqueueErr != nil {
+		// 429 tells Beats and Logstash to retry just this item
+		return itemError(action, fiber.StatusTooManyRequests, "es_rejected_execution_exception", enqueueErr.Error())
+	}
+
+	if action.ID == "" {
+		action.ID = id
+	}
+	return bulkItemResult{
+		Index:   action.Index,
+		ID:      action.ID,
+		Version: 1,
+		Result:  "created",
+		Status:  fiber.StatusCreated,
+	}
+}
+
+// Bulk implements the subset of the Elasticsearch bulk API used by log
+// shippers (POST /_bulk, POST /:index/_bulk). Only index and create actions
+// are supported, update and delete are rejected per item.
+func (h *ElasticsearchHandler) Bulk(c fiber.Ctx) error {
+	start := time.Now()
+
+	apiKey, ok := c.Locals("api_key").(*models.APIKey)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get API key",
+		})
+	}
+
+	mapping, err := h.loadMapping(apiKey.ProjectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to load field mapping",
+		})
+	}
+
+	reader := &lineReader{buf: c.Body()}
+	items := make([]map[string]bulkItemResult, 0)
+	hasErrors := false
+
+	for {
+		line, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bulkError(c, err.Error())
+		}
+
+		op, action, err := parseAction(line, c.Params("index"))
+		if err != nil {
+			return bulkError(c, err.Error())
+		}
+
+		var result bulkItemResult
+		switch op {
+		case "index", "create":
+			source, err := reader.next()
+			if err != nil {
+				return bulkError(c, "action/metadata line is missing its source")
+			}
+			result = h.indexDocument(c, apiKey, mapping, action, source)
+		case "update":
+			// Consume the partial document so the next action lines up
+			if _, err := reader.next(); err != nil {
+				return bulkError(c, "action/metadata line is missing its source")
+			}
+			result = itemError(action, fiber.StatusBadRequest, "illegal_argument_exception", "update is not supported")
+		case "delete":
+			result = itemError(action, fiber.StatusBadRequest, "illegal_argument_exception", "delete is not supported")
+		default:
+			return bulkError(c, fmt.Sprintf("malformed action/metadata line, unknown action [%s]", op))
+		}
+
+		if result.Error != nil {
+			hasErrors = true
+		}
+		items = append(items, map[string]bulkItemResult{op: result})
+	}
+
+	return c.JSON(fiber.Map{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": hasErrors,
+		"items":  items,
+	})
+}
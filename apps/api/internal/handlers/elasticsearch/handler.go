@@ -0,0 +1,18 @@
+package elasticsearch
+
+import (
+	"github.com/ted-too/logsicle/internal/queue"
+	"gorm.io/gorm"
+)
+
+type ElasticsearchHandler struct {
+	db    *gorm.DB
+	queue *queue.QueueService
+}
+
+func NewElasticsearchHandler(db *gorm.DB, queue *queue.QueueService) *ElasticsearchHandler {
+	return &ElasticsearchHandler{
+		db:    db,
+		queue: queue,
+	}
+}
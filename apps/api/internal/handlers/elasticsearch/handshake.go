@@ -0,0 +1,78 @@
+package elasticsearch
+
+import (
+	"github.com/gofiber/fiber/v3"
+)
+
+// Version reported to clients. Beats, Logstash and the official clients
+// refuse to talk to clusters that do not look like a supported release.
+const (
+	clusterName    = "logsicle"
+	clusterVersion = "8.11.0"
+	luceneVersion  = "9.8.0"
+)
+
+// ProductHeader marks every response as coming from Elasticsearch, which the
+// official clients (7.14+) verify before sending any data
+func (h *ElasticsearchHandler) ProductHeader(c fiber.Ctx) error {
+	c.Set("X-Elastic-Product", "Elasticsearch")
+	return c.Next()
+}
+
+// Info answers the root endpoint clients probe on startup (GET/HEAD /)
+func (h *ElasticsearchHandler) Info(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"name":         clusterName,
+		"cluster_name": clusterName,
+		"cluster_uuid": clusterName,
+		"version": fiber.Map{
+			"number":                              clusterVersion,
+			"build_flavor":                        "default",
+			"build_type":                          "docker",
+			"lucene_version":                      luceneVersion,
+			"minimum_wire_compatibility_version":  "7.17.0",
+			"minimum_index_compatibility_version": "7.0.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// License reports an active basic license (GET /_license)
+func (h *ElasticsearchHandler) License(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"license": fiber.Map{
+			"status": "active",
+			"uid":    clusterName,
+			"type":   "basic",
+			"mode":   "basic",
+		},
+	})
+}
+
+// XPack reports that no x-pack features are available (GET /_xpack)
+func (h *ElasticsearchHandler) XPack(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"build": fiber.Map{
+			"hash": "",
+			"date": "",
+		},
+		"license": fiber.Map{
+			"uid":    clusterName,
+			"type":   "basic",
+			"mode":   "basic",
+			"status": "active",
+		},
+		"features": fiber.Map{},
+	})
+}
+
+// ResourceNotFound answers existence checks for index templates and ILM
+// policies. Logsicle has no such resources, so clients go on to create them.
+func (h *ElasticsearchHandler) ResourceNotFound(c fiber.Ctx) error {
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{})
+}
+
+// Acknowledge accepts and discards index template and ILM policy uploads
+func (h *ElasticsearchHandler) Acknowledge(c fiber.Ctx) error {
+	return c.JSON(fiber.Map{"acknowledged": true})
+}
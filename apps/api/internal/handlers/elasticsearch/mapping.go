@@ -0,0 +1,110 @@
+package elasticsearch
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+)
+
+type UpdateMappingInput struct {
+	TimestampField   *string `json:"timestamp_field"`
+	MessageField     *string `json:"message_field"`
+	LevelField       *string `json:"level_field"`
+	ServiceNameField *string `json:"service_name_field"`
+	EnvironmentField *string `json:"environment_field"`
+	HostField        *string `json:"host_field"`
+	MethodField      *string `json:"method_field"`
+	PathField        *string `json:"path_field"`
+	StatusCodeField  *string `json:"status_code_field"`
+	DurationField    *string `json:"duration_field"`
+	DurationUnit     *string `json:"duration_unit"`
+	IPAddressField   *string `json:"ip_address_field"`
+	UserAgentField   *string `json:"user_agent_field"`
+}
+
+func (u UpdateMappingInput) Validate() error {
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.TimestampField, validation.Length(0, 255)),
+		validation.Field(&u.MessageField, validation.NilOrNotEmpty, validation.Length(1, 255)),
+		validation.Field(&u.LevelField, validation.Length(0, 255)),
+		validation.Field(&u.ServiceNameField, validation.Length(0, 255)),
+		validation.Field(&u.EnvironmentField, validation.Length(0, 255)),
+		validation.Field(&u.HostField, validation.Length(0, 255)),
+		validation.Field(&u.MethodField, validation.Length(0, 255)),
+		validation.Field(&u.PathField, validation.Length(0, 255)),
+		validation.Field(&u.StatusCodeField, validation.Length(0, 255)),
+		validation.Field(&u.DurationField, validation.Length(0, 255)),
+		validation.Field(&u.DurationUnit, validation.In("ns", "us", "ms", "s")),
+		validation.Field(&u.IPAddressField, validation.Length(0, 255)),
+		validation.Field(&u.UserAgentField, validation.Length(0, 255)),
+	)
+}
+
+// GetMapping returns the project's bulk API field mapping, or the defaults
+// when none has been configured
+func (h *ElasticsearchHandler) GetMapping(c fiber.Ctx) error {
+	mapping, err := h.loadMapping(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch field mapping",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(mapping)
+}
+
+// UpdateMapping creates or updates the project's bulk API field mapping.
+// Omitted fields keep their current value.
+func (h *ElasticsearchHandler) UpdateMapping(c fiber.Ctx) error {
+	input := new(UpdateMappingInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	mapping, err := h.loadMapping(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch field mapping",
+			"error":   err.Error(),
+		})
+	}
+
+	for dst, src := range map[*string]*string{
+		&mapping.TimestampField:   input.TimestampField,
+		&mapping.MessageField:     input.MessageField,
+		&mapping.LevelField:       input.LevelField,
+		&mapping.ServiceNameField: input.ServiceNameField,
+		&mapping.EnvironmentField: input.EnvironmentField,
+		&mapping.HostField:        input.HostField,
+		&mapping.MethodField:      input.MethodField,
+		&mapping.PathField:        input.PathField,
+		&mapping.StatusCodeField:  input.StatusCodeField,
+		&mapping.DurationField:    input.DurationField,
+		&mapping.DurationUnit:     input.DurationUnit,
+		&mapping.IPAddressField:   input.IPAddressField,
+		&mapping.UserAgentField:   input.UserAgentField,
+	} {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	if err := h.db.Save(mapping).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update field mapping",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(mapping)
+}
@@ -2,13 +2,16 @@ package events
 
 import (
 	"database/sql"
+	"fmt"
 	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/gofiber/fiber/v3"
 	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/jsonschema"
 	"github.com/ted-too/logsicle/internal/storage"
 	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
 	"gorm.io/gorm"
 )
 
@@ -40,6 +43,29 @@ type CreateEventChannelInput struct {
 	MetadataSchema *string  `json:"metadata_schema"`
 }
 
+// validateMetadataSchema checks that a metadata schema is a JSON Schema
+// document ingest can enforce. An empty string clears the schema.
+func validateMetadataSchema(value interface{}) error {
+	schema, _ := value.(*string)
+	if schema == nil || *schema == "" {
+		return nil
+	}
+	if _, err := jsonschema.Compile([]byte(*schema)); err != nil {
+		return fmt.Errorf("invalid JSON Schema: %w", err)
+	}
+	return nil
+}
+
+func (c CreateEventChannelInput) Validate() error {
+	if err := c.CreateChannelInput.Validate(); err != nil {
+		return err
+	}
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.RequiredTags, validation.Each(validation.Length(1, 50))),
+		validation.Field(&c.MetadataSchema, validation.By(validateMetadataSchema)),
+	)
+}
+
 func (c CreateEventChannelInput) ValidateAndCreate(projectID string) (*models.EventChannel, error) {
 	if err := c.Validate(); err != nil {
 		return nil, err
@@ -75,7 +101,7 @@ func (c CreateEventChannelInput) ValidateAndCreate(projectID string) (*models.Ev
 		}
 	}
 	var metadataSchema sql.NullString
-	if c.MetadataSchema != nil {
+	if c.MetadataSchema != nil && *c.MetadataSchema != "" {
 		metadataSchema = sql.NullString{
 			String: *c.MetadataSchema,
 			Valid:  true,
@@ -150,7 +176,7 @@ func (h *EventsHandler) CreateChannel(c fiber.Ctx) error {
 
 func (h *EventsHandler) DeleteChannel(c fiber.Ctx) error {
 	projectID := c.Params("id")
-	channelID := c.Params("id")
+	channelID := c.Params("channelId")
 
 	result := h.db.Unscoped().Where("id = ? AND project_id = ?", channelID, projectID).Delete(&models.EventChannel{})
 	if result.Error != nil {
@@ -195,9 +221,25 @@ type UpdateEventChannelInput struct {
 	MetadataSchema *string   `json:"metadata_schema"`
 }
 
+func (u UpdateEventChannelInput) Validate() error {
+	if err := u.UpdateChannelInput.Validate(); err != nil {
+		return err
+	}
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.RequiredTags, validation.By(func(value interface{}) error {
+			tags, _ := value.(*[]string)
+			if tags == nil {
+				return nil
+			}
+			return validation.Validate(*tags, validation.Each(validation.Length(1, 50)))
+		})),
+		validation.Field(&u.MetadataSchema, validation.By(validateMetadataSchema)),
+	)
+}
+
 func (h *EventsHandler) UpdateChannel(c fiber.Ctx) error {
 	projectID := c.Params("id")
-	channelID := c.Params("id")
+	channelID := c.Params("channelId")
 
 	var project models.Project
 	if err := h.db.Where("id = ?", projectID).First(&project).Error; err != nil {
@@ -264,7 +306,7 @@ func (h *EventsHandler) UpdateChannel(c fiber.Ctx) error {
 		channel.RequiredTags = *input.RequiredTags
 	}
 	if input.MetadataSchema != nil {
-		channel.MetadataSchema = sql.NullString{String: *input.MetadataSchema, Valid: true}
+		channel.MetadataSchema = sql.NullString{String: *input.MetadataSchema, Valid: *input.MetadataSchema != ""}
 	}
 
 	if err := h.db.Save(&channel).Error; err != nil {
@@ -311,3 +353,75 @@ func (h *EventsHandler) GetEventChannel(c fiber.Ctx) error {
 
 	return c.JSON(channel)
 }
+
+// ValidateSampleInput checks a sample event against a channel. When
+// metadata_schema or required_tags are set they replace the channel's own,
+// so changes can be tried before they are saved.
+type ValidateSampleInput struct {
+	Event          tsmodels.EventLogInput `json:"event"`
+	RequiredTags   *[]string              `json:"required_tags"`
+	MetadataSchema *string                `json:"metadata_schema"`
+}
+
+// ValidateSample reports whether a sample event would be accepted by the
+// channel, with every required tag and metadata schema failure
+func (h *EventsHandler) ValidateSample(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	channelID := c.Params("channelId")
+
+	input := new(ValidateSampleInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	var channel models.EventChannel
+	if err := h.db.Where("id = ? AND project_id = ?", channelID, projectID).First(&channel).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Channel not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch channel",
+			"error":   err.Error(),
+		})
+	}
+
+	rules := &channelRules{requiredTags: channel.RequiredTags}
+	if input.RequiredTags != nil {
+		rules.requiredTags = *input.RequiredTags
+	}
+
+	schema := channel.MetadataSchema.String
+	if input.MetadataSchema != nil {
+		schema = *input.MetadataSchema
+	}
+	if schema != "" {
+		compiled, err := jsonschema.Compile([]byte(schema))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid metadata schema",
+				"error":   err.Error(),
+			})
+		}
+		rules.schema = compiled
+	}
+
+	input.Event.ProjectID = projectID
+
+	var errs jsonschema.ValidationErrors
+	if _, err := input.Event.ValidateAndCreate(channelID); err != nil {
+		errs = append(errs, jsonschema.ValidationError{Message: err.Error()})
+	}
+	if err := rules.check(&input.Event); err != nil {
+		errs = append(errs, channelErrors(err)...)
+	}
+
+	return c.JSON(fiber.Map{
+		"valid":  len(errs) == 0,
+		"errors": errs,
+	})
+}
@@ -7,15 +7,17 @@ import (
 )
 
 type EventsHandler struct {
-	db   *gorm.DB
-	pool *pgxpool.Pool
-	qs   *queue.QueueService
+	db      *gorm.DB
+	pool    *pgxpool.Pool
+	qs      *queue.QueueService
+	schemas *schemaCache
 }
 
 func NewEventsHandler(db *gorm.DB, pool *pgxpool.Pool, qs *queue.QueueService) *EventsHandler {
 	return &EventsHandler{
-		db:   db,
-		pool: pool,
-		qs:   qs,
+		db:      db,
+		pool:    pool,
+		qs:      qs,
+		schemas: &schemaCache{},
 	}
 }
@@ -1,7 +1,11 @@
 package events
 
 import (
+	"encoding/json"
+	"errors"
+
 	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/jsonschema"
 	"github.com/ted-too/logsicle/internal/server"
 	"github.com/ted-too/logsicle/internal/storage/timescale/models"
 )
@@ -17,11 +21,23 @@ func (h *EventsHandler) IngestEvent(c fiber.Ctx) error {
 		return server.SendError(c, fiber.NewError(fiber.StatusInternalServerError, "Failed to get channel ID"))
 	}
 
+	rules, err := h.loadChannelRules(c.Context(), channelID)
+	if err != nil {
+		return server.SendError(c, err, fiber.StatusInternalServerError)
+	}
+
 	log, err := input.ValidateAndCreate(channelID)
 	if err != nil {
 		return server.SendError(c, err, fiber.StatusBadRequest)
 	}
 
+	if err := rules.check(input); err != nil {
+		return server.SendResponse(c, fiber.Map{
+			"message": err.Error(),
+			"errors":  channelErrors(err),
+		}, fiber.StatusBadRequest)
+	}
+
 	if err := h.qs.EnqueueEventLog(c.Context(), log); err != nil {
 		return server.SendError(c, err, fiber.StatusInternalServerError)
 	}
@@ -29,10 +45,22 @@ func (h *EventsHandler) IngestEvent(c fiber.Ctx) error {
 	return server.SendResponse(c, nil, fiber.StatusAccepted)
 }
 
+// channelErrors returns the individual failures of a channel validation
+// error
+func channelErrors(err error) jsonschema.ValidationErrors {
+	var channelErr *ChannelValidationError
+	if errors.As(err, &channelErr) {
+		return channelErr.Errors
+	}
+	return nil
+}
+
 type IngestBatchEventErrorResponse struct {
 	Id    string               `json:"id"`
 	Input models.EventLogInput `json:"input"`
 	server.ErrorResponse
+	// Individual required tag and metadata schema failures
+	Errors jsonschema.ValidationErrors `json:"errors,omitempty"`
 }
 
 type IngestBatchEventData struct {
@@ -45,6 +73,10 @@ type IngestBatchEventBody struct {
 }
 
 func (h *EventsHandler) IngestBatchEvent(c fiber.Ctx) error {
+	if server.IsNDJSON(c) {
+		return h.ingestBatchNDJSON(c)
+	}
+
 	input := new(IngestBatchEventBody)
 	if err := c.Bind().JSON(input); err != nil {
 		return server.SendError(c, err)
@@ -55,11 +87,19 @@ func (h *EventsHandler) IngestBatchEvent(c fiber.Ctx) error {
 		return server.SendError(c, fiber.NewError(fiber.StatusInternalServerError, "Failed to get channel ID"))
 	}
 
+	rules, err := h.loadChannelRules(c.Context(), channelID)
+	if err != nil {
+		return server.SendError(c, err, fiber.StatusInternalServerError)
+	}
+
 	processed := 0
 	var failed []IngestBatchEventErrorResponse
 
 	for _, input := range input.Data {
 		log, err := input.Data.ValidateAndCreate(channelID)
+		if err == nil {
+			err = rules.check(&input.Data)
+		}
 		if err != nil {
 			failed = append(failed, IngestBatchEventErrorResponse{
 				Id:    input.Id,
@@ -68,6 +108,7 @@ func (h *EventsHandler) IngestBatchEvent(c fiber.Ctx) error {
 					Message: err.Error(),
 					Code:    fiber.StatusBadRequest,
 				},
+				Errors: channelErrors(err),
 			})
 			continue
 		}
@@ -92,3 +133,46 @@ func (h *EventsHandler) IngestBatchEvent(c fiber.Ctx) error {
 		"failed":    failed,
 	}, fiber.StatusAccepted)
 }
+
+// ingestBatchNDJSON ingests an application/x-ndjson body with one
+// EventLogInput per line, reporting rejected lines by line number
+func (h *EventsHandler) ingestBatchNDJSON(c fiber.Ctx) error {
+	projectID, ok := c.Locals("project_id").(string)
+	if !ok {
+		return server.SendError(c, fiber.NewError(fiber.StatusInternalServerError, "Failed to get project ID"), fiber.StatusInternalServerError)
+	}
+
+	channelID, ok := c.Locals("channel_id").(string)
+	if !ok {
+		return server.SendError(c, fiber.NewError(fiber.StatusInternalServerError, "Failed to get channel ID"), fiber.StatusInternalServerError)
+	}
+
+	rules, err := h.loadChannelRules(c.Context(), channelID)
+	if err != nil {
+		return server.SendError(c, err, fiber.StatusInternalServerError)
+	}
+
+	return server.IngestNDJSON(c, func(line []byte) (int, error) {
+		var input models.EventLogInput
+		if err := json.Unmarshal(line, &input); err != nil {
+			return fiber.StatusBadRequest, err
+		}
+		if err := server.MatchProject(&input.ProjectID, projectID); err != nil {
+			return fiber.StatusForbidden, err
+		}
+
+		log, err := input.ValidateAndCreate(channelID)
+		if err != nil {
+			return fiber.StatusBadRequest, err
+		}
+		if err := rules.check(&input); err != nil {
+			return fiber.StatusBadRequest, err
+		}
+
+		if err := h.qs.EnqueueEventLog(c.Context(), log); err != nil {
+			return fiber.StatusInternalServerError, err
+		}
+
+		return 0, nil
+	})
+}
@@ -0,0 +1,126 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/jsonschema"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// ChannelValidationError reports every way an event breaks its channel's
+// required tags and metadata schema
+type ChannelValidationError struct {
+	Errors jsonschema.ValidationErrors
+}
+
+func (e *ChannelValidationError) Error() string {
+	return "event does not match channel rules: " + e.Errors.Error()
+}
+
+// channelRules are the ingest checks of an event channel
+type channelRules struct {
+	requiredTags []string
+	schema       *jsonschema.Schema
+}
+
+type cachedSchema struct {
+	updatedAt time.Time
+	schema    *jsonschema.Schema
+}
+
+// schemaCache keeps compiled metadata schemas until their channel changes
+type schemaCache struct {
+	mu      sync.Mutex
+	schemas map[string]cachedSchema
+}
+
+func (s *schemaCache) get(channel *models.EventChannel) (*jsonschema.Schema, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.schemas[channel.ID]; ok && cached.updatedAt.Equal(channel.UpdatedAt) {
+		return cached.schema, nil
+	}
+
+	schema, err := jsonschema.Compile([]byte(channel.MetadataSchema.String))
+	if err != nil {
+		return nil, err
+	}
+	if s.schemas == nil {
+		s.schemas = make(map[string]cachedSchema)
+	}
+	s.schemas[channel.ID] = cachedSchema{updatedAt: channel.UpdatedAt, schema: schema}
+	return schema, nil
+}
+
+// loadChannelRules fetches the rules events ingested into a channel must
+// follow. Events without a channel have none.
+func (h *EventsHandler) loadChannelRules(ctx context.Context, channelID string) (*channelRules, error) {
+	if channelID == "" {
+		return &channelRules{}, nil
+	}
+
+	var channel models.EventChannel
+	if err := h.db.WithContext(ctx).Where("id = ?", channelID).First(&channel).Error; err != nil {
+		return nil, fmt.Errorf("failed to load event channel: %w", err)
+	}
+
+	rules := &channelRules{requiredTags: channel.RequiredTags}
+	if channel.MetadataSchema.Valid && channel.MetadataSchema.String != "" {
+		schema, err := h.schemas.get(&channel)
+		if err != nil {
+			return nil, fmt.Errorf("event channel has an invalid metadata schema: %w", err)
+		}
+		rules.schema = schema
+	}
+	return rules, nil
+}
+
+// hasTag reports whether tags satisfy a required tag, either exactly or as
+// the key of a "key:value" tag
+func hasTag(tags []string, required string) bool {
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return tag == required || strings.HasPrefix(tag, required+":")
+	})
+}
+
+// check validates an event against the channel, returning a
+// *ChannelValidationError listing every problem
+func (r *channelRules) check(input *tsmodels.EventLogInput) error {
+	var errs jsonschema.ValidationErrors
+
+	for _, required := range r.requiredTags {
+		if !hasTag(input.Tags, required) {
+			errs = append(errs, jsonschema.ValidationError{
+				Path:    "/tags",
+				Message: fmt.Sprintf("missing required tag %q", required),
+			})
+		}
+	}
+
+	if r.schema != nil {
+		// A missing metadata object is validated as empty so required
+		// properties are reported
+		var metadata any = map[string]any{}
+		if input.Metadata != nil {
+			metadata = input.Metadata
+		}
+		if err := r.schema.Validate(metadata); err != nil {
+			for _, e := range err.(jsonschema.ValidationErrors) {
+				e.Path = "/metadata" + e.Path
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ChannelValidationError{Errors: errs}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package issues
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gorm.io/gorm"
+)
+
+type IssuesHandler struct {
+	db   *gorm.DB
+	pool *pgxpool.Pool
+}
+
+func NewIssuesHandler(db *gorm.DB, pool *pgxpool.Pool) *IssuesHandler {
+	return &IssuesHandler{
+		db:   db,
+		pool: pool,
+	}
+}
@@ -0,0 +1,292 @@
+package issues
+
+import (
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/issues"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"github.com/ted-too/logsicle/internal/storage/timescale"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// Number of latest events returned with an issue
+const recentEventsLimit = 10
+
+var issueSorts = map[string]string{
+	"last_seen":  "last_seen DESC",
+	"first_seen": "first_seen DESC",
+	"count":      "count DESC, last_seen DESC",
+}
+
+type ListIssuesQuery struct {
+	Status      *string `query:"status"`
+	Environment *string `query:"environment"`
+	Version     *string `query:"version"`
+	Search      *string `query:"search"`
+	Sort        string  `query:"sort"`
+	Limit       int     `query:"limit"`
+	Page        int     `query:"page"`
+}
+
+func (q *ListIssuesQuery) SetDefaults() {
+	if q.Sort == "" {
+		q.Sort = "last_seen"
+	}
+	if q.Limit == 0 {
+		q.Limit = 20
+	} else if q.Limit > 100 {
+		q.Limit = 100
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+}
+
+func (q ListIssuesQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Status, validation.In(models.IssueStatuses...)),
+		validation.Field(&q.Sort, validation.In("last_seen", "first_seen", "count")),
+		validation.Field(&q.Limit, validation.Required, validation.Min(1), validation.Max(100)),
+		validation.Field(&q.Page, validation.Required, validation.Min(1)),
+	)
+}
+
+type IssuesResponse struct {
+	Data []models.Issue           `json:"data"`
+	Meta timescale.PaginationMeta `json:"meta"`
+}
+
+// ListIssues returns a project's issues, most recently seen first by default
+func (h *IssuesHandler) ListIssues(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	query := new(ListIssuesQuery)
+	if err := c.Bind().Query(query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid query parameters",
+			"error":   err.Error(),
+		})
+	}
+
+	query.SetDefaults()
+
+	if err := query.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Query parameters validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	base := h.db.Model(&models.Issue{}).Where("project_id = ?", projectID)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to count issues",
+			"error":   err.Error(),
+		})
+	}
+
+	filtered := base.Session(&gorm.Session{})
+	if query.Status != nil {
+		filtered = filtered.Where("status = ?", *query.Status)
+	}
+	if query.Environment != nil {
+		filtered = filtered.Where("? = ANY(environments)", *query.Environment)
+	}
+	if query.Version != nil {
+		filtered = filtered.Where("? = ANY(versions)", *query.Version)
+	}
+	if query.Search != nil {
+		search := "%" + *query.Search + "%"
+		filtered = filtered.Where("(type ILIKE ? OR value ILIKE ? OR culprit ILIKE ?)", search, search, search)
+	}
+
+	var filteredCount int64
+	if err := filtered.Count(&filteredCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to count issues",
+			"error":   err.Error(),
+		})
+	}
+
+	issueList := make([]models.Issue, 0)
+	if err := filtered.
+		Order(issueSorts[query.Sort]).
+		Limit(query.Limit).
+		Offset((query.Page - 1) * query.Limit).
+		Find(&issueList).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch issues",
+			"error":   err.Error(),
+		})
+	}
+
+	totalPages := (int(filteredCount) + query.Limit - 1) / query.Limit
+	var nextPage *int
+	var prevPage *int
+	if query.Page < totalPages {
+		next := query.Page + 1
+		nextPage = &next
+	}
+	if query.Page > 1 {
+		prev := query.Page - 1
+		prevPage = &prev
+	}
+
+	return c.JSON(IssuesResponse{
+		Data: issueList,
+		Meta: timescale.PaginationMeta{
+			TotalRowCount:         int(total),
+			TotalFilteredRowCount: int(filteredCount),
+			CurrentPage:           query.Page,
+			NextPage:              nextPage,
+			PrevPage:              prevPage,
+		},
+	})
+}
+
+func (h *IssuesHandler) findIssue(c fiber.Ctx) (*models.Issue, error) {
+	var issue models.Issue
+	if err := h.db.Where("id = ? AND project_id = ?", c.Params("issueId"), c.Params("id")).First(&issue).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Issue not found",
+			})
+		}
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch issue",
+			"error":   err.Error(),
+		})
+	}
+	return &issue, nil
+}
+
+// GetIssue returns an issue with its latest events
+func (h *IssuesHandler) GetIssue(c fiber.Ctx) error {
+	issue, err := h.findIssue(c)
+	if issue == nil {
+		return err
+	}
+
+	rows, err := h.pool.Query(c.Context(), `
+		SELECT
+			al.id, al.project_id, al.level, al.message,
+			al.fields, al.timestamp, al.caller, al.function,
+			al.service_name, al.version, al.environment, al.host,
+			al.exception, al.issue_id, al.trace_id, al.span_id
+		FROM app_logs al
+		WHERE al.project_id = $1 AND al.issue_id = $2
+		ORDER BY al.timestamp DESC
+		LIMIT $3`,
+		issue.ProjectID, issue.ID, recentEventsLimit,
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch issue events",
+			"error":   err.Error(),
+		})
+	}
+	defer rows.Close()
+
+	events := make([]tsmodels.AppLog, 0)
+	for rows.Next() {
+		var log tsmodels.AppLog
+		if err := rows.Scan(
+			&log.ID, &log.ProjectID, &log.Level, &log.Message,
+			&log.Fields, &log.Timestamp, &log.Caller, &log.Function,
+			&log.ServiceName, &log.Version, &log.Environment, &log.Host,
+			&log.Exception, &log.IssueID, &log.TraceID, &log.SpanID,
+		); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to scan issue events",
+				"error":   err.Error(),
+			})
+		}
+		events = append(events, log)
+	}
+	if err := rows.Err(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch issue events",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"issue":         issue,
+		"recent_events": events,
+	})
+}
+
+type UpdateIssueInput struct {
+	Status string `json:"status"`
+	// Version the issue is fixed in, defaults to the latest version it was
+	// seen in. Only occurrences in newer versions reopen the issue.
+	ResolvedInVersion *string `json:"resolved_in_version"`
+}
+
+func (i UpdateIssueInput) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Status, validation.Required, validation.In(models.IssueStatuses...)),
+		validation.Field(&i.ResolvedInVersion, validation.Length(0, 255)),
+	)
+}
+
+// latestVersion returns the newest of versions, nil when there are none
+func latestVersion(versions []string) *string {
+	var latest *string
+	for i := range versions {
+		if latest == nil || issues.CompareVersions(versions[i], *latest) > 0 {
+			latest = &versions[i]
+		}
+	}
+	return latest
+}
+
+// UpdateIssue changes the status of an issue
+func (h *IssuesHandler) UpdateIssue(c fiber.Ctx) error {
+	input := new(UpdateIssueInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	issue, err := h.findIssue(c)
+	if issue == nil {
+		return err
+	}
+
+	issue.Status = input.Status
+	if input.Status == models.IssueStatusResolved {
+		now := time.Now()
+		issue.ResolvedAt = &now
+		issue.ResolvedInVersion = input.ResolvedInVersion
+		if issue.ResolvedInVersion == nil || *issue.ResolvedInVersion == "" {
+			issue.ResolvedInVersion = latestVersion(issue.Versions)
+		}
+	} else {
+		issue.ResolvedAt = nil
+		issue.ResolvedInVersion = nil
+	}
+
+	if err := h.db.Model(issue).Select("status", "resolved_at", "resolved_in_version", "updated_at").Updates(issue).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update issue",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(issue)
+}
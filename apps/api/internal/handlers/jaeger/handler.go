@@ -0,0 +1,18 @@
+package jaeger
+
+import (
+	"github.com/ted-too/logsicle/internal/queue"
+	"gorm.io/gorm"
+)
+
+type JaegerHandler struct {
+	db    *gorm.DB
+	queue *queue.QueueService
+}
+
+func NewJaegerHandler(db *gorm.DB, queue *queue.QueueService) *JaegerHandler {
+	return &JaegerHandler{
+		db:    db,
+		queue: queue,
+	}
+}
@@ -0,0 +1,219 @@
+package jaeger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/server"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Span name used when a span has no operation name
+	defaultSpanName = "unknown"
+	// Event name used for span logs without an "event" field
+	defaultEventName = "log"
+)
+
+// Values of the span.kind tag
+var spanKinds = map[string]models.SpanKind{
+	"client":   models.SpanKindClient,
+	"server":   models.SpanKindServer,
+	"producer": models.SpanKindProducer,
+	"consumer": models.SpanKindConsumer,
+	"internal": models.SpanKindInternal,
+}
+
+func formatTraceID(low, high int64) string {
+	if high == 0 {
+		return fmt.Sprintf("%016x", uint64(low))
+	}
+	return fmt.Sprintf("%016x%016x", uint64(high), uint64(low))
+}
+
+func formatSpanID(id int64) string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+func tagsToMap(tags []Tag) map[string]any {
+	m := make(map[string]any, len(tags))
+	for _, tag := range tags {
+		m[tag.Key] = tag.Value
+	}
+	return m
+}
+
+// spanStatus derives the span status from the "error" tag, falling back to
+// the tags OpenTelemetry exporters add. Consumed tags are removed.
+func spanStatus(tags map[string]any) (models.SpanStatus, string) {
+	code, _ := tags["otel.status_code"].(string)
+	message, _ := tags["otel.status_description"].(string)
+	delete(tags, "otel.status_code")
+	delete(tags, "otel.status_description")
+
+	if value, ok := tags["error"]; ok {
+		delete(tags, "error")
+		if value == true || value == "true" {
+			return models.SpanStatusError, message
+		}
+	}
+
+	switch strings.ToUpper(code) {
+	case "ERROR":
+		return models.SpanStatusError, message
+	case "OK":
+		return models.SpanStatusOk, ""
+	default:
+		return models.SpanStatusUnset, ""
+	}
+}
+
+func toTraceInput(projectID string, process Process, span Span) (models.TraceInput, error) {
+	traceID := models.NormalizeTraceID(formatTraceID(span.TraceIDLow, span.TraceIDHigh))
+	if traceID == "" {
+		return models.TraceInput{}, fmt.Errorf("span has no trace ID")
+	}
+	spanID := models.NormalizeSpanID(formatSpanID(span.SpanID))
+	if spanID == "" {
+		return models.TraceInput{}, fmt.Errorf("span has no span ID")
+	}
+
+	// Newer clients only send the parent as a CHILD_OF reference, any other
+	// reference becomes a link
+	parentID := models.NormalizeSpanID(formatSpanID(span.ParentSpanID))
+	var links []models.TraceLink
+	for _, ref := range span.References {
+		refTraceID := formatTraceID(ref.TraceIDLow, ref.TraceIDHigh)
+		refSpanID := formatSpanID(ref.SpanID)
+		if ref.RefType == refChildOf && refTraceID == traceID && (parentID == "" || parentID == refSpanID) {
+			parentID = models.NormalizeSpanID(refSpanID)
+			continue
+		}
+
+		refType := "child_of"
+		if ref.RefType == refFollowsFrom {
+			refType = "follows_from"
+		}
+		links = append(links, models.TraceLink{
+			TraceID:    refTraceID,
+			SpanID:     refSpanID,
+			Attributes: models.ConvertToJSONB(map[string]any{"jaeger.ref_type": refType}),
+		})
+	}
+
+	name := span.OperationName
+	if name == "" {
+		name = defaultSpanName
+	}
+
+	attributes := tagsToMap(span.Tags)
+	kind := models.SpanKindUnspecified
+	if value, ok := attributes["span.kind"].(string); ok {
+		if k, ok := spanKinds[strings.ToLower(value)]; ok {
+			kind = k
+			delete(attributes, "span.kind")
+		}
+	}
+	status, statusMessage := spanStatus(attributes)
+
+	resourceAttributes := tagsToMap(process.Tags)
+	resourceAttributes["service.name"] = process.ServiceName
+	serviceVersion, _ := resourceAttributes["service.version"].(string)
+
+	var events []models.TraceEvent
+	for _, log := range span.Logs {
+		fields := tagsToMap(log.Fields)
+		eventName := defaultEventName
+		if value, ok := fields["event"].(string); ok && value != "" {
+			eventName = value
+			delete(fields, "event")
+		}
+		var eventAttributes models.JSONB
+		if len(fields) > 0 {
+			eventAttributes = models.ConvertToJSONB(fields)
+		}
+		events = append(events, models.TraceEvent{
+			Name:       eventName,
+			Timestamp:  time.UnixMicro(log.Timestamp),
+			Attributes: eventAttributes,
+		})
+	}
+
+	start := time.UnixMicro(span.StartTime)
+
+	return models.TraceInput{
+		ProjectID:          projectID,
+		TraceID:            traceID,
+		SpanID:             spanID,
+		ParentID:           parentID,
+		Name:               name,
+		Kind:               string(kind),
+		StartTime:          start,
+		EndTime:            start.Add(time.Duration(span.Duration) * time.Microsecond),
+		Status:             string(status),
+		StatusMessage:      statusMessage,
+		ServiceName:        process.ServiceName,
+		ServiceVersion:     serviceVersion,
+		Attributes:         attributes,
+		Events:             events,
+		Links:              links,
+		ResourceAttributes: resourceAttributes,
+	}, nil
+}
+
+func toTrace(projectID string, process Process, span Span) (*models.Trace, error) {
+	input, err := toTraceInput(projectID, process, span)
+	if err != nil {
+		return nil, err
+	}
+	return input.ValidateAndCreate()
+}
+
+// PostSpans implements the Jaeger collector HTTP API (POST /api/traces).
+// The body is a jaeger.thrift Batch in the Thrift binary protocol.
+func (h *JaegerHandler) PostSpans(c fiber.Ctx) error {
+	projectID, ok := c.Locals("project_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get project ID")
+	}
+
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	if !strings.HasPrefix(contentType, "application/x-thrift") && !strings.HasPrefix(contentType, "application/vnd.apache.thrift.binary") {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("unsupported content type: %s", contentType))
+	}
+
+	body, err := server.ReadBody(c)
+	if err != nil {
+		return c.Status(err.(*fiber.Error).Code).SendString(err.Error())
+	}
+
+	batch, err := decodeBatch(body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("unable to process request body: %v", err))
+	}
+	if batch.Process.ServiceName == "" {
+		return c.Status(fiber.StatusBadRequest).SendString("process.serviceName is required")
+	}
+
+	// Convert every span before queueing any, a rejected batch must not
+	// leave part of it stored
+	traces := make([]*models.Trace, 0, len(batch.Spans))
+	for i, span := range batch.Spans {
+		trace, err := toTrace(projectID, batch.Process, span)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(
+				fmt.Sprintf("span %d of %d rejected: %v", i+1, len(batch.Spans), err),
+			)
+		}
+		traces = append(traces, trace)
+	}
+
+	if err := h.queue.EnqueueTraces(c.Context(), traces); err != nil {
+		// Nothing is queued on failure, let the client resend the batch
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
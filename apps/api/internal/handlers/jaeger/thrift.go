@@ -0,0 +1,488 @@
+package jaeger
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Minimal decoder for jaeger.thrift Batch structs in the Thrift binary
+// protocol. Only the fields the collector needs are read:
+//
+//	Batch   { 1: Process process; 2: list<Span> spans; }
+//	Process { 1: string serviceName; 2: list<Tag> tags; }
+//	Tag     { 1: string key; 2: TagType vType; 3: string vStr; 4: double vDouble;
+//	          5: bool vBool; 6: i64 vLong; 7: binary vBinary; }
+//	Span    { 1: i64 traceIdLow; 2: i64 traceIdHigh; 3: i64 spanId; 4: i64 parentSpanId;
+//	          5: string operationName; 6: list<SpanRef> references; 7: i32 flags;
+//	          8: i64 startTime; 9: i64 duration; 10: list<Tag> tags; 11: list<Log> logs; }
+//	SpanRef { 1: SpanRefType refType; 2: i64 traceIdLow; 3: i64 traceIdHigh; 4: i64 spanId; }
+//	Log     { 1: i64 timestamp; 2: list<Tag> fields; }
+
+const (
+	typeStop   = 0
+	typeBool   = 2
+	typeByte   = 3
+	typeDouble = 4
+	typeI16    = 6
+	typeI32    = 8
+	typeI64    = 10
+	typeString = 11
+	typeStruct = 12
+	typeMap    = 13
+	typeSet    = 14
+	typeList   = 15
+)
+
+// Deepest struct nesting skipped before a body is rejected
+const maxSkipDepth = 64
+
+// TagType values
+const (
+	tagString = 0
+	tagDouble = 1
+	tagBool   = 2
+	tagLong   = 3
+	tagBinary = 4
+)
+
+// SpanRefType values
+const (
+	refChildOf     = 0
+	refFollowsFrom = 1
+)
+
+type Batch struct {
+	Process Process
+	Spans   []Span
+}
+
+type Process struct {
+	ServiceName string
+	Tags        []Tag
+}
+
+type Tag struct {
+	Key   string
+	Value any
+}
+
+type SpanRef struct {
+	RefType     int32
+	TraceIDLow  int64
+	TraceIDHigh int64
+	SpanID      int64
+}
+
+type Log struct {
+	Timestamp int64
+	Fields    []Tag
+}
+
+// Span is a Jaeger span. Start times and durations are in microseconds.
+type Span struct {
+	TraceIDLow    int64
+	TraceIDHigh   int64
+	SpanID        int64
+	ParentSpanID  int64
+	OperationName string
+	References    []SpanRef
+	Flags         int32
+	StartTime     int64
+	Duration      int64
+	Tags          []Tag
+	Logs          []Log
+}
+
+type thriftReader struct {
+	buf []byte
+}
+
+func (r *thriftReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf) {
+		return nil, fmt.Errorf("truncated message")
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+func (r *thriftReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *thriftReader) bool() (bool, error) {
+	b, err := r.byte()
+	return b != 0, err
+}
+
+func (r *thriftReader) i16() (int16, error) {
+	b, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(b)), nil
+}
+
+func (r *thriftReader) i32() (int32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *thriftReader) i64() (int64, error) {
+	b, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+func (r *thriftReader) double() (float64, error) {
+	v, err := r.i64()
+	return math.Float64frombits(uint64(v)), err
+}
+
+func (r *thriftReader) binary() ([]byte, error) {
+	length, err := r.i32()
+	if err != nil {
+		return nil, err
+	}
+	return r.next(int(length))
+}
+
+func (r *thriftReader) string() (string, error) {
+	b, err := r.binary()
+	return string(b), err
+}
+
+// structFields reads the fields of a struct, passing each one to field
+// until the stop marker. field must consume or skip the value.
+func (r *thriftReader) structFields(field func(id int16, fieldType byte) error) error {
+	for {
+		fieldType, err := r.byte()
+		if err != nil {
+			return err
+		}
+		if fieldType == typeStop {
+			return nil
+		}
+		id, err := r.i16()
+		if err != nil {
+			return err
+		}
+		if err := field(id, fieldType); err != nil {
+			return err
+		}
+	}
+}
+
+// list reads a list header and calls elem once per element
+func (r *thriftReader) list(elemType byte, elem func() error) error {
+	actualType, err := r.byte()
+	if err != nil {
+		return err
+	}
+	size, err := r.i32()
+	if err != nil {
+		return err
+	}
+	// Every element takes at least one byte, reject sizes the body cannot hold
+	if size < 0 || int(size) > len(r.buf) {
+		return fmt.Errorf("invalid list size %d", size)
+	}
+	if actualType != elemType {
+		return fmt.Errorf("unexpected list element type %d", actualType)
+	}
+	for i := 0; i < int(size); i++ {
+		if err := elem(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *thriftReader) skip(fieldType byte, depth int) error {
+	if depth > maxSkipDepth {
+		return fmt.Errorf("message nested too deeply")
+	}
+
+	switch fieldType {
+	case typeBool, typeByte:
+		_, err := r.next(1)
+		return err
+	case typeI16:
+		_, err := r.next(2)
+		return err
+	case typeI32:
+		_, err := r.next(4)
+		return err
+	case typeDouble, typeI64:
+		_, err := r.next(8)
+		return err
+	case typeString:
+		_, err := r.binary()
+		return err
+	case typeStruct:
+		return r.structFields(func(_ int16, fieldType byte) error {
+			return r.skip(fieldType, depth+1)
+		})
+	case typeMap:
+		keyType, err := r.byte()
+		if err != nil {
+			return err
+		}
+		valueType, err := r.byte()
+		if err != nil {
+			return err
+		}
+		size, err := r.i32()
+		if err != nil {
+			return err
+		}
+		if size < 0 || int(size) > len(r.buf) {
+			return fmt.Errorf("invalid map size %d", size)
+		}
+		for i := 0; i < int(size); i++ {
+			if err := r.skip(keyType, depth+1); err != nil {
+				return err
+			}
+			if err := r.skip(valueType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeSet, typeList:
+		elemType, err := r.byte()
+		if err != nil {
+			return err
+		}
+		size, err := r.i32()
+		if err != nil {
+			return err
+		}
+		if size < 0 || int(size) > len(r.buf) {
+			return fmt.Errorf("invalid list size %d", size)
+		}
+		for i := 0; i < int(size); i++ {
+			if err := r.skip(elemType, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported thrift type %d", fieldType)
+	}
+}
+
+func decodeBatch(data []byte) (*Batch, error) {
+	batch := &Batch{}
+	r := &thriftReader{buf: data}
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		switch {
+		case id == 1 && fieldType == typeStruct:
+			process, err := r.process()
+			if err != nil {
+				return err
+			}
+			batch.Process = *process
+		case id == 2 && fieldType == typeList:
+			return r.list(typeStruct, func() error {
+				span, err := r.span()
+				if err != nil {
+					return err
+				}
+				batch.Spans = append(batch.Spans, *span)
+				return nil
+			})
+		default:
+			return r.skip(fieldType, 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+func (r *thriftReader) process() (*Process, error) {
+	process := &Process{}
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		var err error
+		switch {
+		case id == 1 && fieldType == typeString:
+			process.ServiceName, err = r.string()
+		case id == 2 && fieldType == typeList:
+			process.Tags, err = r.tags()
+		default:
+			err = r.skip(fieldType, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return process, nil
+}
+
+func (r *thriftReader) tags() ([]Tag, error) {
+	var tags []Tag
+	err := r.list(typeStruct, func() error {
+		tag, err := r.tag()
+		if err != nil {
+			return err
+		}
+		tags = append(tags, *tag)
+		return nil
+	})
+	return tags, err
+}
+
+func (r *thriftReader) tag() (*Tag, error) {
+	var (
+		key       string
+		valueType int32
+		values    = make(map[int32]any, 1)
+	)
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		var err error
+		switch {
+		case id == 1 && fieldType == typeString:
+			key, err = r.string()
+		case id == 2 && fieldType == typeI32:
+			valueType, err = r.i32()
+		case id == 3 && fieldType == typeString:
+			values[tagString], err = r.string()
+		case id == 4 && fieldType == typeDouble:
+			values[tagDouble], err = r.double()
+		case id == 5 && fieldType == typeBool:
+			values[tagBool], err = r.bool()
+		case id == 6 && fieldType == typeI64:
+			values[tagLong], err = r.i64()
+		case id == 7 && fieldType == typeString:
+			values[tagBinary], err = r.binary()
+		default:
+			err = r.skip(fieldType, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tag{Key: key, Value: values[valueType]}, nil
+}
+
+func (r *thriftReader) span() (*Span, error) {
+	span := &Span{}
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		var err error
+		switch {
+		case id == 1 && fieldType == typeI64:
+			span.TraceIDLow, err = r.i64()
+		case id == 2 && fieldType == typeI64:
+			span.TraceIDHigh, err = r.i64()
+		case id == 3 && fieldType == typeI64:
+			span.SpanID, err = r.i64()
+		case id == 4 && fieldType == typeI64:
+			span.ParentSpanID, err = r.i64()
+		case id == 5 && fieldType == typeString:
+			span.OperationName, err = r.string()
+		case id == 6 && fieldType == typeList:
+			err = r.list(typeStruct, func() error {
+				ref, err := r.spanRef()
+				if err != nil {
+					return err
+				}
+				span.References = append(span.References, *ref)
+				return nil
+			})
+		case id == 7 && fieldType == typeI32:
+			span.Flags, err = r.i32()
+		case id == 8 && fieldType == typeI64:
+			span.StartTime, err = r.i64()
+		case id == 9 && fieldType == typeI64:
+			span.Duration, err = r.i64()
+		case id == 10 && fieldType == typeList:
+			span.Tags, err = r.tags()
+		case id == 11 && fieldType == typeList:
+			err = r.list(typeStruct, func() error {
+				log, err := r.log()
+				if err != nil {
+					return err
+				}
+				span.Logs = append(span.Logs, *log)
+				return nil
+			})
+		default:
+			err = r.skip(fieldType, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return span, nil
+}
+
+func (r *thriftReader) spanRef() (*SpanRef, error) {
+	ref := &SpanRef{}
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		var err error
+		switch {
+		case id == 1 && fieldType == typeI32:
+			ref.RefType, err = r.i32()
+		case id == 2 && fieldType == typeI64:
+			ref.TraceIDLow, err = r.i64()
+		case id == 3 && fieldType == typeI64:
+			ref.TraceIDHigh, err = r.i64()
+		case id == 4 && fieldType == typeI64:
+			ref.SpanID, err = r.i64()
+		default:
+			err = r.skip(fieldType, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ref, nil
+}
+
+func (r *thriftReader) log() (*Log, error) {
+	log := &Log{}
+
+	err := r.structFields(func(id int16, fieldType byte) error {
+		var err error
+		switch {
+		case id == 1 && fieldType == typeI64:
+			log.Timestamp, err = r.i64()
+		case id == 2 && fieldType == typeList:
+			log.Fields, err = r.tags()
+		default:
+			err = r.skip(fieldType, 0)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return log, nil
+}
@@ -0,0 +1,18 @@
+package loki
+
+import (
+	"github.com/ted-too/logsicle/internal/queue"
+	"gorm.io/gorm"
+)
+
+type LokiHandler struct {
+	db    *gorm.DB
+	queue *queue.QueueService
+}
+
+func NewLokiHandler(db *gorm.DB, queue *queue.QueueService) *LokiHandler {
+	return &LokiHandler{
+		db:    db,
+		queue: queue,
+	}
+}
@@ -0,0 +1,249 @@
+package loki
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/protowire"
+)
+
+// Minimal decoder for the logproto.PushRequest wire format. Only the fields
+// used by push clients are read, everything else is skipped:
+//
+//	PushRequest    { repeated StreamAdapter streams = 1; }
+//	StreamAdapter  { string labels = 1; repeated EntryAdapter entries = 2; }
+//	EntryAdapter   { Timestamp timestamp = 1; string line = 2; repeated LabelPair structuredMetadata = 3; }
+//	LabelPair      { string name = 1; string value = 2; }
+//	Timestamp      { int64 seconds = 1; int32 nanos = 2; }
+
+func decodePushRequest(data []byte) (*PushRequest, error) {
+	req := &PushRequest{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+		if field == 1 && wireType == protowire.WireBytes {
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			stream, err := decodeStream(b)
+			if err != nil {
+				return nil, err
+			}
+			req.Streams = append(req.Streams, *stream)
+			continue
+		}
+		if err := r.Skip(wireType); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func decodeStream(data []byte) (*Stream, error) {
+	stream := &Stream{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			labels, err := parseLabels(string(b))
+			if err != nil {
+				return nil, err
+			}
+			stream.Labels = labels
+		case field == 2 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			entry, err := decodeEntry(b)
+			if err != nil {
+				return nil, err
+			}
+			stream.Entries = append(stream.Entries, *entry)
+		default:
+			if err := r.Skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return stream, nil
+}
+
+func decodeEntry(data []byte) (*Entry, error) {
+	entry := &Entry{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == 1 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			ts, err := decodeTimestamp(b)
+			if err != nil {
+				return nil, err
+			}
+			entry.Timestamp = ts
+		case field == 2 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			entry.Line = string(b)
+		case field == 3 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			name, value, err := decodeLabelPair(b)
+			if err != nil {
+				return nil, err
+			}
+			if entry.StructuredMetadata == nil {
+				entry.StructuredMetadata = make(map[string]string)
+			}
+			entry.StructuredMetadata[name] = value
+		default:
+			if err := r.Skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entry, nil
+}
+
+func decodeTimestamp(data []byte) (time.Time, error) {
+	var seconds, nanos int64
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if wireType != protowire.WireVarint {
+			if err := r.Skip(wireType); err != nil {
+				return time.Time{}, err
+			}
+			continue
+		}
+		v, err := r.Varint()
+		if err != nil {
+			return time.Time{}, err
+		}
+		switch field {
+		case 1:
+			seconds = int64(v)
+		case 2:
+			nanos = int64(int32(v))
+		}
+	}
+
+	return time.Unix(seconds, nanos), nil
+}
+
+func decodeLabelPair(data []byte) (string, string, error) {
+	var name, value string
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return "", "", err
+		}
+		if wireType != protowire.WireBytes {
+			if err := r.Skip(wireType); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		b, err := r.Bytes()
+		if err != nil {
+			return "", "", err
+		}
+		switch field {
+		case 1:
+			name = string(b)
+		case 2:
+			value = string(b)
+		}
+	}
+
+	return name, value, nil
+}
+
+// parseLabels parses a Prometheus style label set, e.g. {job="api", env="prod"}
+func parseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("invalid label set: %s", s)
+	}
+	s = s[1 : len(s)-1]
+
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			break
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, fmt.Errorf("invalid label set")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				switch s[i+1] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i+1])
+				}
+				i++
+				continue
+			}
+			if s[i] == '"' {
+				s = s[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(s[i])
+		}
+		if !closed {
+			return nil, fmt.Errorf("unterminated label value for %s", name)
+		}
+
+		labels[name] = value.String()
+	}
+
+	return labels, nil
+}
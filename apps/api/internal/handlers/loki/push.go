@@ -0,0 +1,231 @@
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/klauspost/compress/snappy"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Maximum decompressed size of a protobuf push request
+const maxDecodedSize = 32 * 1024 * 1024
+
+const (
+	// Default service name when no stream label identifies the service
+	defaultServiceName = "loki"
+	// Longest message accepted by AppLogInput validation
+	maxAppLogMessageLength = 10000
+)
+
+// Stream labels checked, in order, for each AppLog field
+var (
+	serviceNameLabels = []string{"service_name", "service", "app", "application", "job", "container", "container_name"}
+	environmentLabels = []string{"environment", "env", "deployment_environment"}
+	hostLabels        = []string{"host", "hostname", "node", "nodename", "instance"}
+	levelLabels       = []string{"level", "severity", "detected_level", "lvl"}
+)
+
+type PushRequest struct {
+	Streams []Stream
+}
+
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+type Entry struct {
+	Timestamp          time.Time
+	Line               string
+	StructuredMetadata map[string]string
+}
+
+// jsonPushRequest is the JSON body accepted by /loki/api/v1/push
+type jsonPushRequest struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][]any           `json:"values"`
+	} `json:"streams"`
+}
+
+func decodeJSONPushRequest(data []byte) (*PushRequest, error) {
+	var body jsonPushRequest
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+
+	req := &PushRequest{}
+	for _, s := range body.Streams {
+		stream := Stream{Labels: s.Stream}
+		for _, value := range s.Values {
+			if len(value) < 2 {
+				return nil, fmt.Errorf("entry must contain a timestamp and a line")
+			}
+
+			tsStr, ok := value[0].(string)
+			if !ok {
+				return nil, fmt.Errorf("entry timestamp must be a string of unix nanoseconds")
+			}
+			ns, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid entry timestamp: %s", tsStr)
+			}
+
+			line, ok := value[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("entry line must be a string")
+			}
+
+			entry := Entry{
+				Timestamp: time.Unix(0, ns),
+				Line:      line,
+			}
+
+			if len(value) > 2 {
+				if metadata, ok := value[2].(map[string]any); ok {
+					entry.StructuredMetadata = make(map[string]string, len(metadata))
+					for k, v := range metadata {
+						entry.StructuredMetadata[k] = fmt.Sprint(v)
+					}
+				}
+			}
+
+			stream.Entries = append(stream.Entries, entry)
+		}
+		req.Streams = append(req.Streams, stream)
+	}
+
+	return req, nil
+}
+
+func decodeProtobufPushRequest(data []byte) (*PushRequest, error) {
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+	if size > maxDecodedSize {
+		return nil, fmt.Errorf("decoded body exceeds %d bytes", maxDecodedSize)
+	}
+
+	decoded, err := snappy.Decode(nil, data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy body: %w", err)
+	}
+
+	return decodePushRequest(decoded)
+}
+
+// firstLabel returns the value of the first label present, removing it from
+// the remaining labels so it is not duplicated into Fields
+func firstLabel(labels map[string]string, names []string) string {
+	for _, name := range names {
+		if value, ok := labels[name]; ok && value != "" {
+			delete(labels, name)
+			return value
+		}
+	}
+	return ""
+}
+
+func toAppLogInput(projectID string, labels map[string]string, entry Entry) models.AppLogInput {
+	// Work on a copy, labels are shared by every entry in the stream
+	remaining := make(map[string]string, len(labels)+len(entry.StructuredMetadata))
+	for k, v := range labels {
+		remaining[k] = v
+	}
+	for k, v := range entry.StructuredMetadata {
+		remaining[k] = v
+	}
+
+	serviceName := firstLabel(remaining, serviceNameLabels)
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	environment := firstLabel(remaining, environmentLabels)
+	host := firstLabel(remaining, hostLabels)
+
+	level := models.DetectLogLevel(entry.Line)
+	if levelLabel := firstLabel(remaining, levelLabels); levelLabel != "" {
+		if normalized, ok := models.NormalizeLogLevel(levelLabel); ok {
+			level = normalized
+		}
+	}
+
+	var fields map[string]any
+	if len(remaining) > 0 {
+		fields = make(map[string]any, len(remaining))
+		for k, v := range remaining {
+			fields[k] = v
+		}
+	}
+
+	message := entry.Line
+	if message == "" {
+		message = "-"
+	}
+	if runes := []rune(message); len(runes) > maxAppLogMessageLength {
+		message = string(runes[:maxAppLogMessageLength])
+	}
+
+	return models.AppLogInput{
+		ProjectID:   projectID,
+		Level:       string(level),
+		Message:     message,
+		Fields:      fields,
+		ServiceName: serviceName,
+		Environment: environment,
+		Host:        host,
+		Timestamp:   entry.Timestamp.Format(time.RFC3339Nano),
+	}
+}
+
+// Push implements the Loki push API (POST /loki/api/v1/push)
+func (h *LokiHandler) Push(c fiber.Ctx) error {
+	projectID, ok := c.Locals("project_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get project ID")
+	}
+
+	var (
+		req *PushRequest
+		err error
+	)
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	if strings.HasPrefix(contentType, fiber.MIMEApplicationJSON) {
+		req, err = decodeJSONPushRequest(c.Body())
+	} else {
+		// Loki treats anything that is not JSON as snappy compressed protobuf
+		req, err = decodeProtobufPushRequest(c.Body())
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	// Promtail and Grafana Agent drop a push rejected with 400 instead of
+	// retrying it, so entries that still fail validation are dropped on their
+	// own rather than failing the valid entries with them
+	var logs []*models.AppLog
+	for _, stream := range req.Streams {
+		for _, entry := range stream.Entries {
+			appLog, err := toAppLogInput(projectID, stream.Labels, entry).ValidateAndCreate()
+			if err != nil {
+				log.Printf("Dropping invalid Loki entry for project %s: %v", projectID, err)
+				continue
+			}
+			logs = append(logs, appLog)
+		}
+	}
+
+	if err := h.queue.EnqueueAppLogs(c.Context(), logs); err != nil {
+		// Nothing is queued on failure, let the client resend the push
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
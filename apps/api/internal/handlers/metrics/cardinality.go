@@ -0,0 +1,266 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/storage/timescale"
+)
+
+const (
+	// Default and maximum number of metrics and attribute keys returned
+	defaultCardinalityLimit = 50
+	maxCardinalityLimit     = 1000
+)
+
+// seriesExpression identifies a series, a metric name together with its
+// service and attribute set
+const seriesExpression = `md5(service_name || coalesce(attributes::text, ''))`
+
+// MetricCardinality is the number of series a metric had in a time range
+type MetricCardinality struct {
+	Name   string `json:"name"`
+	Series int64  `json:"series"`
+	Points int64  `json:"points"`
+	// Series currently tracked against the limit, only for limited metrics
+	ActiveSeries *int  `json:"active_series,omitempty"`
+	Limit        int64 `json:"limit,omitempty"`
+}
+
+// AttributeCardinality is the number of distinct values of an attribute key
+type AttributeCardinality struct {
+	Key     string `json:"key"`
+	Values  int64  `json:"values"`
+	Metrics int64  `json:"metrics"`
+}
+
+// CardinalityPoint is the number of series seen in a time bucket
+type CardinalityPoint struct {
+	Timestamp int64 `json:"timestamp"`
+	Series    int64 `json:"series"`
+}
+
+type cardinalityQuery struct {
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Interval string
+	Limit    int
+}
+
+// GetCardinality returns series counts per metric name and distinct values
+// per attribute key in a time range, with the series count trend and any
+// active limit warnings. With a name, attributes and trend cover that
+// metric only.
+func (h *MetricsHandler) GetCardinality(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	if projectID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Project ID is required",
+		})
+	}
+
+	// Check if user can access this project
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("org_id").(string)
+	if !canUserAccessProject(h.db, userID, orgID, projectID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Forbidden",
+		})
+	}
+
+	startUnix, err := parseInt64(c.Query("start", fmt.Sprintf("%d", time.Now().Add(-24*time.Hour).UnixMilli())))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start time",
+		})
+	}
+
+	endUnix, err := parseInt64(c.Query("end", fmt.Sprintf("%d", time.Now().UnixMilli())))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end time",
+		})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultCardinalityLimit)))
+	if err != nil || limit < 1 || limit > maxCardinalityLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": fmt.Sprintf("Limit must be between 1 and %d", maxCardinalityLimit),
+		})
+	}
+
+	// If no interval is provided, suggest one based on time range
+	interval := c.Query("interval", "")
+	if interval == "" {
+		interval = timescale.SuggestInterval(startUnix, endUnix)
+	}
+
+	options := timescale.CommonMetricsQueryOptions{
+		Start:    startUnix,
+		End:      endUnix,
+		Interval: interval,
+	}
+	if err := options.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	query := cardinalityQuery{
+		Name:     c.Query("name"),
+		Start:    timescale.UnixMsToTime(startUnix),
+		End:      timescale.UnixMsToTime(endUnix),
+		Interval: interval,
+		Limit:    limit,
+	}
+
+	metrics, err := getMetricCardinality(c.Context(), h.pool, projectID, query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get metric cardinality",
+		})
+	}
+
+	attributes, err := getAttributeCardinality(c.Context(), h.pool, projectID, query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get attribute cardinality",
+		})
+	}
+
+	trend, err := getCardinalityTrend(c.Context(), h.pool, projectID, query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get cardinality trend",
+		})
+	}
+
+	// Annotate metrics with their limit and the series tracked against it
+	limits, err := h.limiter.Load(c.Context(), projectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to load cardinality limits",
+		})
+	}
+	active := h.limiter.ActiveSeries(projectID)
+	for i := range metrics {
+		metrics[i].Limit = limits.Limit(metrics[i].Name)
+		if n, ok := active[metrics[i].Name]; ok {
+			metrics[i].ActiveSeries = &n
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"metrics":    metrics,
+		"attributes": attributes,
+		"trend":      trend,
+		"interval":   interval,
+		"warnings":   h.limiter.Warnings(projectID),
+	})
+}
+
+// getMetricCardinality counts the series of the metrics with the most
+// series
+func getMetricCardinality(ctx context.Context, pool *pgxpool.Pool, projectID string, query cardinalityQuery) ([]MetricCardinality, error) {
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT name, COUNT(DISTINCT %s) AS series, COUNT(*) AS points
+		FROM metrics
+		WHERE project_id = $1
+		AND timestamp BETWEEN $2 AND $3
+		GROUP BY name
+		ORDER BY series DESC, name
+		LIMIT $4`, seriesExpression),
+		projectID, query.Start, query.End, query.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (MetricCardinality, error) {
+		var m MetricCardinality
+		err := row.Scan(&m.Name, &m.Series, &m.Points)
+		return m, err
+	})
+}
+
+// getAttributeCardinality counts the distinct values of the attribute keys
+// with the most values
+func getAttributeCardinality(ctx context.Context, pool *pgxpool.Pool, projectID string, query cardinalityQuery) ([]AttributeCardinality, error) {
+	args := []interface{}{projectID, query.Start, query.End}
+	conditions := []string{
+		"m.project_id = $1",
+		"m.timestamp BETWEEN $2 AND $3",
+	}
+	if query.Name != "" {
+		args = append(args, query.Name)
+		conditions = append(conditions, fmt.Sprintf("m.name = $%d", len(args)))
+	}
+	args = append(args, query.Limit)
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT a.key, COUNT(DISTINCT a.value) AS values, COUNT(DISTINCT m.name) AS metrics
+		FROM metrics m
+		CROSS JOIN LATERAL jsonb_each_text(
+			CASE WHEN jsonb_typeof(m.attributes) = 'object' THEN m.attributes ELSE '{}'::jsonb END
+		) AS a(key, value)
+		WHERE %s
+		GROUP BY a.key
+		ORDER BY values DESC, a.key
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (AttributeCardinality, error) {
+		var a AttributeCardinality
+		err := row.Scan(&a.Key, &a.Values, &a.Metrics)
+		return a, err
+	})
+}
+
+// getCardinalityTrend counts the series seen per time bucket
+func getCardinalityTrend(ctx context.Context, pool *pgxpool.Pool, projectID string, query cardinalityQuery) ([]CardinalityPoint, error) {
+	args := []interface{}{projectID, query.Start, query.End}
+	conditions := []string{
+		"project_id = $1",
+		"timestamp BETWEEN $2 AND $3",
+	}
+	if query.Name != "" {
+		args = append(args, query.Name)
+		conditions = append(conditions, fmt.Sprintf("name = $%d", len(args)))
+	}
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT
+			time_bucket(%s, timestamp) AS bucket,
+			COUNT(DISTINCT name || %s) AS series
+		FROM metrics
+		WHERE %s
+		GROUP BY bucket
+		ORDER BY bucket`,
+		timescale.ConvertIntervalToPostgresFormat(query.Interval), seriesExpression, strings.Join(conditions, " AND ")),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (CardinalityPoint, error) {
+		var bucket time.Time
+		var p CardinalityPoint
+		if err := row.Scan(&bucket, &p.Series); err != nil {
+			return p, err
+		}
+		p.Timestamp = timescale.TimeToUnixMs(bucket)
+		return p, nil
+	})
+}
@@ -0,0 +1,297 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"github.com/ted-too/logsicle/internal/storage/timescale"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+var catalogSorts = map[string]string{
+	"name":       "name ASC",
+	"last_seen":  "last_seen DESC, name ASC",
+	"first_seen": "first_seen DESC, name ASC",
+}
+
+type ListCatalogQuery struct {
+	Search  *string `query:"search"`
+	Service *string `query:"service"`
+	Type    *string `query:"type"`
+	Sort    string  `query:"sort"`
+	Limit   int     `query:"limit"`
+	Page    int     `query:"page"`
+}
+
+func (q *ListCatalogQuery) SetDefaults() {
+	if q.Sort == "" {
+		q.Sort = "name"
+	}
+	if q.Limit == 0 {
+		q.Limit = 50
+	} else if q.Limit > 500 {
+		q.Limit = 500
+	}
+	if q.Page == 0 {
+		q.Page = 1
+	}
+}
+
+func (q ListCatalogQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Type, validation.In(
+			string(tsmodels.MetricTypeGauge),
+			string(tsmodels.MetricTypeSum),
+			string(tsmodels.MetricTypeHistogram),
+			string(tsmodels.MetricTypeExponentialHistogram),
+			string(tsmodels.MetricTypeSummary),
+		)),
+		validation.Field(&q.Sort, validation.In("name", "last_seen", "first_seen")),
+		validation.Field(&q.Limit, validation.Required, validation.Min(1), validation.Max(500)),
+		validation.Field(&q.Page, validation.Required, validation.Min(1)),
+	)
+}
+
+type CatalogResponse struct {
+	Data []models.MetricCatalogEntry `json:"data"`
+	Meta timescale.PaginationMeta    `json:"meta"`
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListCatalog returns the metrics a project has reported with their type,
+// unit, description and services
+func (h *MetricsHandler) ListCatalog(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	query := new(ListCatalogQuery)
+	if err := c.Bind().Query(query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid query parameters",
+			"error":   err.Error(),
+		})
+	}
+
+	query.SetDefaults()
+
+	if err := query.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Query parameters validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	base := h.db.Model(&models.MetricCatalogEntry{}).Where("project_id = ?", projectID)
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to count metrics",
+			"error":   err.Error(),
+		})
+	}
+
+	filtered := base.Session(&gorm.Session{})
+	if query.Search != nil {
+		search := "%" + escapeLike(*query.Search) + "%"
+		filtered = filtered.Where("(name ILIKE ? OR description ILIKE ?)", search, search)
+	}
+	if query.Service != nil {
+		filtered = filtered.Where("? = ANY(services)", *query.Service)
+	}
+	if query.Type != nil {
+		filtered = filtered.Where("type = ?", *query.Type)
+	}
+
+	var filteredCount int64
+	if err := filtered.Count(&filteredCount).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to count metrics",
+			"error":   err.Error(),
+		})
+	}
+
+	entries := make([]models.MetricCatalogEntry, 0)
+	if err := filtered.
+		Order(catalogSorts[query.Sort]).
+		Limit(query.Limit).
+		Offset((query.Page - 1) * query.Limit).
+		Find(&entries).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch metrics",
+			"error":   err.Error(),
+		})
+	}
+
+	totalPages := (int(filteredCount) + query.Limit - 1) / query.Limit
+	var nextPage *int
+	var prevPage *int
+	if query.Page < totalPages {
+		next := query.Page + 1
+		nextPage = &next
+	}
+	if query.Page > 1 {
+		prev := query.Page - 1
+		prevPage = &prev
+	}
+
+	return c.JSON(CatalogResponse{
+		Data: entries,
+		Meta: timescale.PaginationMeta{
+			TotalRowCount:         int(total),
+			TotalFilteredRowCount: int(filteredCount),
+			CurrentPage:           query.Page,
+			NextPage:              nextPage,
+			PrevPage:              prevPage,
+		},
+	})
+}
+
+// GetCatalogEntry returns a metric with its attribute keys and sample values
+func (h *MetricsHandler) GetCatalogEntry(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	var entry models.MetricCatalogEntry
+	if err := h.db.Where("project_id = ? AND name = ?", projectID, c.Params("name")).First(&entry).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Metric not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch metric",
+			"error":   err.Error(),
+		})
+	}
+
+	entry.Attributes = make([]models.MetricCatalogAttribute, 0)
+	if err := h.db.
+		Where("project_id = ? AND metric_name = ?", projectID, entry.Name).
+		Order("key").
+		Find(&entry.Attributes).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch metric attributes",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(entry)
+}
+
+// Fields that can be autocompleted
+const (
+	autocompleteName           = "name"
+	autocompleteAttributeKey   = "attribute_key"
+	autocompleteAttributeValue = "attribute_value"
+	autocompleteService        = "service"
+)
+
+type AutocompleteQuery struct {
+	Field  string `query:"field"`
+	Prefix string `query:"prefix"`
+	Metric string `query:"metric"` // limits attribute keys and values to one metric
+	Key    string `query:"key"`    // attribute key of the values
+	Limit  int    `query:"limit"`
+}
+
+func (q *AutocompleteQuery) SetDefaults() {
+	if q.Field == "" {
+		q.Field = autocompleteName
+	}
+	if q.Limit == 0 {
+		q.Limit = 20
+	}
+}
+
+func (q AutocompleteQuery) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.Field, validation.In(autocompleteName, autocompleteAttributeKey, autocompleteAttributeValue, autocompleteService)),
+		validation.Field(&q.Key, validation.When(q.Field == autocompleteAttributeValue, validation.Required)),
+		validation.Field(&q.Limit, validation.Min(1), validation.Max(100)),
+	)
+}
+
+// Autocomplete suggests metric names, services, attribute keys or sample
+// attribute values starting with a prefix, for query builders
+func (h *MetricsHandler) Autocomplete(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	query := new(AutocompleteQuery)
+	if err := c.Bind().Query(query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid query parameters",
+			"error":   err.Error(),
+		})
+	}
+
+	query.SetDefaults()
+
+	if err := query.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Query parameters validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	prefix := escapeLike(query.Prefix) + "%"
+	values := make([]string, 0)
+
+	var err error
+	switch query.Field {
+	case autocompleteName:
+		err = h.db.Model(&models.MetricCatalogEntry{}).
+			Where("project_id = ? AND name ILIKE ?", projectID, prefix).
+			Order("name").
+			Limit(query.Limit).
+			Pluck("name", &values).Error
+	case autocompleteService:
+		err = h.db.Raw(`
+			SELECT DISTINCT s
+			FROM metric_catalog_entries, unnest(services) AS s
+			WHERE project_id = ? AND deleted_at IS NULL AND s ILIKE ?
+			ORDER BY s
+			LIMIT ?`, projectID, prefix, query.Limit).
+			Scan(&values).Error
+	case autocompleteAttributeKey:
+		tx := h.db.Model(&models.MetricCatalogAttribute{}).
+			Where("project_id = ? AND key ILIKE ?", projectID, prefix)
+		if query.Metric != "" {
+			tx = tx.Where("metric_name = ?", query.Metric)
+		}
+		err = tx.Distinct("key").Order("key").Limit(query.Limit).Pluck("key", &values).Error
+	case autocompleteAttributeValue:
+		args := []interface{}{projectID, query.Key}
+		metricCondition := ""
+		if query.Metric != "" {
+			metricCondition = "AND metric_name = ?"
+			args = append(args, query.Metric)
+		}
+		args = append(args, prefix, query.Limit)
+		err = h.db.Raw(`
+			SELECT DISTINCT v
+			FROM metric_catalog_attributes, unnest(sample_values) AS v
+			WHERE project_id = ? AND key = ? AND deleted_at IS NULL `+metricCondition+`
+			AND v ILIKE ?
+			ORDER BY v
+			LIMIT ?`, args...).
+			Scan(&values).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch suggestions",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"field":  query.Field,
+		"values": values,
+	})
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/storage/timescale"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Default and maximum number of exemplars returned
+	defaultExemplarLimit = 100
+	maxExemplarLimit     = 1000
+)
+
+// MetricExemplar is an exemplar with the series it was recorded for
+type MetricExemplar struct {
+	models.Exemplar
+	MetricID         string       `json:"metric_id"`
+	Name             string       `json:"name"`
+	ServiceName      string       `json:"service_name"`
+	MetricAttributes models.JSONB `json:"metric_attributes,omitempty"`
+}
+
+type exemplarQuery struct {
+	Name        string
+	ServiceName string
+	TraceID     string
+	MinValue    *float64
+	Start       time.Time
+	End         time.Time
+	Limit       int
+}
+
+// GetExemplars returns the exemplars recorded with a project's metrics, most
+// recent first, so a point on a chart can link to an example trace
+func (h *MetricsHandler) GetExemplars(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	if projectID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Project ID is required",
+		})
+	}
+
+	// Check if user can access this project
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("org_id").(string)
+	if !canUserAccessProject(h.db, userID, orgID, projectID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Forbidden",
+		})
+	}
+
+	startUnix, err := parseInt64(c.Query("start", fmt.Sprintf("%d", time.Now().Add(-24*time.Hour).UnixMilli())))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start time",
+		})
+	}
+
+	endUnix, err := parseInt64(c.Query("end", fmt.Sprintf("%d", time.Now().UnixMilli())))
+	if err != nil || endUnix < startUnix {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end time",
+		})
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit", strconv.Itoa(defaultExemplarLimit)))
+	if err != nil || limit < 1 || limit > maxExemplarLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": fmt.Sprintf("Limit must be between 1 and %d", maxExemplarLimit),
+		})
+	}
+
+	query := exemplarQuery{
+		Name:        c.Query("name"),
+		ServiceName: c.Query("service_name"),
+		TraceID:     models.NormalizeTraceID(c.Query("trace_id")),
+		Start:       timescale.UnixMsToTime(startUnix),
+		End:         timescale.UnixMsToTime(endUnix),
+		Limit:       limit,
+	}
+
+	if minValue := c.Query("min_value"); minValue != "" {
+		v, err := strconv.ParseFloat(minValue, 64)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid min_value",
+			})
+		}
+		query.MinValue = &v
+	}
+
+	exemplars, err := getExemplars(c.Context(), h.pool, projectID, query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get exemplars",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"exemplars": exemplars,
+	})
+}
+
+// getExemplars expands the exemplars of the matching metrics
+func getExemplars(ctx context.Context, pool *pgxpool.Pool, projectID string, query exemplarQuery) ([]MetricExemplar, error) {
+	args := []interface{}{projectID, query.Start, query.End}
+	conditions := []string{
+		"m.project_id = $1",
+		"m.timestamp BETWEEN $2 AND $3",
+		"m.exemplars IS NOT NULL",
+	}
+
+	if query.Name != "" {
+		args = append(args, query.Name)
+		conditions = append(conditions, fmt.Sprintf("m.name = $%d", len(args)))
+	}
+	if query.ServiceName != "" {
+		args = append(args, query.ServiceName)
+		conditions = append(conditions, fmt.Sprintf("m.service_name = $%d", len(args)))
+	}
+	if query.TraceID != "" {
+		args = append(args, query.TraceID)
+		conditions = append(conditions, fmt.Sprintf("e.exemplar->>'trace_id' = $%d", len(args)))
+	}
+	if query.MinValue != nil {
+		args = append(args, *query.MinValue)
+		conditions = append(conditions, fmt.Sprintf("(e.exemplar->>'value')::double precision >= $%d", len(args)))
+	}
+	args = append(args, query.Limit)
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT m.id, m.name, m.service_name, m.attributes, e.exemplar
+		FROM metrics m
+		CROSS JOIN LATERAL jsonb_array_elements(m.exemplars) AS e(exemplar)
+		WHERE %s
+		ORDER BY m.timestamp DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exemplars := []MetricExemplar{}
+	for rows.Next() {
+		var e MetricExemplar
+		var raw models.JSONB
+		if err := rows.Scan(&e.MetricID, &e.Name, &e.ServiceName, &e.MetricAttributes, &raw); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &e.Exemplar); err != nil {
+			continue
+		}
+		exemplars = append(exemplars, e)
+	}
+
+	return exemplars, rows.Err()
+}
@@ -2,20 +2,23 @@ package metrics
 
 import (
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/cardinality"
 	"github.com/ted-too/logsicle/internal/queue"
 	"gorm.io/gorm"
 )
 
 type MetricsHandler struct {
-	db    *gorm.DB
-	pool  *pgxpool.Pool
-	queue *queue.QueueService
+	db      *gorm.DB
+	pool    *pgxpool.Pool
+	queue   *queue.QueueService
+	limiter *cardinality.Limiter
 }
 
-func NewMetricsHandler(db *gorm.DB, pool *pgxpool.Pool, qs *queue.QueueService) *MetricsHandler {
+func NewMetricsHandler(db *gorm.DB, pool *pgxpool.Pool, qs *queue.QueueService, limiter *cardinality.Limiter) *MetricsHandler {
 	return &MetricsHandler{
-		db:    db,
-		pool:  pool,
-		queue: qs,
+		db:      db,
+		pool:    pool,
+		queue:   qs,
+		limiter: limiter,
 	}
 }
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/cardinality"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// Maximum number of per-metric limit overrides
+const maxMetricLimits = 500
+
+type UpdateLimitsInput struct {
+	MaxSeriesPerMetric *int64            `json:"max_series_per_metric"`
+	Action             *string           `json:"action"`
+	MetricLimits       *map[string]int64 `json:"metric_limits"`
+}
+
+func validateAction(value interface{}) error {
+	action, _ := value.(*string)
+	if action == nil {
+		return nil
+	}
+	return cardinality.ValidateAction(*action)
+}
+
+func validateMetricLimits(value interface{}) error {
+	limits, _ := value.(*map[string]int64)
+	if limits == nil {
+		return nil
+	}
+	if len(*limits) > maxMetricLimits {
+		return fmt.Errorf("at most %d metric limits are allowed", maxMetricLimits)
+	}
+	for name, limit := range *limits {
+		if name == "" {
+			return fmt.Errorf("metric name is required")
+		}
+		if limit < 0 {
+			return fmt.Errorf("limit of %s must be no less than 0", name)
+		}
+	}
+	return nil
+}
+
+func (u UpdateLimitsInput) Validate() error {
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.MaxSeriesPerMetric, validation.Min(int64(0))),
+		validation.Field(&u.Action, validation.By(validateAction)),
+		validation.Field(&u.MetricLimits, validation.By(validateMetricLimits)),
+	)
+}
+
+func (h *MetricsHandler) loadLimits(projectID string) (*models.MetricCardinalitySettings, error) {
+	var settings models.MetricCardinalitySettings
+	err := h.db.Where("project_id = ?", projectID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = models.DefaultMetricCardinalitySettings(projectID)
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetLimits returns the project's metric cardinality limits, or the
+// defaults when none have been configured
+func (h *MetricsHandler) GetLimits(c fiber.Ctx) error {
+	settings, err := h.loadLimits(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch cardinality limits",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateLimits creates or updates the project's metric cardinality limits.
+// Omitted fields keep their current value.
+func (h *MetricsHandler) UpdateLimits(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	input := new(UpdateLimitsInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	settings, err := h.loadLimits(projectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch cardinality limits",
+			"error":   err.Error(),
+		})
+	}
+
+	if input.MaxSeriesPerMetric != nil {
+		settings.MaxSeriesPerMetric = *input.MaxSeriesPerMetric
+	}
+	if input.Action != nil {
+		settings.Action = *input.Action
+	}
+	if input.MetricLimits != nil {
+		limits := *input.MetricLimits
+		if limits == nil {
+			limits = map[string]int64{}
+		}
+		b, err := json.Marshal(limits)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid metric limits",
+				"error":   err.Error(),
+			})
+		}
+		settings.MetricLimits = string(b)
+	}
+
+	// Select all columns on create so a zero limit is not replaced by the
+	// column default
+	if settings.ID == "" {
+		err = h.db.Select("*").Create(settings).Error
+	} else {
+		err = h.db.Save(settings).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update cardinality limits",
+			"error":   err.Error(),
+		})
+	}
+
+	h.limiter.Invalidate(projectID)
+
+	return c.JSON(settings)
+}
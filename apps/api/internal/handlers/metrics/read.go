@@ -197,7 +197,8 @@ func getMetrics(ctx context.Context, pool *pgxpool.Pool, projectID string, optio
 			quantile_values,
 			service_name, service_version,
 			attributes, resource_attributes,
-			aggregation_temporality
+			aggregation_temporality,
+			start_time, exemplars
 		FROM metrics
 		WHERE project_id = $1
 		AND timestamp BETWEEN $2 AND $3
@@ -268,6 +269,7 @@ func getMetrics(ctx context.Context, pool *pgxpool.Pool, projectID string, optio
 			&m.ServiceName, &m.ServiceVersion,
 			&m.Attributes, &m.ResourceAttributes,
 			&m.AggregationTemporality,
+			&m.StartTime, &m.Exemplars,
 		)
 		if err != nil {
 			return nil, nil, err
@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/rollup"
+	"github.com/ted-too/logsicle/internal/storage/timescale"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Maximum number of series returned for a metric
+const maxQuerySeries = 100
+
+// SeriesPoint is a metric series aggregated over an interval
+type SeriesPoint struct {
+	Timestamp int64 `json:"timestamp"`
+	// Value by type: the average of gauges, the sum of delta sums and the
+	// latest value of cumulative sums, null for distributions
+	Value  *float64 `json:"value"`
+	Last   *float64 `json:"last,omitempty"`
+	Avg    *float64 `json:"avg,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Points int64    `json:"points"`
+
+	// Histograms and summaries
+	BucketCounts []int64  `json:"bucket_counts,omitempty"`
+	Count        *int64   `json:"count,omitempty"`
+	Sum          *float64 `json:"sum,omitempty"`
+}
+
+// MetricSeries is a series of a metric, one service and attribute set
+type MetricSeries struct {
+	ServiceName            string                        `json:"service_name"`
+	Attributes             models.JSONB                  `json:"attributes,omitempty"`
+	Type                   models.MetricType             `json:"type"`
+	AggregationTemporality models.AggregationTemporality `json:"aggregation_temporality"`
+	Bounds                 []float64                     `json:"bounds,omitempty"`
+	Points                 []SeriesPoint                 `json:"points"`
+}
+
+type seriesQuery struct {
+	Name        string
+	ServiceName string
+	Start       time.Time
+	End         time.Time
+	Interval    time.Duration
+	Resolution  *rollup.Resolution
+}
+
+// GetSeries returns the series of a metric aggregated per interval. The
+// resolution, raw points or a rollup, is picked for the time range unless
+// one is requested.
+func (h *MetricsHandler) GetSeries(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	if projectID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Project ID is required",
+		})
+	}
+
+	// Check if user can access this project
+	userID := c.Locals("user_id").(string)
+	orgID := c.Locals("org_id").(string)
+	if !canUserAccessProject(h.db, userID, orgID, projectID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Forbidden",
+		})
+	}
+
+	name := c.Query("name")
+	if name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Metric name is required",
+		})
+	}
+
+	startUnix, err := parseInt64(c.Query("start", fmt.Sprintf("%d", time.Now().Add(-time.Hour).UnixMilli())))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid start time",
+		})
+	}
+
+	endUnix, err := parseInt64(c.Query("end", fmt.Sprintf("%d", time.Now().UnixMilli())))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid end time",
+		})
+	}
+
+	// If no interval is provided, suggest one based on time range
+	interval := c.Query("interval", "")
+	if interval == "" {
+		interval = timescale.SuggestInterval(startUnix, endUnix)
+	}
+
+	options := timescale.CommonMetricsQueryOptions{
+		Start:    startUnix,
+		End:      endUnix,
+		Interval: interval,
+	}
+	if err := options.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	query := seriesQuery{
+		Name:        name,
+		ServiceName: c.Query("service_name"),
+		Start:       timescale.UnixMsToTime(startUnix),
+		End:         timescale.UnixMsToTime(endUnix),
+	}
+
+	if resolution := c.Query("resolution", "auto"); resolution == "auto" {
+		query.Resolution = rollup.ForRange(query.Start, query.End, time.Now())
+	} else {
+		res, ok := rollup.Lookup(resolution)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid resolution",
+			})
+		}
+		query.Resolution = res
+	}
+
+	// Intervals finer than the resolution are widened to it
+	query.Interval, err = time.ParseDuration(interval)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid interval",
+		})
+	}
+	if query.Interval < query.Resolution.Step {
+		query.Interval = query.Resolution.Step
+		interval = query.Resolution.Name
+	}
+
+	series, truncated, err := getSeries(c.Context(), h.pool, projectID, query)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get metric series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"series":     series,
+		"truncated":  truncated,
+		"resolution": query.Resolution.Name,
+		"interval":   interval,
+	})
+}
+
+// getSeries aggregates the points of a metric per series and interval from
+// the query's resolution. At most maxQuerySeries series are returned, the
+// second result reports whether more exist.
+func getSeries(ctx context.Context, pool *pgxpool.Pool, projectID string, query seriesQuery) ([]*MetricSeries, bool, error) {
+	args := []interface{}{projectID, query.Name, query.Start, query.End}
+	conditions := []string{
+		"project_id = $1",
+		"name = $2",
+		"bucket >= $3",
+		"bucket < $4",
+	}
+	if query.ServiceName != "" {
+		args = append(args, query.ServiceName)
+		conditions = append(conditions, fmt.Sprintf("service_name = $%d", len(args)))
+	}
+
+	interval := rollup.IntervalLiteral(query.Interval)
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT
+			series_key, service_name, attributes, type, aggregation_temporality, bounds,
+			time_bucket(%[1]s, bucket) AS point_time,
+			%[2]s
+		FROM %[3]s AS source
+		WHERE %[4]s
+		GROUP BY series_key, service_name, attributes, type, aggregation_temporality, bounds,
+			time_bucket(%[1]s, bucket)
+		ORDER BY service_name, series_key, point_time`,
+		interval, rollup.Aggregates, query.Resolution.Source(), strings.Join(conditions, " AND ")),
+		args...,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	series := []*MetricSeries{}
+	truncated := false
+	var current *MetricSeries
+	var currentKey string
+
+	for rows.Next() {
+		var (
+			key, serviceName string
+			attributes       models.JSONB
+			metricType       models.MetricType
+			temporality      models.AggregationTemporality
+			bounds           []float64
+			pointTime        time.Time
+			valueSum         *float64
+			point            SeriesPoint
+		)
+		if err := rows.Scan(
+			&key, &serviceName, &attributes, &metricType, &temporality, &bounds,
+			&pointTime,
+			&point.Last, &valueSum, &point.Min, &point.Max, &point.Points,
+			&point.BucketCounts, &point.Count, &point.Sum,
+		); err != nil {
+			return nil, false, err
+		}
+
+		if current == nil || key != currentKey || serviceName != current.ServiceName {
+			if len(series) == maxQuerySeries {
+				truncated = true
+				break
+			}
+			current = &MetricSeries{
+				ServiceName:            serviceName,
+				Attributes:             attributes,
+				Type:                   metricType,
+				AggregationTemporality: temporality,
+				Bounds:                 bounds,
+				Points:                 []SeriesPoint{},
+			}
+			currentKey = key
+			series = append(series, current)
+		}
+
+		point.Timestamp = timescale.TimeToUnixMs(pointTime)
+		if valueSum != nil && point.Points > 0 {
+			avg := *valueSum / float64(point.Points)
+			point.Avg = &avg
+		}
+		switch {
+		case metricType == models.MetricTypeGauge:
+			point.Value = point.Avg
+		case metricType == models.MetricTypeSum && temporality == models.AggregationTemporalityDelta:
+			point.Value = valueSum
+		case metricType == models.MetricTypeSum:
+			point.Value = point.Last
+		}
+		current.Points = append(current.Points, point)
+	}
+
+	return series, truncated, rows.Err()
+}
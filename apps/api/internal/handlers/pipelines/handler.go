@@ -0,0 +1,18 @@
+package pipelines
+
+import (
+	"github.com/ted-too/logsicle/internal/pipeline"
+	"gorm.io/gorm"
+)
+
+type PipelinesHandler struct {
+	db     *gorm.DB
+	runner *pipeline.Runner
+}
+
+func NewPipelinesHandler(db *gorm.DB, runner *pipeline.Runner) *PipelinesHandler {
+	return &PipelinesHandler{
+		db:     db,
+		runner: runner,
+	}
+}
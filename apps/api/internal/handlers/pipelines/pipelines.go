@@ -0,0 +1,246 @@
+package pipelines
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/pipeline"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+// Maximum number of processors in a single pipeline
+const maxProcessors = 100
+
+type CreatePipelineInput struct {
+	Name        string                     `json:"name"`
+	Description *string                    `json:"description"`
+	Enabled     *bool                      `json:"enabled"`
+	Position    *int                       `json:"position"`
+	Processors  []pipeline.ProcessorConfig `json:"processors"`
+}
+
+func (i CreatePipelineInput) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&i.Description, validation.Length(0, 1000)),
+		validation.Field(&i.Position, validation.Min(0)),
+		validation.Field(&i.Processors, validation.Length(0, maxProcessors)),
+	)
+}
+
+type UpdatePipelineInput struct {
+	Name        *string                     `json:"name"`
+	Description *string                     `json:"description"`
+	Enabled     *bool                       `json:"enabled"`
+	Position    *int                        `json:"position"`
+	Processors  *[]pipeline.ProcessorConfig `json:"processors"`
+}
+
+func (i UpdatePipelineInput) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Name, validation.NilOrNotEmpty, validation.Length(1, 255)),
+		validation.Field(&i.Description, validation.Length(0, 1000)),
+		validation.Field(&i.Position, validation.Min(0)),
+		validation.Field(&i.Processors, validation.Length(0, maxProcessors)),
+	)
+}
+
+// encodeProcessors compiles processors to reject invalid configs before they
+// are stored
+func encodeProcessors(processors []pipeline.ProcessorConfig) (string, error) {
+	if processors == nil {
+		processors = []pipeline.ProcessorConfig{}
+	}
+	if _, err := pipeline.Compile(processors); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(processors)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (h *PipelinesHandler) ListPipelines(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	var pipelines []models.Pipeline
+	if err := h.db.Where("project_id = ?", projectID).
+		Order("position ASC, created_at ASC").
+		Find(&pipelines).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch pipelines",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(pipelines)
+}
+
+func (h *PipelinesHandler) GetPipeline(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	pipelineID := c.Params("pipelineId")
+
+	var p models.Pipeline
+	if err := h.db.Where("id = ? AND project_id = ?", pipelineID, projectID).First(&p).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Pipeline not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch pipeline",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(p)
+}
+
+func (h *PipelinesHandler) CreatePipeline(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	input := new(CreatePipelineInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	processors, err := encodeProcessors(input.Processors)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid processors",
+			"error":   err.Error(),
+		})
+	}
+
+	p := &models.Pipeline{
+		ProjectID:  projectID,
+		Name:       input.Name,
+		Enabled:    true,
+		Processors: processors,
+	}
+	if input.Description != nil {
+		p.Description = sql.NullString{String: *input.Description, Valid: true}
+	}
+	if input.Enabled != nil {
+		p.Enabled = *input.Enabled
+	}
+	if input.Position != nil {
+		p.Position = *input.Position
+	}
+
+	// Select all columns so a false Enabled is not replaced by the default
+	if err := h.db.Select("*").Create(p).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create pipeline",
+			"error":   err.Error(),
+		})
+	}
+
+	h.runner.Invalidate(projectID)
+
+	return c.Status(fiber.StatusCreated).JSON(p)
+}
+
+// UpdatePipeline updates a pipeline. Omitted fields keep their current value.
+func (h *PipelinesHandler) UpdatePipeline(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	pipelineID := c.Params("pipelineId")
+
+	input := new(UpdatePipelineInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	var p models.Pipeline
+	if err := h.db.Where("id = ? AND project_id = ?", pipelineID, projectID).First(&p).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Pipeline not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch pipeline",
+			"error":   err.Error(),
+		})
+	}
+
+	if input.Processors != nil {
+		processors, err := encodeProcessors(*input.Processors)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid processors",
+				"error":   err.Error(),
+			})
+		}
+		p.Processors = processors
+	}
+	if input.Name != nil {
+		p.Name = *input.Name
+	}
+	if input.Description != nil {
+		p.Description = sql.NullString{String: *input.Description, Valid: *input.Description != ""}
+	}
+	if input.Enabled != nil {
+		p.Enabled = *input.Enabled
+	}
+	if input.Position != nil {
+		p.Position = *input.Position
+	}
+
+	if err := h.db.Save(&p).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update pipeline",
+			"error":   err.Error(),
+		})
+	}
+
+	h.runner.Invalidate(projectID)
+
+	return c.JSON(p)
+}
+
+func (h *PipelinesHandler) DeletePipeline(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	pipelineID := c.Params("pipelineId")
+
+	result := h.db.Where("id = ? AND project_id = ?", pipelineID, projectID).Delete(&models.Pipeline{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete pipeline",
+			"error":   result.Error.Error(),
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Pipeline not found",
+		})
+	}
+
+	h.runner.Invalidate(projectID)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
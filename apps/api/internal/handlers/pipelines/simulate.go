@@ -0,0 +1,97 @@
+package pipelines
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/pipeline"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Maximum number of sample logs per simulation
+const maxSimulateLogs = 100
+
+// SimulateInput runs sample logs through the given processors, or through
+// the project's enabled pipelines when processors is omitted
+type SimulateInput struct {
+	Processors *[]pipeline.ProcessorConfig `json:"processors"`
+	Logs       []models.AppLogInput        `json:"logs"`
+}
+
+func (i SimulateInput) Validate() error {
+	return validation.ValidateStruct(&i,
+		validation.Field(&i.Processors, validation.Length(0, maxProcessors)),
+		validation.Field(&i.Logs, validation.Required, validation.Length(1, maxSimulateLogs)),
+	)
+}
+
+type SimulateResult struct {
+	Input  models.AppLogInput `json:"input"`
+	Output *models.AppLog     `json:"output,omitempty"`
+	pipeline.Result
+	Error string `json:"error,omitempty"`
+}
+
+// Simulate shows what ingest pipelines do to sample logs without storing
+// anything
+func (h *PipelinesHandler) Simulate(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	input := new(SimulateInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	var pipelines []*pipeline.Pipeline
+	if input.Processors != nil {
+		compiled, err := pipeline.Compile(*input.Processors)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid processors",
+				"error":   err.Error(),
+			})
+		}
+		pipelines = []*pipeline.Pipeline{compiled}
+	} else {
+		loaded, err := h.runner.Load(c.Context(), projectID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to load pipelines",
+				"error":   err.Error(),
+			})
+		}
+		pipelines = loaded
+	}
+
+	results := make([]SimulateResult, 0, len(input.Logs))
+	for _, sample := range input.Logs {
+		sample.ProjectID = projectID
+		result := SimulateResult{Input: sample}
+
+		appLog, err := sample.ValidateAndCreate()
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.Result = pipeline.Run(appLog, pipelines...)
+		if !result.Dropped {
+			result.Output = appLog
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+	})
+}
@@ -0,0 +1,18 @@
+package redaction
+
+import (
+	"github.com/ted-too/logsicle/internal/redaction"
+	"gorm.io/gorm"
+)
+
+type RedactionHandler struct {
+	db     *gorm.DB
+	runner *redaction.Runner
+}
+
+func NewRedactionHandler(db *gorm.DB, runner *redaction.Runner) *RedactionHandler {
+	return &RedactionHandler{
+		db:     db,
+		runner: runner,
+	}
+}
@@ -0,0 +1,174 @@
+package redaction
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/lib/pq"
+	"github.com/ted-too/logsicle/internal/redaction"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+type UpdateSettingsInput struct {
+	Enabled         *bool                   `json:"enabled"`
+	Mode            *string                 `json:"mode"`
+	Detectors       *[]string               `json:"detectors"`
+	Rules           *[]models.RedactionRule `json:"rules"`
+	IPAnonymization *string                 `json:"ip_anonymization"`
+}
+
+func validateDetectors(value interface{}) error {
+	detectors, _ := value.(*[]string)
+	if detectors == nil {
+		return nil
+	}
+	for _, detector := range *detectors {
+		if err := validation.Validate(detector, validation.In(
+			models.RedactionDetectorAuthorization,
+			models.RedactionDetectorCookie,
+			models.RedactionDetectorCreditCard,
+			models.RedactionDetectorEmail,
+			models.RedactionDetectorJWT,
+			models.RedactionDetectorIP,
+		)); err != nil {
+			return fmt.Errorf("%s: %w", detector, err)
+		}
+	}
+	return nil
+}
+
+func validateRules(value interface{}) error {
+	rules, _ := value.(*[]models.RedactionRule)
+	if rules == nil {
+		return nil
+	}
+	for i, rule := range *rules {
+		if err := redaction.ValidateRule(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (u UpdateSettingsInput) Validate() error {
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.Mode, redaction.ModeRule),
+		validation.Field(&u.Detectors, validation.By(validateDetectors)),
+		validation.Field(&u.Rules, validation.Length(0, redaction.MaxRules), validation.By(validateRules)),
+		validation.Field(&u.IPAnonymization, validation.In(
+			models.IPAnonymizationNone,
+			models.IPAnonymizationTruncate,
+			models.IPAnonymizationHash,
+			models.IPAnonymizationRemove,
+		)),
+	)
+}
+
+func (h *RedactionHandler) loadSettings(projectID string) (*models.RedactionSettings, error) {
+	var settings models.RedactionSettings
+	err := h.db.Where("project_id = ?", projectID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = models.DefaultRedactionSettings(projectID)
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetSettings returns the project's redaction settings, or the defaults when
+// none have been configured
+func (h *RedactionHandler) GetSettings(c fiber.Ctx) error {
+	settings, err := h.loadSettings(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch redaction settings",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateSettings creates or updates the project's redaction settings.
+// Omitted fields keep their current value.
+func (h *RedactionHandler) UpdateSettings(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	input := new(UpdateSettingsInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	settings, err := h.loadSettings(projectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch redaction settings",
+			"error":   err.Error(),
+		})
+	}
+
+	if input.Enabled != nil {
+		settings.Enabled = *input.Enabled
+	}
+	if input.Mode != nil {
+		settings.Mode = *input.Mode
+	}
+	if input.Detectors != nil {
+		settings.Detectors = pq.StringArray(*input.Detectors)
+	}
+	if input.Rules != nil {
+		rules := *input.Rules
+		if rules == nil {
+			rules = []models.RedactionRule{}
+		}
+		b, err := json.Marshal(rules)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid rules",
+				"error":   err.Error(),
+			})
+		}
+		settings.Rules = string(b)
+	}
+	if input.IPAnonymization != nil {
+		settings.IPAnonymization = *input.IPAnonymization
+	}
+
+	if settings.Detectors == nil {
+		settings.Detectors = pq.StringArray{}
+	}
+
+	// Select all columns on create so a false Enabled is not replaced by the
+	// column default
+	if settings.ID == "" {
+		err = h.db.Select("*").Create(settings).Error
+	} else {
+		err = h.db.Save(settings).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update redaction settings",
+			"error":   err.Error(),
+		})
+	}
+
+	h.runner.Invalidate(projectID)
+
+	return c.JSON(settings)
+}
@@ -1,6 +1,8 @@
 package requests
 
 import (
+	"encoding/json"
+
 	"github.com/gofiber/fiber/v3"
 	"github.com/ted-too/logsicle/internal/server"
 	"github.com/ted-too/logsicle/internal/storage/timescale/models"
@@ -40,6 +42,10 @@ type IngestBatchRequestLogBody struct {
 }
 
 func (h *RequestLogsHandler) IngestBatchRequestLog(c fiber.Ctx) error {
+	if server.IsNDJSON(c) {
+		return h.ingestBatchNDJSON(c)
+	}
+
 	input := new(IngestBatchRequestLogBody)
 	if err := c.Bind().JSON(input); err != nil {
 		return server.SendError(c, err)
@@ -82,3 +88,33 @@ func (h *RequestLogsHandler) IngestBatchRequestLog(c fiber.Ctx) error {
 		"failed":    failed,
 	}, fiber.StatusAccepted)
 }
+
+// ingestBatchNDJSON ingests an application/x-ndjson body with one
+// RequestLogInput per line, reporting rejected lines by line number
+func (h *RequestLogsHandler) ingestBatchNDJSON(c fiber.Ctx) error {
+	projectID, ok := c.Locals("project_id").(string)
+	if !ok {
+		return server.SendError(c, fiber.NewError(fiber.StatusInternalServerError, "Failed to get project ID"), fiber.StatusInternalServerError)
+	}
+
+	return server.IngestNDJSON(c, func(line []byte) (int, error) {
+		var input models.RequestLogInput
+		if err := json.Unmarshal(line, &input); err != nil {
+			return fiber.StatusBadRequest, err
+		}
+		if err := server.MatchProject(&input.ProjectID, projectID); err != nil {
+			return fiber.StatusForbidden, err
+		}
+
+		log, err := input.ValidateAndCreate()
+		if err != nil {
+			return fiber.StatusBadRequest, err
+		}
+
+		if err := h.queue.EnqueueRequestLog(c.Context(), log); err != nil {
+			return fiber.StatusInternalServerError, err
+		}
+
+		return 0, nil
+	})
+}
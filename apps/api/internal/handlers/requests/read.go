@@ -7,6 +7,8 @@ import (
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/middleware"
+	storageModels "github.com/ted-too/logsicle/internal/storage/models"
 	"github.com/ted-too/logsicle/internal/storage/timescale"
 	"github.com/ted-too/logsicle/internal/storage/timescale/models"
 )
@@ -17,6 +19,7 @@ type Filter struct {
 	PathPattern *string  `json:"path_pattern,omitempty" query:"path_pattern"`
 	Host        *string  `json:"host,omitempty" query:"host"`
 	Level       []string `json:"level,omitempty" query:"level"`
+	TraceID     *string  `json:"trace_id,omitempty" query:"traceId"`
 }
 
 func (f Filter) ProcessLevels() []string {
@@ -205,7 +208,15 @@ func (h *RequestLogsHandler) GetRequestLogs(c fiber.Ctx) error {
 		baseParams = append(baseParams, *query.Host)
 		paramCount++
 	}
-	if query.Search != nil {
+	if query.TraceID != nil {
+		whereClause += fmt.Sprintf(" AND rl.trace_id = $%d", paramCount)
+		baseParams = append(baseParams, strings.ToLower(*query.TraceID))
+		paramCount++
+	}
+	// Bodies and headers are neither searched nor returned without permission
+	// to view them
+	canViewBodies := middleware.HasProjectPermission(c, storageModels.PermissionViewRequestBodies)
+	if query.Search != nil && canViewBodies {
 		whereClause += fmt.Sprintf(`
 			AND (
 				rl.path ILIKE $%d
@@ -215,6 +226,17 @@ func (h *RequestLogsHandler) GetRequestLogs(c fiber.Ctx) error {
 				OR rl.response_body::text ILIKE $%d
 			)`, paramCount, paramCount, paramCount, paramCount, paramCount)
 
+		searchTerm := fmt.Sprintf("%%%s%%", *query.Search)
+		baseParams = append(baseParams, searchTerm)
+		paramCount++
+	} else if query.Search != nil {
+		whereClause += fmt.Sprintf(`
+			AND (
+				rl.path ILIKE $%d
+				OR rl.host ILIKE $%d
+				OR rl.error ILIKE $%d
+			)`, paramCount, paramCount, paramCount)
+
 		searchTerm := fmt.Sprintf("%%%s%%", *query.Search)
 		baseParams = append(baseParams, searchTerm)
 		paramCount++
@@ -248,7 +270,8 @@ func (h *RequestLogsHandler) GetRequestLogs(c fiber.Ctx) error {
 			rl.id, rl.project_id, rl.method, rl.path, rl.status_code,
 			rl.level, rl.duration, rl.request_body, rl.response_body, rl.headers, 
 			rl.query_params, rl.user_agent, rl.ip_address, rl.protocol, 
-			rl.host, rl.error, rl.timestamp
+			rl.host, rl.error, rl.timestamp,
+			COALESCE(rl.trace_id, ''), COALESCE(rl.span_id, '')
 	` + baseQuery + whereClause + `
 		ORDER BY rl.timestamp DESC
 		LIMIT $` + fmt.Sprint(paramCount) + ` OFFSET $` + fmt.Sprint(paramCount+1)
@@ -273,6 +296,7 @@ func (h *RequestLogsHandler) GetRequestLogs(c fiber.Ctx) error {
 			&log.Level, &log.Duration, &log.RequestBody, &log.ResponseBody, &log.Headers,
 			&log.QueryParams, &log.UserAgent, &log.IPAddress, &log.Protocol,
 			&log.Host, &log.Error, &log.Timestamp,
+			&log.TraceID, &log.SpanID,
 		)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -280,6 +304,9 @@ func (h *RequestLogsHandler) GetRequestLogs(c fiber.Ctx) error {
 				"message": err.Error(),
 			})
 		}
+		if !canViewBodies {
+			log.StripPayloads()
+		}
 		logs = append(logs, log)
 	}
 
@@ -8,6 +8,8 @@ import (
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/log"
+	"github.com/ted-too/logsicle/internal/middleware"
+	storageModels "github.com/ted-too/logsicle/internal/storage/models"
 	"github.com/ted-too/logsicle/internal/storage/timescale/models"
 )
 
@@ -22,6 +24,7 @@ func (h *RequestLogsHandler) StreamLogs(c fiber.Ctx) error {
 
 	ctx := c.Context()
 	channel := make(chan models.RequestLog)
+	canViewBodies := middleware.HasProjectPermission(c, storageModels.PermissionViewRequestBodies)
 
 	// Start Redis subscription in a goroutine
 	go h.subscribeToRequestLogs(ctx, projectID, channel)
@@ -30,6 +33,9 @@ func (h *RequestLogsHandler) StreamLogs(c fiber.Ctx) error {
 		for {
 			select {
 			case requestLog := <-channel:
+				if !canViewBodies {
+					requestLog.StripPayloads()
+				}
 				jsonData, err := json.Marshal(requestLog)
 				if err != nil {
 					continue
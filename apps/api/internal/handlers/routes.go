@@ -1,33 +1,86 @@
 package handlers
 
 import (
+	"bytes"
 	"log"
+	"regexp"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/blobstore"
+	"github.com/ted-too/logsicle/internal/cardinality"
 	"github.com/ted-too/logsicle/internal/config"
 	appHandler "github.com/ted-too/logsicle/internal/handlers/app"
+	artifactsHandler "github.com/ted-too/logsicle/internal/handlers/artifacts"
 	authHandler "github.com/ted-too/logsicle/internal/handlers/auth"
+	esHandler "github.com/ted-too/logsicle/internal/handlers/elasticsearch"
 	"github.com/ted-too/logsicle/internal/handlers/events"
+	issuesHandler "github.com/ted-too/logsicle/internal/handlers/issues"
+	jaegerHandler "github.com/ted-too/logsicle/internal/handlers/jaeger"
+	lokiHandler "github.com/ted-too/logsicle/internal/handlers/loki"
 	metricsHandler "github.com/ted-too/logsicle/internal/handlers/metrics"
+	pipelinesHandler "github.com/ted-too/logsicle/internal/handlers/pipelines"
+	redactionHandler "github.com/ted-too/logsicle/internal/handlers/redaction"
 	requestsHandler "github.com/ted-too/logsicle/internal/handlers/requests"
+	samplingHandler "github.com/ted-too/logsicle/internal/handlers/sampling"
 	"github.com/ted-too/logsicle/internal/handlers/teams"
 	tracesHandler "github.com/ted-too/logsicle/internal/handlers/traces"
+	zipkinHandler "github.com/ted-too/logsicle/internal/handlers/zipkin"
+	"github.com/ted-too/logsicle/internal/mailer"
 	"github.com/ted-too/logsicle/internal/middleware"
+	"github.com/ted-too/logsicle/internal/oauth"
+	"github.com/ted-too/logsicle/internal/pipeline"
 	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/redaction"
+	"github.com/ted-too/logsicle/internal/sampling"
+	"github.com/ted-too/logsicle/internal/server"
+	"github.com/ted-too/logsicle/internal/sourcemap"
 	"github.com/ted-too/logsicle/internal/storage/models"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *queue.Processor, queueService *queue.QueueService, cfg *config.Config) {
-	authHandler := authHandler.NewAuthHandler(db)
+// Path prefixes of the ingest routes, which accept bodies up to the ingest
+// body limit
+var ingestPathPrefixes = []string{"/v1/ingest/", "/loki/api/v1/", "/es/", "/api/"}
+
+// Artifact uploads are multipart forms, the body limit leaves room for the
+// form fields around the file
+var artifactUploadPath = regexp.MustCompile(`^/v1/projects/[^/]+/releases/[^/]+/artifacts$`)
+
+const artifactFormOverhead = 64 * 1024
+
+func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *queue.Processor, queueService *queue.QueueService, pipelineRunner *pipeline.Runner, redactionRunner *redaction.Runner, artifactStore blobstore.Store, symbolicator *sourcemap.Symbolicator, sampler *sampling.Sampler, metricLimiter *cardinality.Limiter, mail mailer.Mailer, cfg *config.Config) {
+	authHandler := authHandler.NewAuthHandler(db, oauth.NewRegistry(cfg), mail, cfg)
 	teamsHandler := teams.NewTeamsHandler(db)
 	eventsHandler := events.NewEventsHandler(db, pool, queueService)
 	appHandler := appHandler.NewAppLogsHandler(db, pool, queueService)
 	requestsHandler := requestsHandler.NewRequestLogsHandler(db, pool, queueService)
-	metricsHandler := metricsHandler.NewMetricsHandler(db, pool, queueService)
+	metricsHandler := metricsHandler.NewMetricsHandler(db, pool, queueService, metricLimiter)
 	tracesHandler := tracesHandler.NewTracesHandler(db, pool, queueService)
+	lokiHandler := lokiHandler.NewLokiHandler(db, queueService)
+	esHandler := esHandler.NewElasticsearchHandler(db, queueService)
+	zipkinHandler := zipkinHandler.NewZipkinHandler(db, queueService)
+	jaegerHandler := jaegerHandler.NewJaegerHandler(db, queueService)
+	pipelinesHandler := pipelinesHandler.NewPipelinesHandler(db, pipelineRunner)
+	redactionHandler := redactionHandler.NewRedactionHandler(db, redactionRunner)
+	issuesHandler := issuesHandler.NewIssuesHandler(db, pool)
+	artifactsHandler := artifactsHandler.NewArtifactsHandler(db, artifactStore, symbolicator, cfg.Artifacts.MaxSize)
+	samplingHandler := samplingHandler.NewSamplingHandler(db, sampler)
+
+	// Only ingest routes and artifact uploads accept bodies beyond the
+	// default limit
+	server.LimitBodies(app, func(path []byte) int {
+		for _, prefix := range ingestPathPrefixes {
+			if bytes.HasPrefix(path, []byte(prefix)) {
+				return cfg.Ingest.MaxBodySize
+			}
+		}
+		if artifactUploadPath.Match(path) {
+			return cfg.Artifacts.MaxSize + artifactFormOverhead
+		}
+		return 0
+	})
 
 	// Health check endpoint
 	app.Get("/health", func(c fiber.Ctx) error {
@@ -49,6 +102,64 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *que
 		v1Ingest.Post("/trace/batch", tracesHandler.IngestBatchTrace)
 	}
 
+	// Loki push API compatibility
+	loki := app.Group("/loki/api/v1", middleware.HeaderAPIAuth(db, models.ScopeAppLogsWrite))
+	{
+		loki.Post("/push", lokiHandler.Push)
+	}
+
+	// Elasticsearch bulk API compatibility, clients use /es as their base URL
+	es := app.Group("/es", esHandler.ProductHeader, middleware.HeaderAPIAuth(db, models.ScopeAppLogsWrite, models.ScopeRequestWrite))
+	{
+		es.Get("/", esHandler.Info)
+		es.Head("/", esHandler.Info)
+		es.Get("/_license", esHandler.License)
+		es.Get("/_xpack", esHandler.XPack)
+		es.Post("/_bulk", esHandler.Bulk)
+		es.Put("/_bulk", esHandler.Bulk)
+		es.Post("/:index/_bulk", esHandler.Bulk)
+		es.Put("/:index/_bulk", esHandler.Bulk)
+
+		// Index templates and ILM policies are accepted but not stored
+		for _, resource := range []string{"/_index_template/:name", "/_template/:name", "/_ilm/policy/:name"} {
+			es.Get(resource, esHandler.ResourceNotFound)
+			es.Head(resource, esHandler.ResourceNotFound)
+			es.Put(resource, esHandler.Acknowledge)
+		}
+	}
+
+	// Zipkin v2 and Jaeger collector compatibility for traces
+	collectors := app.Group("/api", middleware.HeaderAPIAuth(db, models.ScopeTracesWrite))
+	{
+		collectors.Post("/v2/spans", zipkinHandler.PostSpans)
+		collectors.Post("/traces", jaegerHandler.PostSpans)
+	}
+
+	// Jaeger query API for the Grafana Jaeger data source, which uses /jaeger
+	// as its base URL
+	jaegerQuery := app.Group("/jaeger/api", middleware.HeaderAPIAuth(db, models.ScopeTracesRead))
+	{
+		jaegerQuery.Get("/services", tracesHandler.JaegerServices)
+		jaegerQuery.Get("/services/:service/operations", tracesHandler.JaegerServiceOperations)
+		jaegerQuery.Get("/operations", tracesHandler.JaegerOperations)
+		jaegerQuery.Get("/traces", tracesHandler.JaegerSearchTraces)
+		jaegerQuery.Get("/traces/:traceId", tracesHandler.JaegerGetTrace)
+	}
+
+	// Tempo query API for the Grafana Tempo data source, which uses /tempo
+	// as its base URL
+	tempo := app.Group("/tempo/api", middleware.HeaderAPIAuth(db, models.ScopeTracesRead))
+	{
+		tempo.Get("/echo", tracesHandler.TempoEcho)
+		tempo.Get("/search", tracesHandler.TempoSearch)
+		tempo.Get("/search/tags", tracesHandler.TempoSearchTags)
+		tempo.Get("/search/tag/:name/values", tracesHandler.TempoSearchTagValues)
+		tempo.Get("/traces/:traceId", tracesHandler.TempoTraceByID)
+		tempo.Get("/v2/search/tags", tracesHandler.TempoSearchTagsV2)
+		tempo.Get("/v2/search/tag/:name/values", tracesHandler.TempoSearchTagValuesV2)
+		tempo.Get("/v2/traces/:traceId", tracesHandler.TempoTraceByIDV2)
+	}
+
 	// FIXME: Make super authd middleware
 	v1SuperAuthd := app.Group("/v1")
 	{
@@ -71,6 +182,18 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *que
 		auth.Post("/sign-up", authHandler.Register)
 		auth.Post("/sign-in", authHandler.Login)
 		auth.Post("/sign-out", authHandler.Logout)
+		auth.Post("/two-factor", authHandler.VerifyTwoFactorLogin)
+		auth.Post("/verify-email", authHandler.VerifyEmail)
+		auth.Post("/forgot-password", authHandler.ForgotPassword)
+		auth.Post("/reset-password", authHandler.ResetPassword)
+
+		// Social login and organization SSO
+		auth.Get("/providers", authHandler.ListProviders)
+		auth.Get("/oauth/:provider", authHandler.StartOAuth)
+		auth.Get("/oauth/:provider/callback", authHandler.OAuthCallback)
+		auth.Get("/sso", authHandler.FindSSO)
+		auth.Get("/sso/callback", authHandler.SSOCallback)
+		auth.Get("/sso/:slug", authHandler.StartSSO)
 
 		// Invitation routes (for non-authenticated users)
 		auth.Get("/invitations/:token", teamsHandler.ValidateInvitation)
@@ -80,21 +203,47 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *que
 	requireManagementMiddleware := middleware.RequireRole(models.RoleAdmin, models.RoleOwner)
 
 	// Protected routes
-	v1Authd := v1.Group("", middleware.AuthMiddleware(db))
+	v1Authd := v1.Group("", middleware.AuthMiddleware(db, cfg.SessionIdleTimeout()))
 	{
 		// User routes
 		v1Authd.Get("/me", authHandler.Me)
 		v1Authd.Patch("/me", authHandler.UpdateUser)
+		v1Authd.Post("/me/verify-email", authHandler.ResendEmailVerification)
+		v1Authd.Post("/me/password", authHandler.ChangePassword)
+		v1Authd.Post("/me/two-factor", authHandler.EnrollTwoFactor)
+		v1Authd.Post("/me/two-factor/confirm", authHandler.ConfirmTwoFactor)
+		v1Authd.Post("/me/two-factor/recovery-codes", authHandler.RegenerateRecoveryCodes)
+		v1Authd.Delete("/me/two-factor", authHandler.DisableTwoFactor)
+		v1Authd.Get("/me/sessions", authHandler.ListSessions)
+		v1Authd.Delete("/me/sessions", authHandler.RevokeOtherSessions)
+		v1Authd.Delete("/me/sessions/:sessionId", authHandler.RevokeSession)
+		v1Authd.Get("/me/accounts", authHandler.ListAccounts)
+		v1Authd.Delete("/me/accounts/:accountId", authHandler.UnlinkAccount)
 
 		// Invitation acceptance for authenticated users
 		v1Authd.Post("/invitations/accept", authHandler.AcceptInvitation)
 
+		// Organization SSO (requires active organization and admin role)
+		orgSSO := v1Authd.Group("/organizations/sso", middleware.RequireActiveOrganization(db), requireManagementMiddleware)
+		{
+			orgSSO.Get("", authHandler.GetSSOProvider)
+			orgSSO.Put("", authHandler.UpdateSSOProvider)
+			orgSSO.Delete("", authHandler.DeleteSSOProvider)
+			orgSSO.Post("/domains/verify", authHandler.VerifySSODomains)
+		}
+
+		// Organization two-factor policy (requires active organization and admin role)
+		v1Authd.Put("/organizations/two-factor", authHandler.UpdateTwoFactorPolicy, middleware.RequireActiveOrganization(db), requireManagementMiddleware)
+
 		// Organization routes
 		v1Authd.Post("/organizations", teamsHandler.CreateOrganization)
 		v1Authd.Get("/organizations", teamsHandler.ListUserOrganizationMemberships)
 		v1Authd.Get("/organizations/members", teamsHandler.ListOrganizationMembers)
+		v1Authd.Delete("/organizations/members/:userId", teamsHandler.RemoveOrganizationMember, middleware.RequireActiveOrganization(db), requireManagementMiddleware)
+		v1Authd.Delete("/organizations/members/:userId/sessions", authHandler.RevokeMemberSessions, middleware.RequireActiveOrganization(db), middleware.RequireRole(models.RoleOwner))
 		v1Authd.Delete("/organizations/:id", teamsHandler.DeleteOrganization, requireManagementMiddleware)
 		v1Authd.Post("/organizations/:id/activate", authHandler.SetActiveOrganization)
+		v1Authd.Post("/organizations/:id/leave", teamsHandler.LeaveOrganization)
 
 		// Organization invitations (requires active organization and admin role)
 		orgInvitationsAdmin := v1Authd.Group("/invitations", middleware.RequireActiveOrganization(db), requireManagementMiddleware)
@@ -108,49 +257,113 @@ func SetupRoutes(app *fiber.App, db *gorm.DB, pool *pgxpool.Pool, processor *que
 		// Project routes (requires active organization)
 		projects := v1Authd.Group("/projects", middleware.RequireActiveOrganization(db))
 		{
-			projectsManagement := projects.Group("", requireManagementMiddleware)
-			projectsManagement.Post("", teamsHandler.CreateProject)
+			projects.Post("", teamsHandler.CreateProject, requireManagementMiddleware)
 			projects.Get("", teamsHandler.ListProjects)
-			projects.Get("/:id", teamsHandler.GetProject)
-			projectsManagement.Patch("/:id", teamsHandler.UpdateProject)
-			projectsManagement.Delete("/:id", teamsHandler.DeleteProject)
+		}
+
+		// Routes of a single project require a project role, organization
+		// owners and admins are admins of every project
+		project := projects.Group("/:id", middleware.RequireProjectAccess(db))
+		{
+			canViewProject := middleware.RequireProjectPermission(models.PermissionViewProject)
+			canTriageIssues := middleware.RequireProjectPermission(models.PermissionTriageIssues)
+			canManageSettings := middleware.RequireProjectPermission(models.PermissionManageSettings)
+			canDeleteLogs := middleware.RequireProjectPermission(models.PermissionDeleteLogs)
+			canManageAPIKeys := middleware.RequireProjectPermission(models.PermissionManageAPIKeys)
+			canManageMembers := middleware.RequireProjectPermission(models.PermissionManageMembers)
+			canManageProject := middleware.RequireProjectPermission(models.PermissionManageProject)
+
+			project.Get("", teamsHandler.GetProject, canViewProject)
+			project.Patch("", teamsHandler.UpdateProject, canManageProject)
+			project.Delete("", teamsHandler.DeleteProject, canManageProject)
+			project.Get("/permissions", teamsHandler.GetProjectPermissions, canViewProject)
+
+			// Project members
+			project.Get("/members", teamsHandler.ListProjectMembers, canViewProject)
+			project.Post("/members", teamsHandler.AddProjectMember, canManageMembers)
+			project.Patch("/members/:userId", teamsHandler.UpdateProjectMember, canManageMembers)
+			project.Delete("/members/:userId", teamsHandler.RemoveProjectMember, canManageMembers)
 
 			// API Key routes
-			projectsManagement.Post("/:id/api-keys", authHandler.CreateAPIKey)
-			projectsManagement.Get("/:id/api-keys", authHandler.ListAPIKeys)
-			projectsManagement.Delete("/:id/api-keys/:keyId", authHandler.DeleteAPIKey)
+			project.Post("/api-keys", authHandler.CreateAPIKey, canManageAPIKeys)
+			project.Get("/api-keys", authHandler.ListAPIKeys, canManageAPIKeys)
+			project.Delete("/api-keys/:keyId", authHandler.DeleteAPIKey, canManageAPIKeys)
+
+			// Elasticsearch bulk API field mapping
+			project.Get("/elasticsearch/mapping", esHandler.GetMapping, canViewProject)
+			project.Put("/elasticsearch/mapping", esHandler.UpdateMapping, canManageSettings)
+
+			// Ingest pipeline routes
+			project.Get("/pipelines", pipelinesHandler.ListPipelines, canViewProject)
+			project.Post("/pipelines/simulate", pipelinesHandler.Simulate, canViewProject)
+			project.Get("/pipelines/:pipelineId", pipelinesHandler.GetPipeline, canViewProject)
+			project.Post("/pipelines", pipelinesHandler.CreatePipeline, canManageSettings)
+			project.Patch("/pipelines/:pipelineId", pipelinesHandler.UpdatePipeline, canManageSettings)
+			project.Delete("/pipelines/:pipelineId", pipelinesHandler.DeletePipeline, canManageSettings)
+
+			// Request log redaction settings
+			project.Get("/redaction", redactionHandler.GetSettings, canViewProject)
+			project.Put("/redaction", redactionHandler.UpdateSettings, canManageProject)
 
 			// Events routes
-			projects.Get("/:id/events", eventsHandler.GetEventLogs)
-			projects.Delete("/:id/events/:eventId", eventsHandler.DeleteEvent, requireManagementMiddleware)
-			projects.Get("/:id/events/stream", eventsHandler.StreamEvents)
-			projects.Get("/:id/events/metrics", eventsHandler.GetMetrics)
-			projects.Get("/:id/events/channels", eventsHandler.GetEventChannels)
-			projects.Get("/:id/events/channels/:channelId", eventsHandler.GetEventChannel)
-			projectsManagement.Post("/:id/events/channels", eventsHandler.CreateChannel)
-			projectsManagement.Patch("/:id/events/channels/:channelId", eventsHandler.UpdateChannel)
-			projectsManagement.Delete("/:id/events/channels/:channelId", eventsHandler.DeleteChannel)
+			project.Get("/events", eventsHandler.GetEventLogs, canViewProject)
+			project.Delete("/events/:eventId", eventsHandler.DeleteEvent, canDeleteLogs)
+			project.Get("/events/stream", eventsHandler.StreamEvents, canViewProject)
+			project.Get("/events/metrics", eventsHandler.GetMetrics, canViewProject)
+			project.Get("/events/channels", eventsHandler.GetEventChannels, canViewProject)
+			project.Get("/events/channels/:channelId", eventsHandler.GetEventChannel, canViewProject)
+			project.Post("/events/channels/:channelId/validate", eventsHandler.ValidateSample, canViewProject)
+			project.Post("/events/channels", eventsHandler.CreateChannel, canManageSettings)
+			project.Patch("/events/channels/:channelId", eventsHandler.UpdateChannel, canManageSettings)
+			project.Delete("/events/channels/:channelId", eventsHandler.DeleteChannel, canManageSettings)
 
 			// App logs routes
-			projects.Get("/:id/app", appHandler.GetAppLogs)
-			projects.Delete("/:id/app/:logId", appHandler.DeleteAppLog, requireManagementMiddleware)
-			projects.Get("/:id/app/stream", appHandler.StreamAppLogs)
-			projects.Get("/:id/app/charts/timeline", appHandler.GetTimelineChart)
+			project.Get("/app", appHandler.GetAppLogs, canViewProject)
+			project.Delete("/app/:logId", appHandler.DeleteAppLog, canDeleteLogs)
+			project.Get("/app/stream", appHandler.StreamAppLogs, canViewProject)
+			project.Get("/app/charts/timeline", appHandler.GetTimelineChart, canViewProject)
 
-			// Request logs routes
-			projects.Get("/:id/request", requestsHandler.GetRequestLogs)
-			projects.Delete("/:id/request/:logId", requestsHandler.DeleteRequestLog, requireManagementMiddleware)
-			projects.Get("/:id/request/stream", requestsHandler.StreamLogs)
-			projects.Get("/:id/request/charts/timeline", requestsHandler.GetTimelineChart)
+			// Issues grouped from app log exceptions
+			project.Get("/issues", issuesHandler.ListIssues, canViewProject)
+			project.Get("/issues/:issueId", issuesHandler.GetIssue, canViewProject)
+			project.Patch("/issues/:issueId", issuesHandler.UpdateIssue, canTriageIssues)
+
+			// Release source map artifacts
+			project.Get("/releases/:release/artifacts", artifactsHandler.ListArtifacts, canViewProject)
+			project.Post("/releases/:release/artifacts", artifactsHandler.UploadArtifact, canManageSettings)
+			project.Delete("/releases/:release/artifacts/:artifactId", artifactsHandler.DeleteArtifact, canManageSettings)
+
+			// Request logs routes, bodies are stripped without permission to view them
+			project.Get("/request", requestsHandler.GetRequestLogs, canViewProject)
+			project.Delete("/request/:logId", requestsHandler.DeleteRequestLog, canDeleteLogs)
+			project.Get("/request/stream", requestsHandler.StreamLogs, canViewProject)
+			project.Get("/request/charts/timeline", requestsHandler.GetTimelineChart, canViewProject)
 
 			// Metrics routes
-			projects.Get("/:id/metrics", metricsHandler.GetMetrics)
-			projects.Get("/:id/metrics/stats", metricsHandler.GetMetricStats)
+			project.Get("/metrics", metricsHandler.GetMetrics, canViewProject)
+			project.Get("/metrics/stats", metricsHandler.GetMetricStats, canViewProject)
+			project.Get("/metrics/series", metricsHandler.GetSeries, canViewProject)
+			project.Get("/metrics/exemplars", metricsHandler.GetExemplars, canViewProject)
+			project.Get("/metrics/cardinality", metricsHandler.GetCardinality, canViewProject)
+
+			// Metric catalog
+			project.Get("/metrics/catalog", metricsHandler.ListCatalog, canViewProject)
+			project.Get("/metrics/catalog/autocomplete", metricsHandler.Autocomplete, canViewProject)
+			project.Get("/metrics/catalog/:name", metricsHandler.GetCatalogEntry, canViewProject)
+
+			// Metric cardinality limits
+			project.Get("/metrics/limits", metricsHandler.GetLimits, canViewProject)
+			project.Put("/metrics/limits", metricsHandler.UpdateLimits, canManageSettings)
 
 			// Traces routes
-			projects.Get("/:id/traces", tracesHandler.GetTraces)
-			projects.Get("/:id/traces/stats", tracesHandler.GetTraceStats)
-			projects.Get("/:id/traces/:traceId", tracesHandler.GetTraceTimeline)
+			project.Get("/traces", tracesHandler.GetTraces, canViewProject)
+			project.Get("/traces/stats", tracesHandler.GetTraceStats, canViewProject)
+			project.Get("/traces/:traceId", tracesHandler.GetTraceTimeline, canViewProject)
+			project.Get("/traces/:traceId/correlated", tracesHandler.GetCorrelatedTrace, canViewProject)
+
+			// Trace tail sampling settings
+			project.Get("/sampling", samplingHandler.GetSettings, canViewProject)
+			project.Put("/sampling", samplingHandler.UpdateSettings, canManageSettings)
 		}
 	}
 
@@ -0,0 +1,18 @@
+package sampling
+
+import (
+	"github.com/ted-too/logsicle/internal/sampling"
+	"gorm.io/gorm"
+)
+
+type SamplingHandler struct {
+	db      *gorm.DB
+	sampler *sampling.Sampler
+}
+
+func NewSamplingHandler(db *gorm.DB, sampler *sampling.Sampler) *SamplingHandler {
+	return &SamplingHandler{
+		db:      db,
+		sampler: sampler,
+	}
+}
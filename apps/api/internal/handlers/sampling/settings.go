@@ -0,0 +1,143 @@
+package sampling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/sampling"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+type UpdateSettingsInput struct {
+	Enabled            *bool                           `json:"enabled"`
+	KeepErrors         *bool                           `json:"keep_errors"`
+	LatencyThresholdMs *int64                          `json:"latency_threshold_ms"`
+	AttributeRules     *[]models.SamplingAttributeRule `json:"attribute_rules"`
+	SampleRate         *float64                        `json:"sample_rate"`
+}
+
+func validateAttributeRules(value interface{}) error {
+	rules, _ := value.(*[]models.SamplingAttributeRule)
+	if rules == nil {
+		return nil
+	}
+	for i, rule := range *rules {
+		if err := sampling.ValidateAttributeRule(rule); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (u UpdateSettingsInput) Validate() error {
+	return validation.ValidateStruct(&u,
+		validation.Field(&u.LatencyThresholdMs, validation.Min(int64(0))),
+		validation.Field(&u.AttributeRules, validation.Length(0, sampling.MaxAttributeRules), validation.By(validateAttributeRules)),
+		validation.Field(&u.SampleRate, validation.Min(0.0), validation.Max(1.0)),
+	)
+}
+
+func (h *SamplingHandler) loadSettings(projectID string) (*models.TraceSamplingSettings, error) {
+	var settings models.TraceSamplingSettings
+	err := h.db.Where("project_id = ?", projectID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		settings = models.DefaultTraceSamplingSettings(projectID)
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// GetSettings returns the project's tail sampling settings, or the defaults
+// when none have been configured
+func (h *SamplingHandler) GetSettings(c fiber.Ctx) error {
+	settings, err := h.loadSettings(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch sampling settings",
+			"error":   err.Error(),
+		})
+	}
+
+	return c.JSON(settings)
+}
+
+// UpdateSettings creates or updates the project's tail sampling settings.
+// Omitted fields keep their current value.
+func (h *SamplingHandler) UpdateSettings(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	input := new(UpdateSettingsInput)
+	if err := c.Bind().JSON(input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+			"error":   err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Validation failed",
+			"error":   err.Error(),
+		})
+	}
+
+	settings, err := h.loadSettings(projectID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch sampling settings",
+			"error":   err.Error(),
+		})
+	}
+
+	if input.Enabled != nil {
+		settings.Enabled = *input.Enabled
+	}
+	if input.KeepErrors != nil {
+		settings.KeepErrors = *input.KeepErrors
+	}
+	if input.LatencyThresholdMs != nil {
+		settings.LatencyThresholdMs = *input.LatencyThresholdMs
+	}
+	if input.AttributeRules != nil {
+		rules := *input.AttributeRules
+		if rules == nil {
+			rules = []models.SamplingAttributeRule{}
+		}
+		b, err := json.Marshal(rules)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid attribute rules",
+				"error":   err.Error(),
+			})
+		}
+		settings.AttributeRules = string(b)
+	}
+	if input.SampleRate != nil {
+		settings.SampleRate = *input.SampleRate
+	}
+
+	// Select all columns on create so false booleans and a zero rate are not
+	// replaced by the column defaults
+	if settings.ID == "" {
+		err = h.db.Select("*").Create(settings).Error
+	} else {
+		err = h.db.Save(settings).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update sampling settings",
+			"error":   err.Error(),
+		})
+	}
+
+	h.sampler.Invalidate(projectID)
+
+	return c.JSON(settings)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gosimple/slug"
 	"github.com/ted-too/logsicle/internal/storage"
 	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
 )
 
 func (h *TeamsHandler) ListOrganizationMembers(c fiber.Ctx) error {
@@ -160,6 +161,17 @@ func (h *TeamsHandler) DeleteOrganization(c fiber.Ctx) error {
 		})
 	}
 
+	// Delete project roles on the organization's projects
+	if err := tx.Unscoped().
+		Where("project_id IN (?)", tx.Model(&models.Project{}).Select("id").Where("organization_id = ?", orgID)).
+		Delete(&models.ProjectMember{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to delete project members",
+			"message": err.Error(),
+		})
+	}
+
 	// Delete projects associated with the organization
 	if err := tx.Where("organization_id = ?", orgID).Delete(&models.Project{}).Error; err != nil {
 		tx.Rollback()
@@ -213,3 +225,119 @@ func (h *TeamsHandler) DeleteOrganization(c fiber.Ctx) error {
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// removeMember removes a user from an organization together with their roles
+// on its projects
+func removeMember(tx *gorm.DB, orgID, userID string) error {
+	if err := tx.Unscoped().
+		Where("user_id = ? AND project_id IN (?)", userID, tx.Model(&models.Project{}).Select("id").Where("organization_id = ?", orgID)).
+		Delete(&models.ProjectMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("organization_id = ? AND user_id = ?", orgID, userID).Delete(&models.TeamMembership{}).Error
+}
+
+// RemoveOrganizationMember removes a member from the active organization.
+// Only owners can remove owners, and members leave rather than remove
+// themselves.
+func (h *TeamsHandler) RemoveOrganizationMember(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	membership := c.Locals("membership").(*models.TeamMembership)
+	userID := c.Params("userId")
+
+	if userID == userSession.UserID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Cannot remove yourself",
+			"message": "Leave the organization instead",
+		})
+	}
+
+	var member models.TeamMembership
+	if err := h.db.Where("organization_id = ? AND user_id = ?", userSession.ActiveOrganization, userID).First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Member not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to load member",
+			"message": err.Error(),
+		})
+	}
+
+	if member.Role == models.RoleOwner && membership.Role != models.RoleOwner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Insufficient permissions",
+		})
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return removeMember(tx, userSession.ActiveOrganization, userID)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to remove member",
+			"message": err.Error(),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// LeaveOrganization removes the current user from an organization. The last
+// owner cannot leave.
+func (h *TeamsHandler) LeaveOrganization(c fiber.Ctx) error {
+	userSession := c.Locals("session").(storage.Session)
+	orgID := c.Params("id")
+
+	var membership models.TeamMembership
+	if err := h.db.Where("organization_id = ? AND user_id = ?", orgID, userSession.UserID).First(&membership).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Not a member of this organization",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to load membership",
+			"message": err.Error(),
+		})
+	}
+
+	if membership.Role == models.RoleOwner {
+		var owners int64
+		if err := h.db.Model(&models.TeamMembership{}).Where("organization_id = ? AND role = ?", orgID, models.RoleOwner).Count(&owners).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Failed to check organization owners",
+				"message": err.Error(),
+			})
+		}
+		if owners <= 1 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":   "Last owner",
+				"message": "Transfer ownership or delete the organization instead",
+			})
+		}
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return removeMember(tx, orgID, userSession.UserID)
+	}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to leave organization",
+			"message": err.Error(),
+		})
+	}
+
+	// If this was the active organization, switch to another one
+	if userSession.ActiveOrganization == orgID {
+		var other models.TeamMembership
+		if err := h.db.Where("user_id = ?", userSession.UserID).First(&other).Error; err != nil {
+			userSession.ActiveOrganization = ""
+		} else {
+			userSession.ActiveOrganization = other.OrganizationID
+		}
+
+		session.FromContext(c).Set(storage.SessionDataKey, userSession)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
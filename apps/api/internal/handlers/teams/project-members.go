@@ -0,0 +1,200 @@
+package teams
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+type AddProjectMemberRequest struct {
+	UserID string             `json:"user_id"`
+	Role   models.ProjectRole `json:"role"`
+}
+
+func (r AddProjectMemberRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.UserID, validation.Required),
+		validation.Field(&r.Role, validation.Required, validation.By(validateProjectRole)),
+	)
+}
+
+type UpdateProjectMemberRequest struct {
+	Role models.ProjectRole `json:"role"`
+}
+
+func (r UpdateProjectMemberRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Role, validation.Required, validation.By(validateProjectRole)),
+	)
+}
+
+func validateProjectRole(value interface{}) error {
+	if role, ok := value.(models.ProjectRole); !ok || !role.Valid() {
+		return validation.NewError("validation_invalid_project_role", "must be one of viewer, editor or admin")
+	}
+	return nil
+}
+
+// GetProjectPermissions returns the current user's role and permissions on a project
+func (h *TeamsHandler) GetProjectPermissions(c fiber.Ctx) error {
+	// Project role is already resolved by middleware
+	role := c.Locals("project_role").(models.ProjectRole)
+
+	return c.JSON(fiber.Map{
+		"role":        role,
+		"permissions": role.Permissions(),
+	})
+}
+
+// ListProjectMembers returns the members assigned to a project. Organization
+// owners and admins administer every project and are not listed.
+func (h *TeamsHandler) ListProjectMembers(c fiber.Ctx) error {
+	projectID := c.Params("id")
+
+	var members []models.ProjectMember
+	if err := h.db.Preload("User").Where("project_id = ?", projectID).Order("created_at").Find(&members).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to load project members",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(members)
+}
+
+// AddProjectMember assigns an organization member a role on a project
+func (h *TeamsHandler) AddProjectMember(c fiber.Ctx) error {
+	membership := c.Locals("membership").(*models.TeamMembership)
+	projectID := c.Params("id")
+
+	var input AddProjectMemberRequest
+	if err := c.Bind().Body(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	var target models.TeamMembership
+	if err := h.db.Where("organization_id = ? AND user_id = ?", membership.OrganizationID, input.UserID).First(&target).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User is not a member of this organization",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch organization member",
+		})
+	}
+
+	if _, ok := models.ProjectRoleFor(target.Role); ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Organization owners and admins already administer every project",
+		})
+	}
+
+	var count int64
+	if err := h.db.Model(&models.ProjectMember{}).Where("project_id = ? AND user_id = ?", projectID, input.UserID).Count(&count).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check project membership",
+		})
+	}
+
+	if count > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already a member of this project",
+		})
+	}
+
+	member := models.ProjectMember{
+		ProjectID: projectID,
+		UserID:    input.UserID,
+		Role:      input.Role,
+	}
+
+	if err := h.db.Create(&member).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to add project member",
+		})
+	}
+
+	if err := h.db.Preload("User").First(&member, "id = ?", member.ID).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load project member",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(member)
+}
+
+// UpdateProjectMember changes a member's role on a project
+func (h *TeamsHandler) UpdateProjectMember(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	userID := c.Params("userId")
+
+	var input UpdateProjectMemberRequest
+	if err := c.Bind().Body(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Invalid request body",
+			"message": err.Error(),
+		})
+	}
+
+	if err := input.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Validation failed",
+			"message": err.Error(),
+		})
+	}
+
+	var member models.ProjectMember
+	if err := h.db.Preload("User").Where("project_id = ? AND user_id = ?", projectID, userID).First(&member).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Project member not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch project member",
+		})
+	}
+
+	member.Role = input.Role
+
+	if err := h.db.Model(&member).Update("role", member.Role).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update project member",
+		})
+	}
+
+	return c.JSON(member)
+}
+
+// RemoveProjectMember removes a member's access to a project
+func (h *TeamsHandler) RemoveProjectMember(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	userID := c.Params("userId")
+
+	result := h.db.Unscoped().Where("project_id = ? AND user_id = ?", projectID, userID).Delete(&models.ProjectMember{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to remove project member",
+		})
+	}
+
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Project member not found",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -25,14 +25,22 @@ func (p ProjectInput) Validate() error {
 	)
 }
 
-// ListProjects returns all projects in the active organization
+// ListProjects returns the projects in the active organization the user can
+// access
 func (h *TeamsHandler) ListProjects(c fiber.Ctx) error {
 	// Active organization is already verified by middleware
 	session := c.Locals("session").(storage.Session)
 	orgID := session.ActiveOrganization
+	membership := c.Locals("membership").(*models.TeamMembership)
+
+	query := h.db.Preload("APIKeys").Where("organization_id = ?", orgID)
+	if _, ok := models.ProjectRoleFor(membership.Role); !ok {
+		// Members only see the projects they are assigned to
+		query = query.Where("id IN (?)", h.db.Model(&models.ProjectMember{}).Select("project_id").Where("user_id = ?", session.UserID))
+	}
 
 	var projects []models.Project
-	if err := h.db.Preload("APIKeys").Where("organization_id = ?", orgID).Find(&projects).Error; err != nil {
+	if err := query.Find(&projects).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch projects",
 		})
@@ -166,5 +174,9 @@ func (h *TeamsHandler) DeleteProject(c fiber.Ctx) error {
 		})
 	}
 
+	if err := h.db.Unscoped().Where("project_id = ?", projectID).Delete(&models.ProjectMember{}).Error; err != nil {
+		log.Printf("Failed to remove members of deleted project %s: %v", projectID, err)
+	}
+
 	return c.SendStatus(fiber.StatusNoContent)
 }
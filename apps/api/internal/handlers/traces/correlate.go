@@ -0,0 +1,156 @@
+package traces
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/middleware"
+	storageModels "github.com/ted-too/logsicle/internal/storage/models"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Maximum number of rows of each kind returned for a trace
+const maxCorrelatedRows = 1000
+
+type CorrelatedTrace struct {
+	TraceID     string              `json:"trace_id"`
+	Spans       []*models.Trace     `json:"spans"`
+	AppLogs     []models.AppLog     `json:"app_logs"`
+	RequestLogs []models.RequestLog `json:"request_logs"`
+}
+
+// GetCorrelatedTrace returns the spans, app logs and request logs of a trace
+func (h *TracesHandler) GetCorrelatedTrace(c fiber.Ctx) error {
+	projectID := c.Params("id")
+	traceID := c.Params("traceId")
+
+	// Log trace IDs are stored as lowercase hex, spans keep the ID they
+	// were sent with
+	normalized := models.NormalizeTraceID(traceID)
+	if normalized == "" {
+		normalized = strings.ToLower(traceID)
+	}
+
+	spans, err := getTraceSpans(c.Context(), h.pool, projectID, traceID)
+	if err == nil && len(spans) == 0 && normalized != traceID {
+		spans, err = getTraceSpans(c.Context(), h.pool, projectID, normalized)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get trace spans",
+			"error":   err.Error(),
+		})
+	}
+	if len(spans) > maxCorrelatedRows {
+		spans = spans[:maxCorrelatedRows]
+	}
+	if spans == nil {
+		spans = []*models.Trace{}
+	}
+
+	appLogs, err := getTraceAppLogs(c.Context(), h.pool, projectID, normalized)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get trace app logs",
+			"error":   err.Error(),
+		})
+	}
+
+	requestLogs, err := getTraceRequestLogs(c.Context(), h.pool, projectID, normalized)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to get trace request logs",
+			"error":   err.Error(),
+		})
+	}
+	if !middleware.HasProjectPermission(c, storageModels.PermissionViewRequestBodies) {
+		for i := range requestLogs {
+			requestLogs[i].StripPayloads()
+		}
+	}
+
+	return c.JSON(CorrelatedTrace{
+		TraceID:     normalized,
+		Spans:       spans,
+		AppLogs:     appLogs,
+		RequestLogs: requestLogs,
+	})
+}
+
+// getTraceAppLogs gets the app logs of a trace in time order
+func getTraceAppLogs(ctx context.Context, pool *pgxpool.Pool, projectID string, traceID string) ([]models.AppLog, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT
+			id, project_id, level, message,
+			fields, timestamp, caller, function,
+			service_name, version, environment, host,
+			exception, issue_id, trace_id, span_id
+		FROM app_logs
+		WHERE project_id = $1
+		AND trace_id = $2
+		ORDER BY timestamp
+		LIMIT $3`,
+		projectID, traceID, maxCorrelatedRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]models.AppLog, 0)
+	for rows.Next() {
+		var log models.AppLog
+		if err := rows.Scan(
+			&log.ID, &log.ProjectID, &log.Level, &log.Message,
+			&log.Fields, &log.Timestamp, &log.Caller, &log.Function,
+			&log.ServiceName, &log.Version, &log.Environment, &log.Host,
+			&log.Exception, &log.IssueID, &log.TraceID, &log.SpanID,
+		); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
+
+// getTraceRequestLogs gets the request logs of a trace in time order
+func getTraceRequestLogs(ctx context.Context, pool *pgxpool.Pool, projectID string, traceID string) ([]models.RequestLog, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT
+			id, project_id, method, path, status_code,
+			level, duration, request_body, response_body, headers,
+			query_params, user_agent, ip_address, protocol,
+			host, error, timestamp,
+			COALESCE(trace_id, ''), COALESCE(span_id, '')
+		FROM request_logs
+		WHERE project_id = $1
+		AND trace_id = $2
+		ORDER BY timestamp
+		LIMIT $3`,
+		projectID, traceID, maxCorrelatedRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := make([]models.RequestLog, 0)
+	for rows.Next() {
+		var log models.RequestLog
+		if err := rows.Scan(
+			&log.ID, &log.ProjectID, &log.Method, &log.Path, &log.StatusCode,
+			&log.Level, &log.Duration, &log.RequestBody, &log.ResponseBody, &log.Headers,
+			&log.QueryParams, &log.UserAgent, &log.IPAddress, &log.Protocol,
+			&log.Host, &log.Error, &log.Timestamp,
+			&log.TraceID, &log.SpanID,
+		); err != nil {
+			return nil, err
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
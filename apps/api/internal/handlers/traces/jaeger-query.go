@@ -0,0 +1,399 @@
+package traces
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Jaeger query API used by the Grafana Jaeger data source. Times are in
+// microseconds.
+
+// Search window used when a Jaeger search has no start time
+const defaultJaegerLookback = time.Hour
+
+type jaegerError struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	TraceID string `json:"traceID,omitempty"`
+}
+
+type jaegerResponse struct {
+	Data   any           `json:"data"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+	Errors []jaegerError `json:"errors"`
+}
+
+type jaegerKeyValue struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type jaegerReference struct {
+	RefType string `json:"refType"`
+	TraceID string `json:"traceID"`
+	SpanID  string `json:"spanID"`
+}
+
+type jaegerLog struct {
+	Timestamp int64            `json:"timestamp"`
+	Fields    []jaegerKeyValue `json:"fields"`
+}
+
+type jaegerSpan struct {
+	TraceID       string            `json:"traceID"`
+	SpanID        string            `json:"spanID"`
+	OperationName string            `json:"operationName"`
+	References    []jaegerReference `json:"references"`
+	Flags         int               `json:"flags"`
+	StartTime     int64             `json:"startTime"`
+	Duration      int64             `json:"duration"`
+	Tags          []jaegerKeyValue  `json:"tags"`
+	Logs          []jaegerLog       `json:"logs"`
+	ProcessID     string            `json:"processID"`
+	Warnings      []string          `json:"warnings"`
+}
+
+type jaegerProcess struct {
+	ServiceName string           `json:"serviceName"`
+	Tags        []jaegerKeyValue `json:"tags"`
+}
+
+type jaegerTrace struct {
+	TraceID   string                   `json:"traceID"`
+	Spans     []jaegerSpan             `json:"spans"`
+	Processes map[string]jaegerProcess `json:"processes"`
+	Warnings  []string                 `json:"warnings"`
+}
+
+type jaegerOperation struct {
+	Name     string `json:"name"`
+	SpanKind string `json:"spanKind"`
+}
+
+func sendJaegerData(c fiber.Ctx, data any, total int) error {
+	return c.JSON(jaegerResponse{Data: data, Total: total})
+}
+
+func sendJaegerError(c fiber.Ctx, code int, msg string) error {
+	return c.Status(code).JSON(jaegerResponse{
+		Errors: []jaegerError{{Code: code, Msg: msg}},
+	})
+}
+
+// jaegerSpanKind converts a span kind to the lowercase Jaeger form, e.g.
+// SPAN_KIND_SERVER to server
+func jaegerSpanKind(kind models.SpanKind) string {
+	if kind == models.SpanKindUnspecified {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(string(kind), "SPAN_KIND_"))
+}
+
+func toJaegerKeyValue(key string, value any) jaegerKeyValue {
+	switch v := value.(type) {
+	case string:
+		return jaegerKeyValue{Key: key, Type: "string", Value: v}
+	case bool:
+		return jaegerKeyValue{Key: key, Type: "bool", Value: v}
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return jaegerKeyValue{Key: key, Type: "int64", Value: int64(v)}
+		}
+		return jaegerKeyValue{Key: key, Type: "float64", Value: v}
+	default:
+		b, _ := json.Marshal(v)
+		return jaegerKeyValue{Key: key, Type: "string", Value: string(b)}
+	}
+}
+
+// toJaegerTags converts attributes to tags sorted by key
+func toJaegerTags(attributes map[string]any) []jaegerKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tags := make([]jaegerKeyValue, 0, len(keys))
+	for _, key := range keys {
+		tags = append(tags, toJaegerKeyValue(key, attributes[key]))
+	}
+	return tags
+}
+
+// toJaegerTrace converts the spans of one trace. Spans sharing a service
+// and resource share a process.
+func toJaegerTrace(spans []*models.Trace) jaegerTrace {
+	trace := jaegerTrace{
+		Spans:     make([]jaegerSpan, 0, len(spans)),
+		Processes: make(map[string]jaegerProcess),
+		Warnings:  []string{},
+	}
+	processIDs := make(map[string]string)
+
+	for _, span := range spans {
+		trace.TraceID = span.TraceID
+		data := decodeSpanData(span)
+
+		processKey := span.ServiceName + "\x00" + span.ServiceVersion.String + "\x00" + string(span.ResourceAttributes)
+		processID, ok := processIDs[processKey]
+		if !ok {
+			processID = fmt.Sprintf("p%d", len(processIDs)+1)
+			processIDs[processKey] = processID
+
+			resource := data.ResourceAttributes
+			if resource == nil {
+				resource = make(map[string]any)
+			}
+			delete(resource, "service.name")
+			if span.ServiceVersion.Valid {
+				resource["service.version"] = span.ServiceVersion.String
+			}
+			trace.Processes[processID] = jaegerProcess{
+				ServiceName: span.ServiceName,
+				Tags:        toJaegerTags(resource),
+			}
+		}
+
+		attributes := data.Attributes
+		if attributes == nil {
+			attributes = make(map[string]any)
+		}
+		if kind := jaegerSpanKind(span.Kind); kind != "" {
+			attributes["span.kind"] = kind
+		}
+		switch span.Status {
+		case models.SpanStatusError:
+			attributes["error"] = true
+			attributes["otel.status_code"] = "ERROR"
+		case models.SpanStatusOk:
+			attributes["otel.status_code"] = "OK"
+		}
+		if span.StatusMsg.Valid {
+			attributes["otel.status_description"] = span.StatusMsg.String
+		}
+
+		references := []jaegerReference{}
+		if span.ParentID.Valid {
+			references = append(references, jaegerReference{
+				RefType: "CHILD_OF",
+				TraceID: span.TraceID,
+				SpanID:  span.ParentID.String,
+			})
+		}
+		for _, link := range data.Links {
+			references = append(references, jaegerReference{
+				RefType: "FOLLOWS_FROM",
+				TraceID: link.TraceID,
+				SpanID:  link.SpanID,
+			})
+		}
+
+		logs := make([]jaegerLog, 0, len(data.Events))
+		for _, event := range data.Events {
+			var fields map[string]any
+			if len(event.Attributes) > 0 {
+				_ = json.Unmarshal(event.Attributes, &fields)
+			}
+			if fields == nil {
+				fields = make(map[string]any)
+			}
+			fields["event"] = event.Name
+			logs = append(logs, jaegerLog{
+				Timestamp: event.Timestamp.UnixMicro(),
+				Fields:    toJaegerTags(fields),
+			})
+		}
+
+		trace.Spans = append(trace.Spans, jaegerSpan{
+			TraceID:       span.TraceID,
+			SpanID:        span.ID,
+			OperationName: span.Name,
+			References:    references,
+			StartTime:     span.StartTime.UnixMicro(),
+			Duration:      span.EndTime.Sub(span.StartTime).Microseconds(),
+			Tags:          toJaegerTags(attributes),
+			Logs:          logs,
+			ProcessID:     processID,
+			Warnings:      []string{},
+		})
+	}
+
+	return trace
+}
+
+// JaegerServices lists services (GET /api/services)
+func (h *TracesHandler) JaegerServices(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+
+	services, err := getServiceNames(c.Context(), h.pool, projectID)
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusInternalServerError, "failed to get services")
+	}
+
+	return sendJaegerData(c, services, len(services))
+}
+
+// JaegerServiceOperations lists the span names of a service
+// (GET /api/services/:service/operations)
+func (h *TracesHandler) JaegerServiceOperations(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+	service, err := url.PathUnescape(c.Params("service"))
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusBadRequest, "invalid service name")
+	}
+
+	operations, err := getOperations(c.Context(), h.pool, projectID, service, "")
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusInternalServerError, "failed to get operations")
+	}
+
+	// The same name may be reported with several span kinds
+	names := make([]string, 0, len(operations))
+	for i, op := range operations {
+		if i == 0 || operations[i-1].Name != op.Name {
+			names = append(names, op.Name)
+		}
+	}
+
+	return sendJaegerData(c, names, len(names))
+}
+
+// JaegerOperations lists the operations of a service with their span kind
+// (GET /api/operations?service=&spanKind=)
+func (h *TracesHandler) JaegerOperations(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+	service := c.Query("service")
+	if service == "" {
+		return sendJaegerError(c, fiber.StatusBadRequest, "parameter 'service' is required")
+	}
+
+	var kind models.SpanKind
+	if spanKind := c.Query("spanKind"); spanKind != "" {
+		kind = models.SpanKind("SPAN_KIND_" + strings.ToUpper(spanKind))
+	}
+
+	operations, err := getOperations(c.Context(), h.pool, projectID, service, kind)
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusInternalServerError, "failed to get operations")
+	}
+
+	data := make([]jaegerOperation, 0, len(operations))
+	for _, op := range operations {
+		data = append(data, jaegerOperation{Name: op.Name, SpanKind: jaegerSpanKind(op.Kind)})
+	}
+
+	return sendJaegerData(c, data, len(data))
+}
+
+// parseMicros parses a unix timestamp in microseconds
+func parseMicros(s string) (time.Time, error) {
+	us, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMicro(us), nil
+}
+
+// JaegerSearchTraces searches traces (GET /api/traces). Tags are a JSON
+// object, durations use Go duration syntax, e.g. 1.5s.
+func (h *TracesHandler) JaegerSearchTraces(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+
+	search := traceSearch{
+		ServiceName: c.Query("service"),
+		Operation:   c.Query("operation"),
+		End:         time.Now(),
+	}
+
+	if end := c.Query("end"); end != "" {
+		t, err := parseMicros(end)
+		if err != nil {
+			return sendJaegerError(c, fiber.StatusBadRequest, "invalid end time")
+		}
+		search.End = t
+	}
+
+	lookback := defaultJaegerLookback
+	if value := c.Query("lookback"); value != "" && value != "custom" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return sendJaegerError(c, fiber.StatusBadRequest, "invalid lookback")
+		}
+		lookback = d
+	}
+	search.Start = search.End.Add(-lookback)
+	if start := c.Query("start"); start != "" {
+		t, err := parseMicros(start)
+		if err != nil {
+			return sendJaegerError(c, fiber.StatusBadRequest, "invalid start time")
+		}
+		search.Start = t
+	}
+
+	if tags := c.Query("tags"); tags != "" {
+		if err := json.Unmarshal([]byte(tags), &search.Tags); err != nil {
+			return sendJaegerError(c, fiber.StatusBadRequest, "tags must be a JSON object of strings")
+		}
+	}
+
+	for name, target := range map[string]*time.Duration{"minDuration": &search.MinDuration, "maxDuration": &search.MaxDuration} {
+		if value := c.Query(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return sendJaegerError(c, fiber.StatusBadRequest, fmt.Sprintf("invalid %s", name))
+			}
+			*target = d
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return sendJaegerError(c, fiber.StatusBadRequest, "invalid limit")
+		}
+		search.Limit = n
+	}
+
+	results, err := searchTraces(c.Context(), h.pool, projectID, search)
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusInternalServerError, "failed to search traces")
+	}
+
+	traces := make([]jaegerTrace, 0, len(results))
+	for _, spans := range results {
+		traces = append(traces, toJaegerTrace(spans))
+	}
+
+	return sendJaegerData(c, traces, len(traces))
+}
+
+// JaegerGetTrace gets a trace by ID (GET /api/traces/:traceId)
+func (h *TracesHandler) JaegerGetTrace(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+	traceID := c.Params("traceId")
+
+	spans, err := findTrace(c.Context(), h.pool, projectID, traceID)
+	if err != nil {
+		return sendJaegerError(c, fiber.StatusInternalServerError, "failed to get trace")
+	}
+	if len(spans) == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(jaegerResponse{
+			Errors: []jaegerError{{Code: fiber.StatusNotFound, Msg: "trace not found", TraceID: traceID}},
+		})
+	}
+
+	return sendJaegerData(c, []jaegerTrace{toJaegerTrace(spans)}, 1)
+}
@@ -308,24 +308,8 @@ func getTraces(ctx context.Context, pool *pgxpool.Pool, projectID string, option
 	}
 	defer rows.Close()
 
-	var traces []*models.Trace
-	for rows.Next() {
-		t := &models.Trace{}
-		err := rows.Scan(
-			&t.ID, &t.TraceID, &t.ParentID, &t.ProjectID,
-			&t.Name, &t.Kind, &t.StartTime, &t.EndTime,
-			&t.DurationMs, &t.Status, &t.StatusMsg,
-			&t.ServiceName, &t.ServiceVersion,
-			&t.Attributes, &t.Events, &t.Links,
-			&t.ResourceAttributes, &t.Timestamp,
-		)
-		if err != nil {
-			return nil, nil, err
-		}
-		traces = append(traces, t)
-	}
-
-	if err := rows.Err(); err != nil {
+	traces, err := scanTraces(rows)
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -407,8 +391,8 @@ func getTraceStats(ctx context.Context, pool *pgxpool.Pool, projectID string, op
 	return stats, nil
 }
 
-// getTraceSpans gets all spans for a specific trace ID
-func getTraceSpans(ctx context.Context, pool *pgxpool.Pool, projectID string, traceID string) ([]*models.Trace, error) {
+// getTraceSpans gets all spans for the given trace IDs in start time order
+func getTraceSpans(ctx context.Context, pool *pgxpool.Pool, projectID string, traceIDs ...string) ([]*models.Trace, error) {
 	query := `
 		SELECT 
 			id, trace_id, parent_id, project_id,
@@ -419,16 +403,21 @@ func getTraceSpans(ctx context.Context, pool *pgxpool.Pool, projectID string, tr
 			resource_attributes, timestamp
 		FROM traces
 		WHERE project_id = $1
-		AND trace_id = $2
+		AND trace_id = ANY($2)
 		ORDER BY start_time
 	`
 
-	rows, err := pool.Query(ctx, query, projectID, traceID)
+	rows, err := pool.Query(ctx, query, projectID, traceIDs)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanTraces(rows)
+}
+
+// scanTraces scans rows selecting every traces column in table order
+func scanTraces(rows pgx.Rows) ([]*models.Trace, error) {
 	var spans []*models.Trace
 	for rows.Next() {
 		t := &models.Trace{}
@@ -0,0 +1,297 @@
+package traces
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Default and maximum number of traces returned by a search
+	defaultSearchLimit = 20
+	maxSearchLimit     = 1000
+	// Window searched when listing services, operations and tags
+	catalogueLookback = 7 * 24 * time.Hour
+	// Maximum number of tag names or values returned
+	maxTagRows = 1000
+)
+
+// traceSearch filters the spans of a project. A trace matches when one of
+// its spans matches every filter.
+type traceSearch struct {
+	Start       time.Time
+	End         time.Time
+	ServiceName string
+	Operation   string
+	Tags        map[string]string
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Limit       int
+}
+
+// queryArgs collects positional query arguments
+type queryArgs []any
+
+func (a *queryArgs) add(value any) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// tagCondition matches a span tag. Tags consumed at ingest are matched
+// against the columns they were stored in.
+func tagCondition(args *queryArgs, key, value string) string {
+	switch key {
+	case "error":
+		if value == "true" {
+			return "status = 'STATUS_ERROR'"
+		}
+		return "status <> 'STATUS_ERROR'"
+	case "span.kind":
+		return "kind = " + args.add("SPAN_KIND_"+strings.ToUpper(value))
+	case "service.name":
+		return "service_name = " + args.add(value)
+	case "service.version":
+		return "service_version = " + args.add(value)
+	default:
+		k, v := args.add(key), args.add(value)
+		return fmt.Sprintf("(attributes->>%s = %s OR resource_attributes->>%s = %s)", k, v, k, v)
+	}
+}
+
+// searchTraces returns the spans of the most recent matching traces, one
+// slice per trace
+func searchTraces(ctx context.Context, pool *pgxpool.Pool, projectID string, search traceSearch) ([][]*models.Trace, error) {
+	args := queryArgs{}
+	conditions := []string{
+		"project_id = " + args.add(projectID),
+		fmt.Sprintf("timestamp BETWEEN %s AND %s", args.add(search.Start), args.add(search.End)),
+	}
+
+	if search.ServiceName != "" {
+		conditions = append(conditions, "service_name = "+args.add(search.ServiceName))
+	}
+	if search.Operation != "" {
+		conditions = append(conditions, "name = "+args.add(search.Operation))
+	}
+	for key, value := range search.Tags {
+		conditions = append(conditions, tagCondition(&args, key, value))
+	}
+	if search.MinDuration > 0 {
+		conditions = append(conditions, "duration_ms >= "+args.add(search.MinDuration.Milliseconds()))
+	}
+	if search.MaxDuration > 0 {
+		conditions = append(conditions, "duration_ms <= "+args.add(search.MaxDuration.Milliseconds()))
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	query := fmt.Sprintf(`
+		SELECT trace_id
+		FROM traces
+		WHERE %s
+		GROUP BY trace_id
+		ORDER BY MAX(start_time) DESC
+		LIMIT %s
+	`, strings.Join(conditions, " AND "), args.add(limit))
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	traceIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if len(traceIDs) == 0 {
+		return [][]*models.Trace{}, nil
+	}
+
+	spans, err := getTraceSpans(ctx, pool, projectID, traceIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	byTrace := make(map[string][]*models.Trace, len(traceIDs))
+	for _, span := range spans {
+		byTrace[span.TraceID] = append(byTrace[span.TraceID], span)
+	}
+
+	traces := make([][]*models.Trace, 0, len(traceIDs))
+	for _, traceID := range traceIDs {
+		if spans := byTrace[traceID]; len(spans) > 0 {
+			traces = append(traces, spans)
+		}
+	}
+
+	return traces, nil
+}
+
+// findTrace gets the spans of a trace. Spans keep the ID they were sent
+// with while query clients may lowercase, strip or pad it, so every form of
+// the ID is looked up.
+func findTrace(ctx context.Context, pool *pgxpool.Pool, projectID string, traceID string) ([]*models.Trace, error) {
+	candidates := []string{traceID}
+	if normalized := models.NormalizeTraceID(models.PadTraceID(strings.ToLower(traceID))); normalized != "" {
+		candidates = append(candidates, normalized)
+		if len(normalized) == 32 && strings.HasPrefix(normalized, strings.Repeat("0", 16)) {
+			candidates = append(candidates, normalized[16:])
+		}
+	}
+
+	return getTraceSpans(ctx, pool, projectID, candidates...)
+}
+
+// getServiceNames lists the services that reported spans recently
+func getServiceNames(ctx context.Context, pool *pgxpool.Pool, projectID string) ([]string, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT DISTINCT service_name
+		FROM traces
+		WHERE project_id = $1
+		AND timestamp > $2
+		ORDER BY service_name`,
+		projectID, time.Now().Add(-catalogueLookback),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+type traceOperation struct {
+	Name string
+	Kind models.SpanKind
+}
+
+// getOperations lists the span names a service reported recently,
+// optionally limited to one span kind
+func getOperations(ctx context.Context, pool *pgxpool.Pool, projectID string, serviceName string, kind models.SpanKind) ([]traceOperation, error) {
+	args := queryArgs{}
+	conditions := []string{
+		"project_id = " + args.add(projectID),
+		"service_name = " + args.add(serviceName),
+		"timestamp > " + args.add(time.Now().Add(-catalogueLookback)),
+	}
+	if kind != "" {
+		conditions = append(conditions, "kind = "+args.add(string(kind)))
+	}
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT name, kind
+		FROM traces
+		WHERE %s
+		ORDER BY name`, strings.Join(conditions, " AND ")),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (traceOperation, error) {
+		var op traceOperation
+		err := row.Scan(&op.Name, &op.Kind)
+		return op, err
+	})
+}
+
+// getTagNames lists the span and resource attribute keys seen recently
+func getTagNames(ctx context.Context, pool *pgxpool.Pool, projectID string, column string) ([]string, error) {
+	if column != "attributes" && column != "resource_attributes" {
+		return nil, fmt.Errorf("invalid tag column: %s", column)
+	}
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT jsonb_object_keys(%[1]s) AS key
+		FROM traces
+		WHERE project_id = $1
+		AND timestamp > $2
+		AND jsonb_typeof(%[1]s) = 'object'
+		ORDER BY key
+		LIMIT $3`, column),
+		projectID, time.Now().Add(-catalogueLookback), maxTagRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// getTagValues lists the values of a tag seen recently. Tags stored in
+// their own column are read from it.
+func getTagValues(ctx context.Context, pool *pgxpool.Pool, projectID string, column string, key string) ([]string, error) {
+	var value string
+	args := queryArgs{projectID, time.Now().Add(-catalogueLookback)}
+
+	switch {
+	case key == "service.name":
+		value = "service_name"
+	case key == "service.version":
+		value = "service_version"
+	case key == "name":
+		value = "name"
+	case key == "status":
+		value = "status::text"
+	case key == "kind":
+		value = "kind::text"
+	case column == "attributes" || column == "resource_attributes":
+		value = fmt.Sprintf("%s->>%s", column, args.add(key))
+	default:
+		return nil, fmt.Errorf("invalid tag column: %s", column)
+	}
+
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT %[1]s AS value
+		FROM traces
+		WHERE project_id = $1
+		AND timestamp > $2
+		AND %[1]s IS NOT NULL
+		ORDER BY value
+		LIMIT %[2]s`, value, args.add(maxTagRows)),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// spanData is the decoded JSON data of a span
+type spanData struct {
+	Attributes         map[string]any
+	ResourceAttributes map[string]any
+	Events             []models.TraceEvent
+	Links              []models.TraceLink
+}
+
+// decodeSpanData decodes the JSONB columns of a span, skipping any that
+// are missing or malformed
+func decodeSpanData(span *models.Trace) spanData {
+	var data spanData
+	if len(span.Attributes) > 0 {
+		_ = json.Unmarshal(span.Attributes, &data.Attributes)
+	}
+	if len(span.ResourceAttributes) > 0 {
+		_ = json.Unmarshal(span.ResourceAttributes, &data.ResourceAttributes)
+	}
+	if len(span.Events) > 0 {
+		_ = json.Unmarshal(span.Events, &data.Events)
+	}
+	if len(span.Links) > 0 {
+		_ = json.Unmarshal(span.Links, &data.Links)
+	}
+	return data
+}
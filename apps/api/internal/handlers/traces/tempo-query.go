@@ -0,0 +1,770 @@
+package traces
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/protowire"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Tempo query API used by the Grafana Tempo data source. Traces are
+// returned as OTLP, protobuf encoded when the client asks for it.
+
+// Search window used when a Tempo search has no start time
+const defaultTempoLookback = time.Hour
+
+// Intrinsic span fields Tempo exposes as tags
+var tempoIntrinsics = []string{"duration", "kind", "name", "status"}
+
+// OTLP enum values
+var (
+	otlpSpanKinds = map[models.SpanKind]int{
+		models.SpanKindUnspecified: 0,
+		models.SpanKindInternal:    1,
+		models.SpanKindServer:      2,
+		models.SpanKindClient:      3,
+		models.SpanKindProducer:    4,
+		models.SpanKindConsumer:    5,
+	}
+	otlpStatusCodes = map[models.SpanStatus]int{
+		models.SpanStatusUnset: 0,
+		models.SpanStatusOk:    1,
+		models.SpanStatusError: 2,
+	}
+)
+
+// otlpValue is an OTLP AnyValue holding a string, bool, int64 or float64
+type otlpValue struct {
+	value any
+}
+
+func (v otlpValue) MarshalJSON() ([]byte, error) {
+	switch value := v.value.(type) {
+	case bool:
+		return json.Marshal(map[string]bool{"boolValue": value})
+	case int64:
+		return json.Marshal(map[string]string{"intValue": strconv.FormatInt(value, 10)})
+	case float64:
+		return json.Marshal(map[string]float64{"doubleValue": value})
+	default:
+		return json.Marshal(map[string]string{"stringValue": fmt.Sprint(value)})
+	}
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+
+	time time.Time
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+
+	startTime time.Time
+	endTime   time.Time
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct{}   `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type tempoTraceSearchMetadata struct {
+	TraceID           string `json:"traceID"`
+	RootServiceName   string `json:"rootServiceName"`
+	RootTraceName     string `json:"rootTraceName"`
+	StartTimeUnixNano string `json:"startTimeUnixNano"`
+	DurationMs        int64  `json:"durationMs"`
+}
+
+type tempoTagScope struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+type tempoTagValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// otlpID converts a stored ID to raw bytes of the given size. Hex IDs are
+// decoded and left padded, other IDs (e.g. generated span IDs) are hashed
+// so references to them still resolve.
+func otlpID(id string, size int) []byte {
+	if b, err := hex.DecodeString(id); err == nil && len(b) <= size && len(b) > 0 {
+		padded := make([]byte, size)
+		copy(padded[size-len(b):], b)
+		return padded
+	}
+	if size == 8 {
+		h := fnv.New64a()
+		h.Write([]byte(id))
+		return h.Sum(nil)
+	}
+	h := fnv.New128a()
+	h.Write([]byte(id))
+	return h.Sum(nil)
+}
+
+func otlpTraceID(id string) string {
+	return hex.EncodeToString(otlpID(id, 16))
+}
+
+func otlpSpanID(id string) string {
+	return hex.EncodeToString(otlpID(id, 8))
+}
+
+func unixNanoString(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// toOTLPAttributes converts attributes sorted by key. Numbers without a
+// fraction become ints, nested values are JSON encoded strings.
+func toOTLPAttributes(attributes map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value any
+		switch v := attributes[key].(type) {
+		case string, bool:
+			value = v
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				value = int64(v)
+			} else {
+				value = v
+			}
+		default:
+			b, _ := json.Marshal(v)
+			value = string(b)
+		}
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: otlpValue{value}})
+	}
+	return kvs
+}
+
+// toOTLPTrace converts the spans of one trace, grouping spans that share a
+// service and resource into one ResourceSpans
+func toOTLPTrace(spans []*models.Trace) []otlpResourceSpans {
+	var batches []otlpResourceSpans
+	batchIndex := make(map[string]int)
+
+	for _, span := range spans {
+		data := decodeSpanData(span)
+
+		resourceKey := span.ServiceName + "\x00" + span.ServiceVersion.String + "\x00" + string(span.ResourceAttributes)
+		index, ok := batchIndex[resourceKey]
+		if !ok {
+			resource := data.ResourceAttributes
+			if resource == nil {
+				resource = make(map[string]any)
+			}
+			resource["service.name"] = span.ServiceName
+			if span.ServiceVersion.Valid {
+				resource["service.version"] = span.ServiceVersion.String
+			}
+
+			index = len(batches)
+			batchIndex[resourceKey] = index
+			batches = append(batches, otlpResourceSpans{
+				Resource:   otlpResource{Attributes: toOTLPAttributes(resource)},
+				ScopeSpans: []otlpScopeSpans{{Spans: []otlpSpan{}}},
+			})
+		}
+
+		s := otlpSpan{
+			TraceID:           otlpTraceID(span.TraceID),
+			SpanID:            otlpSpanID(span.ID),
+			Name:              span.Name,
+			Kind:              otlpSpanKinds[span.Kind],
+			StartTimeUnixNano: unixNanoString(span.StartTime),
+			EndTimeUnixNano:   unixNanoString(span.EndTime),
+			Attributes:        toOTLPAttributes(data.Attributes),
+			Status: otlpStatus{
+				Code:    otlpStatusCodes[span.Status],
+				Message: span.StatusMsg.String,
+			},
+			startTime: span.StartTime,
+			endTime:   span.EndTime,
+		}
+		if span.ParentID.Valid {
+			s.ParentSpanID = otlpSpanID(span.ParentID.String)
+		}
+
+		for _, event := range data.Events {
+			var attributes map[string]any
+			if len(event.Attributes) > 0 {
+				_ = json.Unmarshal(event.Attributes, &attributes)
+			}
+			s.Events = append(s.Events, otlpEvent{
+				TimeUnixNano: unixNanoString(event.Timestamp),
+				Name:         event.Name,
+				Attributes:   toOTLPAttributes(attributes),
+				time:         event.Timestamp,
+			})
+		}
+
+		for _, link := range data.Links {
+			var attributes map[string]any
+			if len(link.Attributes) > 0 {
+				_ = json.Unmarshal(link.Attributes, &attributes)
+			}
+			s.Links = append(s.Links, otlpLink{
+				TraceID:    otlpTraceID(link.TraceID),
+				SpanID:     otlpSpanID(link.SpanID),
+				Attributes: toOTLPAttributes(attributes),
+			})
+		}
+
+		batches[index].ScopeSpans[0].Spans = append(batches[index].ScopeSpans[0].Spans, s)
+	}
+
+	return batches
+}
+
+func encodeOTLPKeyValues(w *protowire.Writer, field int, kvs []otlpKeyValue) {
+	for _, kv := range kvs {
+		value := &protowire.Writer{}
+		switch v := kv.Value.value.(type) {
+		case bool:
+			value.Bool(2, v)
+		case int64:
+			value.Varint(3, uint64(v))
+		case float64:
+			value.Double(4, v)
+		default:
+			value.String(1, fmt.Sprint(v))
+		}
+
+		m := &protowire.Writer{}
+		m.String(1, kv.Key)
+		m.Message(2, value)
+		w.Message(field, m)
+	}
+}
+
+// encodeOTLPSpan encodes an opentelemetry.proto.trace.v1.Span
+func encodeOTLPSpan(s otlpSpan) *protowire.Writer {
+	w := &protowire.Writer{}
+	w.Bytes(1, otlpID(s.TraceID, 16))
+	w.Bytes(2, otlpID(s.SpanID, 8))
+	if s.ParentSpanID != "" {
+		w.Bytes(4, otlpID(s.ParentSpanID, 8))
+	}
+	w.String(5, s.Name)
+	w.Varint(6, uint64(s.Kind))
+	w.Fixed64(7, uint64(s.startTime.UnixNano()))
+	w.Fixed64(8, uint64(s.endTime.UnixNano()))
+	encodeOTLPKeyValues(w, 9, s.Attributes)
+
+	for _, event := range s.Events {
+		e := &protowire.Writer{}
+		e.Fixed64(1, uint64(event.time.UnixNano()))
+		e.String(2, event.Name)
+		encodeOTLPKeyValues(e, 3, event.Attributes)
+		w.Message(11, e)
+	}
+
+	for _, link := range s.Links {
+		l := &protowire.Writer{}
+		l.Bytes(1, otlpID(link.TraceID, 16))
+		l.Bytes(2, otlpID(link.SpanID, 8))
+		encodeOTLPKeyValues(l, 4, link.Attributes)
+		w.Message(13, l)
+	}
+
+	status := &protowire.Writer{}
+	if s.Status.Message != "" {
+		status.String(2, s.Status.Message)
+	}
+	if s.Status.Code != 0 {
+		status.Varint(3, uint64(s.Status.Code))
+	}
+	w.Message(15, status)
+
+	return w
+}
+
+// encodeTempoTrace encodes a tempopb.Trace, a list of ResourceSpans
+func encodeTempoTrace(batches []otlpResourceSpans) *protowire.Writer {
+	w := &protowire.Writer{}
+	for _, batch := range batches {
+		resource := &protowire.Writer{}
+		encodeOTLPKeyValues(resource, 1, batch.Resource.Attributes)
+
+		rs := &protowire.Writer{}
+		rs.Message(1, resource)
+		for _, scopeSpans := range batch.ScopeSpans {
+			ss := &protowire.Writer{}
+			for _, span := range scopeSpans.Spans {
+				ss.Message(2, encodeOTLPSpan(span))
+			}
+			rs.Message(2, ss)
+		}
+		w.Message(1, rs)
+	}
+	return w
+}
+
+func wantsProtobuf(c fiber.Ctx) bool {
+	return strings.Contains(strings.ToLower(c.Get(fiber.HeaderAccept)), "application/protobuf")
+}
+
+// TempoEcho answers the data source connection test (GET /api/echo)
+func (h *TracesHandler) TempoEcho(c fiber.Ctx) error {
+	return c.SendString("echo")
+}
+
+// sendTempoTrace gets a trace by ID, wrapping it in a TraceByIDResponse for
+// the v2 API
+func (h *TracesHandler) sendTempoTrace(c fiber.Ctx, v2 bool) error {
+	projectID := c.Locals("project_id").(string)
+
+	spans, err := findTrace(c.Context(), h.pool, projectID, c.Params("traceId"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get trace")
+	}
+	if len(spans) == 0 {
+		return c.Status(fiber.StatusNotFound).SendString("trace not found")
+	}
+
+	batches := toOTLPTrace(spans)
+
+	if wantsProtobuf(c) {
+		trace := encodeTempoTrace(batches)
+		if v2 {
+			response := &protowire.Writer{}
+			response.Message(1, trace)
+			trace = response
+		}
+		c.Set(fiber.HeaderContentType, "application/protobuf")
+		return c.Send(trace.Encoded())
+	}
+
+	if v2 {
+		return c.JSON(fiber.Map{
+			"trace": fiber.Map{"resourceSpans": batches},
+		})
+	}
+	return c.JSON(fiber.Map{"batches": batches})
+}
+
+// TempoTraceByID gets a trace by ID (GET /api/traces/:traceId)
+func (h *TracesHandler) TempoTraceByID(c fiber.Ctx) error {
+	return h.sendTempoTrace(c, false)
+}
+
+// TempoTraceByIDV2 gets a trace by ID (GET /api/v2/traces/:traceId)
+func (h *TracesHandler) TempoTraceByIDV2(c fiber.Ctx) error {
+	return h.sendTempoTrace(c, true)
+}
+
+// splitOutsideQuotes splits s on sep, ignoring separators inside double
+// quoted strings
+func splitOutsideQuotes(s string, sep string) []string {
+	var parts []string
+	inQuotes := false
+	last := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.HasPrefix(s[i:], sep):
+			parts = append(parts, s[last:i])
+			i += len(sep) - 1
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+func unquoteValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// addTempoTag adds a tag filter, mapping well known tags to the dedicated
+// search fields
+func addTempoTag(search *traceSearch, key, value string) {
+	switch key {
+	case "name":
+		search.Operation = value
+	case "service.name":
+		search.ServiceName = value
+	default:
+		if search.Tags == nil {
+			search.Tags = make(map[string]string)
+		}
+		search.Tags[key] = value
+	}
+}
+
+// parseTempoTags parses logfmt encoded tags, e.g.
+// service.name=api http.status_code=500
+func parseTempoTags(search *traceSearch, tags string) error {
+	for _, pair := range splitOutsideQuotes(strings.TrimSpace(tags), " ") {
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid tag: %s", pair)
+		}
+		value, err := unquoteValue(value)
+		if err != nil {
+			return fmt.Errorf("invalid tag value: %s", pair)
+		}
+		addTempoTag(search, key, value)
+	}
+	return nil
+}
+
+// parseTraceQL parses the subset of TraceQL the Grafana search editor
+// produces: a single spanset of conditions joined by &&, e.g.
+// { resource.service.name = "api" && span.http.status_code = 500 && duration > 100ms }
+func parseTraceQL(search *traceSearch, query string) error {
+	query = strings.TrimSpace(query)
+	if !strings.HasPrefix(query, "{") || !strings.HasSuffix(query, "}") {
+		return fmt.Errorf("unsupported TraceQL query, only a single spanset is supported")
+	}
+	query = strings.TrimSpace(query[1 : len(query)-1])
+	if query == "" {
+		return nil
+	}
+
+	for _, condition := range splitOutsideQuotes(query, "&&") {
+		condition = strings.TrimSpace(condition)
+
+		var lhs, op, rhs string
+		for _, candidate := range []string{">=", "<=", "!=", "=~", "!~", "=", ">", "<"} {
+			parts := splitOutsideQuotes(condition, candidate)
+			if len(parts) == 2 {
+				lhs, op, rhs = strings.TrimSpace(parts[0]), candidate, strings.TrimSpace(parts[1])
+				break
+			}
+		}
+		if op == "" {
+			return fmt.Errorf("unsupported TraceQL condition: %s", condition)
+		}
+
+		value, err := unquoteValue(rhs)
+		if err != nil {
+			return fmt.Errorf("invalid TraceQL value: %s", rhs)
+		}
+
+		if lhs == "duration" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid TraceQL duration: %s", value)
+			}
+			switch op {
+			case ">", ">=":
+				search.MinDuration = d
+			case "<", "<=":
+				search.MaxDuration = d
+			default:
+				return fmt.Errorf("unsupported TraceQL duration operator: %s", op)
+			}
+			continue
+		}
+
+		if op != "=" {
+			return fmt.Errorf("unsupported TraceQL operator: %s", op)
+		}
+
+		switch lhs {
+		case "status":
+			if value != "error" {
+				return fmt.Errorf("unsupported TraceQL status: %s", value)
+			}
+			addTempoTag(search, "error", "true")
+		case "kind":
+			addTempoTag(search, "span.kind", value)
+		case "name":
+			addTempoTag(search, "name", value)
+		default:
+			key := strings.TrimPrefix(lhs, ".")
+			key = strings.TrimPrefix(strings.TrimPrefix(key, "span."), "resource.")
+			if key == "" {
+				return fmt.Errorf("unsupported TraceQL attribute: %s", lhs)
+			}
+			addTempoTag(search, key, value)
+		}
+	}
+
+	return nil
+}
+
+// parseUnixSeconds parses a unix timestamp in seconds
+func parseUnixSeconds(s string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+// toTempoSearchMetadata summarizes a trace by its root span
+func toTempoSearchMetadata(spans []*models.Trace) tempoTraceSearchMetadata {
+	root := spans[0]
+	start, end := spans[0].StartTime, spans[0].EndTime
+	for _, span := range spans {
+		if !span.ParentID.Valid && root.ParentID.Valid {
+			root = span
+		}
+		if span.StartTime.Before(start) {
+			start = span.StartTime
+		}
+		if span.EndTime.After(end) {
+			end = span.EndTime
+		}
+	}
+
+	return tempoTraceSearchMetadata{
+		TraceID:           root.TraceID,
+		RootServiceName:   root.ServiceName,
+		RootTraceName:     root.Name,
+		StartTimeUnixNano: unixNanoString(start),
+		DurationMs:        end.Sub(start).Milliseconds(),
+	}
+}
+
+// TempoSearch searches traces (GET /api/search). Filters are given as
+// logfmt tags or a TraceQL spanset, times are unix seconds.
+func (h *TracesHandler) TempoSearch(c fiber.Ctx) error {
+	projectID := c.Locals("project_id").(string)
+
+	search := traceSearch{End: time.Now()}
+	if end := c.Query("end"); end != "" {
+		t, err := parseUnixSeconds(end)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("invalid end time")
+		}
+		search.End = t
+	}
+	search.Start = search.End.Add(-defaultTempoLookback)
+	if start := c.Query("start"); start != "" {
+		t, err := parseUnixSeconds(start)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("invalid start time")
+		}
+		search.Start = t
+	}
+
+	if q := c.Query("q"); q != "" {
+		if err := parseTraceQL(&search, q); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+	}
+	if tags := c.Query("tags"); tags != "" {
+		if err := parseTempoTags(&search, tags); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+	}
+
+	for name, target := range map[string]*time.Duration{"minDuration": &search.MinDuration, "maxDuration": &search.MaxDuration} {
+		if value := c.Query(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("invalid %s", name))
+			}
+			*target = d
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("invalid limit")
+		}
+		search.Limit = n
+	}
+
+	results, err := searchTraces(c.Context(), h.pool, projectID, search)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to search traces")
+	}
+
+	traces := make([]tempoTraceSearchMetadata, 0, len(results))
+	for _, spans := range results {
+		traces = append(traces, toTempoSearchMetadata(spans))
+	}
+
+	return c.JSON(fiber.Map{
+		"traces":  traces,
+		"metrics": fiber.Map{"inspectedTraces": len(traces)},
+	})
+}
+
+// tempoTagNames lists span and resource tag names. Tags stored in their
+// own column are always listed.
+func (h *TracesHandler) tempoTagNames(c fiber.Ctx) (span []string, resource []string, err error) {
+	projectID := c.Locals("project_id").(string)
+
+	if span, err = getTagNames(c.Context(), h.pool, projectID, "attributes"); err != nil {
+		return nil, nil, err
+	}
+	if resource, err = getTagNames(c.Context(), h.pool, projectID, "resource_attributes"); err != nil {
+		return nil, nil, err
+	}
+	for _, name := range []string{"service.name", "service.version"} {
+		if !containsString(resource, name) {
+			resource = append(resource, name)
+		}
+	}
+	sort.Strings(resource)
+
+	return span, resource, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// TempoSearchTags lists tag names (GET /api/search/tags)
+func (h *TracesHandler) TempoSearchTags(c fiber.Ctx) error {
+	span, resource, err := h.tempoTagNames(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get tags")
+	}
+
+	names := append([]string{"name", "status"}, span...)
+	for _, name := range resource {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return c.JSON(fiber.Map{"tagNames": names})
+}
+
+// TempoSearchTagsV2 lists tag names by scope (GET /api/v2/search/tags)
+func (h *TracesHandler) TempoSearchTagsV2(c fiber.Ctx) error {
+	span, resource, err := h.tempoTagNames(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get tags")
+	}
+
+	scopes := []tempoTagScope{
+		{Name: "span", Tags: span},
+		{Name: "resource", Tags: resource},
+		{Name: "intrinsic", Tags: tempoIntrinsics},
+	}
+	if scope := c.Query("scope"); scope != "" && scope != "all" {
+		for _, s := range scopes {
+			if s.Name == scope {
+				scopes = []tempoTagScope{s}
+				break
+			}
+		}
+	}
+
+	return c.JSON(fiber.Map{"scopes": scopes})
+}
+
+// tempoTagValues lists the values of a tag. Names may be scoped, e.g.
+// resource.service.name, span.http.method or .http.method.
+func (h *TracesHandler) tempoTagValues(c fiber.Ctx) ([]string, error) {
+	projectID := c.Locals("project_id").(string)
+	name := c.Params("name")
+
+	column := "attributes"
+	switch {
+	case strings.HasPrefix(name, "resource."):
+		column, name = "resource_attributes", strings.TrimPrefix(name, "resource.")
+	case strings.HasPrefix(name, "span."):
+		name = strings.TrimPrefix(name, "span.")
+	case strings.HasPrefix(name, "."):
+		name = strings.TrimPrefix(name, ".")
+	}
+
+	return getTagValues(c.Context(), h.pool, projectID, column, name)
+}
+
+// TempoSearchTagValues lists tag values (GET /api/search/tag/:name/values)
+func (h *TracesHandler) TempoSearchTagValues(c fiber.Ctx) error {
+	values, err := h.tempoTagValues(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get tag values")
+	}
+
+	return c.JSON(fiber.Map{"tagValues": values})
+}
+
+// TempoSearchTagValuesV2 lists typed tag values
+// (GET /api/v2/search/tag/:name/values)
+func (h *TracesHandler) TempoSearchTagValuesV2(c fiber.Ctx) error {
+	values, err := h.tempoTagValues(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get tag values")
+	}
+
+	typed := make([]tempoTagValue, 0, len(values))
+	for _, value := range values {
+		typed = append(typed, tempoTagValue{Type: "string", Value: value})
+	}
+
+	return c.JSON(fiber.Map{"tagValues": typed})
+}
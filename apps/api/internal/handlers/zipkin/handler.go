@@ -0,0 +1,18 @@
+package zipkin
+
+import (
+	"github.com/ted-too/logsicle/internal/queue"
+	"gorm.io/gorm"
+)
+
+type ZipkinHandler struct {
+	db    *gorm.DB
+	queue *queue.QueueService
+}
+
+func NewZipkinHandler(db *gorm.DB, queue *queue.QueueService) *ZipkinHandler {
+	return &ZipkinHandler{
+		db:    db,
+		queue: queue,
+	}
+}
@@ -0,0 +1,243 @@
+package zipkin
+
+import (
+	"encoding/hex"
+	"net"
+
+	"github.com/ted-too/logsicle/internal/protowire"
+)
+
+// Minimal decoder for the zipkin.proto3 ListOfSpans wire format:
+//
+//	ListOfSpans { repeated Span spans = 1; }
+//	Span        { bytes trace_id = 1; bytes parent_id = 2; bytes id = 3; Kind kind = 4;
+//	              string name = 5; fixed64 timestamp = 6; uint64 duration = 7;
+//	              Endpoint local_endpoint = 8; Endpoint remote_endpoint = 9;
+//	              repeated Annotation annotations = 10; map<string, string> tags = 11;
+//	              bool debug = 12; bool shared = 13; }
+//	Endpoint    { string service_name = 1; bytes ipv4 = 2; bytes ipv6 = 3; int32 port = 4; }
+//	Annotation  { fixed64 timestamp = 1; string value = 2; }
+
+// Span kinds in enum order, index 0 is SPAN_KIND_UNSPECIFIED
+var protoKinds = []string{"", "CLIENT", "SERVER", "PRODUCER", "CONSUMER"}
+
+func decodeListOfSpans(data []byte) ([]Span, error) {
+	var spans []Span
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+		if field == 1 && wireType == protowire.WireBytes {
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			span, err := decodeSpan(b)
+			if err != nil {
+				return nil, err
+			}
+			spans = append(spans, *span)
+			continue
+		}
+		if err := r.Skip(wireType); err != nil {
+			return nil, err
+		}
+	}
+
+	return spans, nil
+}
+
+func decodeSpan(data []byte) (*Span, error) {
+	span := &Span{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case 1:
+				span.TraceID = hex.EncodeToString(b)
+			case 2:
+				span.ParentID = hex.EncodeToString(b)
+			case 3:
+				span.ID = hex.EncodeToString(b)
+			case 5:
+				span.Name = string(b)
+			case 8, 9:
+				endpoint, err := decodeEndpoint(b)
+				if err != nil {
+					return nil, err
+				}
+				if field == 8 {
+					span.LocalEndpoint = endpoint
+				} else {
+					span.RemoteEndpoint = endpoint
+				}
+			case 10:
+				annotation, err := decodeAnnotation(b)
+				if err != nil {
+					return nil, err
+				}
+				span.Annotations = append(span.Annotations, *annotation)
+			case 11:
+				key, value, err := decodeMapEntry(b)
+				if err != nil {
+					return nil, err
+				}
+				if span.Tags == nil {
+					span.Tags = make(map[string]string)
+				}
+				span.Tags[key] = value
+			}
+		case field == 6 && wireType == protowire.WireI64:
+			v, err := r.Fixed64()
+			if err != nil {
+				return nil, err
+			}
+			span.Timestamp = int64(v)
+		case wireType == protowire.WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case 4:
+				if v < uint64(len(protoKinds)) {
+					span.Kind = protoKinds[v]
+				}
+			case 7:
+				span.Duration = int64(v)
+			case 12:
+				span.Debug = v != 0
+			case 13:
+				span.Shared = v != 0
+			}
+		default:
+			if err := r.Skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return span, nil
+}
+
+func decodeEndpoint(data []byte) (*Endpoint, error) {
+	endpoint := &Endpoint{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			switch field {
+			case 1:
+				endpoint.ServiceName = string(b)
+			case 2:
+				if len(b) == net.IPv4len {
+					endpoint.IPv4 = net.IP(b).String()
+				}
+			case 3:
+				if len(b) == net.IPv6len {
+					endpoint.IPv6 = net.IP(b).String()
+				}
+			}
+		case field == 4 && wireType == protowire.WireVarint:
+			v, err := r.Varint()
+			if err != nil {
+				return nil, err
+			}
+			endpoint.Port = int(int32(v))
+		default:
+			if err := r.Skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return endpoint, nil
+}
+
+func decodeAnnotation(data []byte) (*Annotation, error) {
+	annotation := &Annotation{}
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case field == 1 && wireType == protowire.WireI64:
+			v, err := r.Fixed64()
+			if err != nil {
+				return nil, err
+			}
+			annotation.Timestamp = int64(v)
+		case field == 2 && wireType == protowire.WireBytes:
+			b, err := r.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			annotation.Value = string(b)
+		default:
+			if err := r.Skip(wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return annotation, nil
+}
+
+// decodeMapEntry decodes a map<string, string> entry
+func decodeMapEntry(data []byte) (string, string, error) {
+	var key, value string
+	r := protowire.NewReader(data)
+
+	for !r.Done() {
+		field, wireType, err := r.Tag()
+		if err != nil {
+			return "", "", err
+		}
+		if wireType != protowire.WireBytes {
+			if err := r.Skip(wireType); err != nil {
+				return "", "", err
+			}
+			continue
+		}
+		b, err := r.Bytes()
+		if err != nil {
+			return "", "", err
+		}
+		switch field {
+		case 1:
+			key = string(b)
+		case 2:
+			value = string(b)
+		}
+	}
+
+	return key, value, nil
+}
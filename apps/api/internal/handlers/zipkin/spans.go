@@ -0,0 +1,240 @@
+package zipkin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/server"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Service name used when a span has no local endpoint
+	defaultServiceName = "zipkin"
+	// Span name used when a span has none, Zipkin allows empty names
+	defaultSpanName = "unknown"
+)
+
+// Zipkin span kinds, spans without a kind are local (internal) spans
+var spanKinds = map[string]models.SpanKind{
+	"":         models.SpanKindInternal,
+	"CLIENT":   models.SpanKindClient,
+	"SERVER":   models.SpanKindServer,
+	"PRODUCER": models.SpanKindProducer,
+	"CONSUMER": models.SpanKindConsumer,
+}
+
+// Span is a Zipkin v2 span. Timestamps and durations are in microseconds.
+type Span struct {
+	TraceID        string            `json:"traceId"`
+	ParentID       string            `json:"parentId,omitempty"`
+	ID             string            `json:"id"`
+	Kind           string            `json:"kind,omitempty"`
+	Name           string            `json:"name,omitempty"`
+	Timestamp      int64             `json:"timestamp,omitempty"`
+	Duration       int64             `json:"duration,omitempty"`
+	Debug          bool              `json:"debug,omitempty"`
+	Shared         bool              `json:"shared,omitempty"`
+	LocalEndpoint  *Endpoint         `json:"localEndpoint,omitempty"`
+	RemoteEndpoint *Endpoint         `json:"remoteEndpoint,omitempty"`
+	Annotations    []Annotation      `json:"annotations,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+type Endpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type Annotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+func (e *Endpoint) ip() string {
+	if e.IPv4 != "" {
+		return e.IPv4
+	}
+	return e.IPv6
+}
+
+// spanStatus derives the span status from the Zipkin "error" tag, falling
+// back to the tags OpenTelemetry exporters add. Consumed tags are removed.
+func spanStatus(tags map[string]any) (models.SpanStatus, string) {
+	if value, ok := tags["error"]; ok {
+		delete(tags, "error")
+		message, _ := value.(string)
+		if message == "true" {
+			message = ""
+		}
+		return models.SpanStatusError, message
+	}
+
+	code, _ := tags["otel.status_code"].(string)
+	message, _ := tags["otel.status_description"].(string)
+	delete(tags, "otel.status_code")
+	delete(tags, "otel.status_description")
+
+	switch strings.ToUpper(code) {
+	case "ERROR":
+		return models.SpanStatusError, message
+	case "OK":
+		return models.SpanStatusOk, ""
+	default:
+		return models.SpanStatusUnset, ""
+	}
+}
+
+func toTraceInput(projectID string, span Span) (models.TraceInput, error) {
+	traceID := models.NormalizeTraceID(models.PadTraceID(span.TraceID))
+	if traceID == "" {
+		return models.TraceInput{}, fmt.Errorf("invalid traceId: %q", span.TraceID)
+	}
+	spanID := models.NormalizeSpanID(models.PadSpanID(span.ID))
+	if spanID == "" {
+		return models.TraceInput{}, fmt.Errorf("invalid id: %q", span.ID)
+	}
+	var parentID string
+	if span.ParentID != "" {
+		if parentID = models.NormalizeSpanID(models.PadSpanID(span.ParentID)); parentID == "" {
+			return models.TraceInput{}, fmt.Errorf("invalid parentId: %q", span.ParentID)
+		}
+	}
+	if span.Timestamp <= 0 {
+		return models.TraceInput{}, fmt.Errorf("span %s has no timestamp", spanID)
+	}
+
+	kind, ok := spanKinds[strings.ToUpper(span.Kind)]
+	if !ok {
+		return models.TraceInput{}, fmt.Errorf("invalid kind: %s", span.Kind)
+	}
+
+	name := span.Name
+	if name == "" {
+		name = defaultSpanName
+	}
+
+	serviceName := defaultServiceName
+	resourceAttributes := make(map[string]any)
+	if local := span.LocalEndpoint; local != nil {
+		if local.ServiceName != "" {
+			serviceName = local.ServiceName
+		}
+		if ip := local.ip(); ip != "" {
+			resourceAttributes["net.host.ip"] = ip
+		}
+		if local.Port != 0 {
+			resourceAttributes["net.host.port"] = local.Port
+		}
+	}
+	resourceAttributes["service.name"] = serviceName
+
+	attributes := make(map[string]any, len(span.Tags))
+	for k, v := range span.Tags {
+		attributes[k] = v
+	}
+	status, statusMessage := spanStatus(attributes)
+
+	if remote := span.RemoteEndpoint; remote != nil {
+		if remote.ServiceName != "" {
+			attributes["peer.service"] = remote.ServiceName
+		}
+		if ip := remote.ip(); ip != "" {
+			attributes["net.peer.ip"] = ip
+		}
+		if remote.Port != 0 {
+			attributes["net.peer.port"] = remote.Port
+		}
+	}
+	if span.Debug {
+		attributes["zipkin.debug"] = true
+	}
+	if span.Shared {
+		attributes["zipkin.shared"] = true
+	}
+
+	var events []models.TraceEvent
+	for _, annotation := range span.Annotations {
+		events = append(events, models.TraceEvent{
+			Name:      annotation.Value,
+			Timestamp: time.UnixMicro(annotation.Timestamp),
+		})
+	}
+
+	start := time.UnixMicro(span.Timestamp)
+
+	return models.TraceInput{
+		ProjectID:          projectID,
+		TraceID:            traceID,
+		SpanID:             spanID,
+		ParentID:           parentID,
+		Name:               name,
+		Kind:               string(kind),
+		StartTime:          start,
+		EndTime:            start.Add(time.Duration(span.Duration) * time.Microsecond),
+		Status:             string(status),
+		StatusMessage:      statusMessage,
+		ServiceName:        serviceName,
+		Attributes:         attributes,
+		Events:             events,
+		ResourceAttributes: resourceAttributes,
+	}, nil
+}
+
+func toTrace(projectID string, span Span) (*models.Trace, error) {
+	input, err := toTraceInput(projectID, span)
+	if err != nil {
+		return nil, err
+	}
+	return input.ValidateAndCreate()
+}
+
+// PostSpans implements the Zipkin v2 collector API (POST /api/v2/spans).
+// The body is a JSON list of spans or a protobuf ListOfSpans.
+func (h *ZipkinHandler) PostSpans(c fiber.Ctx) error {
+	projectID, ok := c.Locals("project_id").(string)
+	if !ok {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to get project ID")
+	}
+
+	body, err := server.ReadBody(c)
+	if err != nil {
+		return c.Status(err.(*fiber.Error).Code).SendString(err.Error())
+	}
+
+	var spans []Span
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	if strings.HasPrefix(contentType, "application/x-protobuf") || strings.HasPrefix(contentType, "application/protobuf") {
+		spans, err = decodeListOfSpans(body)
+	} else {
+		err = json.Unmarshal(body, &spans)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	// Convert every span before queueing any, a rejected batch must not
+	// leave part of it stored
+	traces := make([]*models.Trace, 0, len(spans))
+	for i, span := range spans {
+		trace, err := toTrace(projectID, span)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(
+				fmt.Sprintf("span %d of %d rejected: %v", i+1, len(spans), err),
+			)
+		}
+		traces = append(traces, trace)
+	}
+
+	if err := h.queue.EnqueueTraces(c.Context(), traces); err != nil {
+		// Nothing is queued on failure, let the client resend the batch
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
@@ -0,0 +1,119 @@
+package issues
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+var (
+	// Content hashes in bundle and file names, e.g. main.3f2a1b9c.js
+	fileHashPattern = regexp.MustCompile(`[.\-_][0-9a-fA-F]{6,}(\.|$)`)
+	// Memory addresses printed in function names and messages
+	addressPattern = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+	uuidPattern    = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	numberPattern  = regexp.MustCompile(`\d+`)
+	// Quoted values in messages, e.g. user "bob" not found
+	quotedPattern = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+)
+
+// Fingerprint identifies the issue an exception belongs to. It hashes the
+// exception type and the normalized stack, ignoring line and column numbers
+// so the issue survives unrelated edits. Only in app frames are used when
+// any are marked. Exceptions without frames fall back to the normalized
+// message.
+func Fingerprint(exception *models.Exception) string {
+	parts := []string{exception.Type}
+
+	frames := inAppFrames(exception.Stacktrace)
+	if len(frames) > 0 {
+		for _, frame := range frames {
+			parts = append(parts, normalizeLocation(frame)+"|"+normalizeFunction(frame.Function))
+		}
+	} else {
+		parts = append(parts, normalizeMessage(exception.Value))
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// inAppFrames returns the frames marked as application code, or every frame
+// when none are marked
+func inAppFrames(frames []models.StackFrame) []models.StackFrame {
+	var inApp []models.StackFrame
+	for _, frame := range frames {
+		if frame.InApp != nil && *frame.InApp {
+			inApp = append(inApp, frame)
+		}
+	}
+	if len(inApp) > 0 {
+		return inApp
+	}
+	return frames
+}
+
+// culpritFrame is the most recent in app frame
+func culpritFrame(frames []models.StackFrame) *models.StackFrame {
+	frames = inAppFrames(frames)
+	if len(frames) == 0 {
+		return nil
+	}
+	return &frames[len(frames)-1]
+}
+
+// Culprit describes where an exception was raised, e.g. "handleLogin (/static/js/main.js)"
+func Culprit(exception *models.Exception) string {
+	frame := culpritFrame(exception.Stacktrace)
+	if frame == nil {
+		return exception.Module
+	}
+
+	location := normalizeLocation(*frame)
+	switch {
+	case frame.Function == "":
+		return location
+	case location == "":
+		return frame.Function
+	default:
+		return frame.Function + " (" + location + ")"
+	}
+}
+
+// normalizeLocation prefers the module and strips URL origins, query
+// strings and content hashes from file names
+func normalizeLocation(frame models.StackFrame) string {
+	if frame.Module != "" {
+		return frame.Module
+	}
+	file := frame.Filename
+	if file == "" {
+		file = frame.AbsPath
+	}
+	if i := strings.Index(file, "://"); i >= 0 {
+		file = file[i+3:]
+		if j := strings.Index(file, "/"); j >= 0 {
+			file = file[j:]
+		}
+	}
+	if i := strings.IndexAny(file, "?#"); i >= 0 {
+		file = file[:i]
+	}
+	return fileHashPattern.ReplaceAllString(file, "$1")
+}
+
+func normalizeFunction(function string) string {
+	return addressPattern.ReplaceAllString(function, "")
+}
+
+// normalizeMessage replaces values that typically differ between
+// occurrences of the same error
+func normalizeMessage(message string) string {
+	message = uuidPattern.ReplaceAllString(message, "<uuid>")
+	message = addressPattern.ReplaceAllString(message, "<addr>")
+	message = quotedPattern.ReplaceAllString(message, "<str>")
+	return numberPattern.ReplaceAllString(message, "<n>")
+}
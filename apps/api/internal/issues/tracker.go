@@ -0,0 +1,110 @@
+package issues
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// Tracker groups app logs carrying an exception into issues once they are
+// inserted, and reopens resolved issues that regress
+type Tracker struct {
+	db *gorm.DB
+}
+
+func NewTracker(db *gorm.DB) *Tracker {
+	return &Tracker{db: db}
+}
+
+// upsertIssueSQL records an occurrence, creating the issue on first sight
+const upsertIssueSQL = `
+	INSERT INTO issues (
+		id, created_at, updated_at, project_id, fingerprint, type, value,
+		culprit, level, service_name, status, first_seen, last_seen, count,
+		versions, environments
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+	ON CONFLICT (project_id, fingerprint) DO UPDATE SET
+		updated_at = EXCLUDED.updated_at,
+		first_seen = LEAST(issues.first_seen, EXCLUDED.first_seen),
+		last_seen = GREATEST(issues.last_seen, EXCLUDED.last_seen),
+		count = issues.count + 1,
+		versions = COALESCE((SELECT array_agg(DISTINCT v) FROM unnest(issues.versions || EXCLUDED.versions) v), '{}'),
+		environments = COALESCE((SELECT array_agg(DISTINCT e) FROM unnest(issues.environments || EXCLUDED.environments) e), '{}')
+	RETURNING id, status, resolved_at, resolved_in_version`
+
+type occurrence struct {
+	ID                string
+	Status            string
+	ResolvedAt        *time.Time
+	ResolvedInVersion *string
+}
+
+// Record groups an app log into its issue and returns the issue ID, or an
+// empty string when the log has no exception
+func (t *Tracker) Record(ctx context.Context, appLog *tsmodels.AppLog) (string, error) {
+	exception, err := appLog.GetException()
+	if err != nil || exception == nil {
+		return "", err
+	}
+
+	id, err := typeid.New[models.IssueID]()
+	if err != nil {
+		return "", err
+	}
+
+	versions := pq.StringArray{}
+	if appLog.Version.Valid && appLog.Version.String != "" {
+		versions = append(versions, appLog.Version.String)
+	}
+	environments := pq.StringArray{}
+	if appLog.Environment.Valid && appLog.Environment.String != "" {
+		environments = append(environments, appLog.Environment.String)
+	}
+
+	now := time.Now()
+	var issue occurrence
+	if err := t.db.WithContext(ctx).Raw(upsertIssueSQL,
+		id.String(), now, now, appLog.ProjectID, Fingerprint(exception),
+		exception.Type, exception.Value, Culprit(exception), string(appLog.Level),
+		appLog.ServiceName, models.IssueStatusUnresolved, appLog.Timestamp, appLog.Timestamp,
+		versions, environments,
+	).Scan(&issue).Error; err != nil {
+		return "", err
+	}
+
+	if issue.Status == models.IssueStatusResolved && isRegression(&issue, appLog) {
+		if err := t.db.WithContext(ctx).Model(&models.Issue{}).
+			Where("id = ? AND status = ?", issue.ID, models.IssueStatusResolved).
+			Updates(map[string]interface{}{
+				"status":              models.IssueStatusUnresolved,
+				"resolved_at":         nil,
+				"resolved_in_version": nil,
+				"last_regressed_at":   now,
+			}).Error; err != nil {
+			return issue.ID, err
+		}
+	}
+
+	return issue.ID, nil
+}
+
+// isRegression reports whether an occurrence of a resolved issue reopens
+// it. Issues resolved in a known version only regress in a newer version,
+// other issues regress on any occurrence after they were resolved.
+func isRegression(issue *occurrence, appLog *tsmodels.AppLog) bool {
+	if issue.ResolvedAt != nil && appLog.Timestamp.Before(*issue.ResolvedAt) {
+		return false
+	}
+	if issue.ResolvedInVersion == nil || *issue.ResolvedInVersion == "" {
+		return true
+	}
+	if !appLog.Version.Valid || appLog.Version.String == "" {
+		return false
+	}
+	return CompareVersions(appLog.Version.String, *issue.ResolvedInVersion) > 0
+}
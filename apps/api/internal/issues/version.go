@@ -0,0 +1,83 @@
+package issues
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersions orders release versions, returning -1, 0 or 1. Versions
+// are compared as dotted semver-like numbers, a leading "v" and build
+// metadata are ignored and a pre-release sorts before its release.
+// Non-numeric parts are compared as strings.
+func CompareVersions(a, b string) int {
+	a, aPre := splitVersion(a)
+	b, bPre := splitVersion(b)
+
+	if c := compareParts(a, b); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return compareParts(aPre, bPre)
+	}
+}
+
+func splitVersion(v string) (release, prerelease string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.Index(v, "-"); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+func compareParts(a, b string) int {
+	aParts := strings.Split(a, ".")
+	bParts := strings.Split(b, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var x, y string
+		if i < len(aParts) {
+			x = aParts[i]
+		}
+		if i < len(bParts) {
+			y = bParts[i]
+		}
+
+		xn, xErr := strconv.ParseUint(x, 10, 64)
+		yn, yErr := strconv.ParseUint(y, 10, 64)
+		// Missing parts count as zero so 1.2 equals 1.2.0
+		if x == "" {
+			xn, xErr = 0, nil
+		}
+		if y == "" {
+			yn, yErr = 0, nil
+		}
+
+		switch {
+		case xErr == nil && yErr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case xErr == nil:
+			return -1 // numeric identifiers sort before alphanumeric ones
+		case yErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,614 @@
+// Package jsonschema compiles and validates JSON Schema documents. It
+// implements the assertion keywords of drafts 7 through 2020-12 that event
+// metadata schemas use, with $ref limited to pointers inside the document.
+// Keywords it cannot enforce are rejected at compile time rather than
+// silently ignored.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum nesting of schemas, which also bounds $ref chains
+const maxDepth = 64
+
+// Keywords defined by the specification that are not enforced
+var unsupportedKeywords = []string{
+	"$dynamicRef",
+	"$dynamicAnchor",
+	"$recursiveRef",
+	"$recursiveAnchor",
+	"unevaluatedProperties",
+	"unevaluatedItems",
+	"dependentSchemas",
+	"dependencies",
+	"minContains",
+	"maxContains",
+}
+
+var validTypes = []string{"null", "boolean", "object", "array", "number", "integer", "string"}
+
+// Schema is a compiled schema
+type Schema struct {
+	root *node
+}
+
+// node is a compiled (sub)schema. A boolean schema has always set.
+type node struct {
+	always *bool
+
+	ref      string
+	resolved *node
+
+	types []string
+	enum  []any
+	// constant is only checked when hasConst is set, since null is valid
+	constant any
+	hasConst bool
+
+	properties           map[string]*node
+	patternProperties    map[*regexp.Regexp]*node
+	additionalProperties *node
+	propertyNames        *node
+	required             []string
+	dependentRequired    map[string][]string
+	minProperties        *int
+	maxProperties        *int
+
+	prefixItems []*node
+	items       *node
+	contains    *node
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*node
+	anyOf []*node
+	oneOf []*node
+	not   *node
+	ifs   *node
+	then  *node
+	elses *node
+}
+
+type compiler struct {
+	doc any
+	// Compiled target of each reference, filled in by resolve
+	refs    map[string]*node
+	pending []string
+}
+
+// Compile parses a schema document
+func Compile(data []byte) (*Schema, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return CompileValue(doc)
+}
+
+// CompileValue compiles an already decoded schema document
+func CompileValue(doc any) (*Schema, error) {
+	c := &compiler{doc: doc, refs: make(map[string]*node)}
+	root, err := c.compile(doc, "#", 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.resolve(); err != nil {
+		return nil, err
+	}
+	if err := checkCycles(root); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// resolve compiles the targets of $ref nodes once the whole document is
+// known. Targets are compiled once, so recursive schemas terminate.
+func (c *compiler) resolve() error {
+	for len(c.pending) > 0 {
+		ref := c.pending[0]
+		c.pending = c.pending[1:]
+
+		target, err := c.lookup(ref)
+		if err != nil {
+			return err
+		}
+		compiled, err := c.compile(target, ref, 0)
+		if err != nil {
+			return err
+		}
+		*c.refs[ref] = *compiled
+	}
+	return nil
+}
+
+// inPlace returns the subschemas applied to the same instance as n
+func (n *node) inPlace() []*node {
+	var subs []*node
+	if n.resolved != nil {
+		subs = append(subs, n.resolved)
+	}
+	subs = append(subs, n.allOf...)
+	subs = append(subs, n.anyOf...)
+	subs = append(subs, n.oneOf...)
+	for _, sub := range []*node{n.not, n.ifs, n.then, n.elses} {
+		if sub != nil {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// children returns the subschemas applied to properties and items of the
+// instance
+func (n *node) children() []*node {
+	var subs []*node
+	for _, sub := range n.properties {
+		subs = append(subs, sub)
+	}
+	for _, sub := range n.patternProperties {
+		subs = append(subs, sub)
+	}
+	subs = append(subs, n.prefixItems...)
+	for _, sub := range []*node{n.additionalProperties, n.propertyNames, n.items, n.contains} {
+		if sub != nil {
+			subs = append(subs, sub)
+		}
+	}
+	return subs
+}
+
+// checkCycles rejects references that reach their own schema again without
+// descending into a property or item. Validating them never terminates.
+func checkCycles(root *node) error {
+	// Collect every node, references make the graph cyclic
+	var nodes []*node
+	seen := map[*node]bool{root: true}
+	for queue := []*node{root}; len(queue) > 0; queue = queue[1:] {
+		nodes = append(nodes, queue[0])
+		for _, sub := range append(queue[0].inPlace(), queue[0].children()...) {
+			if !seen[sub] {
+				seen[sub] = true
+				queue = append(queue, sub)
+			}
+		}
+	}
+
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[*node]int, len(nodes))
+	var stack []*node
+	var visit func(n *node) error
+	visit = func(n *node) error {
+		state[n] = visiting
+		stack = append(stack, n)
+		for _, sub := range n.inPlace() {
+			switch state[sub] {
+			case visiting:
+				// The cycle is the stack from sub on, name a reference in it
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i].ref != "" {
+						return fmt.Errorf("%s: reference cycle does not descend into the instance", stack[i].ref)
+					}
+					if stack[i] == sub {
+						break
+					}
+				}
+				return fmt.Errorf("reference cycle does not descend into the instance")
+			case 0:
+				if err := visit(sub); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[n] = done
+		return nil
+	}
+	for _, n := range nodes {
+		if state[n] == 0 {
+			if err := visit(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup follows a JSON pointer reference within the document
+func (c *compiler) lookup(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("%s: only references within the schema are supported", ref)
+	}
+	current := c.doc
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return current, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%s: anchors are not supported", ref)
+	}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := current.(type) {
+		case map[string]any:
+			next, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%s: reference not found", ref)
+			}
+			current = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%s: reference not found", ref)
+			}
+			current = v[i]
+		default:
+			return nil, fmt.Errorf("%s: reference not found", ref)
+		}
+	}
+	return current, nil
+}
+
+func (c *compiler) compile(value any, path string, depth int) (*node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%s: schema nested deeper than %d", path, maxDepth)
+	}
+
+	if b, ok := value.(bool); ok {
+		return &node{always: &b}, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+
+	for _, keyword := range unsupportedKeywords {
+		if _, ok := m[keyword]; ok {
+			return nil, fmt.Errorf("%s: %s is not supported", path, keyword)
+		}
+	}
+
+	n := &node{}
+	p := &parser{c: c, m: m, path: path, depth: depth}
+
+	if ref, ok := m["$ref"]; ok {
+		s, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/$ref: must be a string", path)
+		}
+		if _, err := c.lookup(s); err != nil {
+			return nil, err
+		}
+		n.ref = s
+		if n.resolved, ok = c.refs[s]; !ok {
+			n.resolved = &node{}
+			c.refs[s] = n.resolved
+			c.pending = append(c.pending, s)
+		}
+	}
+
+	if t, ok := m["type"]; ok {
+		switch v := t.(type) {
+		case string:
+			n.types = []string{v}
+		case []any:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+				}
+				n.types = append(n.types, s)
+			}
+		default:
+			return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+		}
+		for _, t := range n.types {
+			if !contains(validTypes, t) {
+				return nil, fmt.Errorf("%s/type: unknown type %q", path, t)
+			}
+		}
+	}
+
+	if e, ok := m["enum"]; ok {
+		values, ok := e.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/enum: must be an array", path)
+		}
+		n.enum = values
+	}
+	if v, ok := m["const"]; ok {
+		n.constant, n.hasConst = v, true
+	}
+
+	var err error
+	if n.properties, err = p.schemaMap("properties"); err != nil {
+		return nil, err
+	}
+	if pp, err := p.schemaMap("patternProperties"); err != nil {
+		return nil, err
+	} else if pp != nil {
+		n.patternProperties = make(map[*regexp.Regexp]*node, len(pp))
+		for pattern, schema := range pp {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s/patternProperties: invalid pattern %q: %w", path, pattern, err)
+			}
+			n.patternProperties[re] = schema
+		}
+	}
+	if n.additionalProperties, err = p.schema("additionalProperties"); err != nil {
+		return nil, err
+	}
+	if n.propertyNames, err = p.schema("propertyNames"); err != nil {
+		return nil, err
+	}
+	if n.required, err = p.strings("required"); err != nil {
+		return nil, err
+	}
+	if dr, ok := m["dependentRequired"]; ok {
+		deps, ok := dr.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/dependentRequired: must be an object", path)
+		}
+		n.dependentRequired = make(map[string][]string, len(deps))
+		for key := range deps {
+			sub := &parser{c: c, m: deps, path: path + "/dependentRequired"}
+			if n.dependentRequired[key], err = sub.strings(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if n.minProperties, err = p.count("minProperties"); err != nil {
+		return nil, err
+	}
+	if n.maxProperties, err = p.count("maxProperties"); err != nil {
+		return nil, err
+	}
+
+	// Draft 7 tuples use an items array, 2020-12 uses prefixItems
+	if items, ok := m["items"].([]any); ok {
+		if n.prefixItems, err = p.schemaArray("items", items); err != nil {
+			return nil, err
+		}
+		if n.items, err = p.schema("additionalItems"); err != nil {
+			return nil, err
+		}
+	} else {
+		if prefix, ok := m["prefixItems"]; ok {
+			arr, ok := prefix.([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/prefixItems: must be an array", path)
+			}
+			if n.prefixItems, err = p.schemaArray("prefixItems", arr); err != nil {
+				return nil, err
+			}
+		}
+		if n.items, err = p.schema("items"); err != nil {
+			return nil, err
+		}
+	}
+	if n.contains, err = p.schema("contains"); err != nil {
+		return nil, err
+	}
+	if n.minItems, err = p.count("minItems"); err != nil {
+		return nil, err
+	}
+	if n.maxItems, err = p.count("maxItems"); err != nil {
+		return nil, err
+	}
+	if u, ok := m["uniqueItems"]; ok {
+		if n.uniqueItems, ok = u.(bool); !ok {
+			return nil, fmt.Errorf("%s/uniqueItems: must be a boolean", path)
+		}
+	}
+
+	if n.minLength, err = p.count("minLength"); err != nil {
+		return nil, err
+	}
+	if n.maxLength, err = p.count("maxLength"); err != nil {
+		return nil, err
+	}
+	if pattern, ok := m["pattern"]; ok {
+		s, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", path)
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+	if format, ok := m["format"]; ok {
+		if n.format, ok = format.(string); !ok {
+			return nil, fmt.Errorf("%s/format: must be a string", path)
+		}
+	}
+
+	if n.minimum, err = p.number("minimum"); err != nil {
+		return nil, err
+	}
+	if n.maximum, err = p.number("maximum"); err != nil {
+		return nil, err
+	}
+	// Draft 4 boolean exclusive bounds are not supported, only numbers
+	if n.exclusiveMinimum, err = p.number("exclusiveMinimum"); err != nil {
+		return nil, err
+	}
+	if n.exclusiveMaximum, err = p.number("exclusiveMaximum"); err != nil {
+		return nil, err
+	}
+	if n.multipleOf, err = p.number("multipleOf"); err != nil {
+		return nil, err
+	}
+	if n.multipleOf != nil && *n.multipleOf <= 0 {
+		return nil, fmt.Errorf("%s/multipleOf: must be greater than 0", path)
+	}
+
+	for keyword, dst := range map[string]*[]*node{"allOf": &n.allOf, "anyOf": &n.anyOf, "oneOf": &n.oneOf} {
+		value, ok := m[keyword]
+		if !ok {
+			continue
+		}
+		arr, ok := value.([]any)
+		if !ok || len(arr) == 0 {
+			return nil, fmt.Errorf("%s/%s: must be a non-empty array", path, keyword)
+		}
+		if *dst, err = p.schemaArray(keyword, arr); err != nil {
+			return nil, err
+		}
+	}
+	if n.not, err = p.schema("not"); err != nil {
+		return nil, err
+	}
+	if n.ifs, err = p.schema("if"); err != nil {
+		return nil, err
+	}
+	if n.then, err = p.schema("then"); err != nil {
+		return nil, err
+	}
+	if n.elses, err = p.schema("else"); err != nil {
+		return nil, err
+	}
+
+	// Compile definitions so errors inside them are reported even when
+	// they are not referenced
+	for _, keyword := range []string{"$defs", "definitions"} {
+		if _, err := p.schemaMap(keyword); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// parser reads typed keyword values of a schema object
+type parser struct {
+	c     *compiler
+	m     map[string]any
+	path  string
+	depth int
+}
+
+func (p *parser) schema(keyword string) (*node, error) {
+	value, ok := p.m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	return p.c.compile(value, p.path+"/"+keyword, p.depth+1)
+}
+
+func (p *parser) schemaMap(keyword string) (map[string]*node, error) {
+	value, ok := p.m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be an object", p.path, keyword)
+	}
+	result := make(map[string]*node, len(m))
+	for key, schema := range m {
+		compiled, err := p.c.compile(schema, p.path+"/"+keyword+"/"+key, p.depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = compiled
+	}
+	return result, nil
+}
+
+func (p *parser) schemaArray(keyword string, arr []any) ([]*node, error) {
+	result := make([]*node, 0, len(arr))
+	for i, schema := range arr {
+		compiled, err := p.c.compile(schema, fmt.Sprintf("%s/%s/%d", p.path, keyword, i), p.depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, compiled)
+	}
+	return result, nil
+}
+
+func (p *parser) strings(keyword string) ([]string, error) {
+	value, ok := p.m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	arr, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be an array of strings", p.path, keyword)
+	}
+	result := make([]string, 0, len(arr))
+	for _, item := range arr {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be an array of strings", p.path, keyword)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func (p *parser) number(keyword string) (*float64, error) {
+	value, ok := p.m[keyword]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a number", p.path, keyword)
+	}
+	return &f, nil
+}
+
+func (p *parser) count(keyword string) (*int, error) {
+	f, err := p.number(keyword)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	if *f < 0 || *f != math.Trunc(*f) {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", p.path, keyword)
+	}
+	n := int(*f)
+	return &n, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns map keys in order so errors are reported
+// deterministically
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
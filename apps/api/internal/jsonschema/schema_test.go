@@ -0,0 +1,487 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failure is an instance the schema rejects, with the errors it reports
+type failure struct {
+	instance string
+	want     string
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		valid   []string
+		invalid []failure
+	}{
+		{
+			name:   "true schema",
+			schema: `true`,
+			valid:  []string{`null`, `1`, `"a"`, `{}`},
+		},
+		{
+			name:    "false schema",
+			schema:  `false`,
+			invalid: []failure{{`1`, "no value is allowed here"}},
+		},
+		{
+			name:   "type",
+			schema: `{"type": "string"}`,
+			valid:  []string{`"a"`},
+			invalid: []failure{
+				{`1`, "expected string, got integer"},
+				{`null`, "expected string, got null"},
+			},
+		},
+		{
+			name:    "type array",
+			schema:  `{"type": ["integer", "null"]}`,
+			valid:   []string{`1`, `null`, `2.0`},
+			invalid: []failure{{`1.5`, "expected integer or null, got number"}},
+		},
+		{
+			name:    "number accepts integers",
+			schema:  `{"type": "number"}`,
+			valid:   []string{`1`, `1.5`},
+			invalid: []failure{{`"1"`, "expected number, got string"}},
+		},
+		{
+			name:    "enum",
+			schema:  `{"enum": ["a", 1, {"b": true}]}`,
+			valid:   []string{`"a"`, `1`, `{"b": true}`},
+			invalid: []failure{{`"b"`, `must be one of ["a",1,{"b":true}]`}},
+		},
+		{
+			name:    "const",
+			schema:  `{"const": {"a": [1, 2]}}`,
+			valid:   []string{`{"a": [1, 2]}`},
+			invalid: []failure{{`{"a": [2, 1]}`, `must be {"a":[1,2]}`}},
+		},
+		{
+			name:    "const null",
+			schema:  `{"const": null}`,
+			valid:   []string{`null`},
+			invalid: []failure{{`0`, "must be null"}},
+		},
+		{
+			name:   "properties",
+			schema: `{"properties": {"a": {"type": "string"}, "b/c": {"type": "integer"}}}`,
+			valid:  []string{`{"a": "x"}`, `{}`, `{"d": 1}`, `1`},
+			invalid: []failure{
+				{`{"a": 1}`, "/a: expected string, got integer"},
+				{`{"b/c": "x"}`, "/b~1c: expected integer, got string"},
+			},
+		},
+		{
+			name:    "patternProperties",
+			schema:  `{"patternProperties": {"^x_": {"type": "integer"}}}`,
+			valid:   []string{`{"x_a": 1, "y": "a"}`},
+			invalid: []failure{{`{"x_a": "a"}`, "/x_a: expected integer, got string"}},
+		},
+		{
+			name:    "additionalProperties false",
+			schema:  `{"properties": {"a": true}, "patternProperties": {"^x_": true}, "additionalProperties": false}`,
+			valid:   []string{`{"a": 1, "x_b": 2}`},
+			invalid: []failure{{`{"a": 1, "b": 2}`, "/b: additional property is not allowed"}},
+		},
+		{
+			name:    "additionalProperties schema",
+			schema:  `{"properties": {"a": true}, "additionalProperties": {"type": "boolean"}}`,
+			valid:   []string{`{"a": 1, "b": true}`},
+			invalid: []failure{{`{"b": 1}`, "/b: expected boolean, got integer"}},
+		},
+		{
+			name:    "propertyNames",
+			schema:  `{"propertyNames": {"maxLength": 3}}`,
+			valid:   []string{`{"abc": 1}`},
+			invalid: []failure{{`{"abcd": 1}`, "/abcd: property name is not allowed"}},
+		},
+		{
+			name:   "required",
+			schema: `{"required": ["a", "b"]}`,
+			valid:  []string{`{"a": 1, "b": null}`, `[]`},
+			invalid: []failure{
+				{`{"a": 1}`, "/b: is required"},
+				{`{}`, "/a: is required; /b: is required"},
+			},
+		},
+		{
+			name:    "dependentRequired",
+			schema:  `{"dependentRequired": {"card": ["cvc"]}}`,
+			valid:   []string{`{}`, `{"card": 1, "cvc": 2}`},
+			invalid: []failure{{`{"card": 1}`, "/cvc: is required when card is present"}},
+		},
+		{
+			name:   "minProperties and maxProperties",
+			schema: `{"minProperties": 1, "maxProperties": 2}`,
+			valid:  []string{`{"a": 1}`, `{"a": 1, "b": 2}`},
+			invalid: []failure{
+				{`{}`, "must have at least 1 properties"},
+				{`{"a": 1, "b": 2, "c": 3}`, "must have at most 2 properties"},
+			},
+		},
+		{
+			name:   "items",
+			schema: `{"items": {"type": "integer"}}`,
+			valid:  []string{`[]`, `[1, 2]`},
+			invalid: []failure{
+				{`[1, "a", true]`, "/1: expected integer, got string; /2: expected integer, got boolean"},
+			},
+		},
+		{
+			name:    "prefixItems",
+			schema:  `{"prefixItems": [{"type": "string"}, {"type": "integer"}], "items": false}`,
+			valid:   []string{`["a"]`, `["a", 1]`},
+			invalid: []failure{{`["a", 1, 2]`, "/2: no value is allowed here"}},
+		},
+		{
+			name:    "draft 7 tuple items",
+			schema:  `{"items": [{"type": "string"}], "additionalItems": {"type": "integer"}}`,
+			valid:   []string{`["a", 1, 2]`},
+			invalid: []failure{{`[1, "a"]`, "/0: expected string, got integer; /1: expected integer, got string"}},
+		},
+		{
+			name:    "contains",
+			schema:  `{"contains": {"const": "x"}}`,
+			valid:   []string{`["a", "x"]`},
+			invalid: []failure{{`["a"]`, "must contain an item matching the contains schema"}},
+		},
+		{
+			name:   "minItems and maxItems",
+			schema: `{"minItems": 1, "maxItems": 2}`,
+			valid:  []string{`[1]`, `[1, 2]`},
+			invalid: []failure{
+				{`[]`, "must have at least 1 items"},
+				{`[1, 2, 3]`, "must have at most 2 items"},
+			},
+		},
+		{
+			name:    "uniqueItems",
+			schema:  `{"uniqueItems": true}`,
+			valid:   []string{`[1, "1", {"a": 1}, {"a": 2}]`},
+			invalid: []failure{{`[1, {"a": 1}, {"a": 1}]`, "items 1 and 2 are equal"}},
+		},
+		{
+			name:   "minLength and maxLength count characters",
+			schema: `{"minLength": 2, "maxLength": 3}`,
+			valid:  []string{`"ab"`, `"äöü"`},
+			invalid: []failure{
+				{`"a"`, "must be at least 2 characters"},
+				{`"äöüß"`, "must be at most 3 characters"},
+			},
+		},
+		{
+			name:    "pattern",
+			schema:  `{"pattern": "^[a-z]+$"}`,
+			valid:   []string{`"abc"`, `1`},
+			invalid: []failure{{`"aBc"`, "must match pattern ^[a-z]+$"}},
+		},
+		{
+			name:    "format date-time",
+			schema:  `{"format": "date-time"}`,
+			valid:   []string{`"2026-10-18T12:00:00Z"`, `"2026-10-18T12:00:00.5+02:00"`},
+			invalid: []failure{{`"2026-10-18"`, "must be a valid date-time"}},
+		},
+		{
+			name:    "format date",
+			schema:  `{"format": "date"}`,
+			valid:   []string{`"2026-10-18"`},
+			invalid: []failure{{`"2026-13-01"`, "must be a valid date"}},
+		},
+		{
+			name:    "format time",
+			schema:  `{"format": "time"}`,
+			valid:   []string{`"12:00:00Z"`, `"12:00:00+02:00"`},
+			invalid: []failure{{`"12:00"`, "must be a valid time"}},
+		},
+		{
+			name:   "format email",
+			schema: `{"format": "email"}`,
+			valid:  []string{`"jane@example.com"`},
+			invalid: []failure{
+				{`"jane"`, "must be a valid email"},
+				{`"Jane <jane@example.com>"`, "must be a valid email"},
+			},
+		},
+		{
+			name:    "format uri",
+			schema:  `{"format": "uri"}`,
+			valid:   []string{`"https://example.com/a?b=c"`},
+			invalid: []failure{{`"/relative"`, "must be a valid uri"}},
+		},
+		{
+			name:    "format uuid",
+			schema:  `{"format": "uuid"}`,
+			valid:   []string{`"0190a4b6-5c1e-7d2f-8a3b-4c5d6e7f8091"`},
+			invalid: []failure{{`"0190a4b6"`, "must be a valid uuid"}},
+		},
+		{
+			name:   "format ipv4",
+			schema: `{"format": "ipv4"}`,
+			valid:  []string{`"192.0.2.1"`},
+			invalid: []failure{
+				{`"::ffff:192.0.2.1"`, "must be a valid ipv4"},
+				{`"192.0.2"`, "must be a valid ipv4"},
+			},
+		},
+		{
+			name:    "format ipv6",
+			schema:  `{"format": "ipv6"}`,
+			valid:   []string{`"2001:db8::1"`},
+			invalid: []failure{{`"192.0.2.1"`, "must be a valid ipv6"}},
+		},
+		{
+			name:    "format regex",
+			schema:  `{"format": "regex"}`,
+			valid:   []string{`"^a+$"`},
+			invalid: []failure{{`"("`, "must be a valid regex"}},
+		},
+		{
+			name:   "unknown format is an annotation",
+			schema: `{"format": "hostname-idn"}`,
+			valid:  []string{`"anything"`},
+		},
+		{
+			name:   "minimum and maximum",
+			schema: `{"minimum": 1, "maximum": 3}`,
+			valid:  []string{`1`, `3`, `"a"`},
+			invalid: []failure{
+				{`0.5`, "must be >= 1"},
+				{`4`, "must be <= 3"},
+			},
+		},
+		{
+			name:   "exclusiveMinimum and exclusiveMaximum",
+			schema: `{"exclusiveMinimum": 1, "exclusiveMaximum": 3}`,
+			valid:  []string{`2`},
+			invalid: []failure{
+				{`1`, "must be > 1"},
+				{`3`, "must be < 3"},
+			},
+		},
+		{
+			name:    "multipleOf",
+			schema:  `{"multipleOf": 0.1}`,
+			valid:   []string{`0.3`, `2`},
+			invalid: []failure{{`0.35`, "must be a multiple of 0.1"}},
+		},
+		{
+			name:   "allOf",
+			schema: `{"allOf": [{"type": "integer"}, {"minimum": 2}]}`,
+			valid:  []string{`2`},
+			invalid: []failure{
+				{`1`, "must be >= 2"},
+				{`"a"`, "expected integer, got string"},
+			},
+		},
+		{
+			name:   "anyOf",
+			schema: `{"anyOf": [{"type": "string"}, {"minimum": 2}]}`,
+			valid:  []string{`"a"`, `3`},
+			invalid: []failure{
+				{`1`, "must match at least one schema in anyOf"},
+			},
+		},
+		{
+			name:   "oneOf",
+			schema: `{"oneOf": [{"type": "integer"}, {"minimum": 2}]}`,
+			valid:  []string{`1`, `2.5`},
+			invalid: []failure{
+				{`3`, "must match exactly one schema in oneOf, matched 2"},
+				{`1.5`, "must match exactly one schema in oneOf, matched 0"},
+			},
+		},
+		{
+			name:    "not",
+			schema:  `{"not": {"type": "null"}}`,
+			valid:   []string{`1`},
+			invalid: []failure{{`null`, "must not match the schema in not"}},
+		},
+		{
+			name:   "if then else",
+			schema: `{"if": {"properties": {"kind": {"const": "card"}}}, "then": {"required": ["last4"]}, "else": {"required": ["iban"]}}`,
+			valid:  []string{`{"kind": "card", "last4": "4242"}`, `{"kind": "bank", "iban": "DE00"}`},
+			invalid: []failure{
+				{`{"kind": "card"}`, "/last4: is required"},
+				{`{"kind": "bank"}`, "/iban: is required"},
+			},
+		},
+		{
+			name:   "errors inside anyOf are not reported",
+			schema: `{"properties": {"a": {"anyOf": [{"required": ["x"]}, {"required": ["y"]}]}}}`,
+			valid:  []string{`{"a": {"y": 1}}`},
+			invalid: []failure{
+				{`{"a": {}}`, "/a: must match at least one schema in anyOf"},
+			},
+		},
+		{
+			name:   "ref to $defs",
+			schema: `{"$defs": {"id": {"type": "string", "minLength": 1}}, "properties": {"id": {"$ref": "#/$defs/id"}}}`,
+			valid:  []string{`{"id": "a"}`},
+			invalid: []failure{
+				{`{"id": ""}`, "/id: must be at least 1 characters"},
+			},
+		},
+		{
+			name:    "ref to definitions with escaped pointer",
+			schema:  `{"definitions": {"a/b": {"type": "integer"}}, "items": {"$ref": "#/definitions/a~1b"}}`,
+			valid:   []string{`[1]`},
+			invalid: []failure{{`["a"]`, "/0: expected integer, got string"}},
+		},
+		{
+			name:    "ref siblings apply",
+			schema:  `{"$defs": {"n": {"type": "integer"}}, "$ref": "#/$defs/n", "minimum": 1}`,
+			valid:   []string{`1`},
+			invalid: []failure{{`0`, "must be >= 1"}},
+		},
+		{
+			name:   "recursive ref",
+			schema: `{"type": "object", "required": ["name"], "properties": {"children": {"type": "array", "items": {"$ref": "#"}}}}`,
+			valid:  []string{`{"name": "a", "children": [{"name": "b", "children": [{"name": "c"}]}]}`},
+			invalid: []failure{
+				{`{"name": "a", "children": [{"children": [{}]}]}`, "/children/0/name: is required; /children/0/children/0/name: is required"},
+			},
+		},
+		{
+			name:   "mutually recursive refs",
+			schema: `{"$defs": {"a": {"properties": {"b": {"$ref": "#/$defs/b"}}}, "b": {"type": "object", "properties": {"a": {"$ref": "#/$defs/a"}}}}, "$ref": "#/$defs/a"}`,
+			valid:  []string{`{"b": {"a": {"b": {}}}}`},
+			invalid: []failure{
+				{`{"b": {"a": {"b": 1}}}`, "/b/a/b: expected object, got integer"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := Compile([]byte(tt.schema))
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+
+			for _, instance := range tt.valid {
+				if err := schema.Validate(decode(t, instance)); err != nil {
+					t.Errorf("Validate(%s) = %v, want valid", instance, err)
+				}
+			}
+			for _, f := range tt.invalid {
+				err := schema.Validate(decode(t, f.instance))
+				if err == nil {
+					t.Errorf("Validate(%s) = nil, want %q", f.instance, f.want)
+					continue
+				}
+				if err.Error() != f.want {
+					t.Errorf("Validate(%s) = %q, want %q", f.instance, err, f.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	schema, err := Compile([]byte(`{"items": {"type": "string"}}`))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	err = schema.Validate(decode(t, `[1, "a", 2]`))
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Validate error = %T, want ValidationErrors", err)
+	}
+	want := ValidationErrors{
+		{Path: "/0", Message: "expected string, got integer"},
+		{Path: "/2", Message: "expected string, got integer"},
+	}
+	if len(errs) != len(want) || errs[0] != want[0] || errs[1] != want[1] {
+		t.Errorf("errors = %+v, want %+v", errs, want)
+	}
+
+	many := make([]any, 2*maxErrors)
+	for i := range many {
+		many[i] = float64(i)
+	}
+	if err := schema.Validate(many); !errors.As(err, &errs) || len(errs) != maxErrors {
+		t.Errorf("Validate reported %d errors, want %d", len(errs), maxErrors)
+	}
+}
+
+func TestValidateGoValues(t *testing.T) {
+	schema, err := Compile([]byte(`{"properties": {"count": {"type": "integer", "maximum": 5}}}`))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	if err := schema.Validate(map[string]int{"count": 5}); err != nil {
+		t.Errorf("Validate = %v, want valid", err)
+	}
+	if err := schema.Validate(map[string]int{"count": 6}); err == nil || err.Error() != "/count: must be <= 5" {
+		t.Errorf("Validate = %v, want /count: must be <= 5", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"invalid JSON", `{`, "invalid JSON"},
+		{"not a schema", `1`, "#: schema must be an object or boolean"},
+		{"unsupported keyword", `{"properties": {"a": {"unevaluatedProperties": false}}}`, "#/properties/a: unevaluatedProperties is not supported"},
+		{"dependencies", `{"dependencies": {"a": ["b"]}}`, "#: dependencies is not supported"},
+		{"unknown type", `{"type": "int"}`, `#/type: unknown type "int"`},
+		{"type not a string", `{"type": 1}`, "#/type: must be a string or array of strings"},
+		{"enum not an array", `{"enum": "a"}`, "#/enum: must be an array"},
+		{"properties not an object", `{"properties": []}`, "#/properties: must be an object"},
+		{"invalid pattern property", `{"patternProperties": {"(": true}}`, `#/patternProperties: invalid pattern "("`},
+		{"required not strings", `{"required": [1]}`, "#/required: must be an array of strings"},
+		{"dependentRequired not an object", `{"dependentRequired": []}`, "#/dependentRequired: must be an object"},
+		{"negative count", `{"minLength": -1}`, "#/minLength: must be a non-negative integer"},
+		{"fractional count", `{"maxItems": 1.5}`, "#/maxItems: must be a non-negative integer"},
+		{"number not a number", `{"minimum": "1"}`, "#/minimum: must be a number"},
+		{"draft 4 exclusive bound", `{"exclusiveMinimum": true}`, "#/exclusiveMinimum: must be a number"},
+		{"multipleOf zero", `{"multipleOf": 0}`, "#/multipleOf: must be greater than 0"},
+		{"uniqueItems not a boolean", `{"uniqueItems": 1}`, "#/uniqueItems: must be a boolean"},
+		{"invalid pattern", `{"pattern": "("}`, "#/pattern:"},
+		{"empty anyOf", `{"anyOf": []}`, "#/anyOf: must be a non-empty array"},
+		{"oneOf not an array", `{"oneOf": {}}`, "#/oneOf: must be a non-empty array"},
+		{"invalid oneOf branch", `{"oneOf": [true, 1]}`, "#/oneOf/1: schema must be an object or boolean"},
+		{"invalid unreferenced definition", `{"$defs": {"a": {"type": "int"}}}`, `#/$defs/a/type: unknown type "int"`},
+		{"ref not a string", `{"$ref": 1}`, "#/$ref: must be a string"},
+		{"remote ref", `{"$ref": "https://example.com/schema.json"}`, "only references within the schema are supported"},
+		{"anchor ref", `{"$ref": "#node"}`, "#node: anchors are not supported"},
+		{"missing ref", `{"$ref": "#/$defs/missing"}`, "#/$defs/missing: reference not found"},
+		{"ref out of array bounds", `{"allOf": [true], "$ref": "#/allOf/1"}`, "#/allOf/1: reference not found"},
+		{"self ref", `{"$ref": "#"}`, "#: reference cycle does not descend into the instance"},
+		{"ref cycle", `{"$defs": {"a": {"$ref": "#/$defs/b"}, "b": {"allOf": [{"$ref": "#/$defs/a"}]}}, "properties": {"x": {"$ref": "#/$defs/a"}}}`, "reference cycle does not descend into the instance"},
+		{"ref cycle through anyOf", `{"anyOf": [{"$ref": "#"}, {"$ref": "#"}]}`, "#: reference cycle does not descend into the instance"},
+		{"ref cycle through not", `{"type": "object", "not": {"$ref": "#"}}`, "#: reference cycle does not descend into the instance"},
+		{"too deep", strings.Repeat(`{"not": `, maxDepth+2) + `true` + strings.Repeat(`}`, maxDepth+2), "schema nested deeper than 64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Compile error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, instance string) any {
+	t.Helper()
+
+	var value any
+	if err := json.Unmarshal([]byte(instance), &value); err != nil {
+		t.Fatalf("invalid instance %s: %v", instance, err)
+	}
+	return value
+}
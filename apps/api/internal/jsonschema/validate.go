@@ -0,0 +1,385 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Maximum number of errors reported for a single instance
+const maxErrors = 20
+
+// ValidationError is a single failed assertion. Path is a JSON pointer to the
+// offending value, empty for the instance root.
+type ValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors are the failed assertions of an instance
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+type validator struct {
+	errors ValidationErrors
+}
+
+func (v *validator) add(path, format string, args ...any) {
+	if len(v.errors) < maxErrors {
+		v.errors = append(v.errors, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// Validate checks a decoded JSON value against the schema. Numbers must be
+// float64 as produced by encoding/json. It returns nil or ValidationErrors.
+func (s *Schema) Validate(instance any) error {
+	v := &validator{}
+	v.validate(s.root, normalize(instance), "", 0)
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return v.errors
+}
+
+// normalize converts Go values that are not produced by encoding/json, such
+// as typed maps and integers, by round tripping them through JSON
+func normalize(instance any) any {
+	switch instance.(type) {
+	case nil, bool, float64, string, map[string]any, []any:
+		return instance
+	}
+	b, err := json.Marshal(instance)
+	if err != nil {
+		return instance
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return instance
+	}
+	return out
+}
+
+// passes reports whether instance is valid without recording errors
+func (v *validator) passes(n *node, instance any, depth int) bool {
+	sub := &validator{}
+	sub.validate(n, instance, "", depth)
+	return len(sub.errors) == 0
+}
+
+func typeOf(instance any) string {
+	switch value := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	default:
+		return fmt.Sprintf("%T", instance)
+	}
+}
+
+func pointer(path, token string) string {
+	return path + "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func (v *validator) validate(n *node, instance any, path string, depth int) {
+	if depth > maxDepth*4 {
+		v.add(path, "schema recursion too deep")
+		return
+	}
+
+	if n.always != nil {
+		if !*n.always {
+			v.add(path, "no value is allowed here")
+		}
+		return
+	}
+
+	if n.resolved != nil {
+		v.validate(n.resolved, instance, path, depth+1)
+	}
+
+	actual := typeOf(instance)
+	if len(n.types) > 0 {
+		ok := false
+		for _, t := range n.types {
+			if t == actual || (t == "number" && actual == "integer") {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			v.add(path, "expected %s, got %s", strings.Join(n.types, " or "), actual)
+			return
+		}
+	}
+
+	if n.enum != nil {
+		found := false
+		for _, value := range n.enum {
+			if reflect.DeepEqual(value, instance) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b, _ := json.Marshal(n.enum)
+			v.add(path, "must be one of %s", b)
+		}
+	}
+	if n.hasConst && !reflect.DeepEqual(n.constant, instance) {
+		b, _ := json.Marshal(n.constant)
+		v.add(path, "must be %s", b)
+	}
+
+	switch value := instance.(type) {
+	case map[string]any:
+		v.validateObject(n, value, path, depth)
+	case []any:
+		v.validateArray(n, value, path, depth)
+	case string:
+		v.validateString(n, value, path)
+	case float64:
+		v.validateNumber(n, value, path)
+	}
+
+	for _, sub := range n.allOf {
+		v.validate(sub, instance, path, depth+1)
+	}
+	if n.anyOf != nil {
+		matched := false
+		for _, sub := range n.anyOf {
+			if v.passes(sub, instance, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.add(path, "must match at least one schema in anyOf")
+		}
+	}
+	if n.oneOf != nil {
+		matches := 0
+		for _, sub := range n.oneOf {
+			if v.passes(sub, instance, depth+1) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			v.add(path, "must match exactly one schema in oneOf, matched %d", matches)
+		}
+	}
+	if n.not != nil && v.passes(n.not, instance, depth+1) {
+		v.add(path, "must not match the schema in not")
+	}
+	if n.ifs != nil {
+		if v.passes(n.ifs, instance, depth+1) {
+			if n.then != nil {
+				v.validate(n.then, instance, path, depth+1)
+			}
+		} else if n.elses != nil {
+			v.validate(n.elses, instance, path, depth+1)
+		}
+	}
+}
+
+func (v *validator) validateObject(n *node, object map[string]any, path string, depth int) {
+	for _, key := range n.required {
+		if _, ok := object[key]; !ok {
+			v.add(pointer(path, key), "is required")
+		}
+	}
+	for key, deps := range n.dependentRequired {
+		if _, ok := object[key]; !ok {
+			continue
+		}
+		for _, dep := range deps {
+			if _, ok := object[dep]; !ok {
+				v.add(pointer(path, dep), "is required when %s is present", key)
+			}
+		}
+	}
+	if n.minProperties != nil && len(object) < *n.minProperties {
+		v.add(path, "must have at least %d properties", *n.minProperties)
+	}
+	if n.maxProperties != nil && len(object) > *n.maxProperties {
+		v.add(path, "must have at most %d properties", *n.maxProperties)
+	}
+
+	for _, key := range sortedKeys(object) {
+		value := object[key]
+		keyPath := pointer(path, key)
+
+		if n.propertyNames != nil && !v.passes(n.propertyNames, key, depth+1) {
+			v.add(keyPath, "property name is not allowed")
+		}
+
+		matched := false
+		if schema, ok := n.properties[key]; ok {
+			matched = true
+			v.validate(schema, value, keyPath, depth+1)
+		}
+		for re, schema := range n.patternProperties {
+			if re.MatchString(key) {
+				matched = true
+				v.validate(schema, value, keyPath, depth+1)
+			}
+		}
+		if !matched && n.additionalProperties != nil {
+			if a := n.additionalProperties.always; a != nil && !*a {
+				v.add(keyPath, "additional property is not allowed")
+				continue
+			}
+			v.validate(n.additionalProperties, value, keyPath, depth+1)
+		}
+	}
+}
+
+func (v *validator) validateArray(n *node, array []any, path string, depth int) {
+	if n.minItems != nil && len(array) < *n.minItems {
+		v.add(path, "must have at least %d items", *n.minItems)
+	}
+	if n.maxItems != nil && len(array) > *n.maxItems {
+		v.add(path, "must have at most %d items", *n.maxItems)
+	}
+	if n.uniqueItems {
+	unique:
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if reflect.DeepEqual(array[i], array[j]) {
+					v.add(path, "items %d and %d are equal", i, j)
+					break unique
+				}
+			}
+		}
+	}
+
+	for i, item := range array {
+		itemPath := path + "/" + strconv.Itoa(i)
+		if i < len(n.prefixItems) {
+			v.validate(n.prefixItems[i], item, itemPath, depth+1)
+		} else if n.items != nil {
+			v.validate(n.items, item, itemPath, depth+1)
+		}
+	}
+
+	if n.contains != nil {
+		found := false
+		for _, item := range array {
+			if v.passes(n.contains, item, depth+1) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.add(path, "must contain an item matching the contains schema")
+		}
+	}
+}
+
+func (v *validator) validateString(n *node, s string, path string) {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		v.add(path, "must be at least %d characters", *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		v.add(path, "must be at most %d characters", *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		v.add(path, "must match pattern %s", n.pattern)
+	}
+	if n.format != "" && !validFormat(n.format, s) {
+		v.add(path, "must be a valid %s", n.format)
+	}
+}
+
+func (v *validator) validateNumber(n *node, f float64, path string) {
+	if n.minimum != nil && f < *n.minimum {
+		v.add(path, "must be >= %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		v.add(path, "must be <= %v", *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+		v.add(path, "must be > %v", *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+		v.add(path, "must be < %v", *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil {
+		q := f / *n.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			v.add(path, "must be a multiple of %v", *n.multipleOf)
+		}
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// validFormat asserts the common formats, unknown formats are annotations
+// and always pass
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", s)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	case "uuid":
+		return uuidPattern.MatchString(s)
+	case "ipv4":
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	case "ipv6":
+		ip := net.ParseIP(s)
+		return ip != nil && strings.Contains(s, ":")
+	case "regex":
+		_, err := regexp.Compile(s)
+		return err == nil
+	default:
+		return true
+	}
+}
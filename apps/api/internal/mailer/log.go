@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v3/log"
+)
+
+// LogMailer prints emails to the console instead of sending them, for
+// development
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Infof("Email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
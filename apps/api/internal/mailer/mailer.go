@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ted-too/logsicle/internal/config"
+)
+
+// Mail backends
+const (
+	BackendLog  = "log"
+	BackendSMTP = "smtp"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers transactional email such as verification and password
+// reset links
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the configured mailer
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mail.Backend {
+	case BackendLog:
+		return NewLogMailer(), nil
+	case BackendSMTP:
+		return NewSMTPMailer(cfg.Mail.SMTP.Host, cfg.Mail.SMTP.Port, cfg.Mail.SMTP.Username, cfg.Mail.SMTP.Password, cfg.Mail.From), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail backend %q", cfg.Mail.Backend)
+	}
+}
@@ -1,12 +1,14 @@
 package middleware
 
 import (
+	"encoding/base64"
 	"fmt"
 	"slices"
 	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/server"
 	"github.com/ted-too/logsicle/internal/storage/models"
 	"gorm.io/gorm"
 )
@@ -51,9 +53,15 @@ func validatePreflightOrigin(c fiber.Ctx, db *gorm.DB) error {
 
 // validateOrigin checks if the origin is allowed for a specific project
 func validateOrigin(c fiber.Ctx, db *gorm.DB) (string, *string, error) {
-	// Get project ID from body
+	// Get project ID from body. NDJSON bodies are decoded line by line by
+	// the handler, so the project and channel come from headers instead.
 	body := new(BasicBody)
-	if err := c.Bind().JSON(body); err != nil {
+	if server.IsNDJSON(c) {
+		body.ProjectID = c.Get("X-Project-ID")
+		if channel := c.Get("X-Channel"); channel != "" {
+			body.ChannelSlug = &channel
+		}
+	} else if err := c.Bind().JSON(body); err != nil {
 		return "", nil, fiber.NewError(fiber.StatusBadRequest, "Invalid json body")
 	}
 
@@ -102,12 +110,6 @@ func validateAPIKey(c fiber.Ctx, db *gorm.DB, projectID string, channelSlug *str
 
 	providedKey := parts[1]
 
-	// Find API keys for the project
-	var keys []models.APIKey
-	if err := db.Where("project_id = ?", projectID).Find(&keys).Error; err != nil {
-		return nil, "", fiber.NewError(fiber.StatusInternalServerError, "Failed to validate API key")
-	}
-
 	// Get scope
 	resource, scope := getRequiredScope(c.Method(), c.Path())
 
@@ -125,17 +127,103 @@ func validateAPIKey(c fiber.Ctx, db *gorm.DB, projectID string, channelSlug *str
 		channelID = channel.ID
 	}
 
+	apiKey, err := verifyProjectAPIKey(db, projectID, providedKey, scope)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, channelID, nil
+}
+
+// verifyProjectAPIKey checks the provided key against the project's API keys
+// and ensures it carries at least one of the required scopes
+func verifyProjectAPIKey(db *gorm.DB, projectID, providedKey string, scopes ...string) (*models.APIKey, error) {
+	// Find API keys for the project
+	var keys []models.APIKey
+	if err := db.Where("project_id = ?", projectID).Find(&keys).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Failed to validate API key")
+	}
+
 	// Verify the provided key
 	for i := range keys {
 		if keys[i].VerifyKey(providedKey) {
-			if !hasScope(keys[i].Scopes, scope) {
-				return nil, "", fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
+			for _, scope := range scopes {
+				if hasScope(keys[i].Scopes, scope) {
+					return &keys[i], nil
+				}
 			}
-			return &keys[i], channelID, nil
+			return nil, fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
 		}
 	}
 
-	return nil, "", fiber.NewError(fiber.StatusUnauthorized, "Invalid API key")
+	return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid API key")
+}
+
+// headerCredentials extracts the project ID and API key from request headers.
+// Supported forms are basic auth (username = project ID, password = key),
+// Elasticsearch style "ApiKey base64(project ID:key)" and a bearer token
+// combined with an X-Scope-OrgID or X-Project-ID header.
+func headerCredentials(c fiber.Ctx) (string, string, error) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return "", "", fiber.NewError(fiber.StatusUnauthorized, "Missing API key")
+	}
+
+	scheme, value, ok := strings.Cut(authHeader, " ")
+	if !ok {
+		return "", "", fiber.NewError(fiber.StatusUnauthorized, "Invalid authorization header format")
+	}
+
+	switch strings.ToLower(scheme) {
+	case "basic", "apikey":
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", "", fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials encoding")
+		}
+		projectID, key, ok := strings.Cut(string(decoded), ":")
+		if !ok || projectID == "" || key == "" {
+			return "", "", fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+		}
+		return projectID, key, nil
+	case "bearer":
+		projectID := c.Get("X-Scope-OrgID")
+		if projectID == "" {
+			projectID = c.Get("X-Project-ID")
+		}
+		if projectID == "" {
+			return "", "", fiber.NewError(fiber.StatusBadRequest, "Missing X-Scope-OrgID or X-Project-ID header")
+		}
+		return projectID, value, nil
+	default:
+		return "", "", fiber.NewError(fiber.StatusUnauthorized, "Invalid authorization header format")
+	}
+}
+
+// HeaderAPIAuth authenticates ingest protocols that cannot carry the project
+// ID in the JSON body (Loki, Elasticsearch, ...). The key must hold at least
+// one of the given scopes, which are fixed per route group rather than
+// derived from the path.
+func HeaderAPIAuth(db *gorm.DB, scopes ...string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		projectID, providedKey, err := headerCredentials(c)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		apiKey, err := verifyProjectAPIKey(db, projectID, providedKey, scopes...)
+		if err != nil {
+			return c.Status(err.(*fiber.Error).Code).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		c.Locals("api_key", apiKey)
+		c.Locals("project_id", projectID)
+
+		return c.Next()
+	}
 }
 
 // APIAuth middleware checks for valid API key and permissions
@@ -237,3 +325,10 @@ func hasScope(scopes []string, requiredScope string) bool {
 
 	return false
 }
+
+// VerifyAPIKey checks a project API key outside of a request, e.g. for
+// receivers bound to a project through their configuration
+func VerifyAPIKey(db *gorm.DB, projectID, providedKey string, scopes ...string) error {
+	_, err := verifyProjectAPIKey(db, projectID, providedKey, scopes...)
+	return err
+}
@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"log"
+	"time"
+
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/session"
 	"github.com/ted-too/logsicle/internal/storage"
@@ -8,8 +11,12 @@ import (
 	"gorm.io/gorm"
 )
 
-// AuthMiddleware creates a middleware for protecting routes
-func AuthMiddleware(db *gorm.DB) fiber.Handler {
+// How often the last seen time of a session is written
+const sessionTouchInterval = time.Minute
+
+// AuthMiddleware creates a middleware for protecting routes. Sessions must
+// be recorded, unexpired and used within the idle timeout.
+func AuthMiddleware(db *gorm.DB, idleTimeout time.Duration) fiber.Handler {
 	return func(c fiber.Ctx) error {
 		session := session.FromContext(c)
 
@@ -20,6 +27,32 @@ func AuthMiddleware(db *gorm.DB) fiber.Handler {
 			})
 		}
 
+		var record models.Session
+		if err := db.Where("token_hash = ?", models.HashToken(session.ID())).First(&record).Error; err != nil {
+			session.Destroy()
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session revoked",
+			})
+		}
+
+		now := time.Now()
+		if now.After(record.ExpiresAt) || now.After(userSession.ExpiresAt) || now.Sub(record.LastSeenAt) > idleTimeout {
+			db.Unscoped().Delete(&record)
+			session.Destroy()
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session expired",
+			})
+		}
+
+		if now.Sub(record.LastSeenAt) > sessionTouchInterval {
+			if err := db.Model(&record).Updates(map[string]interface{}{
+				"last_seen_at": now,
+				"ip_address":   c.IP(),
+			}).Error; err != nil {
+				log.Printf("Failed to update session last seen time: %v", err)
+			}
+		}
+
 		// Get user
 		var user models.User
 		if err := db.Preload("Organizations").Where("id = ?", userSession.UserID).First(&user).Error; err != nil {
@@ -29,9 +62,19 @@ func AuthMiddleware(db *gorm.DB) fiber.Handler {
 			})
 		}
 
+		// Sessions are revoked when the password changes
+		if user.SessionsRevokedAt.Valid && userSession.CreatedAt.Before(user.SessionsRevokedAt.Time) {
+			db.Unscoped().Delete(&record)
+			session.Destroy()
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Session revoked",
+			})
+		}
+
 		// Store user in context
 		c.Locals("user", &user)
 		c.Locals("session", userSession)
+		c.Locals("session_id", record.ID)
 
 		return c.Next()
 	}
@@ -56,12 +99,22 @@ func RequireActiveOrganization(db *gorm.DB) fiber.Handler {
 
 		// Verify user belongs to organization
 		var membership models.TeamMembership
-		if err := db.Where("user_id = ? AND organization_id = ?", userSession.UserID, userSession.ActiveOrganization).First(&membership).Error; err != nil {
+		if err := db.Preload("Organization").Where("user_id = ? AND organization_id = ?", userSession.UserID, userSession.ActiveOrganization).First(&membership).Error; err != nil {
 			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 				"error": "Not a member of this organization",
 			})
 		}
 
+		// Organizations can require members to use two-factor authentication
+		if membership.Organization.RequireTwoFactor {
+			if user, ok := c.Locals("user").(*models.User); !ok || !user.TwoFactorEnabled {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Two-factor authentication required",
+					"code":  "two_factor_required",
+				})
+			}
+		}
+
 		// Store membership in context
 		c.Locals("membership", &membership)
 
@@ -114,3 +167,86 @@ func RequireRole(roles ...models.Role) fiber.Handler {
 		return c.Next()
 	}
 }
+
+// RequireProjectAccess creates a middleware that resolves the user's role on
+// the project in the route and requires it to grant view access. It must run
+// after RequireActiveOrganization on a route with an :id parameter.
+func RequireProjectAccess(db *gorm.DB) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		membership, ok := c.Locals("membership").(*models.TeamMembership)
+		if !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Membership not found in context",
+			})
+		}
+
+		projectID := c.Params("id")
+
+		// Verify project belongs to organization
+		var project models.Project
+		if err := db.Select("id").Where("id = ? AND organization_id = ?", projectID, membership.OrganizationID).First(&project).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": "Project not found or access denied",
+				})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to verify project access",
+			})
+		}
+
+		role, ok := models.ProjectRoleFor(membership.Role)
+		if !ok {
+			var member models.ProjectMember
+			if err := db.Where("project_id = ? AND user_id = ?", projectID, membership.UserID).First(&member).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"error": "Project not found or access denied",
+					})
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "Failed to verify project access",
+				})
+			}
+			role = member.Role
+		}
+
+		if !role.Can(models.PermissionViewProject) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Project not found or access denied",
+			})
+		}
+
+		// Store project role in context
+		c.Locals("project_role", role)
+
+		return c.Next()
+	}
+}
+
+// RequireProjectPermission creates a middleware that requires the project
+// role resolved by RequireProjectAccess to grant a permission
+func RequireProjectPermission(permission models.Permission) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if _, ok := c.Locals("project_role").(models.ProjectRole); !ok {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Project role not found in context",
+			})
+		}
+
+		if !HasProjectPermission(c, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Insufficient permissions",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// HasProjectPermission reports whether the project role in context grants a
+// permission, for handlers that adjust their response instead of refusing
+func HasProjectPermission(c fiber.Ctx, permission models.Permission) bool {
+	role, ok := c.Locals("project_role").(models.ProjectRole)
+	return ok && role.Can(permission)
+}
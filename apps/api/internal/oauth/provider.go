@@ -0,0 +1,124 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var ErrNoEmail = errors.New("identity provider returned no email")
+
+// Identity is a user as asserted by an identity provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Provider signs users in through the OAuth 2.0 authorization code flow
+// with PKCE
+type Provider interface {
+	// AuthCodeURL returns the URL users are sent to to sign in
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange redeems an authorization code for the signed in identity
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, *oauth2.Token, error)
+}
+
+// OIDCProvider signs users in with an OpenID Connect issuer
+type OIDCProvider struct {
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	config   oauth2.Config
+}
+
+// NewOIDCProvider discovers the configuration of issuer
+func NewOIDCProvider(ctx context.Context, issuer, clientID, clientSecret, redirectURL string) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover issuer %s: %w", issuer, err)
+	}
+
+	return &OIDCProvider{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       []string{oidc.ScopeOpenID, "email", "profile"},
+		},
+	}, nil
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// oidcClaims are the standard claims of ID tokens and the user info
+// endpoint. Some issuers send email_verified as a string.
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+func (c oidcClaims) emailVerified() bool {
+	return c.EmailVerified == true || c.EmailVerified == "true"
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, *oauth2.Token, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse id_token claims: %w", err)
+	}
+
+	// Issuers may leave profile claims out of the ID token
+	if claims.Email == "" {
+		userInfo, err := p.provider.UserInfo(ctx, oauth2.StaticTokenSource(token))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get user info: %w", err)
+		}
+		if userInfo.Subject != idToken.Subject {
+			return nil, nil, errors.New("user info subject does not match id_token")
+		}
+		if err := userInfo.Claims(&claims); err != nil {
+			return nil, nil, fmt.Errorf("failed to parse user info claims: %w", err)
+		}
+	}
+	if claims.Email == "" {
+		return nil, nil, ErrNoEmail
+	}
+
+	return &Identity{
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.emailVerified(),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, token, nil
+}
@@ -0,0 +1,195 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ted-too/logsicle/internal/oauth/oauthtest"
+	"golang.org/x/oauth2"
+)
+
+const redirectURL = "http://localhost/callback"
+
+func newTestProvider(t *testing.T, issuer *oauthtest.Issuer) *OIDCProvider {
+	t.Helper()
+
+	provider, err := NewOIDCProvider(context.Background(), issuer.URL, issuer.ClientID, issuer.ClientSecret, redirectURL)
+	if err != nil {
+		t.Fatalf("NewOIDCProvider: %v", err)
+	}
+	return provider
+}
+
+// signIn runs the authorization code flow up to the callback and returns
+// the code
+func signIn(t *testing.T, issuer *oauthtest.Issuer, provider *OIDCProvider, state, nonce, verifier string) string {
+	t.Helper()
+
+	callback, err := issuer.Authorize(provider.AuthCodeURL(state, nonce, verifier))
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if got := callback.Query().Get("state"); got != state {
+		t.Fatalf("callback state = %q, want %q", got, state)
+	}
+	return callback.Query().Get("code")
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	provider := newTestProvider(t, issuer)
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		omit   []string
+		want   Identity
+	}{
+		{
+			name: "id token claims",
+			claims: map[string]any{
+				"sub":            "user-1",
+				"email":          "jane@example.com",
+				"email_verified": true,
+				"name":           "Jane",
+				"picture":        "https://example.com/jane.png",
+			},
+			want: Identity{Subject: "user-1", Email: "jane@example.com", EmailVerified: true, Name: "Jane", Picture: "https://example.com/jane.png"},
+		},
+		{
+			name:   "email verified as a string",
+			claims: map[string]any{"sub": "user-2", "email": "john@example.com", "email_verified": "true"},
+			want:   Identity{Subject: "user-2", Email: "john@example.com", EmailVerified: true},
+		},
+		{
+			name:   "unverified email",
+			claims: map[string]any{"sub": "user-3", "email": "joe@example.com", "email_verified": false},
+			want:   Identity{Subject: "user-3", Email: "joe@example.com"},
+		},
+		{
+			name:   "email from user info",
+			claims: map[string]any{"sub": "user-4", "email": "ann@example.com", "email_verified": true, "name": "Ann"},
+			omit:   []string{"email", "email_verified", "name"},
+			want:   Identity{Subject: "user-4", Email: "ann@example.com", EmailVerified: true, Name: "Ann"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer.SignInAs(tt.claims, tt.omit...)
+			verifier := oauth2.GenerateVerifier()
+			code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+			identity, token, err := provider.Exchange(context.Background(), code, "nonce", verifier)
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if *identity != tt.want {
+				t.Errorf("identity = %+v, want %+v", *identity, tt.want)
+			}
+			if token.AccessToken == "" {
+				t.Error("token has no access token")
+			}
+			if _, ok := token.Extra("id_token").(string); !ok {
+				t.Error("token has no id_token")
+			}
+		})
+	}
+}
+
+func TestOIDCProviderExchangeRejects(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	provider := newTestProvider(t, issuer)
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		issuer.SignInAs(map[string]any{"sub": "user-1", "email": "jane@example.com", "nonce": "other"})
+		verifier := oauth2.GenerateVerifier()
+		code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err == nil || !strings.Contains(err.Error(), "nonce") {
+			t.Fatalf("Exchange error = %v, want nonce mismatch", err)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		issuer.SignInAs(map[string]any{"sub": "user-1", "email": "jane@example.com"})
+		code := signIn(t, issuer, provider, "state", "nonce", oauth2.GenerateVerifier())
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", oauth2.GenerateVerifier()); err == nil {
+			t.Fatal("Exchange succeeded with the wrong code verifier")
+		}
+	})
+
+	t.Run("code redeemed twice", func(t *testing.T) {
+		issuer.SignInAs(map[string]any{"sub": "user-1", "email": "jane@example.com"})
+		verifier := oauth2.GenerateVerifier()
+		code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err != nil {
+			t.Fatalf("Exchange: %v", err)
+		}
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err == nil {
+			t.Fatal("Exchange succeeded with a redeemed code")
+		}
+	})
+
+	t.Run("id token of another client", func(t *testing.T) {
+		issuer.SignInAs(map[string]any{"sub": "user-1", "email": "jane@example.com", "aud": "other-client"})
+		verifier := oauth2.GenerateVerifier()
+		code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err == nil || !strings.Contains(err.Error(), "verify id_token") {
+			t.Fatalf("Exchange error = %v, want id_token verification failure", err)
+		}
+	})
+
+	t.Run("id token of another issuer", func(t *testing.T) {
+		other := oauthtest.NewIssuer(t)
+		issuer.SignInAs(map[string]any{"sub": "user-1", "email": "jane@example.com", "iss": other.URL})
+		verifier := oauth2.GenerateVerifier()
+		code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); err == nil || !strings.Contains(err.Error(), "verify id_token") {
+			t.Fatalf("Exchange error = %v, want id_token verification failure", err)
+		}
+	})
+
+	t.Run("no email", func(t *testing.T) {
+		issuer.SignInAs(map[string]any{"sub": "user-1"})
+		verifier := oauth2.GenerateVerifier()
+		code := signIn(t, issuer, provider, "state", "nonce", verifier)
+
+		if _, _, err := provider.Exchange(context.Background(), code, "nonce", verifier); !errors.Is(err, ErrNoEmail) {
+			t.Fatalf("Exchange error = %v, want ErrNoEmail", err)
+		}
+	})
+}
+
+func TestOIDCProviderAuthCodeURL(t *testing.T) {
+	issuer := oauthtest.NewIssuer(t)
+	provider := newTestProvider(t, issuer)
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state", "nonce", oauth2.GenerateVerifier()))
+	if err != nil {
+		t.Fatalf("invalid auth code URL: %v", err)
+	}
+
+	query := authURL.Query()
+	for name, want := range map[string]string{
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"client_id":             issuer.ClientID,
+		"redirect_uri":          redirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if !strings.Contains(query.Get("scope"), "openid") {
+		t.Errorf("scope = %q, want openid", query.Get("scope"))
+	}
+}
@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/storage/models"
+)
+
+const googleIssuer = "https://accounts.google.com"
+
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+type ssoEntry struct {
+	provider  Provider
+	updatedAt time.Time
+}
+
+// Registry holds the configured social login providers and the OpenID
+// Connect providers of organizations. Issuers are discovered on first use.
+type Registry struct {
+	apiBaseURL string
+	cfg        *config.Config
+
+	mu     sync.Mutex
+	social map[string]Provider
+	sso    map[string]ssoEntry
+}
+
+func NewRegistry(cfg *config.Config) *Registry {
+	return &Registry{
+		apiBaseURL: cfg.ApiBaseURL,
+		cfg:        cfg,
+		social:     make(map[string]Provider),
+		sso:        make(map[string]ssoEntry),
+	}
+}
+
+// SocialProviders lists the names of the configured social login providers
+func (r *Registry) SocialProviders() []string {
+	providers := []string{}
+	if r.cfg.OAuth.Google.ClientID != "" {
+		providers = append(providers, models.ProviderGoogle)
+	}
+	if r.cfg.OAuth.GitHub.ClientID != "" {
+		providers = append(providers, models.ProviderGitHub)
+	}
+	return providers
+}
+
+// SocialCallbackURL is where a social login provider redirects users back to
+func (r *Registry) SocialCallbackURL(name string) string {
+	return r.apiBaseURL + "/v1/auth/oauth/" + name + "/callback"
+}
+
+// SSOCallbackURL is where organization providers redirect users back to
+func (r *Registry) SSOCallbackURL() string {
+	return r.apiBaseURL + "/v1/auth/sso/callback"
+}
+
+// Social returns a configured social login provider by name
+func (r *Registry) Social(ctx context.Context, name string) (Provider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if provider, ok := r.social[name]; ok {
+		return provider, nil
+	}
+
+	var provider Provider
+	switch {
+	case name == models.ProviderGoogle && r.cfg.OAuth.Google.ClientID != "":
+		google, err := NewOIDCProvider(ctx, googleIssuer, r.cfg.OAuth.Google.ClientID, r.cfg.OAuth.Google.ClientSecret, r.SocialCallbackURL(name))
+		if err != nil {
+			return nil, err
+		}
+		provider = google
+	case name == models.ProviderGitHub && r.cfg.OAuth.GitHub.ClientID != "":
+		provider = NewGitHubProvider(r.cfg.OAuth.GitHub.ClientID, r.cfg.OAuth.GitHub.ClientSecret, r.SocialCallbackURL(name))
+	default:
+		return nil, ErrUnknownProvider
+	}
+
+	r.social[name] = provider
+	return provider, nil
+}
+
+// SSO returns the provider of an organization, discovering its issuer again
+// when the settings changed
+func (r *Registry) SSO(ctx context.Context, settings models.SSOProvider) (Provider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.sso[settings.ID]; ok && entry.updatedAt.Equal(settings.UpdatedAt) {
+		return entry.provider, nil
+	}
+
+	provider, err := NewOIDCProvider(ctx, settings.Issuer, settings.ClientID, settings.ClientSecret, r.SSOCallbackURL())
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.ID != "" {
+		r.sso[settings.ID] = ssoEntry{provider: provider, updatedAt: settings.UpdatedAt}
+	}
+	return provider, nil
+}
@@ -0,0 +1,204 @@
+package pipeline
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// document gives processors uniform access to an app log. The attribute
+// names below address AppLog columns, any other path is a dotted key inside
+// Fields, optionally prefixed with "fields.".
+type document struct {
+	log    *models.AppLog
+	fields map[string]any
+}
+
+const fieldsPrefix = "fields."
+
+func newDocument(log *models.AppLog) *document {
+	fields := make(map[string]any)
+	if len(log.Fields) > 0 {
+		// Fields always holds a JSON object, anything else is replaced
+		_ = json.Unmarshal(log.Fields, &fields)
+	}
+	return &document{log: log, fields: fields}
+}
+
+// commit writes the processed fields back onto the log
+func (d *document) commit() {
+	d.log.Fields = models.ConvertToJSONB(d.fields)
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func (d *document) get(path string) (any, bool) {
+	switch path {
+	case "message":
+		return d.log.Message, true
+	case "level":
+		return string(d.log.Level), true
+	case "service_name":
+		return d.log.ServiceName, true
+	case "environment":
+		return d.log.Environment.String, d.log.Environment.Valid
+	case "host":
+		return d.log.Host.String, d.log.Host.Valid
+	case "version":
+		return d.log.Version.String, d.log.Version.Valid
+	case "caller":
+		return d.log.Caller.String, d.log.Caller.Valid
+	case "function":
+		return d.log.Function.String, d.log.Function.Valid
+	}
+
+	current := any(d.fields)
+	for _, key := range strings.Split(strings.TrimPrefix(path, fieldsPrefix), ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// getString returns the value at path as a string, stringifying non-string
+// values
+func (d *document) getString(path string) (string, bool) {
+	value, ok := d.get(path)
+	if !ok || value == nil {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value), true
+	}
+	return string(b), true
+}
+
+func toString(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+func (d *document) set(path string, value any) error {
+	switch path {
+	case "message":
+		message := toString(value)
+		if message == "" {
+			return fmt.Errorf("message cannot be empty")
+		}
+		d.log.Message = message
+		return nil
+	case "level":
+		level, ok := models.NormalizeLogLevel(toString(value))
+		if !ok {
+			return fmt.Errorf("invalid log level: %v", value)
+		}
+		d.log.Level = level
+		return nil
+	case "service_name":
+		serviceName := toString(value)
+		if serviceName == "" {
+			return fmt.Errorf("service_name cannot be empty")
+		}
+		d.log.ServiceName = serviceName
+		return nil
+	case "environment":
+		d.log.Environment = nullString(toString(value))
+		return nil
+	case "host":
+		d.log.Host = nullString(toString(value))
+		return nil
+	case "version":
+		d.log.Version = nullString(toString(value))
+		return nil
+	case "caller":
+		d.log.Caller = nullString(toString(value))
+		return nil
+	case "function":
+		d.log.Function = nullString(toString(value))
+		return nil
+	}
+
+	keys := strings.Split(strings.TrimPrefix(path, fieldsPrefix), ".")
+	current := d.fields
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+	return nil
+}
+
+// remove deletes the value at path. Required attributes cannot be removed.
+func (d *document) remove(path string) error {
+	switch path {
+	case "message", "level", "service_name":
+		return fmt.Errorf("%s cannot be removed", path)
+	case "environment":
+		d.log.Environment = sql.NullString{}
+		return nil
+	case "host":
+		d.log.Host = sql.NullString{}
+		return nil
+	case "version":
+		d.log.Version = sql.NullString{}
+		return nil
+	case "caller":
+		d.log.Caller = sql.NullString{}
+		return nil
+	case "function":
+		d.log.Function = sql.NullString{}
+		return nil
+	}
+
+	keys := strings.Split(strings.TrimPrefix(path, fieldsPrefix), ".")
+	current := d.fields
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = next
+	}
+	delete(current, keys[len(keys)-1])
+	return nil
+}
+
+// merge writes every key of values under target. Without a target each key
+// is set as a path, so extracted attributes such as level replace the
+// column value and dotted names nest inside Fields. Values an attribute
+// rejects are kept in Fields instead.
+func (d *document) merge(target string, values map[string]any) error {
+	if target != "" {
+		return d.set(target, values)
+	}
+	for k, v := range values {
+		if err := d.set(k, v); err != nil {
+			d.fields[k] = v
+		}
+	}
+	return nil
+}
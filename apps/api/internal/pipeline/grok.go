@@ -0,0 +1,167 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// grokPatterns is a subset of the standard grok pattern library, covering the
+// patterns most access and application log formats are built from
+var grokPatterns = map[string]string{
+	"USERNAME":     `[a-zA-Z0-9._-]+`,
+	"USER":         `%{USERNAME}`,
+	"INT":          `(?:[+-]?(?:[0-9]+))`,
+	"BASE10NUM":    `(?:[+-]?(?:[0-9]+(?:\.[0-9]+)?|\.[0-9]+))`,
+	"NUMBER":       `(?:%{BASE10NUM})`,
+	"POSINT":       `\b(?:[1-9][0-9]*)\b`,
+	"NONNEGINT":    `\b(?:[0-9]+)\b`,
+	"WORD":         `\b\w+\b`,
+	"NOTSPACE":     `\S+`,
+	"SPACE":        `\s*`,
+	"DATA":         `.*?`,
+	"GREEDYDATA":   `.*`,
+	"QUOTEDSTRING": `(?:"(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')`,
+	"UUID":         `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"EMAILADDRESS": `[a-zA-Z0-9!#$%&'*+/=?^_{|}~.-]+@[a-zA-Z0-9.-]+`,
+
+	"IPV4":         `(?:(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(?:25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)`,
+	"IPV6":         `(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`,
+	"IP":           `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":     `\b(?:[0-9A-Za-z][0-9A-Za-z-]{0,62})(?:\.(?:[0-9A-Za-z][0-9A-Za-z-]{0,62}))*(?:\.?|\b)`,
+	"IPORHOST":     `(?:%{IP}|%{HOSTNAME})`,
+	"HOSTPORT":     `%{IPORHOST}:%{POSINT}`,
+	"UNIXPATH":     `(?:/[\w_%!$@:.,+~-]*)+`,
+	"PATH":         `%{UNIXPATH}`,
+	"URIPATH":      `(?:/[A-Za-z0-9$.+!*'(){},~:;=@#%&_\-]*)+`,
+	"URIPARAM":     `\?[A-Za-z0-9$.+!*'|(){},~@#%&/=:;_?\-\[\]<>]*`,
+	"URIPATHPARAM": `%{URIPATH}(?:%{URIPARAM})?`,
+	"HTTPMETHOD":   `\b(?:GET|POST|PUT|PATCH|DELETE|HEAD|OPTIONS|TRACE|CONNECT)\b`,
+
+	"LOGLEVEL": `(?:[Tt]race|TRACE|[Dd]ebug|DEBUG|[Nn]otice|NOTICE|[Ii]nfo|INFO|[Ww]arn(?:ing)?|WARN(?:ING)?|[Ee]rr(?:or)?|ERR(?:OR)?|[Cc]rit(?:ical)?|CRIT(?:ICAL)?|[Ff]atal|FATAL|[Ss]evere|SEVERE|[Ee]merg(?:ency)?|EMERG(?:ENCY)?|[Aa]lert|ALERT|[Pp]anic|PANIC)`,
+
+	"YEAR":              `(?:\d\d){1,2}`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:0[1-9]|[12][0-9]|3[01]|[1-9])`,
+	"MONTH":             `\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)[a-z]*\b`,
+	"DAY":               `\b(?:Mon|Tue|Wed|Thu|Fri|Sat|Sun)[a-z]*\b`,
+	"HOUR":              `(?:2[0123]|[01]?[0-9])`,
+	"MINUTE":            `(?:[0-5][0-9])`,
+	"SECOND":            `(?:(?:[0-5]?[0-9]|60)(?:[:.,][0-9]+)?)`,
+	"TIME":              `%{HOUR}:%{MINUTE}(?::%{SECOND})?`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} %{INT}`,
+	"SYSLOGTIMESTAMP":   `%{MONTH} +%{MONTHDAY} %{TIME}`,
+
+	"COMMONAPACHELOG":   `%{IPORHOST:client_ip} %{NOTSPACE:ident} %{NOTSPACE:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:method} %{NOTSPACE:path}(?: HTTP/%{NUMBER:http_version})?|%{DATA:raw_request})" %{INT:status:int} (?:%{INT:bytes:int}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} %{QUOTEDSTRING:referrer} %{QUOTEDSTRING:user_agent}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?(?::(int|float))?\}`)
+
+// Maximum depth of nested pattern references
+const maxGrokDepth = 16
+
+// grokCapture maps a generated regex group onto the field it captures
+type grokCapture struct {
+	pattern string
+	field   string
+	convert string
+}
+
+type grokExpression struct {
+	re       *regexp.Regexp
+	captures map[string]grokCapture
+}
+
+// compileGrok expands %{PATTERN:field:type} references into a regular
+// expression. Field names may contain dots, so captures use generated group
+// names and are mapped back when matching.
+func compileGrok(pattern string) (*grokExpression, error) {
+	expr := &grokExpression{captures: make(map[string]grokCapture)}
+
+	expanded, err := expr.expand(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grok pattern: %w", err)
+	}
+	expr.re = re
+	return expr, nil
+}
+
+func (g *grokExpression) expand(pattern string, depth int) (string, error) {
+	if depth > maxGrokDepth {
+		return "", fmt.Errorf("grok patterns nested deeper than %d", maxGrokDepth)
+	}
+
+	var expandErr error
+	expanded := grokReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		parts := grokReference.FindStringSubmatch(ref)
+		name, field, convert := parts[1], parts[2], parts[3]
+
+		definition, ok := grokPatterns[name]
+		if !ok {
+			if expandErr == nil {
+				expandErr = fmt.Errorf("unknown grok pattern: %s", name)
+			}
+			return ""
+		}
+
+		inner, err := g.expand(definition, depth+1)
+		if err != nil {
+			if expandErr == nil {
+				expandErr = err
+			}
+			return ""
+		}
+
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+
+		group := "g" + strconv.Itoa(len(g.captures))
+		g.captures[group] = grokCapture{pattern: name, field: field, convert: convert}
+		return "(?P<" + group + ">" + inner + ")"
+	})
+
+	return expanded, expandErr
+}
+
+// match returns the captured fields, or false when the input does not match
+func (g *grokExpression) match(input string) (map[string]any, bool) {
+	match := g.re.FindStringSubmatch(input)
+	if match == nil {
+		return nil, false
+	}
+
+	values := make(map[string]any)
+	for i, group := range g.re.SubexpNames() {
+		capture, ok := g.captures[group]
+		if !ok || match[i] == "" {
+			continue
+		}
+
+		value := any(match[i])
+		switch capture.convert {
+		case "int":
+			if n, err := strconv.ParseInt(match[i], 10, 64); err == nil {
+				value = n
+			}
+		case "float":
+			if f, err := strconv.ParseFloat(match[i], 64); err == nil {
+				value = f
+			}
+		default:
+			if capture.pattern == "QUOTEDSTRING" {
+				value = match[i][1 : len(match[i])-1]
+			}
+		}
+		values[capture.field] = value
+	}
+	return values, true
+}
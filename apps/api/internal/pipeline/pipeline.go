@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Pipeline is a compiled, ordered list of processors
+type Pipeline struct {
+	processors []*processor
+}
+
+// Result describes the outcome of running a log through pipelines
+type Result struct {
+	Dropped bool     `json:"dropped"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Compile validates processor configs and prepares them to run
+func Compile(configs []ProcessorConfig) (*Pipeline, error) {
+	p := &Pipeline{processors: make([]*processor, 0, len(configs))}
+	for i, cfg := range configs {
+		compiled, err := compileProcessor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %w", i, cfg.Type, err)
+		}
+		p.processors = append(p.processors, compiled)
+	}
+	return p, nil
+}
+
+// CompileJSON compiles a JSON array of processor configs, as stored on
+// models.Pipeline
+func CompileJSON(data []byte) (*Pipeline, error) {
+	var configs []ProcessorConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("invalid processors: %w", err)
+	}
+	return Compile(configs)
+}
+
+// Run applies every pipeline to the log in order. A failing processor is
+// recorded and skipped so one bad rule does not lose the log.
+func Run(log *models.AppLog, pipelines ...*Pipeline) Result {
+	var result Result
+
+	doc := newDocument(log)
+	for _, p := range pipelines {
+		for i, proc := range p.processors {
+			keep, err := proc.apply(doc)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("processor %d (%s): %v", i, proc.Type, err))
+			}
+			if !keep {
+				result.Dropped = true
+				return result
+			}
+		}
+	}
+	doc.commit()
+
+	return result
+}
@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Processor types
+const (
+	ProcessorJSON   = "json"   // parse a JSON object out of a field
+	ProcessorRegex  = "regex"  // extract named groups of a regular expression
+	ProcessorGrok   = "grok"   // extract fields with a grok pattern
+	ProcessorKV     = "kv"     // parse key=value pairs
+	ProcessorRename = "rename" // move a value to another path
+	ProcessorRemove = "remove" // delete values
+	ProcessorLevel  = "level"  // remap a value onto the log level
+	ProcessorDrop   = "drop"   // discard the log
+)
+
+// Condition matches a value of the log. Exactly one of the operators is set.
+type Condition struct {
+	Field    string  `json:"field"`
+	Equals   *string `json:"equals,omitempty"`
+	Contains *string `json:"contains,omitempty"`
+	Matches  *string `json:"matches,omitempty"`
+	Exists   *bool   `json:"exists,omitempty"`
+}
+
+func (c Condition) Validate() error {
+	operators := 0
+	for _, set := range []bool{c.Equals != nil, c.Contains != nil, c.Matches != nil, c.Exists != nil} {
+		if set {
+			operators++
+		}
+	}
+	if operators != 1 {
+		return fmt.Errorf("exactly one of equals, contains, matches or exists is required")
+	}
+
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Field, validation.Required),
+	)
+}
+
+// ProcessorConfig is the stored form of a processor. Which options apply
+// depends on Type, Field defaults to "message" where a source is read.
+type ProcessorConfig struct {
+	Type string `json:"type"`
+	// Only run the processor when the condition matches, required for drop
+	If *Condition `json:"if,omitempty"`
+
+	Field  string `json:"field,omitempty"`  // json, regex, grok, kv, level
+	Target string `json:"target,omitempty"` // json, regex, grok, kv: object to write into, fields root when empty
+
+	Pattern string `json:"pattern,omitempty"` // regex, grok
+
+	FieldSplit string `json:"field_split,omitempty"` // kv, defaults to whitespace
+	ValueSplit string `json:"value_split,omitempty"` // kv, defaults to "="
+
+	From string `json:"from,omitempty"` // rename
+	To   string `json:"to,omitempty"`   // rename
+
+	Fields []string `json:"fields,omitempty"` // remove
+
+	Mapping map[string]string `json:"mapping,omitempty"` // level: source value -> log level
+}
+
+func (p ProcessorConfig) Validate() error {
+	patternRequired := p.Type == ProcessorRegex || p.Type == ProcessorGrok
+
+	return validation.ValidateStruct(&p,
+		validation.Field(&p.Type,
+			validation.Required,
+			validation.In(ProcessorJSON, ProcessorRegex, ProcessorGrok, ProcessorKV,
+				ProcessorRename, ProcessorRemove, ProcessorLevel, ProcessorDrop),
+		),
+		validation.Field(&p.If, validation.When(p.Type == ProcessorDrop, validation.Required)),
+		validation.Field(&p.Pattern, validation.When(patternRequired, validation.Required)),
+		validation.Field(&p.From, validation.When(p.Type == ProcessorRename, validation.Required)),
+		validation.Field(&p.To, validation.When(p.Type == ProcessorRename, validation.Required)),
+		validation.Field(&p.Fields, validation.When(p.Type == ProcessorRemove, validation.Required)),
+		validation.Field(&p.Mapping, validation.By(validateLevelMapping)),
+	)
+}
+
+// validateLevelMapping checks every source value maps to a log level. Source
+// values are matched case-insensitively, so keys differing only in case
+// are rejected.
+func validateLevelMapping(value interface{}) error {
+	mapping, _ := value.(map[string]string)
+	seen := make(map[string]string, len(mapping))
+	for from, to := range mapping {
+		if _, ok := models.NormalizeLogLevel(to); !ok {
+			return fmt.Errorf("%s maps to invalid log level %q", from, to)
+		}
+		key := strings.ToLower(from)
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("%s and %s differ only in case", other, from)
+		}
+		seen[key] = from
+	}
+	return nil
+}
+
+// condition is a compiled Condition
+type condition struct {
+	Condition
+	re *regexp.Regexp
+}
+
+func (c *condition) match(doc *document) bool {
+	value, ok := doc.getString(c.Field)
+	switch {
+	case c.Exists != nil:
+		return ok == *c.Exists
+	case !ok:
+		return false
+	case c.Equals != nil:
+		return value == *c.Equals
+	case c.Contains != nil:
+		return strings.Contains(value, *c.Contains)
+	default:
+		return c.re.MatchString(value)
+	}
+}
+
+// processor is a compiled ProcessorConfig. apply returns false when the log
+// is dropped.
+type processor struct {
+	ProcessorConfig
+	cond  *condition
+	re    *regexp.Regexp
+	grok  *grokExpression
+	split *regexp.Regexp
+}
+
+func compileProcessor(cfg ProcessorConfig) (*processor, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Field == "" {
+		cfg.Field = "message"
+	}
+
+	p := &processor{ProcessorConfig: cfg}
+
+	if cfg.If != nil {
+		if err := cfg.If.Validate(); err != nil {
+			return nil, fmt.Errorf("if: %w", err)
+		}
+		p.cond = &condition{Condition: *cfg.If}
+		if cfg.If.Matches != nil {
+			re, err := regexp.Compile(*cfg.If.Matches)
+			if err != nil {
+				return nil, fmt.Errorf("if: invalid pattern: %w", err)
+			}
+			p.cond.re = re
+		}
+	}
+
+	switch cfg.Type {
+	case ProcessorRegex:
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		p.re = re
+	case ProcessorGrok:
+		grok, err := compileGrok(cfg.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.grok = grok
+	case ProcessorLevel:
+		// Lowercase the keys once, apply looks up the lowercased source
+		p.Mapping = make(map[string]string, len(cfg.Mapping))
+		for from, to := range cfg.Mapping {
+			p.Mapping[strings.ToLower(from)] = to
+		}
+	case ProcessorKV:
+		if cfg.FieldSplit != "" {
+			p.split = regexp.MustCompile(regexp.QuoteMeta(cfg.FieldSplit))
+		}
+		if p.ValueSplit == "" {
+			p.ValueSplit = "="
+		}
+	}
+
+	return p, nil
+}
+
+func (p *processor) apply(doc *document) (bool, error) {
+	if p.cond != nil && !p.cond.match(doc) {
+		return true, nil
+	}
+
+	switch p.Type {
+	case ProcessorDrop:
+		return false, nil
+	case ProcessorRename:
+		value, ok := doc.get(p.From)
+		if !ok {
+			return true, nil
+		}
+		if err := doc.set(p.To, value); err != nil {
+			return true, err
+		}
+		return true, doc.remove(p.From)
+	case ProcessorRemove:
+		for _, field := range p.Fields {
+			if err := doc.remove(field); err != nil {
+				return true, err
+			}
+		}
+		return true, nil
+	}
+
+	source, ok := doc.getString(p.Field)
+	if !ok {
+		return true, nil
+	}
+
+	switch p.Type {
+	case ProcessorJSON:
+		trimmed := strings.TrimSpace(source)
+		if !strings.HasPrefix(trimmed, "{") {
+			return true, nil
+		}
+		var values map[string]any
+		if err := json.Unmarshal([]byte(trimmed), &values); err != nil {
+			return true, fmt.Errorf("invalid JSON in %s: %w", p.Field, err)
+		}
+		return true, doc.merge(p.Target, values)
+	case ProcessorRegex:
+		match := p.re.FindStringSubmatch(source)
+		if match == nil {
+			return true, nil
+		}
+		values := make(map[string]any)
+		for i, name := range p.re.SubexpNames() {
+			if name != "" && match[i] != "" {
+				values[name] = match[i]
+			}
+		}
+		return true, doc.merge(p.Target, values)
+	case ProcessorGrok:
+		values, ok := p.grok.match(source)
+		if !ok {
+			return true, nil
+		}
+		return true, doc.merge(p.Target, values)
+	case ProcessorKV:
+		values := parseKV(source, p.split, p.ValueSplit)
+		if len(values) == 0 {
+			return true, nil
+		}
+		return true, doc.merge(p.Target, values)
+	case ProcessorLevel:
+		level, ok := p.Mapping[strings.ToLower(source)]
+		if !ok {
+			level = source
+		}
+		return true, doc.set("level", level)
+	}
+
+	return true, nil
+}
+
+// parseKV extracts key=value pairs, honouring double quoted values when
+// pairs are whitespace separated
+func parseKV(input string, split *regexp.Regexp, valueSplit string) map[string]any {
+	var pairs []string
+	if split != nil {
+		pairs = split.Split(input, -1)
+	} else {
+		pairs = splitQuoted(input)
+	}
+
+	values := make(map[string]any)
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), valueSplit)
+		if !ok || key == "" || strings.ContainsAny(key, " \t\"") {
+			continue
+		}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values
+}
+
+// splitQuoted splits on whitespace outside of double quotes
+func splitQuoted(input string) []string {
+	var (
+		parts   []string
+		current strings.Builder
+		quoted  bool
+	)
+	for i := 0; i < len(input); i++ {
+		ch := input[i]
+		switch {
+		case ch == '\\' && quoted && i+1 < len(input):
+			current.WriteByte(input[i+1])
+			i++
+		case ch == '"':
+			quoted = !quoted
+			current.WriteByte(ch)
+		case (ch == ' ' || ch == '\t') && !quoted:
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
@@ -0,0 +1,59 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+func TestLevelProcessorMapping(t *testing.T) {
+	p, err := Compile([]ProcessorConfig{{
+		Type:    ProcessorLevel,
+		Field:   "severity",
+		Mapping: map[string]string{"W-LVL": "warn", "Oops": "fatal"},
+	}})
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	tests := []struct {
+		severity string
+		want     models.LogLevel
+	}{
+		{severity: "W-LVL", want: models.LogLevelWarning},
+		{severity: "w-lvl", want: models.LogLevelWarning},
+		{severity: "oops", want: models.LogLevelFatal},
+		{severity: "error", want: models.LogLevelError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.severity, func(t *testing.T) {
+			log := &models.AppLog{
+				Level:       models.LogLevelInfo,
+				Message:     "disk almost full",
+				ServiceName: "api",
+				Fields:      models.ConvertToJSONB(map[string]any{"severity": tt.severity}),
+			}
+
+			result := Run(log, p)
+			if len(result.Errors) > 0 {
+				t.Fatalf("Run errors: %v", result.Errors)
+			}
+			if log.Level != tt.want {
+				t.Errorf("level = %q, want %q", log.Level, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelProcessorMappingCollision(t *testing.T) {
+	_, err := Compile([]ProcessorConfig{{
+		Type:    ProcessorLevel,
+		Field:   "severity",
+		Mapping: map[string]string{"WARN": "warn", "warn": "error"},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "differ only in case") {
+		t.Fatalf("Compile error = %v, want case collision", err)
+	}
+}
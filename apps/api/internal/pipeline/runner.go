@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// How long a project's compiled pipelines are reused before reloading
+const cacheTTL = 30 * time.Second
+
+type cacheEntry struct {
+	pipelines []*Pipeline
+	loadedAt  time.Time
+}
+
+// Runner applies each project's enabled pipelines to app logs before they
+// are queued
+type Runner struct {
+	db    *gorm.DB
+	mu    sync.RWMutex
+	cache map[string]cacheEntry
+}
+
+func NewRunner(db *gorm.DB) *Runner {
+	return &Runner{
+		db:    db,
+		cache: make(map[string]cacheEntry),
+	}
+}
+
+// Load returns the compiled enabled pipelines of a project in position order
+func (r *Runner) Load(ctx context.Context, projectID string) ([]*Pipeline, error) {
+	r.mu.RLock()
+	entry, ok := r.cache[projectID]
+	r.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.pipelines, nil
+	}
+
+	var stored []models.Pipeline
+	if err := r.db.WithContext(ctx).
+		Where("project_id = ? AND enabled = ?", projectID, true).
+		Order("position ASC, created_at ASC").
+		Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	pipelines := make([]*Pipeline, 0, len(stored))
+	for _, p := range stored {
+		compiled, err := CompileJSON([]byte(p.Processors))
+		if err != nil {
+			// Processors are validated on save, skip anything that no
+			// longer compiles rather than blocking ingest
+			log.Printf("Skipping pipeline %s: %v", p.ID, err)
+			continue
+		}
+		pipelines = append(pipelines, compiled)
+	}
+
+	r.mu.Lock()
+	r.cache[projectID] = cacheEntry{pipelines: pipelines, loadedAt: time.Now()}
+	r.mu.Unlock()
+
+	return pipelines, nil
+}
+
+// Invalidate drops the cached pipelines of a project
+func (r *Runner) Invalidate(projectID string) {
+	r.mu.Lock()
+	delete(r.cache, projectID)
+	r.mu.Unlock()
+}
+
+// ProcessAppLog implements queue.AppLogProcessor. Logs are kept unchanged
+// when pipelines cannot be loaded.
+func (r *Runner) ProcessAppLog(ctx context.Context, appLog *tsmodels.AppLog) bool {
+	pipelines, err := r.Load(ctx, appLog.ProjectID)
+	if err != nil {
+		log.Printf("Error loading pipelines for project %s: %v", appLog.ProjectID, err)
+		return true
+	}
+	if len(pipelines) == 0 {
+		return true
+	}
+
+	result := Run(appLog, pipelines...)
+	for _, e := range result.Errors {
+		log.Printf("Pipeline error for project %s: %s", appLog.ProjectID, e)
+	}
+	return !result.Dropped
+}
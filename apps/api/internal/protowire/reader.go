@@ -0,0 +1,90 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Wire types of the protobuf encoding
+const (
+	WireVarint = 0
+	WireI64    = 1
+	WireBytes  = 2
+	WireI32    = 5
+)
+
+// Reader is a minimal protobuf wire format reader for hand written decoders
+// that only need a handful of fields from a message
+type Reader struct {
+	buf []byte
+}
+
+func NewReader(data []byte) *Reader {
+	return &Reader{buf: data}
+}
+
+func (r *Reader) Done() bool {
+	return len(r.buf) == 0
+}
+
+func (r *Reader) Varint() (uint64, error) {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid varint")
+	}
+	r.buf = r.buf[n:]
+	return v, nil
+}
+
+// Tag reads a field key, returning the field number and wire type
+func (r *Reader) Tag() (int, int, error) {
+	v, err := r.Varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (r *Reader) Bytes() ([]byte, error) {
+	length, err := r.Varint()
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(len(r.buf)) {
+		return nil, fmt.Errorf("truncated message")
+	}
+	b := r.buf[:length]
+	r.buf = r.buf[length:]
+	return b, nil
+}
+
+func (r *Reader) Fixed64() (uint64, error) {
+	if len(r.buf) < 8 {
+		return 0, fmt.Errorf("truncated message")
+	}
+	v := binary.LittleEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v, nil
+}
+
+func (r *Reader) Skip(wireType int) error {
+	switch wireType {
+	case WireVarint:
+		_, err := r.Varint()
+		return err
+	case WireI64:
+		_, err := r.Fixed64()
+		return err
+	case WireBytes:
+		_, err := r.Bytes()
+		return err
+	case WireI32:
+		if len(r.buf) < 4 {
+			return fmt.Errorf("truncated message")
+		}
+		r.buf = r.buf[4:]
+	default:
+		return fmt.Errorf("unsupported wire type %d", wireType)
+	}
+	return nil
+}
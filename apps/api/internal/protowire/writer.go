@@ -0,0 +1,59 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Writer is a minimal protobuf wire format writer for hand written encoders
+type Writer struct {
+	buf []byte
+}
+
+func (w *Writer) tag(field int, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (w *Writer) Varint(field int, v uint64) {
+	w.tag(field, WireVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *Writer) Bool(field int, v bool) {
+	var n uint64
+	if v {
+		n = 1
+	}
+	w.Varint(field, n)
+}
+
+func (w *Writer) Fixed64(field int, v uint64) {
+	w.tag(field, WireI64)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, v)
+}
+
+func (w *Writer) Double(field int, v float64) {
+	w.Fixed64(field, math.Float64bits(v))
+}
+
+func (w *Writer) Bytes(field int, b []byte) {
+	w.tag(field, WireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *Writer) String(field int, s string) {
+	w.tag(field, WireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// Message writes an embedded message encoded by m
+func (w *Writer) Message(field int, m *Writer) {
+	w.Bytes(field, m.buf)
+}
+
+// Encoded returns the encoded message
+func (w *Writer) Encoded() []byte {
+	return w.buf
+}
@@ -2,6 +2,7 @@ package queue
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -12,8 +13,68 @@ import (
 	"github.com/ted-too/logsicle/internal/storage/timescale/models"
 )
 
+// TraceSampler holds back spans until their trace has been sampled
+type TraceSampler interface {
+	// Sample returns the spans to insert now and buffers the rest, returning
+	// the stream message IDs of the buffered spans. Those messages are left
+	// in the stream until their trace is decided, and spans read again from
+	// a message that is already buffered are not buffered twice.
+	Sample(ctx context.Context, spans []*models.Trace, messageIDs []string) (insert []*models.Trace, held []string)
+	// Run decides buffered traces until ctx is done, calling commit with
+	// every decided trace. Buffered messages are only acknowledged by commit.
+	Run(ctx context.Context, commit func(context.Context, []SampledTrace) error)
+	// Stats returns kept and dropped counts for the internal metrics
+	Stats() map[string]interface{}
+}
+
+// SampledTrace is a trace decided by the sampler, with the stream messages
+// its buffered spans were read from
+type SampledTrace struct {
+	Keep       bool
+	Spans      []*models.Trace
+	MessageIDs []string
+}
+
+// SpanMetricsAggregator derives metrics from spans
+type SpanMetricsAggregator interface {
+	Add(spans []*models.Trace)
+	// Run inserts the aggregated metrics until ctx is done
+	Run(ctx context.Context, insert func(context.Context, []*models.Metric) error)
+}
+
+// MetricLimiter enforces series limits on metrics before they are inserted
+type MetricLimiter interface {
+	// Limit returns the metrics to insert, the rest are dropped. The series,
+	// drops and warnings of the call are only recorded by commit, which is
+	// called once the metrics are inserted.
+	Limit(ctx context.Context, metrics []*models.Metric) (insert []*models.Metric, commit func())
+	// Run expires inactive series until ctx is done
+	Run(ctx context.Context)
+	// Stats returns tracked series and dropped counts for the internal metrics
+	Stats() map[string]interface{}
+}
+
+// MetricCatalog records the metrics that are inserted
+type MetricCatalog interface {
+	Observe(metrics []*models.Metric)
+	// Run writes the observed metrics until ctx is done
+	Run(ctx context.Context)
+}
+
+// IssueTracker groups app logs carrying an exception into issues
+type IssueTracker interface {
+	// Record returns the issue ID of an app log, or an empty string when it
+	// has no exception
+	Record(ctx context.Context, log *models.AppLog) (string, error)
+}
+
 type Processor struct {
 	qs              *QueueService
+	issueTracker    IssueTracker
+	sampler         TraceSampler
+	spanMetrics     SpanMetricsAggregator
+	metricLimiter   MetricLimiter
+	metricCatalog   MetricCatalog
 	processedCount  map[string]int64
 	errorCount      map[string]int64
 	lastProcessTime map[string]time.Time
@@ -24,6 +85,15 @@ type Processor struct {
 type processorConfig[T models.LogEntry] struct {
 	stream     string
 	bulkInsert func(context.Context, []T) error
+	// filter optionally decides which items of a batch to insert. Messages
+	// missing from ack are left in the stream for the filter to acknowledge
+	// later. commit, when not nil, applies the filter's side effects once
+	// the items are stored, so they are not repeated when an insert fails
+	// and the batch is retried.
+	filter func(ctx context.Context, items []T, messageIDs []string) (insert []T, ack []string, commit func())
+	// afterInsert optionally runs once items are stored, before they are
+	// published, for the same reason
+	afterInsert func(context.Context, []T)
 }
 
 // streamProcessor is a generic processor for a specific type
@@ -42,6 +112,33 @@ func NewProcessor(qs *QueueService) *Processor {
 	}
 }
 
+// UseIssueTracker groups app logs into issues once they are inserted
+func (p *Processor) UseIssueTracker(t IssueTracker) {
+	p.issueTracker = t
+}
+
+// UseTraceSampler tail samples spans before they are inserted
+func (p *Processor) UseTraceSampler(s TraceSampler) {
+	p.sampler = s
+}
+
+// UseSpanMetrics aggregates metrics from every span read from the trace
+// stream
+func (p *Processor) UseSpanMetrics(a SpanMetricsAggregator) {
+	p.spanMetrics = a
+}
+
+// UseMetricLimiter enforces cardinality limits on metrics read from the
+// metric stream
+func (p *Processor) UseMetricLimiter(l MetricLimiter) {
+	p.metricLimiter = l
+}
+
+// UseMetricCatalog records every inserted metric in the catalog
+func (p *Processor) UseMetricCatalog(c MetricCatalog) {
+	p.metricCatalog = c
+}
+
 func (p *Processor) Start(ctx context.Context) {
 	go p.processEventLogs(ctx)
 	go p.processAppLogs(ctx)
@@ -59,10 +156,14 @@ func newStreamProcessor[T models.LogEntry](p *Processor, cfg processorConfig[T])
 	}
 }
 
-// process handles the common Redis stream processing logic
+// process handles the common Redis stream processing logic. Reading starts
+// at the beginning of the stream, so messages left unacknowledged by a
+// previous run are processed again, then follows the last batch processed
+// so messages held back by a filter are not read again.
 func (sp *streamProcessor[T]) process(ctx context.Context) {
 	backoff := time.Second
 	maxBackoff := time.Minute
+	lastID := "0"
 
 	for {
 		select {
@@ -70,7 +171,7 @@ func (sp *streamProcessor[T]) process(ctx context.Context) {
 			return
 		default:
 			streams, err := sp.qs.Redis.XRead(ctx, &redis.XReadArgs{
-				Streams: []string{sp.cfg.stream, "0"},
+				Streams: []string{sp.cfg.stream, lastID},
 				Count:   BatchSize,
 				Block:   time.Second * 1,
 			}).Result()
@@ -88,14 +189,18 @@ func (sp *streamProcessor[T]) process(ctx context.Context) {
 			// Reset backoff on successful read
 			backoff = time.Second
 
-			// Process batch with retries
-			if err := sp.processBatch(ctx, streams[0].Messages); err != nil {
+			// Failed batches are read again from the same position
+			messages := streams[0].Messages
+			if err := sp.processBatch(ctx, messages); err != nil {
 				sp.processor.incrementErrorCount(sp.cfg.stream)
 				log.Printf("Error processing batch for %s: %v", sp.cfg.stream, err)
 				continue
 			}
+			if len(messages) > 0 {
+				lastID = messages[len(messages)-1].ID
+			}
 
-			sp.processor.updateInternalMetrics(sp.cfg.stream, len(streams[0].Messages))
+			sp.processor.updateInternalMetrics(sp.cfg.stream, len(messages))
 		}
 	}
 }
@@ -116,12 +221,14 @@ func (sp *streamProcessor[T]) processWithRecovery(ctx context.Context) {
 func (sp *streamProcessor[T]) processBatch(ctx context.Context, messages []redis.XMessage) error {
 	var batch []T
 	var messageIDs []string
+	var invalid []string
 
 	for _, msg := range messages {
 		data := msg.Values["data"].(string)
 		var item T
 		if err := json.Unmarshal([]byte(data), &item); err != nil {
 			log.Printf("Error unmarshaling data from stream %s: %v", sp.cfg.stream, err)
+			invalid = append(invalid, msg.ID)
 			continue
 		}
 
@@ -129,29 +236,47 @@ func (sp *streamProcessor[T]) processBatch(ctx context.Context, messages []redis
 		messageIDs = append(messageIDs, msg.ID)
 	}
 
-	if len(batch) > 0 {
-		if err := sp.cfg.bulkInsert(ctx, batch); err != nil {
+	insert, ack := batch, messageIDs
+	var commit func()
+	if len(batch) > 0 && sp.cfg.filter != nil {
+		insert, ack, commit = sp.cfg.filter(ctx, batch, messageIDs)
+	}
+
+	if len(insert) > 0 {
+		if err := sp.cfg.bulkInsert(ctx, insert); err != nil {
 			return err
 		}
-
-		// Publish to Redis for live updates
-		for _, item := range batch {
-			data, err := json.Marshal(item)
-			if err != nil {
-				continue
-			}
-
-			channel := fmt.Sprintf("logs:%s:%s", item.GetProjectID(), item.GetLogType())
-			sp.qs.Redis.Publish(ctx, channel, string(data))
+		if sp.cfg.afterInsert != nil {
+			sp.cfg.afterInsert(ctx, insert)
 		}
+		publishLive(ctx, sp.qs, insert)
+	}
+	if commit != nil {
+		commit()
+	}
 
-		// Acknowledge processed messages
-		sp.qs.Redis.XDel(ctx, sp.cfg.stream, messageIDs...)
+	// Acknowledge processed messages, and messages that can never be
+	ack = append(ack, invalid...)
+	if len(ack) > 0 {
+		sp.qs.Redis.XDel(ctx, sp.cfg.stream, ack...)
 	}
 
 	return nil
 }
 
+// publishLive publishes inserted items to Redis for live updates
+func publishLive[T models.LogEntry](ctx context.Context, qs *QueueService, items []T) {
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+
+		channel := fmt.Sprintf("logs:%s:%s", item.GetProjectID(), item.GetLogType())
+		qs.Redis.Publish(ctx, channel, string(data))
+	}
+}
+
 // Metrics methods on the main Processor
 func (p *Processor) updateInternalMetrics(stream string, count int) {
 	p.mu.Lock()
@@ -170,11 +295,18 @@ func (p *Processor) GetInternalMetrics() map[string]interface{} {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	return map[string]interface{}{
+	metrics := map[string]interface{}{
 		"processed_count":   p.processedCount,
 		"error_count":       p.errorCount,
 		"last_process_time": p.lastProcessTime,
 	}
+	if p.sampler != nil {
+		metrics["trace_sampling"] = p.sampler.Stats()
+	}
+	if p.metricLimiter != nil {
+		metrics["metric_cardinality"] = p.metricLimiter.Stats()
+	}
+	return metrics
 }
 
 // Type-specific processors
@@ -191,6 +323,9 @@ func (p *Processor) processAppLogs(ctx context.Context) {
 		stream:     AppLogStream,
 		bulkInsert: p.qs.ts.BulkInsertAppLogs,
 	}
+	if p.issueTracker != nil {
+		cfg.afterInsert = p.groupIssues
+	}
 	newStreamProcessor(p, cfg).processWithRecovery(ctx)
 }
 
@@ -207,6 +342,15 @@ func (p *Processor) processMetrics(ctx context.Context) {
 		stream:     MetricStream,
 		bulkInsert: p.qs.ts.BulkInsertMetrics,
 	}
+	if p.metricLimiter != nil {
+		go p.metricLimiter.Run(ctx)
+	}
+	if p.metricCatalog != nil {
+		go p.metricCatalog.Run(ctx)
+	}
+	if p.metricLimiter != nil || p.metricCatalog != nil {
+		cfg.filter = p.filterMetrics
+	}
 	newStreamProcessor(p, cfg).processWithRecovery(ctx)
 }
 
@@ -215,9 +359,142 @@ func (p *Processor) processTraces(ctx context.Context) {
 		stream:     TraceStream,
 		bulkInsert: p.qs.ts.BulkInsertTraces,
 	}
+	if p.sampler != nil {
+		go p.sampler.Run(ctx, p.commitSampledTraces)
+	}
+	if p.spanMetrics != nil {
+		go p.spanMetrics.Run(ctx, p.insertSpanMetrics)
+	}
+	if p.sampler != nil || p.spanMetrics != nil {
+		cfg.filter = p.filterTraces
+	}
 	newStreamProcessor(p, cfg).processWithRecovery(ctx)
 }
 
+// groupIssues records the issues of inserted app logs and links the logs to
+// them. Logs stay stored without an issue when grouping fails.
+func (p *Processor) groupIssues(ctx context.Context, logs []*models.AppLog) {
+	var grouped []*models.AppLog
+	for _, appLog := range logs {
+		issueID, err := p.issueTracker.Record(ctx, appLog)
+		if err != nil {
+			log.Printf("Error grouping app log into issue for project %s: %v", appLog.ProjectID, err)
+			continue
+		}
+		if issueID != "" {
+			appLog.IssueID = sql.NullString{String: issueID, Valid: true}
+			grouped = append(grouped, appLog)
+		}
+	}
+
+	if len(grouped) > 0 {
+		if err := p.qs.ts.UpdateAppLogIssues(ctx, grouped); err != nil {
+			log.Printf("Error linking app logs to issues: %v", err)
+		}
+	}
+}
+
+// filterTraces holds back spans awaiting a sampling decision. Span metrics
+// are aggregated from every span whose fate is settled, inserted or not, so
+// rates are not skewed by dropped traces. Held spans are aggregated once
+// their trace is decided.
+func (p *Processor) filterTraces(ctx context.Context, spans []*models.Trace, messageIDs []string) ([]*models.Trace, []string, func()) {
+	if p.sampler == nil {
+		return spans, messageIDs, p.addSpanMetrics(spans)
+	}
+
+	insert, held := p.sampler.Sample(ctx, spans, messageIDs)
+	if len(held) == 0 {
+		return insert, messageIDs, p.addSpanMetrics(spans)
+	}
+
+	isHeld := make(map[string]bool, len(held))
+	for _, id := range held {
+		isHeld[id] = true
+	}
+	var ack []string
+	var settled []*models.Trace
+	for i, id := range messageIDs {
+		if !isHeld[id] {
+			ack = append(ack, id)
+			settled = append(settled, spans[i])
+		}
+	}
+	return insert, ack, p.addSpanMetrics(settled)
+}
+
+// addSpanMetrics returns a commit func aggregating span metrics from spans
+func (p *Processor) addSpanMetrics(spans []*models.Trace) func() {
+	if p.spanMetrics == nil || len(spans) == 0 {
+		return nil
+	}
+	return func() { p.spanMetrics.Add(spans) }
+}
+
+// filterMetrics drops metrics beyond their series limit. The limiter and
+// catalog record the rest once they are inserted.
+func (p *Processor) filterMetrics(ctx context.Context, metrics []*models.Metric, messageIDs []string) ([]*models.Metric, []string, func()) {
+	var limited func()
+	if p.metricLimiter != nil {
+		metrics, limited = p.metricLimiter.Limit(ctx, metrics)
+	}
+	return metrics, messageIDs, func() {
+		if limited != nil {
+			limited()
+		}
+		if p.metricCatalog != nil {
+			p.metricCatalog.Observe(metrics)
+		}
+	}
+}
+
+// insertSpanMetrics inserts metrics derived from spans
+func (p *Processor) insertSpanMetrics(ctx context.Context, metrics []*models.Metric) error {
+	if err := p.qs.ts.BulkInsertMetrics(ctx, metrics); err != nil {
+		p.incrementErrorCount(MetricStream)
+		return err
+	}
+	if p.metricCatalog != nil {
+		p.metricCatalog.Observe(metrics)
+	}
+	publishLive(ctx, p.qs, metrics)
+	return nil
+}
+
+// commitSampledTraces inserts the spans of kept traces, then aggregates
+// span metrics from every decided trace and acknowledges their messages.
+// When the insert fails nothing is acknowledged, and the messages are
+// sampled again when the processor restarts.
+func (p *Processor) commitSampledTraces(ctx context.Context, traces []SampledTrace) error {
+	var kept, decided []*models.Trace
+	var messageIDs []string
+	for _, trace := range traces {
+		if trace.Keep {
+			kept = append(kept, trace.Spans...)
+		}
+		decided = append(decided, trace.Spans...)
+		messageIDs = append(messageIDs, trace.MessageIDs...)
+	}
+
+	// Kept spans are inserted in one batch, so a failure leaves none of them
+	// stored to be inserted twice once the messages are sampled again
+	if len(kept) > 0 {
+		if err := p.qs.ts.BulkInsertTraces(ctx, kept); err != nil {
+			p.incrementErrorCount(TraceStream)
+			return err
+		}
+		publishLive(ctx, p.qs, kept)
+	}
+
+	if p.spanMetrics != nil {
+		p.spanMetrics.Add(decided)
+	}
+	if len(messageIDs) > 0 {
+		p.qs.Redis.XDel(ctx, TraceStream, messageIDs...)
+	}
+	return nil
+}
+
 func min(a, b time.Duration) time.Duration {
 	if a < b {
 		return a
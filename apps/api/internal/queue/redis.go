@@ -20,9 +20,23 @@ const (
 	MaxRetries       = 3
 )
 
+// AppLogProcessor transforms app logs before they are queued. Returning
+// false drops the log.
+type AppLogProcessor interface {
+	ProcessAppLog(ctx context.Context, log *models.AppLog) bool
+}
+
+// RequestLogProcessor transforms request logs before they are queued.
+// Returning false drops the log.
+type RequestLogProcessor interface {
+	ProcessRequestLog(ctx context.Context, log *models.RequestLog) bool
+}
+
 type QueueService struct {
-	Redis *redis.Client
-	ts    *timescale.TimescaleClient
+	Redis           *redis.Client
+	ts              *timescale.TimescaleClient
+	appLogHooks     []AppLogProcessor
+	requestLogHooks []RequestLogProcessor
 }
 
 func NewQueueService(redisURL string, ts *timescale.TimescaleClient) (*QueueService, error) {
@@ -38,6 +52,18 @@ func NewQueueService(redisURL string, ts *timescale.TimescaleClient) (*QueueServ
 	}, nil
 }
 
+// UseAppLogProcessor runs p on every app log before it is queued, after
+// the processors registered before it
+func (q *QueueService) UseAppLogProcessor(p AppLogProcessor) {
+	q.appLogHooks = append(q.appLogHooks, p)
+}
+
+// UseRequestLogProcessor runs p on every request log before it is queued,
+// after the processors registered before it
+func (q *QueueService) UseRequestLogProcessor(p RequestLogProcessor) {
+	q.requestLogHooks = append(q.requestLogHooks, p)
+}
+
 // EnqueueEventLog adds an event log to the queue
 func (q *QueueService) EnqueueEventLog(ctx context.Context, log *models.EventLog) error {
 	return q.enqueue(ctx, EventLogStream, log)
@@ -45,11 +71,42 @@ func (q *QueueService) EnqueueEventLog(ctx context.Context, log *models.EventLog
 
 // EnqueueAppLog adds an application log to the queue
 func (q *QueueService) EnqueueAppLog(ctx context.Context, log *models.AppLog) error {
+	if !q.processAppLog(ctx, log) {
+		return nil
+	}
 	return q.enqueue(ctx, AppLogStream, log)
 }
 
+// EnqueueAppLogs adds application logs to the queue in one transaction, so
+// either all of them are queued or none are and the sender can safely retry
+func (q *QueueService) EnqueueAppLogs(ctx context.Context, logs []*models.AppLog) error {
+	items := make([]interface{}, 0, len(logs))
+	for _, log := range logs {
+		if q.processAppLog(ctx, log) {
+			items = append(items, log)
+		}
+	}
+	return q.enqueueAll(ctx, AppLogStream, items)
+}
+
+// processAppLog runs the app log processors, reporting false when one of
+// them drops the log
+func (q *QueueService) processAppLog(ctx context.Context, log *models.AppLog) bool {
+	for _, hook := range q.appLogHooks {
+		if !hook.ProcessAppLog(ctx, log) {
+			return false
+		}
+	}
+	return true
+}
+
 // EnqueueRequestLog adds a request log to the queue
 func (q *QueueService) EnqueueRequestLog(ctx context.Context, log *models.RequestLog) error {
+	for _, hook := range q.requestLogHooks {
+		if !hook.ProcessRequestLog(ctx, log) {
+			return nil
+		}
+	}
 	return q.enqueue(ctx, RequestLogStream, log)
 }
 
@@ -63,6 +120,16 @@ func (q *QueueService) EnqueueTrace(ctx context.Context, trace *models.Trace) er
 	return q.enqueue(ctx, TraceStream, trace)
 }
 
+// EnqueueTraces adds traces to the queue in one transaction, so either all
+// of them are queued or none are and the sender can safely retry
+func (q *QueueService) EnqueueTraces(ctx context.Context, traces []*models.Trace) error {
+	items := make([]interface{}, len(traces))
+	for i, trace := range traces {
+		items[i] = trace
+	}
+	return q.enqueueAll(ctx, TraceStream, items)
+}
+
 // Generic enqueue function
 func (q *QueueService) enqueue(ctx context.Context, stream string, data interface{}) error {
 	jsonData, err := json.Marshal(data)
@@ -78,6 +145,31 @@ func (q *QueueService) enqueue(ctx context.Context, stream string, data interfac
 	}).Err()
 }
 
+// enqueueAll adds every item to the stream in a single MULTI/EXEC
+func (q *QueueService) enqueueAll(ctx context.Context, stream string, items []interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	_, err := q.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, item := range items {
+			jsonData, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("failed to marshal data: %w", err)
+			}
+
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: stream,
+				Values: map[string]interface{}{
+					"data": jsonData,
+				},
+			})
+		}
+		return nil
+	})
+	return err
+}
+
 // Close closes all connections
 func (q *QueueService) Close() error {
 	if err := q.Redis.Close(); err != nil {
@@ -0,0 +1,86 @@
+package redaction
+
+import (
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/ted-too/logsicle/internal/storage/models"
+)
+
+// Keys, compared lowercase, whose whole value is redacted by the header
+// detectors. They apply at any depth so credentials in query params and
+// bodies are covered too.
+var detectorKeys = map[string][]string{
+	models.RedactionDetectorAuthorization: {
+		"authorization",
+		"proxy-authorization",
+		"x-api-key",
+		"api-key",
+		"api_key",
+		"apikey",
+		"x-auth-token",
+		"access_token",
+		"refresh_token",
+		"client_secret",
+		"password",
+	},
+	models.RedactionDetectorCookie: {
+		"cookie",
+		"set-cookie",
+	},
+}
+
+// valueDetector finds sensitive text inside string values. valid, when set,
+// rejects regex matches that are not real values.
+type valueDetector struct {
+	re    *regexp.Regexp
+	valid func(string) bool
+}
+
+var valueDetectors = map[string]valueDetector{
+	models.RedactionDetectorCreditCard: {
+		re:    regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		valid: luhn,
+	},
+	models.RedactionDetectorEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	models.RedactionDetectorJWT: {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	models.RedactionDetectorIP: {
+		re: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b|(?:[0-9A-Fa-f]{0,4}:){2,7}[0-9A-Fa-f]{0,4}`),
+		valid: func(s string) bool {
+			return net.ParseIP(s) != nil
+		},
+	},
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum
+func luhn(s string) bool {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,254 @@
+package redaction
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Rule types
+const (
+	RuleTypeKey   = "key"
+	RuleTypeRegex = "regex"
+)
+
+// Maximum number of custom rules per project
+const MaxRules = 100
+
+// Order built-in value detectors run in. JWTs go first so their payloads
+// are not partially matched by the other detectors.
+var valueDetectorOrder = []string{
+	models.RedactionDetectorJWT,
+	models.RedactionDetectorCreditCard,
+	models.RedactionDetectorEmail,
+	models.RedactionDetectorIP,
+}
+
+type keyRule struct {
+	name string
+	mode string
+}
+
+type valueRule struct {
+	name     string
+	mode     string
+	detector valueDetector
+}
+
+// Redactor applies a project's redaction settings to request and app logs
+type Redactor struct {
+	hashKey []byte
+	keys    map[string]keyRule
+	values  []valueRule
+	ipMode  string
+}
+
+// ModeRule validates a redaction mode
+var ModeRule = validation.In(models.RedactionModeMask, models.RedactionModeHash, models.RedactionModeRemove)
+
+// ValidateRule checks a custom rule, including that regex patterns compile
+func ValidateRule(rule models.RedactionRule) error {
+	if err := validation.ValidateStruct(&rule,
+		validation.Field(&rule.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&rule.Type, validation.Required, validation.In(RuleTypeKey, RuleTypeRegex)),
+		validation.Field(&rule.Pattern, validation.Required, validation.Length(1, 1024)),
+		validation.Field(&rule.Mode, ModeRule),
+	); err != nil {
+		return err
+	}
+
+	if rule.Type == RuleTypeRegex {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// Compile prepares settings for use. hashKey is mixed with the project ID so
+// hashed values cannot be correlated across projects.
+func Compile(settings models.RedactionSettings, hashKey string) (*Redactor, error) {
+	r := &Redactor{
+		hashKey: []byte(hashKey + ":" + settings.ProjectID),
+		keys:    make(map[string]keyRule),
+		ipMode:  settings.IPAnonymization,
+	}
+	// IP anonymization is configured separately and applies either way
+	if !settings.Enabled {
+		return r, nil
+	}
+
+	for name, keys := range detectorKeys {
+		if !slices.Contains(settings.Detectors, name) {
+			continue
+		}
+		for _, key := range keys {
+			r.keys[key] = keyRule{name: name, mode: settings.Mode}
+		}
+	}
+	for _, name := range valueDetectorOrder {
+		if slices.Contains(settings.Detectors, name) {
+			r.values = append(r.values, valueRule{name: name, mode: settings.Mode, detector: valueDetectors[name]})
+		}
+	}
+
+	var rules []models.RedactionRule
+	if err := json.Unmarshal([]byte(settings.Rules), &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	for i, rule := range rules {
+		if err := ValidateRule(rule); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i, rule.Name, err)
+		}
+		mode := rule.Mode
+		if mode == "" {
+			mode = settings.Mode
+		}
+
+		switch rule.Type {
+		case RuleTypeKey:
+			r.keys[strings.ToLower(rule.Pattern)] = keyRule{name: rule.Name, mode: mode}
+		case RuleTypeRegex:
+			r.values = append(r.values, valueRule{
+				name:     rule.Name,
+				mode:     mode,
+				detector: valueDetector{re: regexp.MustCompile(rule.Pattern)},
+			})
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// replacement returns what a matched value is replaced with
+func (r *Redactor) replacement(name, mode, value string) string {
+	switch mode {
+	case models.RedactionModeHash:
+		return "[" + name + ":" + r.hash(value) + "]"
+	case models.RedactionModeRemove:
+		return ""
+	default:
+		return "[REDACTED:" + name + "]"
+	}
+}
+
+// String redacts sensitive text inside s
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.values {
+		s = rule.detector.re.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.detector.valid != nil && !rule.detector.valid(match) {
+				return match
+			}
+			return r.replacement(rule.name, rule.mode, match)
+		})
+	}
+	return s
+}
+
+// Value redacts a decoded JSON value in place where possible and returns
+// the result
+func (r *Redactor) Value(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			rule, ok := r.keys[strings.ToLower(key)]
+			if !ok {
+				v[key] = r.Value(inner)
+				continue
+			}
+			if rule.mode == models.RedactionModeRemove {
+				delete(v, key)
+				continue
+			}
+			raw, isString := inner.(string)
+			if !isString {
+				b, _ := json.Marshal(inner)
+				raw = string(b)
+			}
+			v[key] = r.replacement(rule.name, rule.mode, raw)
+		}
+		return v
+	case []any:
+		for i, inner := range v {
+			v[i] = r.Value(inner)
+		}
+		return v
+	case string:
+		return r.String(v)
+	default:
+		return v
+	}
+}
+
+func (r *Redactor) jsonb(data tsmodels.JSONB) tsmodels.JSONB {
+	if len(data) == 0 {
+		return data
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return data
+	}
+	return tsmodels.ConvertToJSONB(r.Value(value))
+}
+
+// AnonymizeIP applies the IP anonymization mode to an address
+func (r *Redactor) AnonymizeIP(address string) string {
+	switch r.ipMode {
+	case models.IPAnonymizationTruncate:
+		ip := net.ParseIP(address)
+		if ip == nil {
+			return address
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	case models.IPAnonymizationHash:
+		return r.hash(address)
+	case models.IPAnonymizationRemove:
+		return ""
+	default:
+		return address
+	}
+}
+
+// RedactRequestLog redacts headers, query params, bodies, the path and the
+// error of a request log and anonymizes its IP address
+func (r *Redactor) RedactRequestLog(log *tsmodels.RequestLog) {
+	if len(r.keys) > 0 || len(r.values) > 0 {
+		log.Headers = r.jsonb(log.Headers)
+		log.QueryParams = r.jsonb(log.QueryParams)
+		log.RequestBody = r.jsonb(log.RequestBody)
+		log.ResponseBody = r.jsonb(log.ResponseBody)
+		log.Path = r.String(log.Path)
+		log.Error = r.String(log.Error)
+	}
+	log.IPAddress = r.AnonymizeIP(log.IPAddress)
+}
+
+// RedactAppLog redacts the message, fields and captured exception of an app
+// log
+func (r *Redactor) RedactAppLog(log *tsmodels.AppLog) {
+	if len(r.keys) == 0 && len(r.values) == 0 {
+		return
+	}
+	log.Message = r.String(log.Message)
+	log.Fields = r.jsonb(log.Fields)
+	log.Exception = r.jsonb(log.Exception)
+}
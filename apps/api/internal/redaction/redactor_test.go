@@ -0,0 +1,47 @@
+package redaction
+
+import (
+	"testing"
+
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+func TestDefaultSettings(t *testing.T) {
+	r, err := Compile(models.DefaultRedactionSettings("project"), "key")
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	// A nanosecond timestamp that passes the Luhn check
+	const timestamp = "1760709600123456781"
+	if !luhn(timestamp) {
+		t.Fatalf("%s does not pass the Luhn check", timestamp)
+	}
+
+	log := &tsmodels.RequestLog{
+		Path: "/orders?since=" + timestamp,
+		Headers: tsmodels.ConvertToJSONB(map[string]any{
+			"Authorization":   "Bearer secret",
+			"Cookie":          "session=secret",
+			"X-Request-Start": timestamp,
+		}),
+		RequestBody: tsmodels.ConvertToJSONB(map[string]any{"ts": timestamp}),
+	}
+	r.RedactRequestLog(log)
+
+	if log.Path != "/orders?since="+timestamp {
+		t.Errorf("path = %q, want the timestamp kept", log.Path)
+	}
+	want := tsmodels.ConvertToJSONB(map[string]any{
+		"Authorization":   "[REDACTED:authorization]",
+		"Cookie":          "[REDACTED:cookie]",
+		"X-Request-Start": timestamp,
+	})
+	if string(log.Headers) != string(want) {
+		t.Errorf("headers = %s, want %s", log.Headers, want)
+	}
+	if want := tsmodels.ConvertToJSONB(map[string]any{"ts": timestamp}); string(log.RequestBody) != string(want) {
+		t.Errorf("request body = %s, want %s", log.RequestBody, want)
+	}
+}
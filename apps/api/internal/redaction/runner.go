@@ -0,0 +1,98 @@
+package redaction
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// How long a project's compiled settings are reused before reloading
+const cacheTTL = 30 * time.Second
+
+type cacheEntry struct {
+	redactor *Redactor
+	loadedAt time.Time
+}
+
+// Runner redacts request and app logs with their project's settings before
+// they are queued
+type Runner struct {
+	db      *gorm.DB
+	hashKey string
+	mu      sync.RWMutex
+	cache   map[string]cacheEntry
+}
+
+func NewRunner(db *gorm.DB, hashKey string) *Runner {
+	return &Runner{
+		db:      db,
+		hashKey: hashKey,
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+// Load returns the compiled redaction settings of a project, or the defaults
+// when none are stored
+func (r *Runner) Load(ctx context.Context, projectID string) (*Redactor, error) {
+	r.mu.RLock()
+	entry, ok := r.cache[projectID]
+	r.mu.RUnlock()
+	if ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.redactor, nil
+	}
+
+	settings := models.DefaultRedactionSettings(projectID)
+	if err := r.db.WithContext(ctx).Where("project_id = ?", projectID).First(&settings).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	redactor, err := Compile(settings, r.hashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[projectID] = cacheEntry{redactor: redactor, loadedAt: time.Now()}
+	r.mu.Unlock()
+
+	return redactor, nil
+}
+
+// Invalidate drops the cached settings of a project
+func (r *Runner) Invalidate(projectID string) {
+	r.mu.Lock()
+	delete(r.cache, projectID)
+	r.mu.Unlock()
+}
+
+// loadOrDefault returns the redactor of a project. When settings cannot be
+// loaded the built-in defaults still apply, so credentials are never stored
+// unredacted.
+func (r *Runner) loadOrDefault(ctx context.Context, projectID string) *Redactor {
+	redactor, err := r.Load(ctx, projectID)
+	if err != nil {
+		log.Printf("Error loading redaction settings for project %s: %v", projectID, err)
+		redactor, _ = Compile(models.DefaultRedactionSettings(projectID), r.hashKey)
+	}
+	return redactor
+}
+
+// ProcessRequestLog implements queue.RequestLogProcessor
+func (r *Runner) ProcessRequestLog(ctx context.Context, requestLog *tsmodels.RequestLog) bool {
+	r.loadOrDefault(ctx, requestLog.ProjectID).RedactRequestLog(requestLog)
+	return true
+}
+
+// ProcessAppLog implements queue.AppLogProcessor
+func (r *Runner) ProcessAppLog(ctx context.Context, appLog *tsmodels.AppLog) bool {
+	r.loadOrDefault(ctx, appLog.ProjectID).RedactAppLog(appLog)
+	return true
+}
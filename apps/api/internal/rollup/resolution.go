@@ -0,0 +1,131 @@
+package rollup
+
+import (
+	"fmt"
+	"time"
+)
+
+// Resolution is a level of metric rollups. Each rollup is computed from
+// the resolution below it, the finest from raw metric points.
+type Resolution struct {
+	Name  string
+	Table string
+	// Width of a rollup bucket, 0 for raw points
+	Step time.Duration
+	// How long after a bucket ends it is rolled up, so late points of the
+	// resolution below are included
+	Lag time.Duration
+	// Longest source window rolled up by one statement
+	MaxWindow time.Duration
+	// Matches the table's retention policy
+	Retention time.Duration
+	// Longest query range answered from this resolution
+	MaxQueryRange time.Duration
+
+	source *Resolution
+}
+
+var (
+	Raw = &Resolution{
+		Name:          "raw",
+		Table:         "metrics",
+		Retention:     90 * 24 * time.Hour,
+		MaxQueryRange: 6 * time.Hour,
+	}
+	Minute = &Resolution{
+		Name:          "1m",
+		Table:         "metric_rollups_1m",
+		Step:          time.Minute,
+		Lag:           2 * time.Minute,
+		MaxWindow:     6 * time.Hour,
+		Retention:     30 * 24 * time.Hour,
+		MaxQueryRange: 3 * 24 * time.Hour,
+		source:        Raw,
+	}
+	Hour = &Resolution{
+		Name:          "1h",
+		Table:         "metric_rollups_1h",
+		Step:          time.Hour,
+		Lag:           10 * time.Minute,
+		MaxWindow:     7 * 24 * time.Hour,
+		Retention:     395 * 24 * time.Hour,
+		MaxQueryRange: 180 * 24 * time.Hour,
+		source:        Minute,
+	}
+	Day = &Resolution{
+		Name:      "1d",
+		Table:     "metric_rollups_1d",
+		Step:      24 * time.Hour,
+		Lag:       2 * time.Hour,
+		MaxWindow: 90 * 24 * time.Hour,
+		Retention: 1825 * 24 * time.Hour,
+		source:    Hour,
+	}
+)
+
+// Resolutions from finest to coarsest
+var Resolutions = []*Resolution{Raw, Minute, Hour, Day}
+
+// Lookup returns a resolution by name
+func Lookup(name string) (*Resolution, bool) {
+	for _, r := range Resolutions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// ForRange picks the finest resolution that answers a query range: one
+// still retaining start and meant for ranges of its length
+func ForRange(start, end, now time.Time) *Resolution {
+	for _, r := range Resolutions {
+		if start.Before(now.Add(-r.Retention)) {
+			continue
+		}
+		if r.MaxQueryRange == 0 || end.Sub(start) <= r.MaxQueryRange {
+			return r
+		}
+	}
+	return Day
+}
+
+// rawSource maps raw metric points to the columns of a rollup, so rollups
+// and queries aggregate raw points and rollups the same way
+const rawSource = `(
+	SELECT
+		timestamp AS bucket, project_id, name, type, unit, service_name, attributes,
+		aggregation_temporality, is_monotonic,
+		md5(type::text || aggregation_temporality::text || COALESCE(attributes::text, '') || COALESCE(bounds::text, '')) AS series_key,
+		value AS last_value, value AS value_sum, value AS value_min, value AS value_max, 1::bigint AS point_count,
+		bounds, bucket_counts, count, sum
+	FROM metrics
+)`
+
+// Source returns the relation queried for the resolution, with rollup
+// columns
+func (r *Resolution) Source() string {
+	if r == Raw {
+		return rawSource
+	}
+	return r.Table
+}
+
+// Aggregates merges the rollup columns of a group of rows by type: values
+// keep their last, sum, min and max, delta histograms sum their counts and
+// buckets, and cumulative histograms and summaries keep their latest state.
+// The group must include aggregation_temporality.
+const Aggregates = `
+	last(last_value, bucket) AS last_value,
+	sum(value_sum) AS value_sum,
+	min(value_min) AS value_min,
+	max(value_max) AS value_max,
+	sum(point_count)::bigint AS point_count,
+	CASE WHEN aggregation_temporality = 'DELTA' THEN metric_bucket_counts_sum(bucket_counts) ELSE last(bucket_counts, bucket) END AS bucket_counts,
+	CASE WHEN aggregation_temporality = 'DELTA' THEN sum(count)::bigint ELSE last(count, bucket) END AS count,
+	CASE WHEN aggregation_temporality = 'DELTA' THEN sum(sum) ELSE last(sum, bucket) END AS sum`
+
+// IntervalLiteral formats a duration as a Postgres interval
+func IntervalLiteral(d time.Duration) string {
+	return fmt.Sprintf("INTERVAL '%d seconds'", int64(d/time.Second))
+}
@@ -0,0 +1,139 @@
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// How often rollups are brought up to date
+const runInterval = time.Minute
+
+// Advisory lock held while rolling up, so only one instance does the work
+const advisoryLockKey = 7305423101
+
+// Roller keeps the rollup tables up to date. Each run continues from the
+// latest rollup bucket, re-rolling it, up to the last bucket that ended
+// longer than the lag ago. Points arriving for older buckets, e.g. with
+// backfilled timestamps, are not rolled up.
+type Roller struct {
+	pool *pgxpool.Pool
+}
+
+func NewRoller(pool *pgxpool.Pool) *Roller {
+	return &Roller{pool: pool}
+}
+
+// Run rolls up metrics every run interval until ctx is done
+func (r *Roller) Run(ctx context.Context) {
+	ticker := time.NewTicker(runInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.rollAll(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error rolling up metrics: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Roller) rollAll(ctx context.Context) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", advisoryLockKey).Scan(&locked); err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", advisoryLockKey)
+
+	for _, res := range Resolutions {
+		if res.source == nil {
+			continue
+		}
+		if err := r.roll(ctx, conn, res, time.Now()); err != nil {
+			return fmt.Errorf("%s rollup: %w", res.Name, err)
+		}
+	}
+	return nil
+}
+
+// roll rolls up the source of a resolution from its latest bucket to the
+// last complete one
+func (r *Roller) roll(ctx context.Context, conn *pgxpool.Conn, res *Resolution, now time.Time) error {
+	var latest *time.Time
+	if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT max(bucket) FROM %s", res.Table)).Scan(&latest); err != nil {
+		return err
+	}
+	if latest == nil {
+		// Nothing rolled up yet, start from the oldest source point
+		if err := conn.QueryRow(ctx, fmt.Sprintf("SELECT min(bucket) FROM %s AS source", res.source.Source())).Scan(&latest); err != nil {
+			return err
+		}
+		if latest == nil {
+			return nil
+		}
+	}
+
+	start := latest.Truncate(res.Step)
+	end := now.Add(-res.Lag).Truncate(res.Step)
+
+	for start.Before(end) {
+		windowEnd := start.Add(res.MaxWindow)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+		if _, err := conn.Exec(ctx, rollupSQL(res), start, windowEnd); err != nil {
+			return err
+		}
+		start = windowEnd
+	}
+	return nil
+}
+
+// rollupSQL aggregates the source points of a window into buckets,
+// replacing buckets rolled up before
+func rollupSQL(res *Resolution) string {
+	step := IntervalLiteral(res.Step)
+	return fmt.Sprintf(`
+		INSERT INTO %[1]s (
+			bucket, project_id, name, type, unit, service_name, attributes,
+			aggregation_temporality, is_monotonic, series_key, bounds,
+			last_value, value_sum, value_min, value_max, point_count,
+			bucket_counts, count, sum
+		)
+		SELECT
+			time_bucket(%[2]s, bucket), project_id, name, type, max(unit), service_name, attributes,
+			aggregation_temporality, bool_or(is_monotonic), series_key, bounds,
+			%[3]s
+		FROM %[4]s AS source
+		WHERE bucket >= $1 AND bucket < $2
+		GROUP BY time_bucket(%[2]s, bucket), project_id, name, type, service_name, attributes,
+			aggregation_temporality, series_key, bounds
+		ON CONFLICT (project_id, name, service_name, series_key, bucket) DO UPDATE SET
+			unit = EXCLUDED.unit,
+			is_monotonic = EXCLUDED.is_monotonic,
+			last_value = EXCLUDED.last_value,
+			value_sum = EXCLUDED.value_sum,
+			value_min = EXCLUDED.value_min,
+			value_max = EXCLUDED.value_max,
+			point_count = EXCLUDED.point_count,
+			bucket_counts = EXCLUDED.bucket_counts,
+			count = EXCLUDED.count,
+			sum = EXCLUDED.sum`,
+		res.Table, step, Aggregates, res.source.Source())
+}
@@ -0,0 +1,134 @@
+package sampling
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Maximum number of attribute rules per project
+const MaxAttributeRules = 50
+
+// Reasons a trace was kept
+const (
+	ReasonError         = "error"
+	ReasonLatency       = "latency"
+	ReasonAttribute     = "attribute"
+	ReasonProbabilistic = "probabilistic"
+)
+
+// ValidateAttributeRule checks a rule before it is stored
+func ValidateAttributeRule(rule models.SamplingAttributeRule) error {
+	return validation.ValidateStruct(&rule,
+		validation.Field(&rule.Key, validation.Required, validation.Length(1, 255)),
+		validation.Field(&rule.Value, validation.Length(0, 1000)),
+	)
+}
+
+// Policy is the compiled tail sampling settings of a project
+type Policy struct {
+	enabled          bool
+	keepErrors       bool
+	latencyThreshold int64
+	rules            []models.SamplingAttributeRule
+	rate             float64
+}
+
+// Compile prepares stored settings for sampling decisions
+func Compile(settings models.TraceSamplingSettings) (*Policy, error) {
+	p := &Policy{
+		enabled:          settings.Enabled,
+		keepErrors:       settings.KeepErrors,
+		latencyThreshold: settings.LatencyThresholdMs,
+		rate:             settings.SampleRate,
+	}
+	if settings.AttributeRules != "" {
+		if err := json.Unmarshal([]byte(settings.AttributeRules), &p.rules); err != nil {
+			return nil, fmt.Errorf("invalid attribute rules: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Enabled reports whether traces are buffered for a decision, disabled
+// policies keep every span as it arrives
+func (p *Policy) Enabled() bool {
+	return p.enabled
+}
+
+// Decide returns whether a trace is kept and the first policy that kept it
+func (p *Policy) Decide(traceID string, spans []*tsmodels.Trace) (bool, string) {
+	if p.keepErrors {
+		for _, span := range spans {
+			if span.Status == tsmodels.SpanStatusError {
+				return true, ReasonError
+			}
+		}
+	}
+
+	if p.latencyThreshold > 0 && traceDuration(spans) >= p.latencyThreshold {
+		return true, ReasonLatency
+	}
+
+	if len(p.rules) > 0 {
+		for _, span := range spans {
+			if p.matchesAttributes(span) {
+				return true, ReasonAttribute
+			}
+		}
+	}
+
+	if p.rate > 0 && traceRatio(traceID) < p.rate {
+		return true, ReasonProbabilistic
+	}
+	return false, ""
+}
+
+// traceDuration is the time from the first span start to the last span end
+// seen, in milliseconds
+func traceDuration(spans []*tsmodels.Trace) int64 {
+	if len(spans) == 0 {
+		return 0
+	}
+	start, end := spans[0].StartTime, spans[0].EndTime
+	for _, span := range spans[1:] {
+		if span.StartTime.Before(start) {
+			start = span.StartTime
+		}
+		if span.EndTime.After(end) {
+			end = span.EndTime
+		}
+	}
+	return end.Sub(start).Milliseconds()
+}
+
+func (p *Policy) matchesAttributes(span *tsmodels.Trace) bool {
+	var attributes, resource map[string]any
+	_ = json.Unmarshal(span.Attributes, &attributes)
+	_ = json.Unmarshal(span.ResourceAttributes, &resource)
+
+	for _, rule := range p.rules {
+		for _, attrs := range []map[string]any{attributes, resource} {
+			value, ok := attrs[rule.Key]
+			if !ok {
+				continue
+			}
+			if rule.Value == "" || fmt.Sprint(value) == rule.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// traceRatio maps a trace ID to [0, 1) deterministically, so every span of
+// a trace gets the same probabilistic decision
+func traceRatio(traceID string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(traceID))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
@@ -0,0 +1,324 @@
+package sampling
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// How long a project's compiled policy is reused before reloading
+const cacheTTL = 30 * time.Second
+
+// How long decisions are remembered for spans that arrive after their
+// trace was decided
+const decisionTTL = 5 * time.Minute
+
+// How often buffered traces are checked for a decision
+const flushInterval = time.Second
+
+type cacheEntry struct {
+	policy   *Policy
+	loadedAt time.Time
+}
+
+type bufferedTrace struct {
+	projectID string
+	traceID   string
+	firstSeen time.Time
+	policy    *Policy
+	spans     []*tsmodels.Trace
+	// Stream messages the spans were read from
+	messageIDs []string
+}
+
+type decision struct {
+	keep      bool
+	decidedAt time.Time
+}
+
+// Sampler makes tail sampling decisions. Spans of projects with sampling
+// enabled are buffered per trace for the decision window, then the whole
+// trace is kept or dropped. Buffered spans are held in memory, but their
+// stream messages are only acknowledged once the decision is written, so
+// they are sampled again after an unclean stop.
+type Sampler struct {
+	db       *gorm.DB
+	wait     time.Duration
+	maxSpans int
+
+	mu        sync.Mutex
+	cache     map[string]cacheEntry
+	traces    map[string]*bufferedTrace // by project and trace ID
+	decisions map[string]decision
+	buffered  int
+	// Messages of buffered spans and of decisions not yet committed
+	held map[string]struct{}
+	// Decisions whose commit failed, retried on the next flush
+	uncommitted []queue.SampledTrace
+
+	keptTraces    int64
+	droppedTraces int64
+	keptSpans     int64
+	droppedSpans  int64
+	keptBy        map[string]int64
+}
+
+func NewSampler(db *gorm.DB, wait time.Duration, maxSpans int) *Sampler {
+	return &Sampler{
+		db:        db,
+		wait:      wait,
+		maxSpans:  maxSpans,
+		cache:     make(map[string]cacheEntry),
+		traces:    make(map[string]*bufferedTrace),
+		decisions: make(map[string]decision),
+		held:      make(map[string]struct{}),
+		keptBy:    make(map[string]int64),
+	}
+}
+
+// Load returns the compiled sampling policy of a project, or the defaults
+// when none are stored
+func (s *Sampler) Load(ctx context.Context, projectID string) (*Policy, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[projectID]
+	s.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.policy, nil
+	}
+
+	settings := models.DefaultTraceSamplingSettings(projectID)
+	if err := s.db.WithContext(ctx).Where("project_id = ?", projectID).First(&settings).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	policy, err := Compile(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[projectID] = cacheEntry{policy: policy, loadedAt: time.Now()}
+	s.mu.Unlock()
+
+	return policy, nil
+}
+
+// Invalidate drops the cached policy of a project
+func (s *Sampler) Invalidate(projectID string) {
+	s.mu.Lock()
+	delete(s.cache, projectID)
+	s.mu.Unlock()
+}
+
+func traceKey(projectID, traceID string) string {
+	return projectID + "\x00" + traceID
+}
+
+// Sample implements queue.TraceSampler. It returns the spans to insert
+// now: spans of projects without sampling and late spans of kept traces.
+// Other spans are buffered until their trace is decided, and their message
+// IDs are returned as held.
+func (s *Sampler) Sample(ctx context.Context, spans []*tsmodels.Trace, messageIDs []string) ([]*tsmodels.Trace, []string) {
+	var pass []*tsmodels.Trace
+	var held []string
+	for i, span := range spans {
+		messageID := messageIDs[i]
+		policy, err := s.Load(ctx, span.ProjectID)
+		if err != nil {
+			// Keep spans rather than losing them to a settings error
+			log.Printf("Error loading sampling policy for project %s: %v", span.ProjectID, err)
+			pass = append(pass, span)
+			continue
+		}
+		if !policy.Enabled() {
+			pass = append(pass, span)
+			continue
+		}
+
+		key := traceKey(span.ProjectID, span.TraceID)
+		s.mu.Lock()
+		if _, ok := s.held[messageID]; ok {
+			// Read again after a retry or restart of the processor
+			s.mu.Unlock()
+			held = append(held, messageID)
+			continue
+		}
+		if d, ok := s.decisions[key]; ok {
+			s.countSpans(d.keep, 1)
+			s.mu.Unlock()
+			if d.keep {
+				pass = append(pass, span)
+			}
+			continue
+		}
+		trace, ok := s.traces[key]
+		if !ok {
+			trace = &bufferedTrace{
+				projectID: span.ProjectID,
+				traceID:   span.TraceID,
+				firstSeen: time.Now(),
+				policy:    policy,
+			}
+			s.traces[key] = trace
+		}
+		trace.spans = append(trace.spans, span)
+		trace.messageIDs = append(trace.messageIDs, messageID)
+		s.held[messageID] = struct{}{}
+		s.buffered++
+		s.mu.Unlock()
+		held = append(held, messageID)
+	}
+	return pass, held
+}
+
+func (s *Sampler) countSpans(keep bool, n int) {
+	if keep {
+		s.keptSpans += int64(n)
+	} else {
+		s.droppedSpans += int64(n)
+	}
+}
+
+// due removes the traces whose decision window has passed, and the oldest
+// traces beyond the buffer limit, and decides them. Decisions whose commit
+// failed earlier are returned again.
+func (s *Sampler) due(now time.Time, all bool) []queue.SampledTrace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ready []*bufferedTrace
+	var waiting []*bufferedTrace
+	for _, trace := range s.traces {
+		if all || now.Sub(trace.firstSeen) >= s.wait {
+			ready = append(ready, trace)
+		} else {
+			waiting = append(waiting, trace)
+		}
+	}
+
+	buffered := s.buffered
+	for _, trace := range ready {
+		buffered -= len(trace.spans)
+	}
+	if buffered > s.maxSpans {
+		sort.Slice(waiting, func(i, j int) bool { return waiting[i].firstSeen.Before(waiting[j].firstSeen) })
+		for _, trace := range waiting {
+			if buffered <= s.maxSpans {
+				break
+			}
+			ready = append(ready, trace)
+			buffered -= len(trace.spans)
+		}
+	}
+
+	decided := s.uncommitted
+	s.uncommitted = nil
+	for _, trace := range ready {
+		key := traceKey(trace.projectID, trace.traceID)
+		delete(s.traces, key)
+		s.buffered -= len(trace.spans)
+
+		keep, reason := trace.policy.Decide(trace.traceID, trace.spans)
+		s.decisions[key] = decision{keep: keep, decidedAt: now}
+		s.countSpans(keep, len(trace.spans))
+		if keep {
+			s.keptTraces++
+			s.keptBy[reason]++
+		} else {
+			s.droppedTraces++
+		}
+		decided = append(decided, queue.SampledTrace{
+			Keep:       keep,
+			Spans:      trace.spans,
+			MessageIDs: trace.messageIDs,
+		})
+	}
+
+	for key, d := range s.decisions {
+		if now.Sub(d.decidedAt) > decisionTTL {
+			delete(s.decisions, key)
+		}
+	}
+
+	return decided
+}
+
+// commit writes decided traces, keeping them for the next flush when that
+// fails
+func (s *Sampler) commit(ctx context.Context, decided []queue.SampledTrace, write func(context.Context, []queue.SampledTrace) error) error {
+	if len(decided) == 0 {
+		return nil
+	}
+
+	if err := write(ctx, decided); err != nil {
+		s.mu.Lock()
+		s.uncommitted = decided
+		s.mu.Unlock()
+		return err
+	}
+
+	s.mu.Lock()
+	for _, trace := range decided {
+		for _, messageID := range trace.MessageIDs {
+			delete(s.held, messageID)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// Run implements queue.TraceSampler. It decides buffered traces as their
+// window passes and commits them, deciding everything still buffered when
+// ctx is done.
+func (s *Sampler) Run(ctx context.Context, commit func(context.Context, []queue.SampledTrace) error) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := s.commit(flushCtx, s.due(time.Now(), true), commit); err != nil {
+				log.Printf("Error committing sampled traces on shutdown: %v", err)
+			}
+			return
+		case now := <-ticker.C:
+			if err := s.commit(ctx, s.due(now, false), commit); err != nil {
+				log.Printf("Error committing sampled traces: %v", err)
+			}
+		}
+	}
+}
+
+// Stats implements queue.TraceSampler
+func (s *Sampler) Stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keptBy := make(map[string]int64, len(s.keptBy))
+	for reason, count := range s.keptBy {
+		keptBy[reason] = count
+	}
+
+	return map[string]interface{}{
+		"kept_traces":     s.keptTraces,
+		"dropped_traces":  s.droppedTraces,
+		"kept_spans":      s.keptSpans,
+		"dropped_spans":   s.droppedSpans,
+		"kept_by":         keptBy,
+		"buffered_traces": len(s.traces),
+		"buffered_spans":  s.buffered,
+		"uncommitted":     len(s.uncommitted),
+	}
+}
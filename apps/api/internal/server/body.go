@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/klauspost/compress/zstd"
+	"github.com/valyala/fasthttp"
+)
+
+// LimitBodies raises the body limit of requests for which limitFor returns
+// a positive size, every other request keeps the app's BodyLimit. fasthttp
+// reads the body before routing, so the limit is picked from the request
+// path in the header.
+func LimitBodies(app *fiber.App, limitFor func(path []byte) int) {
+	app.Server().HeaderReceived = func(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+		path := header.RequestURI()
+		if i := bytes.IndexByte(path, '?'); i >= 0 {
+			path = path[:i]
+		}
+		return fasthttp.RequestConfig{MaxRequestBodySize: limitFor(path)}
+	}
+}
+
+// bodyLimit returns the body limit that applied to the request, which also
+// caps its decoded size
+func bodyLimit(c fiber.Ctx) int64 {
+	if headerReceived := c.App().Server().HeaderReceived; headerReceived != nil {
+		if limit := headerReceived(&c.Request().Header).MaxRequestBodySize; limit > 0 {
+			return int64(limit)
+		}
+	}
+	return int64(c.App().Config().BodyLimit)
+}
+
+// bodyReader returns a reader over the raw request body, decoding it
+// according to Content-Encoding without buffering the decoded body
+func bodyReader(c fiber.Ctx) (io.ReadCloser, error) {
+	raw := bytes.NewReader(c.BodyRaw())
+
+	switch encoding := strings.ToLower(strings.TrimSpace(c.Get(fiber.HeaderContentEncoding))); encoding {
+	case "", "identity":
+		return io.NopCloser(raw), nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		return gz, nil
+	case "zstd":
+		zr, err := zstd.NewReader(raw, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding: %s", encoding)
+	}
+}
+
+// ReadBody returns the request body decoded according to Content-Encoding,
+// for formats that are decoded as a whole. The decoded body is held in
+// memory next to the raw one, so a request costs up to twice its body limit.
+// Larger decoded bodies are rejected with 413.
+func ReadBody(c fiber.Ctx) ([]byte, error) {
+	body, err := bodyReader(c)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error())
+	}
+	defer body.Close()
+
+	limit := bodyLimit(c)
+	data, err := io.ReadAll(&io.LimitedReader{R: body, N: limit + 1})
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if int64(len(data)) > limit {
+		return nil, fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("decoded body exceeds %d bytes", limit))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Maximum size of a single NDJSON line
+const maxNDJSONLineSize = 1024 * 1024
+
+// NDJSONLineError reports a rejected line of an NDJSON ingest request.
+// Lines are numbered from 1, blank lines included.
+type NDJSONLineError struct {
+	Line int `json:"line"`
+	ErrorResponse
+}
+
+// IsNDJSON reports whether the request body is newline delimited JSON
+func IsNDJSON(c fiber.Ctx) bool {
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	return strings.HasPrefix(contentType, "application/x-ndjson") ||
+		strings.HasPrefix(contentType, "application/ndjson")
+}
+
+// MatchProject fills in a missing project ID on an NDJSON line and rejects
+// lines addressed to a project other than the authenticated one
+func MatchProject(lineProjectID *string, projectID string) error {
+	if *lineProjectID == "" {
+		*lineProjectID = projectID
+		return nil
+	}
+	if *lineProjectID != projectID {
+		return fiber.NewError(fiber.StatusForbidden, "project_id does not match the authenticated project")
+	}
+	return nil
+}
+
+// scanNDJSON decodes the body according to Content-Encoding and passes
+// every line to fn, numbered from 1. Only one line is held in memory at a
+// time. The decoded body is capped at the request's body limit and lines at
+// maxNDJSONLineSize.
+func scanNDJSON(c fiber.Ctx, fn func(n int, line []byte) error) error {
+	body, err := bodyReader(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, err.Error())
+	}
+	defer body.Close()
+
+	limit := bodyLimit(c)
+	limited := &io.LimitedReader{R: body, N: limit + 1}
+	scanner := bufio.NewScanner(limited)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineSize+1)
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := fn(n, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if limited.N <= 0 {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("decoded body exceeds %d bytes", limit))
+	}
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("line %d: line exceeds %d bytes", n+1, maxNDJSONLineSize))
+		}
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+// IngestNDJSON decodes an NDJSON body line by line, passing every non-blank
+// line to handle. handle returns the status code to report when it rejects
+// a line. The body is first decoded once to check it against the request's
+// body limit and the line size, so an oversized body is rejected with
+// nothing stored, then decoded again to handle its lines. Decoding twice
+// keeps a single line in memory rather than the whole decoded body.
+func IngestNDJSON(c fiber.Ctx, handle func(line []byte) (int, error)) error {
+	if err := scanNDJSON(c, func(int, []byte) error { return nil }); err != nil {
+		return sendNDJSONError(c, err)
+	}
+
+	processed := 0
+	var failed []NDJSONLineError
+
+	err := scanNDJSON(c, func(n int, line []byte) error {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			return nil
+		}
+
+		if code, err := handle(line); err != nil {
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				code = fiberErr.Code
+			}
+			failed = append(failed, NDJSONLineError{
+				Line: n,
+				ErrorResponse: ErrorResponse{
+					Message: err.Error(),
+					Code:    code,
+				},
+			})
+			return nil
+		}
+
+		processed++
+		return nil
+	})
+	if err != nil {
+		return sendNDJSONError(c, err)
+	}
+
+	return SendResponse(c, fiber.Map{
+		"processed": processed,
+		"failed":    failed,
+	}, fiber.StatusAccepted)
+}
+
+func sendNDJSONError(c fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return SendError(c, err, fiberErr.Code)
+	}
+	return SendError(c, err, fiber.StatusBadRequest)
+}
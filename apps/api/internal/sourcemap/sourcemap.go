@@ -0,0 +1,208 @@
+package sourcemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Token is the original location of a generated position. Lines and
+// columns are zero based as in the source map format.
+type Token struct {
+	Source string
+	Line   int
+	Column int
+	Name   string
+}
+
+type segment struct {
+	column int32
+	source int32 // -1 when the segment has no original location
+	line   int32
+	col    int32
+	name   int32 // -1 when the segment has no name
+}
+
+// Map is a parsed revision 3 source map
+type Map struct {
+	File    string
+	sources []string
+	names   []string
+	lines   [][]segment
+}
+
+type rawMap struct {
+	Version    int               `json:"version"`
+	File       string            `json:"file"`
+	SourceRoot string            `json:"sourceRoot"`
+	Sources    []string          `json:"sources"`
+	Names      []string          `json:"names"`
+	Mappings   string            `json:"mappings"`
+	Sections   []json.RawMessage `json:"sections"`
+}
+
+// Parse decodes a source map. Indexed maps with sections are not supported.
+func Parse(data []byte) (*Map, error) {
+	// Maps may start with an XSSI guard line
+	if bytes.HasPrefix(data, []byte(")]}")) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	var raw rawMap
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid source map: %w", err)
+	}
+	if raw.Version != 3 {
+		return nil, fmt.Errorf("unsupported source map version %d", raw.Version)
+	}
+	if len(raw.Sections) > 0 {
+		return nil, errors.New("indexed source maps are not supported")
+	}
+
+	m := &Map{File: raw.File, names: raw.Names}
+	m.sources = make([]string, len(raw.Sources))
+	for i, source := range raw.Sources {
+		if raw.SourceRoot != "" && !strings.Contains(source, "://") && !strings.HasPrefix(source, "/") {
+			source = strings.TrimSuffix(raw.SourceRoot, "/") + "/" + source
+		}
+		m.sources[i] = source
+	}
+
+	if err := m.parseMappings(raw.Mappings); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+const base64Chars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+var base64Values = func() [256]int8 {
+	var values [256]int8
+	for i := range values {
+		values[i] = -1
+	}
+	for i := 0; i < len(base64Chars); i++ {
+		values[base64Chars[i]] = int8(i)
+	}
+	return values
+}()
+
+// decodeVLQ reads one base64 VLQ value starting at i
+func decodeVLQ(s string, i int) (value int32, next int, err error) {
+	var result, shift int64
+	for {
+		if i >= len(s) {
+			return 0, i, errors.New("unterminated VLQ value in mappings")
+		}
+		digit := base64Values[s[i]]
+		if digit < 0 {
+			return 0, i, fmt.Errorf("invalid character %q in mappings", s[i])
+		}
+		i++
+		result += int64(digit&31) << shift
+		if digit&32 == 0 {
+			break
+		}
+		shift += 5
+		if shift > 31 {
+			return 0, i, errors.New("VLQ value in mappings overflows")
+		}
+	}
+	if result&1 == 1 {
+		return int32(-(result >> 1)), i, nil
+	}
+	return int32(result >> 1), i, nil
+}
+
+func (m *Map) parseMappings(mappings string) error {
+	var source, line, col, name int32
+	current := []segment{}
+
+	for i := 0; i <= len(mappings); {
+		if i == len(mappings) || mappings[i] == ';' {
+			sort.SliceStable(current, func(a, b int) bool { return current[a].column < current[b].column })
+			m.lines = append(m.lines, current)
+			current = []segment{}
+			i++
+			continue
+		}
+		if mappings[i] == ',' {
+			i++
+			continue
+		}
+
+		var fields [5]int32
+		n := 0
+		for i < len(mappings) && mappings[i] != ',' && mappings[i] != ';' {
+			if n == len(fields) {
+				return errors.New("too many fields in mappings segment")
+			}
+			value, next, err := decodeVLQ(mappings, i)
+			if err != nil {
+				return err
+			}
+			fields[n] = value
+			n++
+			i = next
+		}
+
+		// The generated column is relative to the previous segment of the
+		// same line, every other field to the previous segment overall
+		seg := segment{source: -1, name: -1}
+		if len(current) > 0 {
+			seg.column = current[len(current)-1].column
+		}
+		seg.column += fields[0]
+		switch n {
+		case 1:
+		case 4, 5:
+			source += fields[1]
+			line += fields[2]
+			col += fields[3]
+			if source < 0 || int(source) >= len(m.sources) {
+				return fmt.Errorf("mappings reference unknown source %d", source)
+			}
+			seg.source, seg.line, seg.col = source, line, col
+			if n == 5 {
+				name += fields[4]
+				if name < 0 || int(name) >= len(m.names) {
+					return fmt.Errorf("mappings reference unknown name %d", name)
+				}
+				seg.name = name
+			}
+		default:
+			return fmt.Errorf("invalid mappings segment with %d fields", n)
+		}
+		current = append(current, seg)
+	}
+	return nil
+}
+
+// Lookup returns the original location of a zero based generated line and
+// column, using the closest mapping at or before the column
+func (m *Map) Lookup(line, column int) (Token, bool) {
+	if line < 0 || line >= len(m.lines) {
+		return Token{}, false
+	}
+	segments := m.lines[line]
+	i := sort.Search(len(segments), func(i int) bool { return int(segments[i].column) > column }) - 1
+	if i < 0 || segments[i].source < 0 {
+		return Token{}, false
+	}
+
+	seg := segments[i]
+	token := Token{
+		Source: m.sources[seg.source],
+		Line:   int(seg.line),
+		Column: int(seg.col),
+	}
+	if seg.name >= 0 {
+		token.Name = m.names[seg.name]
+	}
+	return token, true
+}
@@ -0,0 +1,250 @@
+package sourcemap
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/blobstore"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	tsmodels "github.com/ted-too/logsicle/internal/storage/timescale/models"
+	"gorm.io/gorm"
+)
+
+// How long a release's artifact list is reused before reloading
+const cacheTTL = 30 * time.Second
+
+// Maximum number of parsed source maps kept in memory
+const maxCachedMaps = 100
+
+type releaseEntry struct {
+	artifacts map[string]models.ReleaseArtifact // by name
+	loadedAt  time.Time
+}
+
+// Symbolicator rewrites minified stack frames of app logs to their original
+// location using the source maps uploaded for the log's release
+type Symbolicator struct {
+	db       *gorm.DB
+	store    blobstore.Store
+	maxSize  int64
+	mu       sync.Mutex
+	releases map[string]releaseEntry // by project and release
+	swept    time.Time               // when expired releases were last dropped
+	maps     map[string]*Map         // by artifact checksum
+}
+
+func NewSymbolicator(db *gorm.DB, store blobstore.Store, maxSize int) *Symbolicator {
+	return &Symbolicator{
+		db:       db,
+		store:    store,
+		maxSize:  int64(maxSize),
+		releases: make(map[string]releaseEntry),
+		maps:     make(map[string]*Map),
+	}
+}
+
+func releaseKey(projectID, release string) string {
+	return projectID + "\x00" + release
+}
+
+func (s *Symbolicator) loadArtifacts(ctx context.Context, projectID, release string) (map[string]models.ReleaseArtifact, error) {
+	key := releaseKey(projectID, release)
+
+	s.mu.Lock()
+	entry, ok := s.releases[key]
+	s.mu.Unlock()
+	if ok && time.Since(entry.loadedAt) < cacheTTL {
+		return entry.artifacts, nil
+	}
+
+	var stored []models.ReleaseArtifact
+	if err := s.db.WithContext(ctx).
+		Where("project_id = ? AND release = ?", projectID, release).
+		Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	artifacts := make(map[string]models.ReleaseArtifact, len(stored))
+	for _, a := range stored {
+		artifacts[a.Name] = a
+	}
+
+	s.mu.Lock()
+	s.sweepReleases()
+	// Release names come from clients, only releases with uploaded
+	// artifacts are cached so arbitrary names cannot grow the cache
+	if len(artifacts) > 0 {
+		s.releases[key] = releaseEntry{artifacts: artifacts, loadedAt: time.Now()}
+	} else {
+		delete(s.releases, key)
+	}
+	s.mu.Unlock()
+
+	return artifacts, nil
+}
+
+// sweepReleases drops expired artifact lists, at most once per cacheTTL.
+// Callers hold s.mu.
+func (s *Symbolicator) sweepReleases() {
+	if time.Since(s.swept) < cacheTTL {
+		return
+	}
+	for key, entry := range s.releases {
+		if time.Since(entry.loadedAt) >= cacheTTL {
+			delete(s.releases, key)
+		}
+	}
+	s.swept = time.Now()
+}
+
+func (s *Symbolicator) loadMap(ctx context.Context, artifact models.ReleaseArtifact) (*Map, error) {
+	s.mu.Lock()
+	m, ok := s.maps[artifact.Checksum]
+	s.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	r, err := s.store.Get(ctx, artifact.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, s.maxSize))
+	if err != nil {
+		return nil, err
+	}
+	m, err = Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.maps) >= maxCachedMaps {
+		// Evict an arbitrary map, maps are cheap to reload compared to
+		// tracking recency on every lookup
+		for checksum := range s.maps {
+			delete(s.maps, checksum)
+			break
+		}
+	}
+	s.maps[artifact.Checksum] = m
+	s.mu.Unlock()
+
+	return m, nil
+}
+
+// Invalidate drops the cached artifact lists of a project
+func (s *Symbolicator) Invalidate(projectID string) {
+	s.mu.Lock()
+	for key := range s.releases {
+		if strings.HasPrefix(key, projectID+"\x00") {
+			delete(s.releases, key)
+		}
+	}
+	s.mu.Unlock()
+}
+
+// artifactNames returns the names an artifact for a frame's file may be
+// uploaded under, the exact URL first and then "~/path" matching any host
+func artifactNames(file string) []string {
+	names := []string{file}
+	path := file
+	if i := strings.Index(path, "://"); i >= 0 {
+		path = path[i+3:]
+		j := strings.Index(path, "/")
+		if j < 0 {
+			return names
+		}
+		path = path[j:]
+	}
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	return append(names, "~/"+strings.TrimPrefix(path, "/"))
+}
+
+// Symbolicate rewrites the frames of an exception that have a source map in
+// the release, returning whether any frame changed. Frames keep their
+// minified location in Minified.
+func (s *Symbolicator) Symbolicate(ctx context.Context, projectID, release string, exception *tsmodels.Exception) (bool, error) {
+	artifacts, err := s.loadArtifacts(ctx, projectID, release)
+	if err != nil || len(artifacts) == 0 {
+		return false, err
+	}
+
+	changed := false
+	for i := range exception.Stacktrace {
+		frame := &exception.Stacktrace[i]
+		if frame.Lineno <= 0 || frame.Minified != nil {
+			continue
+		}
+
+		file := frame.AbsPath
+		if file == "" {
+			file = frame.Filename
+		}
+		var artifact *models.ReleaseArtifact
+		for _, name := range artifactNames(file) {
+			if a, ok := artifacts[name]; ok {
+				artifact = &a
+				break
+			}
+		}
+		if artifact == nil {
+			continue
+		}
+
+		m, err := s.loadMap(ctx, *artifact)
+		if err != nil {
+			return changed, err
+		}
+		// Stack traces use one based lines and columns
+		token, ok := m.Lookup(frame.Lineno-1, max(frame.Colno-1, 0))
+		if !ok {
+			continue
+		}
+
+		minified := *frame
+		frame.Minified = &minified
+		frame.Filename = token.Source
+		frame.AbsPath = ""
+		frame.Lineno = token.Line + 1
+		frame.Colno = token.Column + 1
+		if token.Name != "" {
+			frame.Function = token.Name
+		}
+		if frame.InApp == nil {
+			inApp := !strings.Contains(token.Source, "node_modules/")
+			frame.InApp = &inApp
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// ProcessAppLog implements queue.AppLogProcessor. Logs keep their minified
+// frames when symbolication fails.
+func (s *Symbolicator) ProcessAppLog(ctx context.Context, appLog *tsmodels.AppLog) bool {
+	if !appLog.Version.Valid || appLog.Version.String == "" {
+		return true
+	}
+	exception, err := appLog.GetException()
+	if err != nil || exception == nil {
+		return true
+	}
+
+	changed, err := s.Symbolicate(ctx, appLog.ProjectID, appLog.Version.String, exception)
+	if err != nil {
+		log.Printf("Error symbolicating app log for project %s: %v", appLog.ProjectID, err)
+	}
+	if changed {
+		appLog.Exception = tsmodels.ConvertToJSONB(exception)
+	}
+	return true
+}
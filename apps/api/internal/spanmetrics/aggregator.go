@@ -0,0 +1,172 @@
+package spanmetrics
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Name of the histogram metric written for span durations
+const MetricName = "span.duration"
+
+// How often aggregated histograms are written as metrics
+const flushInterval = time.Minute
+
+// Histogram bucket upper bounds in milliseconds
+var Bounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type seriesKey struct {
+	projectID      string
+	serviceName    string
+	serviceVersion string
+	name           string
+	kind           models.SpanKind
+	status         models.SpanStatus
+}
+
+type histogram struct {
+	bucketCounts []uint64 // one more than Bounds, the last counts values above every bound
+	count        uint64
+	sum          float64
+	// Most recent span per bucket, kept as exemplars linking to its trace
+	exemplars []*models.ExemplarInput
+}
+
+// Aggregator turns server and consumer spans into request rate, error rate
+// and duration histograms per service, operation and status. Histograms are
+// written as delta HISTOGRAM metrics every flush interval.
+type Aggregator struct {
+	mu     sync.Mutex
+	series map[seriesKey]*histogram
+	// Start of the current interval
+	intervalStart time.Time
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		series:        make(map[seriesKey]*histogram),
+		intervalStart: time.Now(),
+	}
+}
+
+// Add implements queue.SpanMetricsAggregator. Only spans that handle
+// requests, SERVER and CONSUMER, are counted.
+func (a *Aggregator) Add(spans []*models.Trace) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, span := range spans {
+		if span.Kind != models.SpanKindServer && span.Kind != models.SpanKindConsumer {
+			continue
+		}
+
+		key := seriesKey{
+			projectID:      span.ProjectID,
+			serviceName:    span.ServiceName,
+			serviceVersion: span.ServiceVersion.String,
+			name:           span.Name,
+			kind:           span.Kind,
+			status:         span.Status,
+		}
+		h, ok := a.series[key]
+		if !ok {
+			h = &histogram{
+				bucketCounts: make([]uint64, len(Bounds)+1),
+				exemplars:    make([]*models.ExemplarInput, len(Bounds)+1),
+			}
+			a.series[key] = h
+		}
+
+		duration := float64(span.DurationMs)
+		bucket := sort.SearchFloat64s(Bounds, duration)
+		h.bucketCounts[bucket]++
+		h.count++
+		h.sum += duration
+		h.exemplars[bucket] = &models.ExemplarInput{
+			Value:     duration,
+			Timestamp: span.StartTime,
+			TraceID:   span.TraceID,
+			SpanID:    span.ID,
+		}
+	}
+}
+
+// flush returns the aggregated histograms as metrics and resets them
+func (a *Aggregator) flush() []*models.Metric {
+	a.mu.Lock()
+	series := a.series
+	start, end := a.intervalStart, time.Now()
+	a.series = make(map[seriesKey]*histogram)
+	a.intervalStart = end
+	a.mu.Unlock()
+
+	metrics := make([]*models.Metric, 0, len(series))
+	for key, h := range series {
+		exemplars := make([]models.ExemplarInput, 0, len(h.exemplars))
+		for _, e := range h.exemplars {
+			if e != nil {
+				exemplars = append(exemplars, *e)
+			}
+		}
+
+		metric, err := models.MetricInput{
+			ProjectID:      key.projectID,
+			Name:           MetricName,
+			Description:    "Duration of server and consumer spans, derived from traces",
+			Unit:           "ms",
+			Type:           string(models.MetricTypeHistogram),
+			Bounds:         Bounds,
+			BucketCounts:   h.bucketCounts,
+			Count:          h.count,
+			Sum:            h.sum,
+			ServiceName:    key.serviceName,
+			ServiceVersion: key.serviceVersion,
+			Attributes: map[string]any{
+				"span.name": key.name,
+				"span.kind": string(key.kind),
+				"status":    string(key.status),
+			},
+			AggregationTemporality: string(models.AggregationTemporalityDelta),
+			Timestamp:              end,
+			StartTime:              start,
+			Exemplars:              exemplars,
+		}.ValidateAndCreate()
+		if err != nil {
+			log.Printf("Skipping span metrics for service %s: %v", key.serviceName, err)
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// Run implements queue.SpanMetricsAggregator. It writes the histograms
+// every flush interval and once more when ctx is done.
+func (a *Aggregator) Run(ctx context.Context, insert func(context.Context, []*models.Metric) error) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if metrics := a.flush(); len(metrics) > 0 {
+				if err := insert(flushCtx, metrics); err != nil {
+					log.Printf("Error inserting span metrics on shutdown: %v", err)
+				}
+			}
+			return
+		case <-ticker.C:
+			if metrics := a.flush(); len(metrics) > 0 {
+				if err := insert(ctx, metrics); err != nil {
+					log.Printf("Error inserting span metrics: %v", err)
+				}
+			}
+		}
+	}
+}
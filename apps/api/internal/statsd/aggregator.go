@@ -0,0 +1,247 @@
+package statsd
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Service name used when a sample has no service tag
+	defaultServiceName = "statsd"
+	// Maximum number of series aggregated per flush interval, samples for
+	// new series beyond it are dropped. It also bounds the remembered gauges.
+	maxSeries = 100000
+	// How long the last value of a gauge is kept without updates. Relative
+	// updates to a forgotten gauge start from zero.
+	gaugeTTL = time.Hour
+)
+
+// Histogram bucket upper bounds used for timers, histograms and
+// distributions
+var Bounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Tags mapped to the metric's service instead of its attributes
+const (
+	serviceTag = "service"
+	versionTag = "version"
+)
+
+type seriesKey struct {
+	name           string
+	metricType     string
+	serviceName    string
+	serviceVersion string
+	tags           string // canonical form of the remaining tags
+}
+
+type series struct {
+	attributes map[string]any
+
+	// Counters and gauges
+	value float64
+
+	// Timers, histograms and distributions, sample rates make counts
+	// fractional until they are flushed
+	bucketCounts []float64
+	count        float64
+	sum          float64
+
+	// Sets
+	members map[string]struct{}
+}
+
+// gauge is the last value of a gauge series
+type gauge struct {
+	value     float64
+	updatedAt time.Time
+}
+
+// Aggregator pre-aggregates StatsD samples of one project between flushes
+type Aggregator struct {
+	projectID string
+
+	mu     sync.Mutex
+	series map[seriesKey]*series
+	// Last value of every gauge, relative gauge updates apply to it
+	gauges map[seriesKey]gauge
+	// Start of the current flush interval
+	intervalStart time.Time
+}
+
+func NewAggregator(projectID string) *Aggregator {
+	return &Aggregator{
+		projectID:     projectID,
+		series:        make(map[seriesKey]*series),
+		gauges:        make(map[seriesKey]gauge),
+		intervalStart: time.Now(),
+	}
+}
+
+func newSeriesKey(sample *Sample) (seriesKey, map[string]any) {
+	key := seriesKey{
+		name:        sample.Name,
+		metricType:  sample.Type,
+		serviceName: defaultServiceName,
+	}
+
+	names := make([]string, 0, len(sample.Tags))
+	for name, value := range sample.Tags {
+		switch {
+		case name == serviceTag && value != "":
+			key.serviceName = value
+		case name == versionTag && value != "":
+			key.serviceVersion = value
+		default:
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	attributes := make(map[string]any, len(names))
+	for _, name := range names {
+		canonical.WriteString(name)
+		canonical.WriteByte('=')
+		canonical.WriteString(sample.Tags[name])
+		canonical.WriteByte(',')
+		attributes[name] = sample.Tags[name]
+	}
+	key.tags = canonical.String()
+
+	return key, attributes
+}
+
+// Add aggregates a sample into its series
+func (a *Aggregator) Add(sample *Sample) {
+	key, attributes := newSeriesKey(sample)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.series[key]
+	if !ok {
+		if len(a.series) >= maxSeries {
+			log.Printf("Dropping statsd sample for %s: series limit of %d reached", sample.Name, maxSeries)
+			return
+		}
+		s = &series{attributes: attributes}
+		switch sample.Type {
+		case TypeTimer, TypeHistogram, TypeDistribution:
+			s.bucketCounts = make([]float64, len(Bounds)+1)
+		case TypeSet:
+			s.members = make(map[string]struct{})
+		case TypeGauge:
+			last, ok := a.gauges[key]
+			if !ok && len(a.gauges) >= maxSeries {
+				log.Printf("Dropping statsd sample for %s: gauge limit of %d reached", sample.Name, maxSeries)
+				return
+			}
+			s.value = last.value
+		}
+		a.series[key] = s
+	}
+
+	for _, raw := range sample.Values {
+		if sample.Type == TypeSet {
+			s.members[raw] = struct{}{}
+			continue
+		}
+
+		value, _ := strconv.ParseFloat(raw, 64)
+		switch sample.Type {
+		case TypeCounter:
+			s.value += value / sample.SampleRate
+		case TypeGauge:
+			// A leading sign makes the update relative
+			if strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-") {
+				s.value += value
+			} else {
+				s.value = value
+			}
+			a.gauges[key] = gauge{value: s.value, updatedAt: time.Now()}
+		default:
+			weight := 1 / sample.SampleRate
+			s.bucketCounts[sort.SearchFloat64s(Bounds, value)] += weight
+			s.count += weight
+			s.sum += value * weight
+		}
+	}
+}
+
+// Flush returns the series aggregated since the last flush as metrics and
+// resets them. Counters, timers and histograms are deltas over the
+// interval, gauges are only written when they were updated. Gauges not
+// updated within gaugeTTL are forgotten.
+func (a *Aggregator) Flush() []*models.Metric {
+	a.mu.Lock()
+	aggregated := a.series
+	start, end := a.intervalStart, time.Now()
+	a.series = make(map[seriesKey]*series)
+	a.intervalStart = end
+	for key, g := range a.gauges {
+		if end.Sub(g.updatedAt) > gaugeTTL {
+			delete(a.gauges, key)
+		}
+	}
+	a.mu.Unlock()
+
+	metrics := make([]*models.Metric, 0, len(aggregated))
+	for key, s := range aggregated {
+		input := models.MetricInput{
+			ProjectID:      a.projectID,
+			Name:           key.name,
+			ServiceName:    key.serviceName,
+			ServiceVersion: key.serviceVersion,
+			Attributes:     s.attributes,
+			Timestamp:      end,
+		}
+
+		switch key.metricType {
+		case TypeCounter:
+			input.Type = string(models.MetricTypeSum)
+			input.Value = s.value
+			input.IsMonotonic = true
+			input.AggregationTemporality = string(models.AggregationTemporalityDelta)
+			input.StartTime = start
+		case TypeGauge:
+			input.Type = string(models.MetricTypeGauge)
+			input.Value = s.value
+			input.AggregationTemporality = string(models.AggregationTemporalityUnspecified)
+		case TypeSet:
+			// The number of unique members seen in the interval
+			input.Type = string(models.MetricTypeGauge)
+			input.Value = float64(len(s.members))
+			input.AggregationTemporality = string(models.AggregationTemporalityUnspecified)
+		default:
+			bucketCounts := make([]uint64, len(s.bucketCounts))
+			for i, count := range s.bucketCounts {
+				bucketCounts[i] = uint64(math.Round(count))
+			}
+			input.Type = string(models.MetricTypeHistogram)
+			input.Bounds = Bounds
+			input.BucketCounts = bucketCounts
+			input.Count = uint64(math.Round(s.count))
+			input.Sum = s.sum
+			input.AggregationTemporality = string(models.AggregationTemporalityDelta)
+			input.StartTime = start
+			if key.metricType == TypeTimer {
+				input.Unit = "ms"
+			}
+		}
+
+		metric, err := input.ValidateAndCreate()
+		if err != nil {
+			log.Printf("Skipping statsd metric %s: %v", key.name, err)
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
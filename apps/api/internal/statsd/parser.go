@@ -0,0 +1,98 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// StatsD metric types
+const (
+	TypeCounter      = "c"
+	TypeGauge        = "g"
+	TypeTimer        = "ms"
+	TypeHistogram    = "h"
+	TypeDistribution = "d"
+	TypeSet          = "s"
+)
+
+// Sample is one parsed StatsD line:
+//
+//	<name>:<value>[:<value>...]|<type>[|@<sample rate>][|#<tag>[:<value>],...]
+//
+// Multiple values and tags are DogStatsD extensions.
+type Sample struct {
+	Name       string
+	Type       string
+	Values     []string
+	SampleRate float64
+	Tags       map[string]string
+}
+
+// Parse parses a single StatsD line. DogStatsD events and service checks
+// are not metrics and return a nil sample.
+func Parse(line string) (*Sample, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "_e{") || strings.HasPrefix(line, "_sc|") {
+		return nil, nil
+	}
+
+	head, rest, ok := strings.Cut(line, "|")
+	if !ok {
+		return nil, fmt.Errorf("missing metric type: %q", line)
+	}
+	name, values, ok := strings.Cut(head, ":")
+	if !ok || name == "" || values == "" {
+		return nil, fmt.Errorf("missing metric name or value: %q", line)
+	}
+
+	segments := strings.Split(rest, "|")
+	sample := &Sample{
+		Name:       name,
+		Type:       segments[0],
+		Values:     strings.Split(values, ":"),
+		SampleRate: 1,
+	}
+
+	switch sample.Type {
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+		for _, value := range sample.Values {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, fmt.Errorf("invalid value %q for %s", value, name)
+			}
+		}
+	case TypeSet:
+	default:
+		return nil, fmt.Errorf("unsupported metric type %q for %s", sample.Type, name)
+	}
+
+	for _, segment := range segments[1:] {
+		switch {
+		case strings.HasPrefix(segment, "@"):
+			rate, err := strconv.ParseFloat(segment[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, fmt.Errorf("invalid sample rate %q for %s", segment, name)
+			}
+			sample.SampleRate = rate
+		case strings.HasPrefix(segment, "#"):
+			sample.Tags = parseTags(segment[1:])
+		}
+		// Other DogStatsD fields, e.g. container IDs and timestamps, are ignored
+	}
+
+	return sample, nil
+}
+
+// parseTags parses comma separated DogStatsD tags. Tags without a value
+// are kept with an empty value.
+func parseTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(tag, ":")
+		tags[key] = value
+	}
+	return tags
+}
@@ -0,0 +1,293 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/middleware"
+	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/storage/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// Maximum accepted size of a datagram or TCP line
+	maxMessageSize = 64 * 1024
+	// How long an idle TCP connection is kept open
+	idleTimeout = 5 * time.Minute
+)
+
+type Server struct {
+	cfg        *config.Config
+	db         *gorm.DB
+	qs         *queue.QueueService
+	aggregator *Aggregator
+	listeners  []net.Listener
+	conns      []net.PacketConn
+	wg         sync.WaitGroup
+	stop       chan struct{}
+	stopOnce   sync.Once
+	flushDone  chan struct{}
+	// Whether the API key passed its last check, samples are dropped while
+	// it does not
+	authorized atomic.Bool
+
+	mu      sync.Mutex
+	closed  bool
+	streams map[net.Conn]struct{}
+}
+
+func NewServer(cfg *config.Config, db *gorm.DB, qs *queue.QueueService) *Server {
+	return &Server{
+		cfg:        cfg,
+		db:         db,
+		qs:         qs,
+		aggregator: NewAggregator(cfg.StatsD.ProjectID),
+		stop:       make(chan struct{}),
+		streams:    make(map[net.Conn]struct{}),
+	}
+}
+
+// Start verifies the configured API key, binds all configured listeners and
+// serves them until ctx is done. The key is checked again on every flush.
+func (s *Server) Start(ctx context.Context) error {
+	sc := s.cfg.StatsD
+
+	if err := middleware.VerifyAPIKey(s.db, sc.ProjectID, sc.APIKey, models.ScopeMetricsWrite); err != nil {
+		return fmt.Errorf("failed to verify statsd api key: %w", err)
+	}
+	s.authorized.Store(true)
+
+	flushInterval, err := time.ParseDuration(sc.FlushInterval)
+	if err != nil {
+		return fmt.Errorf("invalid statsd flush interval: %w", err)
+	}
+
+	if sc.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", sc.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on udp %s: %w", sc.UDPAddr, err)
+		}
+		s.conns = append(s.conns, conn)
+		s.wg.Add(1)
+		go s.serveUDP(conn)
+		log.Printf("StatsD listening on udp %s", sc.UDPAddr)
+	}
+
+	if sc.TCPAddr != "" {
+		ln, err := net.Listen("tcp", sc.TCPAddr)
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to listen on tcp %s: %w", sc.TCPAddr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		s.wg.Add(1)
+		go s.serveTCP(ln)
+		log.Printf("StatsD listening on tcp %s", sc.TCPAddr)
+	}
+
+	s.flushDone = make(chan struct{})
+	go s.runFlush(ctx, flushInterval)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.stop:
+		}
+	}()
+
+	return nil
+}
+
+// Close stops all listeners, closes open connections and waits for the
+// final flush
+func (s *Server) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.closeListeners()
+	if s.flushDone != nil {
+		<-s.flushDone
+	}
+}
+
+// closeListeners closes listeners and open connections and waits for them
+// to exit
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	s.closed = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	for conn := range s.streams {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// track registers an accepted connection so Close can close it, reporting
+// false when the server is already closing
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.streams[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.streams, conn)
+	s.mu.Unlock()
+}
+
+// runFlush writes the aggregated metrics every interval, and once more
+// on shutdown so samples received before it are kept
+func (s *Server) runFlush(ctx context.Context, interval time.Duration) {
+	defer close(s.flushDone)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(ctx)
+		case <-s.stop:
+			s.closeListeners()
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			s.flush(flushCtx)
+			cancel()
+			return
+		}
+	}
+}
+
+func (s *Server) flush(ctx context.Context) {
+	s.checkAPIKey()
+
+	metrics := s.aggregator.Flush()
+	if !s.authorized.Load() {
+		return
+	}
+	for _, metric := range metrics {
+		if err := s.qs.EnqueueMetric(ctx, metric); err != nil {
+			log.Printf("Failed to enqueue statsd metric %s: %v", metric.Name, err)
+		}
+	}
+}
+
+// checkAPIKey verifies the configured API key again so a revoked key stops
+// the server from accepting samples. Database failures keep the last
+// result rather than dropping samples on a transient error.
+func (s *Server) checkAPIKey() {
+	sc := s.cfg.StatsD
+
+	err := middleware.VerifyAPIKey(s.db, sc.ProjectID, sc.APIKey, models.ScopeMetricsWrite)
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusInternalServerError {
+		log.Printf("Failed to verify statsd api key: %v", err)
+		return
+	}
+
+	if err != nil && s.authorized.Load() {
+		log.Printf("StatsD api key rejected, dropping samples until it is valid: %v", err)
+	} else if err == nil && !s.authorized.Load() {
+		log.Printf("StatsD api key accepted again")
+	}
+	s.authorized.Store(err == nil)
+}
+
+func (s *Server) serveUDP(conn net.PacketConn) {
+	defer s.wg.Done()
+
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error reading statsd datagram: %v", err)
+			continue
+		}
+
+		// A datagram may carry several newline separated lines
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			s.handleLine(line)
+		}
+	}
+}
+
+func (s *Server) serveTCP(ln net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error accepting statsd connection: %v", err)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading statsd line from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		s.handleLine(scanner.Text())
+	}
+}
+
+func (s *Server) handleLine(line string) {
+	if !s.authorized.Load() || strings.TrimSpace(line) == "" {
+		return
+	}
+
+	sample, err := Parse(line)
+	if err != nil {
+		log.Printf("Skipping statsd line: %v", err)
+		return
+	}
+	if sample != nil {
+		s.aggregator.Add(sample)
+	}
+}
@@ -25,10 +25,32 @@ type Session struct {
 	UserAgent          string    `json:"user_agent"`          // User agent of the client
 	ActiveOrganization string    `json:"active_organization"` // Currently active organization
 	ExpiresAt          time.Time `json:"expires_at"`          // When the session expires
+	CreatedAt          time.Time `json:"created_at"`          // When the user signed in
+}
+
+// OAuth sign in in progress, kept in the session until the provider
+// redirects back
+type OAuthState struct {
+	Provider   string    `json:"provider"`     // Social provider name or SSO provider ID
+	State      string    `json:"state"`        // Sent to the provider and compared on callback
+	Nonce      string    `json:"nonce"`        // Bound into the ID token
+	Verifier   string    `json:"verifier"`     // PKCE code verifier
+	RedirectTo string    `json:"redirect_to"`  // Web app path to return to
+	LinkUserID string    `json:"link_user_id"` // User to link the account to, empty to sign in
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Sign in waiting for a second factor
+type PendingTwoFactor struct {
+	UserID             string    `json:"user_id"`
+	ActiveOrganization string    `json:"active_organization"` // Organization to activate, empty for the first one
+	ExpiresAt          time.Time `json:"expires_at"`
 }
 
 const (
-	SessionDataKey = "user"
+	SessionDataKey    = "user"
+	OAuthStateDataKey = "oauth"
+	TwoFactorDataKey  = "two_factor"
 )
 
 func New(cfg *config.Config) (*gorm.DB, error) {
@@ -0,0 +1,27 @@
+-- Create "elasticsearch_mappings" table
+CREATE TABLE "elasticsearch_mappings" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "timestamp_field" text NOT NULL DEFAULT '@timestamp',
+  "message_field" text NOT NULL DEFAULT 'message',
+  "level_field" text NOT NULL DEFAULT 'log.level',
+  "service_name_field" text NOT NULL DEFAULT 'service.name',
+  "environment_field" text NOT NULL DEFAULT 'service.environment',
+  "host_field" text NOT NULL DEFAULT 'host.name',
+  "method_field" text NOT NULL DEFAULT 'http.request.method',
+  "path_field" text NOT NULL DEFAULT 'url.path',
+  "status_code_field" text NOT NULL DEFAULT 'http.response.status_code',
+  "duration_field" text NOT NULL DEFAULT 'event.duration',
+  "duration_unit" text NOT NULL DEFAULT 'ns',
+  "ip_address_field" text NOT NULL DEFAULT 'source.ip',
+  "user_agent_field" text NOT NULL DEFAULT 'user_agent.original',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_elasticsearch_mappings_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_elasticsearch_mappings_deleted_at" to table: "elasticsearch_mappings"
+CREATE INDEX "idx_elasticsearch_mappings_deleted_at" ON "elasticsearch_mappings" ("deleted_at");
+-- Create index "idx_elasticsearch_mappings_project_id" to table: "elasticsearch_mappings"
+CREATE UNIQUE INDEX "idx_elasticsearch_mappings_project_id" ON "elasticsearch_mappings" ("project_id");
@@ -0,0 +1,19 @@
+-- Create "pipelines" table
+CREATE TABLE "pipelines" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "name" text NOT NULL,
+  "description" text NULL,
+  "enabled" boolean NOT NULL DEFAULT true,
+  "position" bigint NOT NULL DEFAULT 0,
+  "processors" jsonb NOT NULL DEFAULT '[]',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_pipelines_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_pipelines_deleted_at" to table: "pipelines"
+CREATE INDEX "idx_pipelines_deleted_at" ON "pipelines" ("deleted_at");
+-- Create index "idx_pipelines_project_id" to table: "pipelines"
+CREATE INDEX "idx_pipelines_project_id" ON "pipelines" ("project_id");
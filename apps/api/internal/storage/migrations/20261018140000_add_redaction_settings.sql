@@ -0,0 +1,19 @@
+-- Create "redaction_settings" table
+CREATE TABLE "redaction_settings" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "enabled" boolean NOT NULL DEFAULT true,
+  "mode" text NOT NULL DEFAULT 'mask',
+  "detectors" text[] NOT NULL DEFAULT '{authorization,cookie,credit_card,jwt}',
+  "rules" jsonb NOT NULL DEFAULT '[]',
+  "ip_anonymization" text NOT NULL DEFAULT 'none',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_redaction_settings_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_redaction_settings_deleted_at" to table: "redaction_settings"
+CREATE INDEX "idx_redaction_settings_deleted_at" ON "redaction_settings" ("deleted_at");
+-- Create index "idx_redaction_settings_project_id" to table: "redaction_settings"
+CREATE UNIQUE INDEX "idx_redaction_settings_project_id" ON "redaction_settings" ("project_id");
@@ -0,0 +1,40 @@
+-- Create "issues" table
+CREATE TABLE "issues" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "fingerprint" text NOT NULL,
+  "type" text NOT NULL,
+  "value" text NOT NULL DEFAULT '',
+  "culprit" text NOT NULL DEFAULT '',
+  "level" text NOT NULL DEFAULT 'error',
+  "service_name" text NOT NULL DEFAULT '',
+  "status" text NOT NULL DEFAULT 'unresolved',
+  "first_seen" timestamptz NOT NULL,
+  "last_seen" timestamptz NOT NULL,
+  "count" bigint NOT NULL DEFAULT 0,
+  "versions" text[] NOT NULL DEFAULT '{}',
+  "environments" text[] NOT NULL DEFAULT '{}',
+  "resolved_at" timestamptz NULL,
+  "resolved_in_version" text NULL,
+  "last_regressed_at" timestamptz NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_issues_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_issues_deleted_at" to table: "issues"
+CREATE INDEX "idx_issues_deleted_at" ON "issues" ("deleted_at");
+-- Create index "idx_issues_project_fingerprint" to table: "issues"
+CREATE UNIQUE INDEX "idx_issues_project_fingerprint" ON "issues" ("project_id", "fingerprint");
+-- Create index "idx_issues_status" to table: "issues"
+CREATE INDEX "idx_issues_status" ON "issues" ("status");
+-- Create index "idx_issues_last_seen" to table: "issues"
+CREATE INDEX "idx_issues_last_seen" ON "issues" ("last_seen");
+
+-- Add exception and issue columns to app_logs table
+ALTER TABLE "app_logs" ADD COLUMN "exception" jsonb NULL, ADD COLUMN "issue_id" text NULL;
+
+-- Create index for looking up the events of an issue
+CREATE INDEX "idx_app_logs_issue_time"
+ON "app_logs" ("issue_id", "timestamp" DESC) WHERE "issue_id" IS NOT NULL;
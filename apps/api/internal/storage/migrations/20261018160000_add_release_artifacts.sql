@@ -0,0 +1,19 @@
+-- Create "release_artifacts" table
+CREATE TABLE "release_artifacts" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "release" text NOT NULL,
+  "name" text NOT NULL,
+  "size" bigint NOT NULL,
+  "checksum" text NOT NULL,
+  "storage_key" text NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_release_artifacts_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_release_artifacts_deleted_at" to table: "release_artifacts"
+CREATE INDEX "idx_release_artifacts_deleted_at" ON "release_artifacts" ("deleted_at");
+-- Create index "idx_release_artifacts_name" to table: "release_artifacts"
+CREATE UNIQUE INDEX "idx_release_artifacts_name" ON "release_artifacts" ("project_id", "release", "name");
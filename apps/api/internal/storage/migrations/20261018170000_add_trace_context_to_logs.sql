@@ -0,0 +1,10 @@
+-- Add trace context columns to app_logs and request_logs tables
+ALTER TABLE "app_logs" ADD COLUMN "trace_id" text NULL, ADD COLUMN "span_id" text NULL;
+ALTER TABLE "request_logs" ADD COLUMN "trace_id" text NULL, ADD COLUMN "span_id" text NULL;
+
+-- Create indexes for looking up the logs of a trace
+CREATE INDEX "idx_app_logs_trace_time"
+ON "app_logs" ("trace_id", "timestamp" DESC) WHERE "trace_id" IS NOT NULL;
+
+CREATE INDEX "idx_request_logs_trace_time"
+ON "request_logs" ("trace_id", "timestamp" DESC) WHERE "trace_id" IS NOT NULL;
@@ -0,0 +1,19 @@
+-- Create "trace_sampling_settings" table
+CREATE TABLE "trace_sampling_settings" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "enabled" boolean NOT NULL DEFAULT false,
+  "keep_errors" boolean NOT NULL DEFAULT true,
+  "latency_threshold_ms" bigint NOT NULL DEFAULT 0,
+  "attribute_rules" jsonb NOT NULL DEFAULT '[]',
+  "sample_rate" numeric NOT NULL DEFAULT 0.1,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_trace_sampling_settings_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_trace_sampling_settings_deleted_at" to table: "trace_sampling_settings"
+CREATE INDEX "idx_trace_sampling_settings_deleted_at" ON "trace_sampling_settings" ("deleted_at");
+-- Create index "idx_trace_sampling_settings_project_id" to table: "trace_sampling_settings"
+CREATE UNIQUE INDEX "idx_trace_sampling_settings_project_id" ON "trace_sampling_settings" ("project_id");
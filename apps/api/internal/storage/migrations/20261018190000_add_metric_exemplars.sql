@@ -0,0 +1,6 @@
+-- Add observation interval and exemplars to metrics
+ALTER TABLE "metrics" ADD COLUMN "start_time" timestamptz NULL, ADD COLUMN "exemplars" jsonb NULL;
+
+-- Create index for looking up the exemplars of a metric
+CREATE INDEX "idx_metrics_exemplars"
+ON "metrics" ("project_id", "name", "timestamp" DESC) WHERE "exemplars" IS NOT NULL;
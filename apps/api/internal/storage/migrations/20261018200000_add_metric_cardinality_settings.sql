@@ -0,0 +1,17 @@
+-- Create "metric_cardinality_settings" table
+CREATE TABLE "metric_cardinality_settings" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "max_series_per_metric" bigint NOT NULL DEFAULT 0,
+  "action" text NOT NULL DEFAULT 'drop',
+  "metric_limits" jsonb NOT NULL DEFAULT '{}',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_metric_cardinality_settings_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_metric_cardinality_settings_deleted_at" to table: "metric_cardinality_settings"
+CREATE INDEX "idx_metric_cardinality_settings_deleted_at" ON "metric_cardinality_settings" ("deleted_at");
+-- Create index "idx_metric_cardinality_settings_project_id" to table: "metric_cardinality_settings"
+CREATE UNIQUE INDEX "idx_metric_cardinality_settings_project_id" ON "metric_cardinality_settings" ("project_id");
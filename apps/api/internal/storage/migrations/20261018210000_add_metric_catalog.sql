@@ -0,0 +1,41 @@
+-- Create "metric_catalog_entries" table
+CREATE TABLE "metric_catalog_entries" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "name" text NOT NULL,
+  "type" text NOT NULL,
+  "unit" text NOT NULL DEFAULT '',
+  "description" text NOT NULL DEFAULT '',
+  "services" text[] NOT NULL DEFAULT '{}',
+  "first_seen" timestamptz NOT NULL,
+  "last_seen" timestamptz NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_metric_catalog_entries_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_metric_catalog_entries_deleted_at" to table: "metric_catalog_entries"
+CREATE INDEX "idx_metric_catalog_entries_deleted_at" ON "metric_catalog_entries" ("deleted_at");
+-- Create index "idx_metric_catalog_entries_project_name" to table: "metric_catalog_entries"
+CREATE UNIQUE INDEX "idx_metric_catalog_entries_project_name" ON "metric_catalog_entries" ("project_id", "name");
+-- Create index "idx_metric_catalog_entries_last_seen" to table: "metric_catalog_entries"
+CREATE INDEX "idx_metric_catalog_entries_last_seen" ON "metric_catalog_entries" ("last_seen");
+-- Create "metric_catalog_attributes" table
+CREATE TABLE "metric_catalog_attributes" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "metric_name" text NOT NULL,
+  "key" text NOT NULL,
+  "sample_values" text[] NOT NULL DEFAULT '{}',
+  "last_seen" timestamptz NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_metric_catalog_attributes_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_metric_catalog_attributes_deleted_at" to table: "metric_catalog_attributes"
+CREATE INDEX "idx_metric_catalog_attributes_deleted_at" ON "metric_catalog_attributes" ("deleted_at");
+-- Create index "idx_metric_catalog_attributes_metric_key" to table: "metric_catalog_attributes"
+CREATE UNIQUE INDEX "idx_metric_catalog_attributes_metric_key" ON "metric_catalog_attributes" ("project_id", "metric_name", "key");
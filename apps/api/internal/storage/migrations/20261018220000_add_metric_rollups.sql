@@ -0,0 +1,125 @@
+-- Merge histogram bucket counts element-wise, used to roll up delta histograms
+CREATE FUNCTION metric_bucket_counts_add(state bigint[], counts bigint[]) RETURNS bigint[] AS $$
+    SELECT CASE
+        WHEN state IS NULL THEN counts
+        WHEN counts IS NULL THEN state
+        ELSE ARRAY(
+            SELECT COALESCE(a, 0) + COALESCE(b, 0)
+            FROM unnest(state, counts) WITH ORDINALITY AS u(a, b, i)
+            ORDER BY i
+        )
+    END
+$$ LANGUAGE sql IMMUTABLE;
+
+CREATE AGGREGATE metric_bucket_counts_sum(bigint[]) (
+    SFUNC = metric_bucket_counts_add,
+    STYPE = bigint[]
+);
+
+-- Create "metric_rollups_1m" table, metrics rolled up to 1 minute resolution
+CREATE TABLE "metric_rollups_1m" (
+    "bucket" timestamptz NOT NULL,
+    "project_id" text NOT NULL,
+    "name" text NOT NULL,
+    "type" metric_type NOT NULL,
+    "unit" text,
+    "service_name" text NOT NULL,
+    "attributes" jsonb,
+    "aggregation_temporality" aggregation_temporality NOT NULL,
+    "is_monotonic" boolean,
+    -- Identifies the series, a hash of its attributes and histogram bounds
+    "series_key" text NOT NULL,
+
+    -- Gauges and sums
+    "last_value" double precision,
+    "value_sum" double precision,
+    "value_min" double precision,
+    "value_max" double precision,
+    "point_count" bigint NOT NULL,
+
+    -- Histograms and summaries
+    "bounds" double precision[],
+    "bucket_counts" bigint[],
+    "count" bigint,
+    "sum" double precision,
+
+    FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "idx_metric_rollups_1m_series" ON "metric_rollups_1m" ("project_id", "name", "service_name", "series_key", "bucket");
+
+SELECT create_hypertable('metric_rollups_1m', 'bucket', chunk_time_interval => INTERVAL '1 day');
+
+SELECT add_retention_policy('metric_rollups_1m', INTERVAL '30 days');
+
+-- Create "metric_rollups_1h" table, metrics rolled up to 1 hour resolution
+CREATE TABLE "metric_rollups_1h" (
+    "bucket" timestamptz NOT NULL,
+    "project_id" text NOT NULL,
+    "name" text NOT NULL,
+    "type" metric_type NOT NULL,
+    "unit" text,
+    "service_name" text NOT NULL,
+    "attributes" jsonb,
+    "aggregation_temporality" aggregation_temporality NOT NULL,
+    "is_monotonic" boolean,
+    -- Identifies the series, a hash of its attributes and histogram bounds
+    "series_key" text NOT NULL,
+
+    -- Gauges and sums
+    "last_value" double precision,
+    "value_sum" double precision,
+    "value_min" double precision,
+    "value_max" double precision,
+    "point_count" bigint NOT NULL,
+
+    -- Histograms and summaries
+    "bounds" double precision[],
+    "bucket_counts" bigint[],
+    "count" bigint,
+    "sum" double precision,
+
+    FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "idx_metric_rollups_1h_series" ON "metric_rollups_1h" ("project_id", "name", "service_name", "series_key", "bucket");
+
+SELECT create_hypertable('metric_rollups_1h', 'bucket', chunk_time_interval => INTERVAL '7 days');
+
+SELECT add_retention_policy('metric_rollups_1h', INTERVAL '395 days');
+
+-- Create "metric_rollups_1d" table, metrics rolled up to 1 day resolution
+CREATE TABLE "metric_rollups_1d" (
+    "bucket" timestamptz NOT NULL,
+    "project_id" text NOT NULL,
+    "name" text NOT NULL,
+    "type" metric_type NOT NULL,
+    "unit" text,
+    "service_name" text NOT NULL,
+    "attributes" jsonb,
+    "aggregation_temporality" aggregation_temporality NOT NULL,
+    "is_monotonic" boolean,
+    -- Identifies the series, a hash of its attributes and histogram bounds
+    "series_key" text NOT NULL,
+
+    -- Gauges and sums
+    "last_value" double precision,
+    "value_sum" double precision,
+    "value_min" double precision,
+    "value_max" double precision,
+    "point_count" bigint NOT NULL,
+
+    -- Histograms and summaries
+    "bounds" double precision[],
+    "bucket_counts" bigint[],
+    "count" bigint,
+    "sum" double precision,
+
+    FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX "idx_metric_rollups_1d_series" ON "metric_rollups_1d" ("project_id", "name", "service_name", "series_key", "bucket");
+
+SELECT create_hypertable('metric_rollups_1d', 'bucket', chunk_time_interval => INTERVAL '90 days');
+
+SELECT add_retention_policy('metric_rollups_1d', INTERVAL '1825 days');
@@ -0,0 +1,23 @@
+-- Create index "idx_accounts_provider_account" to table: "accounts"
+CREATE UNIQUE INDEX "idx_accounts_provider_account" ON "accounts" ("provider_id", "account_id") WHERE (account_id <> ''::text);
+-- Create "sso_providers" table
+CREATE TABLE "sso_providers" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "organization_id" text NOT NULL,
+  "issuer" text NOT NULL,
+  "client_id" text NOT NULL,
+  "client_secret" text NOT NULL,
+  "allowed_domains" text[] NOT NULL DEFAULT '{}',
+  "auto_join" boolean NOT NULL DEFAULT true,
+  "default_role" text NOT NULL DEFAULT 'member',
+  "enabled" boolean NOT NULL DEFAULT true,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_sso_providers_organization" FOREIGN KEY ("organization_id") REFERENCES "organizations" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_sso_providers_deleted_at" to table: "sso_providers"
+CREATE INDEX "idx_sso_providers_deleted_at" ON "sso_providers" ("deleted_at");
+-- Create index "idx_sso_providers_organization_id" to table: "sso_providers"
+CREATE UNIQUE INDEX "idx_sso_providers_organization_id" ON "sso_providers" ("organization_id");
@@ -0,0 +1,6 @@
+-- Modify "users" table
+ALTER TABLE "users" ADD COLUMN "sessions_revoked_at" timestamptz NULL;
+-- Create index "idx_verifications_identifier" to table: "verifications"
+CREATE INDEX "idx_verifications_identifier" ON "verifications" ("identifier");
+-- Create index "idx_verifications_value" to table: "verifications"
+CREATE INDEX "idx_verifications_value" ON "verifications" ("value");
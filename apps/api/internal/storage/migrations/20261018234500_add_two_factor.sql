@@ -0,0 +1,22 @@
+-- Modify "users" table
+ALTER TABLE "users" ADD COLUMN "two_factor_enabled" boolean NOT NULL DEFAULT false;
+-- Modify "organizations" table
+ALTER TABLE "organizations" ADD COLUMN "require_two_factor" boolean NOT NULL DEFAULT false;
+-- Create "two_factors" table
+CREATE TABLE "two_factors" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "user_id" text NOT NULL,
+  "secret" text NOT NULL,
+  "confirmed_at" timestamptz NULL,
+  "last_used_step" bigint NOT NULL DEFAULT 0,
+  "recovery_codes" text[] NOT NULL DEFAULT '{}',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_two_factors_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_two_factors_deleted_at" to table: "two_factors"
+CREATE INDEX "idx_two_factors_deleted_at" ON "two_factors" ("deleted_at");
+-- Create index "idx_two_factors_user_id" to table: "two_factors"
+CREATE UNIQUE INDEX "idx_two_factors_user_id" ON "two_factors" ("user_id");
@@ -0,0 +1,21 @@
+-- Create "sessions" table
+CREATE TABLE "sessions" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "token_hash" text NOT NULL,
+  "user_id" text NOT NULL,
+  "ip_address" text NULL,
+  "user_agent" text NULL,
+  "expires_at" timestamptz NOT NULL,
+  "last_seen_at" timestamptz NOT NULL,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_sessions_deleted_at" to table: "sessions"
+CREATE INDEX "idx_sessions_deleted_at" ON "sessions" ("deleted_at");
+-- Create index "idx_sessions_token_hash" to table: "sessions"
+CREATE UNIQUE INDEX "idx_sessions_token_hash" ON "sessions" ("token_hash");
+-- Create index "idx_sessions_user_id" to table: "sessions"
+CREATE INDEX "idx_sessions_user_id" ON "sessions" ("user_id");
@@ -0,0 +1,36 @@
+-- Create "project_members" table
+CREATE TABLE "project_members" (
+  "id" text NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "project_id" text NOT NULL,
+  "user_id" text NOT NULL,
+  "role" text NOT NULL DEFAULT 'viewer',
+  PRIMARY KEY ("id"),
+  CONSTRAINT "fk_project_members_project" FOREIGN KEY ("project_id") REFERENCES "projects" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION,
+  CONSTRAINT "fk_project_members_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION
+);
+-- Create index "idx_project_members_deleted_at" to table: "project_members"
+CREATE INDEX "idx_project_members_deleted_at" ON "project_members" ("deleted_at");
+-- Create index "idx_project_members_project_user" to table: "project_members"
+CREATE UNIQUE INDEX "idx_project_members_project_user" ON "project_members" ("project_id", "user_id");
+-- Create index "idx_project_members_user_id" to table: "project_members"
+CREATE INDEX "idx_project_members_user_id" ON "project_members" ("user_id");
+-- Backfill "project_members": organization members keep editing the projects of their organization.
+-- IDs are TypeIDs, a UUIDv7 encoded as 26 base32 characters after the prefix.
+INSERT INTO "project_members" ("id", "created_at", "updated_at", "project_id", "user_id", "role")
+SELECT
+  'pmem_' || (
+    SELECT string_agg(substr('0123456789abcdefghjkmnpqrstvwxyz', substring(u.bits FROM i * 5 + 1 FOR 5)::bit(5)::integer + 1, 1), '' ORDER BY i)
+    FROM generate_series(0, 25) AS i
+  ),
+  now(), now(), p.id, tm.user_id, 'editor'
+FROM "team_memberships" tm
+JOIN "projects" p ON p.organization_id = tm.organization_id AND p.deleted_at IS NULL
+CROSS JOIN LATERAL (
+  SELECT B'00' || ('x' || lpad(to_hex((extract(epoch FROM clock_timestamp()) * 1000)::bigint), 12, '0') || '7' || substr(r.hex, 14, 3) || '8' || substr(r.hex, 18, 15))::bit(128) AS bits
+  FROM (SELECT replace(gen_random_uuid()::text, '-', '') AS hex) r
+) u
+WHERE tm.role = 'member' AND tm.deleted_at IS NULL
+ON CONFLICT ("project_id", "user_id") DO NOTHING;
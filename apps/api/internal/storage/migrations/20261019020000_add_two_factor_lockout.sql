@@ -0,0 +1,2 @@
+-- Modify "two_factors" table
+ALTER TABLE "two_factors" ADD COLUMN "failed_attempts" bigint NOT NULL DEFAULT 0, ADD COLUMN "locked_until" timestamptz NULL;
@@ -0,0 +1,8 @@
+-- Modify "sso_providers" table
+ALTER TABLE "sso_providers" ADD COLUMN "verified_domains" text[] NOT NULL DEFAULT '{}', ADD COLUMN "domain_verification_token" text NOT NULL DEFAULT '';
+-- Existing providers get a token, their domains must be verified before use
+UPDATE "sso_providers" SET "domain_verification_token" = replace(gen_random_uuid()::text, '-', '') || replace(gen_random_uuid()::text, '-', '');
+-- Emails of users created through SSO were asserted by the organization's issuer, not verified
+UPDATE "users" SET "email_verified" = false
+WHERE EXISTS (SELECT 1 FROM "accounts" WHERE "accounts"."user_id" = "users"."id" AND "accounts"."provider_id" LIKE 'sso:%')
+  AND NOT EXISTS (SELECT 1 FROM "accounts" WHERE "accounts"."user_id" = "users"."id" AND "accounts"."provider_id" NOT LIKE 'sso:%');
@@ -0,0 +1,2 @@
+-- Modify "redaction_settings" table
+ALTER TABLE "redaction_settings" ALTER COLUMN "detectors" SET DEFAULT '{authorization,cookie}';
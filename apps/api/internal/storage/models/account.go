@@ -10,9 +10,9 @@ import (
 
 type Account struct {
 	storage.BaseModel
-	AccountID             string    `gorm:"not null" json:"account_id"`    // External account ID from provider
-	ProviderID            string    `gorm:"not null" json:"provider_id"`   // Provider name (google, github)
-	UserID                string    `gorm:"index;not null" json:"user_id"` // User this account belongs to
+	AccountID             string    `gorm:"not null;uniqueIndex:idx_accounts_provider_account,priority:2,where:account_id <> ''" json:"account_id"` // External account ID from provider
+	ProviderID            string    `gorm:"not null;uniqueIndex:idx_accounts_provider_account,priority:1" json:"provider_id"`                       // Provider name (password, google, github, sso:<provider ID>)
+	UserID                string    `gorm:"index;not null" json:"user_id"`                                                                          // User this account belongs to
 	User                  *User     `json:"user" gorm:"foreignKey:UserID"`
 	AccessToken           string    `json:"-"`                        // OAuth access token
 	RefreshToken          string    `json:"-"`                        // OAuth refresh token
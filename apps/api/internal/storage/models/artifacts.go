@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// ReleaseArtifact is a source map uploaded for a release. Name is the URL of
+// the minified file it maps, either absolute or as "~/path" to match any
+// host.
+type ReleaseArtifact struct {
+	storage.BaseModel
+	ProjectID  string   `gorm:"not null;uniqueIndex:idx_release_artifacts_name" json:"project_id"`
+	Project    *Project `json:"-"`
+	Release    string   `gorm:"not null;uniqueIndex:idx_release_artifacts_name" json:"release"`
+	Name       string   `gorm:"not null;uniqueIndex:idx_release_artifacts_name" json:"name"`
+	Size       int64    `gorm:"not null" json:"size"`
+	Checksum   string   `gorm:"not null" json:"checksum"` // sha256 of the content
+	StorageKey string   `gorm:"not null" json:"-"`
+}
+
+func (a ReleaseArtifact) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(a.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = a.ProjectID
+	result["release"] = a.Release
+	result["name"] = a.Name
+	result["size"] = a.Size
+	result["checksum"] = a.Checksum
+
+	return json.Marshal(result)
+}
+
+func (a *ReleaseArtifact) BeforeCreate(tx *gorm.DB) error {
+	if a.BaseModel.ID == "" {
+		id, err := typeid.New[ReleaseArtifactID]()
+		if err != nil {
+			return err
+		}
+		a.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Actions taken on a metric point that would create a series beyond the
+// limit
+const (
+	CardinalityActionDrop           = "drop"            // the point is dropped
+	CardinalityActionStripAttribute = "strip_attribute" // the attribute with the most values is removed
+)
+
+// MetricCardinalitySettings limits the number of active series per metric
+// of a project. A series is a metric name, service and attribute set.
+type MetricCardinalitySettings struct {
+	storage.BaseModel
+	ProjectID          string   `gorm:"uniqueIndex;not null" json:"project_id"`
+	Project            *Project `json:"-"`
+	MaxSeriesPerMetric int64    `gorm:"not null;default:0" json:"max_series_per_metric"` // 0 disables the limit
+	Action             string   `gorm:"not null;default:'drop'" json:"action"`
+	MetricLimits       string   `gorm:"type:jsonb;not null;default:'{}'" json:"-"` // JSON object of metric name -> limit, overriding MaxSeriesPerMetric
+}
+
+// DefaultMetricCardinalitySettings returns the settings used for projects
+// that have not configured limits, which are unlimited
+func DefaultMetricCardinalitySettings(projectID string) MetricCardinalitySettings {
+	return MetricCardinalitySettings{
+		ProjectID:    projectID,
+		Action:       CardinalityActionDrop,
+		MetricLimits: "{}",
+	}
+}
+
+func (s MetricCardinalitySettings) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(s.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = s.ProjectID
+	result["max_series_per_metric"] = s.MaxSeriesPerMetric
+	result["action"] = s.Action
+	result["metric_limits"] = json.RawMessage(s.MetricLimits)
+
+	return json.Marshal(result)
+}
+
+func (s *MetricCardinalitySettings) BeforeCreate(tx *gorm.DB) error {
+	if s.BaseModel.ID == "" {
+		id, err := typeid.New[MetricCardinalitySettingsID]()
+		if err != nil {
+			return err
+		}
+		s.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// ElasticsearchMapping describes where the Elasticsearch compatible bulk API
+// finds log attributes in incoming documents. Fields are dotted paths, e.g.
+// "log.level", matched against both nested objects and flattened keys.
+// Defaults follow the Elastic Common Schema used by Filebeat and Logstash.
+type ElasticsearchMapping struct {
+	storage.BaseModel
+	ProjectID        string   `gorm:"uniqueIndex;not null" json:"project_id"`
+	Project          *Project `json:"-"`
+	TimestampField   string   `gorm:"not null;default:'@timestamp'" json:"timestamp_field"`
+	MessageField     string   `gorm:"not null;default:'message'" json:"message_field"`
+	LevelField       string   `gorm:"not null;default:'log.level'" json:"level_field"`
+	ServiceNameField string   `gorm:"not null;default:'service.name'" json:"service_name_field"`
+	EnvironmentField string   `gorm:"not null;default:'service.environment'" json:"environment_field"`
+	HostField        string   `gorm:"not null;default:'host.name'" json:"host_field"`
+
+	// Request log fields, a document is treated as an access log when the
+	// method, path and status code fields are all present
+	MethodField     string `gorm:"not null;default:'http.request.method'" json:"method_field"`
+	PathField       string `gorm:"not null;default:'url.path'" json:"path_field"`
+	StatusCodeField string `gorm:"not null;default:'http.response.status_code'" json:"status_code_field"`
+	DurationField   string `gorm:"not null;default:'event.duration'" json:"duration_field"`
+	DurationUnit    string `gorm:"not null;default:'ns'" json:"duration_unit"` // ns, us, ms or s
+	IPAddressField  string `gorm:"not null;default:'source.ip'" json:"ip_address_field"`
+	UserAgentField  string `gorm:"not null;default:'user_agent.original'" json:"user_agent_field"`
+}
+
+// DefaultElasticsearchMapping returns the mapping used for projects that have
+// not configured one
+func DefaultElasticsearchMapping(projectID string) ElasticsearchMapping {
+	return ElasticsearchMapping{
+		ProjectID:        projectID,
+		TimestampField:   "@timestamp",
+		MessageField:     "message",
+		LevelField:       "log.level",
+		ServiceNameField: "service.name",
+		EnvironmentField: "service.environment",
+		HostField:        "host.name",
+		MethodField:      "http.request.method",
+		PathField:        "url.path",
+		StatusCodeField:  "http.response.status_code",
+		DurationField:    "event.duration",
+		DurationUnit:     "ns",
+		IPAddressField:   "source.ip",
+		UserAgentField:   "user_agent.original",
+	}
+}
+
+func (m *ElasticsearchMapping) BeforeCreate(tx *gorm.DB) error {
+	if m.BaseModel.ID == "" {
+		id, err := typeid.New[ElasticsearchMappingID]()
+		if err != nil {
+			return err
+		}
+		m.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Issue statuses
+const (
+	IssueStatusUnresolved = "unresolved"
+	IssueStatusResolved   = "resolved"
+	IssueStatusIgnored    = "ignored" // new occurrences are counted but never reopen the issue
+)
+
+var IssueStatuses = []interface{}{
+	IssueStatusUnresolved,
+	IssueStatusResolved,
+	IssueStatusIgnored,
+}
+
+// Issue groups app logs carrying the same exception, identified by the
+// fingerprint of its type and normalized stack
+type Issue struct {
+	storage.BaseModel
+	ProjectID    string         `gorm:"not null;uniqueIndex:idx_issues_project_fingerprint" json:"project_id"`
+	Project      *Project       `json:"-"`
+	Fingerprint  string         `gorm:"not null;uniqueIndex:idx_issues_project_fingerprint" json:"fingerprint"`
+	Type         string         `gorm:"not null" json:"type"`
+	Value        string         `gorm:"not null;default:''" json:"value"`   // message of the first occurrence
+	Culprit      string         `gorm:"not null;default:''" json:"culprit"` // function and file of the top in app frame
+	Level        string         `gorm:"not null;default:'error'" json:"level"`
+	ServiceName  string         `gorm:"not null;default:''" json:"service_name"`
+	Status       string         `gorm:"not null;default:'unresolved';index" json:"status"`
+	FirstSeen    time.Time      `gorm:"not null" json:"first_seen"`
+	LastSeen     time.Time      `gorm:"not null;index" json:"last_seen"`
+	Count        int64          `gorm:"not null;default:0" json:"count"`
+	Versions     pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"versions"`
+	Environments pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"environments"`
+
+	ResolvedAt        *time.Time `json:"resolved_at"`
+	ResolvedInVersion *string    `json:"resolved_in_version"` // latest version seen when the issue was resolved
+	LastRegressedAt   *time.Time `json:"last_regressed_at"`
+}
+
+func (i Issue) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(i.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = i.ProjectID
+	result["fingerprint"] = i.Fingerprint
+	result["type"] = i.Type
+	result["value"] = i.Value
+	result["culprit"] = i.Culprit
+	result["level"] = i.Level
+	result["service_name"] = i.ServiceName
+	result["status"] = i.Status
+	result["first_seen"] = i.FirstSeen
+	result["last_seen"] = i.LastSeen
+	result["count"] = i.Count
+	result["versions"] = i.Versions
+	result["environments"] = i.Environments
+	result["resolved_at"] = i.ResolvedAt
+	result["resolved_in_version"] = i.ResolvedInVersion
+	result["last_regressed_at"] = i.LastRegressedAt
+
+	return json.Marshal(result)
+}
+
+func (i *Issue) BeforeCreate(tx *gorm.DB) error {
+	if i.BaseModel.ID == "" {
+		id, err := typeid.New[IssueID]()
+		if err != nil {
+			return err
+		}
+		i.BaseModel.ID = id.String()
+	}
+	return nil
+}
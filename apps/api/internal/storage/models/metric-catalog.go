@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// MetricCatalogEntry describes a metric a project has reported. Entries are
+// maintained at ingest time.
+type MetricCatalogEntry struct {
+	storage.BaseModel
+	ProjectID   string         `gorm:"not null;uniqueIndex:idx_metric_catalog_entries_project_name" json:"project_id"`
+	Project     *Project       `json:"-"`
+	Name        string         `gorm:"not null;uniqueIndex:idx_metric_catalog_entries_project_name" json:"name"`
+	Type        string         `gorm:"not null" json:"type"` // type of the latest point
+	Unit        string         `gorm:"not null;default:''" json:"unit"`
+	Description string         `gorm:"not null;default:''" json:"description"`
+	Services    pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"services"` // services that emitted the metric
+	FirstSeen   time.Time      `gorm:"not null" json:"first_seen"`
+	LastSeen    time.Time      `gorm:"not null;index" json:"last_seen"`
+
+	Attributes []MetricCatalogAttribute `gorm:"-" json:"attributes,omitempty"`
+}
+
+func (e MetricCatalogEntry) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(e.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = e.ProjectID
+	result["name"] = e.Name
+	result["type"] = e.Type
+	result["unit"] = e.Unit
+	result["description"] = e.Description
+	result["services"] = e.Services
+	result["first_seen"] = e.FirstSeen
+	result["last_seen"] = e.LastSeen
+	if e.Attributes != nil {
+		result["attributes"] = e.Attributes
+	}
+
+	return json.Marshal(result)
+}
+
+func (e *MetricCatalogEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.BaseModel.ID == "" {
+		id, err := typeid.New[MetricCatalogEntryID]()
+		if err != nil {
+			return err
+		}
+		e.BaseModel.ID = id.String()
+	}
+	return nil
+}
+
+// MetricCatalogAttribute is an attribute key seen on a metric, with a few
+// of its values
+type MetricCatalogAttribute struct {
+	storage.BaseModel
+	ProjectID    string         `gorm:"not null;uniqueIndex:idx_metric_catalog_attributes_metric_key" json:"project_id"`
+	Project      *Project       `json:"-"`
+	MetricName   string         `gorm:"not null;uniqueIndex:idx_metric_catalog_attributes_metric_key" json:"metric_name"`
+	Key          string         `gorm:"not null;uniqueIndex:idx_metric_catalog_attributes_metric_key" json:"key"`
+	SampleValues pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"sample_values"`
+	LastSeen     time.Time      `gorm:"not null" json:"last_seen"`
+}
+
+func (a MetricCatalogAttribute) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(a.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = a.ProjectID
+	result["metric_name"] = a.MetricName
+	result["key"] = a.Key
+	result["sample_values"] = a.SampleValues
+	result["last_seen"] = a.LastSeen
+
+	return json.Marshal(result)
+}
+
+func (a *MetricCatalogAttribute) BeforeCreate(tx *gorm.DB) error {
+	if a.BaseModel.ID == "" {
+		id, err := typeid.New[MetricCatalogAttributeID]()
+		if err != nil {
+			return err
+		}
+		a.BaseModel.ID = id.String()
+	}
+	return nil
+}
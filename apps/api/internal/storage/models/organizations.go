@@ -17,14 +17,15 @@ import (
 // Organization represents a team or organization that owns projects
 type Organization struct {
 	storage.BaseModel
-	Name        string           `gorm:"not null" json:"name"`
-	Slug        string           `gorm:"not null;unique" json:"slug"`
-	Logo        sql.NullString   `json:"logo"`
-	Description string           `json:"description"`
-	CreatedByID string           `gorm:"index;not null" json:"created_by_id"` // User ID who created the organisation
-	CreatedBy   User             `json:"created_by" gorm:"foreignKey:CreatedByID"`
-	Projects    []Project        `json:"projects"`
-	Members     []TeamMembership `json:"members" gorm:"foreignKey:OrganizationID"`
+	Name             string           `gorm:"not null" json:"name"`
+	Slug             string           `gorm:"not null;unique" json:"slug"`
+	Logo             sql.NullString   `json:"logo"`
+	Description      string           `json:"description"`
+	RequireTwoFactor bool             `gorm:"not null;default:false" json:"require_two_factor"` // members must enable 2FA to access the organization
+	CreatedByID      string           `gorm:"index;not null" json:"created_by_id"`              // User ID who created the organisation
+	CreatedBy        User             `json:"created_by" gorm:"foreignKey:CreatedByID"`
+	Projects         []Project        `json:"projects"`
+	Members          []TeamMembership `json:"members" gorm:"foreignKey:OrganizationID"`
 }
 
 func (o *Organization) BeforeCreate(tx *gorm.DB) (err error) {
@@ -70,6 +71,7 @@ func (o Organization) MarshalJSON() ([]byte, error) {
 		result["logo"] = nil
 	}
 	result["description"] = o.Description
+	result["require_two_factor"] = o.RequireTwoFactor
 	result["created_by"] = o.CreatedBy
 	result["projects"] = o.Projects
 	result["members"] = o.Members
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Pipeline is an ordered list of processors applied to a project's app logs
+// at ingest. A project's enabled pipelines run in position order.
+type Pipeline struct {
+	storage.BaseModel
+	ProjectID   string         `gorm:"index;not null" json:"project_id"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description sql.NullString `json:"-"`
+	Enabled     bool           `gorm:"not null;default:true" json:"enabled"`
+	Position    int            `gorm:"not null;default:0" json:"position"`
+	Processors  string         `gorm:"type:jsonb;not null;default:'[]'" json:"-"` // JSON array of processor configs
+	Project     *Project       `json:"-"`
+}
+
+func (p Pipeline) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(p.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = p.ProjectID
+	result["name"] = p.Name
+	result["description"] = nil
+	if p.Description.Valid {
+		result["description"] = p.Description.String
+	}
+	result["enabled"] = p.Enabled
+	result["position"] = p.Position
+	result["processors"] = json.RawMessage(p.Processors)
+
+	return json.Marshal(result)
+}
+
+func (p *Pipeline) BeforeCreate(tx *gorm.DB) error {
+	if p.BaseModel.ID == "" {
+		id, err := typeid.New[PipelineID]()
+		if err != nil {
+			return err
+		}
+		p.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -71,3 +71,87 @@ type InvitationPrefix struct{}
 func (InvitationPrefix) Prefix() string { return "inv" }
 
 type InvitationID = typeid.Sortable[InvitationPrefix]
+
+// ElasticsearchMapping prefix for TypeID
+type ElasticsearchMappingPrefix struct{}
+
+func (ElasticsearchMappingPrefix) Prefix() string { return "esmap" }
+
+type ElasticsearchMappingID = typeid.Sortable[ElasticsearchMappingPrefix]
+
+// Pipeline prefix for TypeID
+type PipelinePrefix struct{}
+
+func (PipelinePrefix) Prefix() string { return "pipe" }
+
+type PipelineID = typeid.Sortable[PipelinePrefix]
+
+// RedactionSettings prefix for TypeID
+type RedactionSettingsPrefix struct{}
+
+func (RedactionSettingsPrefix) Prefix() string { return "redact" }
+
+type RedactionSettingsID = typeid.Sortable[RedactionSettingsPrefix]
+
+// Issue prefix for TypeID
+type IssuePrefix struct{}
+
+func (IssuePrefix) Prefix() string { return "iss" }
+
+type IssueID = typeid.Sortable[IssuePrefix]
+
+// ReleaseArtifact prefix for TypeID
+type ReleaseArtifactPrefix struct{}
+
+func (ReleaseArtifactPrefix) Prefix() string { return "art" }
+
+type ReleaseArtifactID = typeid.Sortable[ReleaseArtifactPrefix]
+
+// TraceSamplingSettings prefix for TypeID
+type TraceSamplingSettingsPrefix struct{}
+
+func (TraceSamplingSettingsPrefix) Prefix() string { return "samp" }
+
+type TraceSamplingSettingsID = typeid.Sortable[TraceSamplingSettingsPrefix]
+
+// MetricCardinalitySettings prefix for TypeID
+type MetricCardinalitySettingsPrefix struct{}
+
+func (MetricCardinalitySettingsPrefix) Prefix() string { return "card" }
+
+type MetricCardinalitySettingsID = typeid.Sortable[MetricCardinalitySettingsPrefix]
+
+// MetricCatalogEntry prefix for TypeID
+type MetricCatalogEntryPrefix struct{}
+
+func (MetricCatalogEntryPrefix) Prefix() string { return "mcat" }
+
+type MetricCatalogEntryID = typeid.Sortable[MetricCatalogEntryPrefix]
+
+// MetricCatalogAttribute prefix for TypeID
+type MetricCatalogAttributePrefix struct{}
+
+func (MetricCatalogAttributePrefix) Prefix() string { return "mattr" }
+
+type MetricCatalogAttributeID = typeid.Sortable[MetricCatalogAttributePrefix]
+
+// SSOProvider prefix for TypeID
+type SSOProviderPrefix struct{}
+
+func (SSOProviderPrefix) Prefix() string { return "sso" }
+
+type SSOProviderID = typeid.Sortable[SSOProviderPrefix]
+
+// TwoFactor prefix for TypeID
+type TwoFactorPrefix struct{}
+
+func (TwoFactorPrefix) Prefix() string { return "tfa" }
+
+type TwoFactorID = typeid.Sortable[TwoFactorPrefix]
+
+// ProjectMember prefix for TypeID
+type ProjectMemberPrefix struct{}
+
+func (ProjectMemberPrefix) Prefix() string { return "pmem" }
+
+type ProjectMemberID = typeid.Sortable[ProjectMemberPrefix]
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// ProjectRole defines the permission level within a single project
+type ProjectRole string
+
+const (
+	ProjectRoleViewer ProjectRole = "viewer" // Can read telemetry, without request and response bodies or headers
+	ProjectRoleEditor ProjectRole = "editor" // Can read everything, triage issues and configure ingestion
+	ProjectRoleAdmin  ProjectRole = "admin"  // Can also delete data, manage API keys, members and the project itself
+)
+
+// Permission is a single action on a project, granted through project roles
+type Permission string
+
+const (
+	PermissionViewProject       Permission = "project:view"
+	PermissionViewRequestBodies Permission = "requests:view_bodies" // Request and response bodies and headers
+	PermissionTriageIssues      Permission = "issues:triage"
+	PermissionManageSettings    Permission = "project:settings" // Pipelines, channels, artifacts, mappings, sampling and limits
+	PermissionDeleteLogs        Permission = "logs:delete"
+	PermissionManageAPIKeys     Permission = "project:api_keys"
+	PermissionManageMembers     Permission = "project:members"
+	PermissionManageProject     Permission = "project:manage" // Project details, redaction and deletion
+)
+
+var projectRolePermissions = map[ProjectRole][]Permission{
+	ProjectRoleViewer: {
+		PermissionViewProject,
+	},
+	ProjectRoleEditor: {
+		PermissionViewProject,
+		PermissionViewRequestBodies,
+		PermissionTriageIssues,
+		PermissionManageSettings,
+	},
+	ProjectRoleAdmin: {
+		PermissionViewProject,
+		PermissionViewRequestBodies,
+		PermissionTriageIssues,
+		PermissionManageSettings,
+		PermissionDeleteLogs,
+		PermissionManageAPIKeys,
+		PermissionManageMembers,
+		PermissionManageProject,
+	},
+}
+
+// Valid reports whether r is a known project role
+func (r ProjectRole) Valid() bool {
+	_, ok := projectRolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants the permission
+func (r ProjectRole) Can(permission Permission) bool {
+	return slices.Contains(projectRolePermissions[r], permission)
+}
+
+// Permissions returns the permissions granted by the role
+func (r ProjectRole) Permissions() []Permission {
+	return slices.Clone(projectRolePermissions[r])
+}
+
+// ProjectRoleFor returns the project role implied by an organization role.
+// Owners and admins administer every project, members only get access
+// through a ProjectMember row.
+func ProjectRoleFor(role Role) (ProjectRole, bool) {
+	if role == RoleOwner || role == RoleAdmin {
+		return ProjectRoleAdmin, true
+	}
+	return "", false
+}
+
+// ProjectMember assigns an organization member a role on a project
+type ProjectMember struct {
+	storage.BaseModel
+	ProjectID string      `gorm:"not null;uniqueIndex:idx_project_members_project_user" json:"project_id"`
+	Project   *Project    `json:"-"`
+	UserID    string      `gorm:"not null;uniqueIndex:idx_project_members_project_user;index" json:"user_id"`
+	User      User        `json:"user" gorm:"foreignKey:UserID"`
+	Role      ProjectRole `gorm:"not null;default:'viewer'" json:"role"`
+}
+
+func (m *ProjectMember) BeforeCreate(tx *gorm.DB) error {
+	if m.BaseModel.ID == "" {
+		id, err := typeid.New[ProjectMemberID]()
+		if err != nil {
+			return err
+		}
+		m.BaseModel.ID = id.String()
+	}
+	return nil
+}
+
+func (m ProjectMember) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(m.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = m.ProjectID
+	result["user_id"] = m.UserID
+	result["role"] = m.Role
+	result["permissions"] = m.Role.Permissions()
+	result["user"] = OtherUser{
+		BaseModel: m.User.BaseModel,
+		Name:      m.User.Name,
+		Email:     m.User.Email,
+		Image:     m.User.Image,
+	}
+
+	return json.Marshal(result)
+}
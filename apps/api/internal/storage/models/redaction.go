@@ -0,0 +1,116 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Redaction modes
+const (
+	RedactionModeMask   = "mask"   // replace with a placeholder naming the detector
+	RedactionModeHash   = "hash"   // replace with a keyed hash, equal values stay correlatable
+	RedactionModeRemove = "remove" // drop the key, or the matched text inside strings
+)
+
+// Built-in redaction detectors
+const (
+	RedactionDetectorAuthorization = "authorization" // Authorization, Proxy-Authorization and API key headers
+	RedactionDetectorCookie        = "cookie"        // Cookie and Set-Cookie headers
+	RedactionDetectorCreditCard    = "credit_card"   // Luhn valid card numbers
+	RedactionDetectorEmail         = "email"
+	RedactionDetectorJWT           = "jwt"
+	RedactionDetectorIP            = "ip" // IPv4 and IPv6 addresses inside headers and bodies
+)
+
+var RedactionDetectors = []string{
+	RedactionDetectorAuthorization,
+	RedactionDetectorCookie,
+	RedactionDetectorCreditCard,
+	RedactionDetectorEmail,
+	RedactionDetectorJWT,
+	RedactionDetectorIP,
+}
+
+// IP anonymization modes for a request log's IPAddress, app logs have no
+// client address
+const (
+	IPAnonymizationNone     = "none"
+	IPAnonymizationTruncate = "truncate" // zero the last IPv4 octet or the last 80 IPv6 bits
+	IPAnonymizationHash     = "hash"
+	IPAnonymizationRemove   = "remove"
+)
+
+// RedactionRule is a project specific rule. Key rules match object keys
+// case-insensitively at any depth, regex rules match inside string values.
+type RedactionRule struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"` // key or regex
+	Pattern string `json:"pattern"`
+	Mode    string `json:"mode,omitempty"` // overrides the settings mode
+}
+
+// RedactionSettings controls how request and app logs are redacted at ingest
+type RedactionSettings struct {
+	storage.BaseModel
+	ProjectID       string         `gorm:"uniqueIndex;not null" json:"project_id"`
+	Project         *Project       `json:"-"`
+	Enabled         bool           `gorm:"not null;default:true" json:"enabled"` // detectors and rules, not IP anonymization
+	Mode            string         `gorm:"not null;default:'mask'" json:"mode"`
+	Detectors       pq.StringArray `gorm:"type:text[];not null;default:'{authorization,cookie}'" json:"detectors"`
+	Rules           string         `gorm:"type:jsonb;not null;default:'[]'" json:"-"` // JSON array of RedactionRule
+	IPAnonymization string         `gorm:"not null;default:'none'" json:"ip_anonymization"`
+}
+
+// DefaultRedactionSettings returns the settings used for projects that have
+// not configured redaction. Credential headers are always masked. Content
+// detectors also match ordinary values, such as nanosecond timestamps that
+// pass the Luhn check, so they are off until a project opts in.
+func DefaultRedactionSettings(projectID string) RedactionSettings {
+	return RedactionSettings{
+		ProjectID: projectID,
+		Enabled:   true,
+		Mode:      RedactionModeMask,
+		Detectors: pq.StringArray{
+			RedactionDetectorAuthorization,
+			RedactionDetectorCookie,
+		},
+		Rules:           "[]",
+		IPAnonymization: IPAnonymizationNone,
+	}
+}
+
+func (r RedactionSettings) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(r.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = r.ProjectID
+	result["enabled"] = r.Enabled
+	result["mode"] = r.Mode
+	result["detectors"] = r.Detectors
+	result["rules"] = json.RawMessage(r.Rules)
+	result["ip_anonymization"] = r.IPAnonymization
+
+	return json.Marshal(result)
+}
+
+func (r *RedactionSettings) BeforeCreate(tx *gorm.DB) error {
+	if r.BaseModel.ID == "" {
+		id, err := typeid.New[RedactionSettingsID]()
+		if err != nil {
+			return err
+		}
+		r.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// SamplingAttributeRule keeps traces with a span or resource attribute equal
+// to Value, or with the attribute present when Value is empty
+type SamplingAttributeRule struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// TraceSamplingSettings controls tail sampling of a project's traces. A
+// trace is kept when any policy matches it.
+type TraceSamplingSettings struct {
+	storage.BaseModel
+	ProjectID          string   `gorm:"uniqueIndex;not null" json:"project_id"`
+	Project            *Project `json:"-"`
+	Enabled            bool     `gorm:"not null;default:false" json:"enabled"` // every trace is kept when disabled
+	KeepErrors         bool     `gorm:"not null;default:true" json:"keep_errors"`
+	LatencyThresholdMs int64    `gorm:"not null;default:0" json:"latency_threshold_ms"` // 0 disables the policy
+	AttributeRules     string   `gorm:"type:jsonb;not null;default:'[]'" json:"-"`      // JSON array of SamplingAttributeRule
+	SampleRate         float64  `gorm:"not null;default:0.1" json:"sample_rate"`        // share of other traces kept
+}
+
+// DefaultTraceSamplingSettings returns the settings used for projects that
+// have not configured sampling, which keep every trace
+func DefaultTraceSamplingSettings(projectID string) TraceSamplingSettings {
+	return TraceSamplingSettings{
+		ProjectID:      projectID,
+		Enabled:        false,
+		KeepErrors:     true,
+		AttributeRules: "[]",
+		SampleRate:     0.1,
+	}
+}
+
+func (s TraceSamplingSettings) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(s.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["project_id"] = s.ProjectID
+	result["enabled"] = s.Enabled
+	result["keep_errors"] = s.KeepErrors
+	result["latency_threshold_ms"] = s.LatencyThresholdMs
+	result["attribute_rules"] = json.RawMessage(s.AttributeRules)
+	result["sample_rate"] = s.SampleRate
+
+	return json.Marshal(result)
+}
+
+func (s *TraceSamplingSettings) BeforeCreate(tx *gorm.DB) error {
+	if s.BaseModel.ID == "" {
+		id, err := typeid.New[TraceSamplingSettingsID]()
+		if err != nil {
+			return err
+		}
+		s.BaseModel.ID = id.String()
+	}
+	return nil
+}
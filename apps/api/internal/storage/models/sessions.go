@@ -0,0 +1,55 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Session records a signed in session. Session data lives in the session
+// store, this row is what makes it valid: deleting it signs the session
+// out.
+type Session struct {
+	storage.BaseModel
+	TokenHash  string    `gorm:"uniqueIndex;not null" json:"-"` // Hash of the session cookie
+	UserID     string    `gorm:"index;not null" json:"user_id"`
+	User       *User     `json:"-"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`   // Absolute expiry
+	LastSeenAt time.Time `gorm:"not null" json:"last_seen_at"` // Idle expiry is measured from here
+}
+
+func (s Session) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(s.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["user_id"] = s.UserID
+	result["ip_address"] = s.IPAddress
+	result["user_agent"] = s.UserAgent
+	result["expires_at"] = s.ExpiresAt
+	result["last_seen_at"] = s.LastSeenAt
+
+	return json.Marshal(result)
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.BaseModel.ID == "" {
+		id, err := typeid.New[SessionID]()
+		if err != nil {
+			return err
+		}
+		s.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Account provider IDs, SSO accounts use the ID returned by
+// SSOProvider.AccountProviderID
+const (
+	ProviderPassword = "password"
+	ProviderGoogle   = "google"
+	ProviderGitHub   = "github"
+)
+
+// SSOProvider is an OpenID Connect identity provider an organization's
+// members sign in with
+type SSOProvider struct {
+	storage.BaseModel
+	OrganizationID          string         `gorm:"uniqueIndex;not null" json:"organization_id"`
+	Organization            *Organization  `json:"-"`
+	Issuer                  string         `gorm:"not null" json:"issuer"`
+	ClientID                string         `gorm:"not null" json:"client_id"`
+	ClientSecret            string         `gorm:"not null" json:"-"`
+	AllowedDomains          pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"allowed_domains"`  // email domains users sign in with
+	VerifiedDomains         pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"verified_domains"` // allowed domains the organization proved it owns
+	DomainVerificationToken string         `gorm:"not null" json:"-"`                                         // published in a DNS TXT record to prove domain ownership
+	AutoJoin                bool           `gorm:"not null;default:true" json:"auto_join"`                    // add users as members on first login
+	DefaultRole             Role           `gorm:"not null;default:'member'" json:"default_role"`
+	Enabled                 bool           `gorm:"not null;default:true" json:"enabled"`
+}
+
+// AccountProviderID is the provider ID of accounts signed in through the
+// provider
+func (p SSOProvider) AccountProviderID() string {
+	return "sso:" + p.ID
+}
+
+// AllowsEmail reports whether the domain of email is allowed to sign in.
+// Only verified domains are, an organization cannot sign in users of a
+// domain it does not own.
+func (p SSOProvider) AllowsEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, verified := range p.VerifiedDomains {
+		if strings.ToLower(verified) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// DomainVerificationRecord is the DNS TXT record that proves the
+// organization owns domain
+func (p SSOProvider) DomainVerificationRecord(domain string) (name, value string) {
+	return "_logsicle-challenge." + domain, "logsicle-domain-verification=" + p.DomainVerificationToken
+}
+
+func (p SSOProvider) MarshalJSON() ([]byte, error) {
+	baseJSON, err := json.Marshal(p.BaseModel)
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(baseJSON, &result); err != nil {
+		return nil, err
+	}
+
+	result["organization_id"] = p.OrganizationID
+	result["issuer"] = p.Issuer
+	result["client_id"] = p.ClientID
+	result["allowed_domains"] = p.AllowedDomains
+	result["verified_domains"] = p.VerifiedDomains
+	result["auto_join"] = p.AutoJoin
+	result["default_role"] = p.DefaultRole
+	result["enabled"] = p.Enabled
+
+	return json.Marshal(result)
+}
+
+func (p *SSOProvider) BeforeCreate(tx *gorm.DB) error {
+	if p.BaseModel.ID == "" {
+		id, err := typeid.New[SSOProviderID]()
+		if err != nil {
+			return err
+		}
+		p.BaseModel.ID = id.String()
+	}
+	if p.DomainVerificationToken == "" {
+		tokenBytes := make([]byte, 32)
+		if _, err := rand.Read(tokenBytes); err != nil {
+			return err
+		}
+		p.DomainVerificationToken = hex.EncodeToString(tokenBytes)
+	}
+	return nil
+}
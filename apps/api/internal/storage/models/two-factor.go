@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+	"github.com/sumup/typeid"
+	"github.com/ted-too/logsicle/internal/storage"
+	"gorm.io/gorm"
+)
+
+// TwoFactor is the TOTP enrollment of a user. It takes effect once a code
+// has been confirmed.
+type TwoFactor struct {
+	storage.BaseModel
+	UserID         string         `gorm:"uniqueIndex;not null" json:"user_id"`
+	User           *User          `json:"-"`
+	Secret         string         `gorm:"not null" json:"-"`                          // Base32 TOTP secret
+	ConfirmedAt    sql.NullTime   `json:"confirmed_at"`                               // When enrollment was confirmed
+	LastUsedStep   int64          `gorm:"not null;default:0" json:"-"`                // Time step of the last accepted code, to reject replays
+	RecoveryCodes  pq.StringArray `gorm:"type:text[];not null;default:'{}'" json:"-"` // Argon2 hashes of unused recovery codes
+	FailedAttempts int            `gorm:"not null;default:0" json:"-"`                // Wrong codes since the last accepted one
+	LockedUntil    sql.NullTime   `json:"-"`                                          // Codes are refused until then after too many wrong ones
+}
+
+func (t *TwoFactor) BeforeCreate(tx *gorm.DB) error {
+	if t.BaseModel.ID == "" {
+		id, err := typeid.New[TwoFactorID]()
+		if err != nil {
+			return err
+		}
+		t.BaseModel.ID = id.String()
+	}
+	return nil
+}
@@ -12,13 +12,16 @@ import (
 
 type User struct {
 	storage.BaseModel
-	Name          string         `gorm:"not null" json:"name"`
-	Email         string         `gorm:"uniqueIndex;not null" json:"email"`
-	EmailVerified bool           `gorm:"default:false" json:"email_verified"`
-	Image         sql.NullString `json:"image"`
-	HasOnboarded  bool           `gorm:"default:false" json:"has_onboarded"`
-	LastLoginAt   time.Time      `json:"last_login_at"`
-	Organizations []Organization `json:"organizations" gorm:"many2many:team_memberships"`
+	Name             string         `gorm:"not null" json:"name"`
+	Email            string         `gorm:"uniqueIndex;not null" json:"email"`
+	EmailVerified    bool           `gorm:"default:false" json:"email_verified"`
+	Image            sql.NullString `json:"image"`
+	HasOnboarded     bool           `gorm:"default:false" json:"has_onboarded"`
+	TwoFactorEnabled bool           `gorm:"not null;default:false" json:"two_factor_enabled"`
+	LastLoginAt      time.Time      `json:"last_login_at"`
+	// Sessions created before this time are signed out
+	SessionsRevokedAt sql.NullTime   `json:"-"`
+	Organizations     []Organization `json:"organizations" gorm:"many2many:team_memberships"`
 }
 
 type OtherUser struct {
@@ -66,6 +69,7 @@ func (u User) MarshalJSON() ([]byte, error) {
 	result["email"] = u.Email
 	result["email_verified"] = u.EmailVerified
 	result["has_onboarded"] = u.HasOnboarded
+	result["two_factor_enabled"] = u.TwoFactorEnabled
 	result["last_login_at"] = u.LastLoginAt
 	result["organizations"] = u.Organizations
 
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"time"
 
 	"github.com/sumup/typeid"
@@ -8,13 +10,33 @@ import (
 	"gorm.io/gorm"
 )
 
+// Verification purposes, identifiers are the purpose and the user ID
+const (
+	VerificationEmail         = "email-verification"
+	VerificationPasswordReset = "password-reset"
+)
+
 type Verification struct {
 	storage.BaseModel
-	Identifier string    `gorm:"not null" json:"identifier"` // Email or user ID being verified
-	Value      string    `gorm:"not null" json:"-"`          // Verification token/code
+	Identifier string    `gorm:"index;not null" json:"identifier"` // Email or user ID being verified
+	Value      string    `gorm:"index;not null" json:"-"`          // Verification token/code
 	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
 }
 
+// VerificationIdentifier identifies the verifications of a user for a
+// purpose
+func VerificationIdentifier(purpose, userID string) string {
+	return purpose + ":" + userID
+}
+
+// HashToken hashes a secret token such as a verification token or session
+// cookie. Only hashes are stored so a database leak does not expose usable
+// tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func (v *Verification) BeforeCreate(tx *gorm.DB) error {
 	if v.BaseModel.ID == "" {
 		id, err := typeid.New[VerificationID]()
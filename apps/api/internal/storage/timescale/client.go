@@ -203,11 +203,29 @@ func (c *TimescaleClient) BulkInsertAppLogs(ctx context.Context, logs []*models.
 			INSERT INTO app_logs (
 				id, project_id, level, message,
 				fields, timestamp, caller, function,
-				service_name, version, environment, host
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+				service_name, version, environment, host,
+				exception, issue_id, trace_id, span_id
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
 			log.ID, log.ProjectID, log.Level, log.Message,
 			log.Fields, log.Timestamp, log.Caller, log.Function,
 			log.ServiceName, log.Version, log.Environment, log.Host,
+			log.Exception, log.IssueID, log.TraceID, log.SpanID,
+		)
+	}
+
+	return c.executeBatch(ctx, batch)
+}
+
+// UpdateAppLogIssues links inserted app logs to the issues they were
+// grouped into
+func (c *TimescaleClient) UpdateAppLogIssues(ctx context.Context, logs []*models.AppLog) error {
+	batch := &pgx.Batch{}
+
+	for _, log := range logs {
+		batch.Queue(`
+			UPDATE app_logs SET issue_id = $1
+			WHERE id = $2 AND timestamp = $3`,
+			log.IssueID, log.ID, log.Timestamp,
 		)
 	}
 
@@ -223,10 +241,12 @@ func (c *TimescaleClient) BulkInsertRequestLogs(ctx context.Context, logs []*mod
 							id, project_id, method, path,
 							status_code, level, duration, request_body, response_body,
 							headers, query_params, user_agent, ip_address,
-							protocol, host, error, timestamp
+							protocol, host, error, timestamp,
+							trace_id, span_id
 					) VALUES (
 							$1, $2, $3, $4, $5, $6, $7, $8, $9,
-							$10, $11, $12, $13, $14, $15, $16, $17
+							$10, $11, $12, $13, $14, $15, $16, $17,
+							NULLIF($18, ''), NULLIF($19, '')
 					)`,
 			log.ID,
 			log.ProjectID,
@@ -245,6 +265,8 @@ func (c *TimescaleClient) BulkInsertRequestLogs(ctx context.Context, logs []*mod
 			log.Host,
 			log.Error,
 			log.Timestamp,
+			log.TraceID,
+			log.SpanID,
 		)
 	}
 
@@ -264,7 +286,8 @@ func (c *TimescaleClient) BulkInsertMetrics(ctx context.Context, metrics []*mode
 						quantile_values,
 						service_name, service_version,
 						attributes, resource_attributes,
-						aggregation_temporality
+						aggregation_temporality,
+						start_time, exemplars
 				) VALUES (
 						$1, $2, $3, $4, $5, $6,
 						$7, $8,
@@ -273,7 +296,8 @@ func (c *TimescaleClient) BulkInsertMetrics(ctx context.Context, metrics []*mode
 						$14,
 						$15, $16,
 						$17, $18,
-						$19
+						$19,
+						$20, $21
 				)`,
 			metric.ID,
 			metric.ProjectID,
@@ -294,6 +318,8 @@ func (c *TimescaleClient) BulkInsertMetrics(ctx context.Context, metrics []*mode
 			metric.Attributes,
 			metric.ResourceAttributes,
 			metric.AggregationTemporality,
+			metric.StartTime,
+			metric.Exemplars,
 		)
 	}
 
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -45,6 +47,40 @@ func ValidateLogLevel(value interface{}) error {
 	}
 }
 
+// NormalizeLogLevel maps the level names used by common loggers and shippers
+// (e.g. "WARN", "err", "critical", "trace") onto a LogLevel
+func NormalizeLogLevel(value string) (LogLevel, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "trace", "debug", "dbug", "verbose":
+		return LogLevelDebug, true
+	case "info", "information", "informational", "notice", "inf":
+		return LogLevelInfo, true
+	case "warn", "warning", "wrn":
+		return LogLevelWarning, true
+	case "error", "err", "eror":
+		return LogLevelError, true
+	case "fatal", "critical", "crit", "panic", "emerg", "emergency", "alert":
+		return LogLevelFatal, true
+	default:
+		return "", false
+	}
+}
+
+var logLineLevelPattern = regexp.MustCompile(`(?i)(?:level|lvl|severity)["']?\s*[=:]\s*["']?([a-z]+)|\b(trace|debug|info|warn|warning|error|err|fatal|critical|panic)\b`)
+
+// DetectLogLevel looks for a level in an unstructured log line, preferring
+// explicit "level=..." style keys over bare keywords. Defaults to info.
+func DetectLogLevel(line string) LogLevel {
+	for _, match := range logLineLevelPattern.FindAllStringSubmatch(line, 5) {
+		for _, candidate := range match[1:] {
+			if level, ok := NormalizeLogLevel(candidate); ok {
+				return level
+			}
+		}
+	}
+	return LogLevelInfo
+}
+
 type AppLog struct {
 	ID        string `json:"id"`
 	ProjectID string `json:"project_id"`
@@ -64,6 +100,68 @@ type AppLog struct {
 	Version     sql.NullString `json:"version"`
 	Environment sql.NullString `json:"environment"`
 	Host        sql.NullString `json:"host"`
+
+	// Error tracking, the captured exception and the issue it is grouped into
+	Exception JSONB          `json:"exception,omitempty"`
+	IssueID   sql.NullString `json:"issue_id"`
+
+	// Trace context, lowercase hex IDs
+	TraceID sql.NullString `json:"trace_id"`
+	SpanID  sql.NullString `json:"span_id"`
+}
+
+// Exception is an error captured with a log, in the shape error trackers
+// such as Sentry send it
+type Exception struct {
+	Type   string `json:"type"`
+	Value  string `json:"value,omitempty"`
+	Module string `json:"module,omitempty"`
+	// Stack frames, most recent call last
+	Stacktrace []StackFrame `json:"stacktrace,omitempty"`
+}
+
+type StackFrame struct {
+	Filename string `json:"filename,omitempty"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Function string `json:"function,omitempty"`
+	Module   string `json:"module,omitempty"`
+	Lineno   int    `json:"lineno,omitempty"`
+	Colno    int    `json:"colno,omitempty"`
+	// Whether the frame belongs to the application rather than a library
+	InApp *bool `json:"in_app,omitempty"`
+	// Location in the minified bundle, set when the frame was symbolicated
+	// with a source map
+	Minified *StackFrame `json:"minified,omitempty"`
+}
+
+func (e Exception) Validate() error {
+	return validation.ValidateStruct(&e,
+		validation.Field(&e.Type,
+			validation.Required,
+			validation.Length(1, 255),
+		),
+		validation.Field(&e.Value,
+			validation.Length(0, 10000),
+		),
+		validation.Field(&e.Module,
+			validation.Length(0, 255),
+		),
+		validation.Field(&e.Stacktrace,
+			validation.Length(0, 250),
+		),
+	)
+}
+
+// GetException decodes the captured exception, nil when there is none
+func (l *AppLog) GetException() (*Exception, error) {
+	if len(l.Exception) == 0 || string(l.Exception) == "null" {
+		return nil, nil
+	}
+	var exception Exception
+	if err := json.Unmarshal(l.Exception, &exception); err != nil {
+		return nil, err
+	}
+	return &exception, nil
 }
 
 func (l *AppLog) GetLogType() string {
@@ -84,6 +182,9 @@ func (l AppLog) MarshalJSON() ([]byte, error) {
 		Version     *string `json:"version"`
 		Environment *string `json:"environment"`
 		Host        *string `json:"host"`
+		IssueID     *string `json:"issue_id"`
+		TraceID     *string `json:"trace_id"`
+		SpanID      *string `json:"span_id"`
 	}{
 		Alias: (*Alias)(&l),
 	}
@@ -103,6 +204,15 @@ func (l AppLog) MarshalJSON() ([]byte, error) {
 	if l.Host.Valid {
 		clean.Host = &l.Host.String
 	}
+	if l.IssueID.Valid {
+		clean.IssueID = &l.IssueID.String
+	}
+	if l.TraceID.Valid {
+		clean.TraceID = &l.TraceID.String
+	}
+	if l.SpanID.Valid {
+		clean.SpanID = &l.SpanID.String
+	}
 
 	return json.Marshal(clean)
 }
@@ -117,6 +227,9 @@ func (l *AppLog) UnmarshalJSON(data []byte) error {
 		Version     *string `json:"version"`
 		Environment *string `json:"environment"`
 		Host        *string `json:"host"`
+		IssueID     *string `json:"issue_id"`
+		TraceID     *string `json:"trace_id"`
+		SpanID      *string `json:"span_id"`
 	}{
 		Alias: (*Alias)(l),
 	}
@@ -181,6 +294,39 @@ func (l *AppLog) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	if aux.IssueID != nil {
+		l.IssueID = sql.NullString{
+			String: *aux.IssueID,
+			Valid:  true,
+		}
+	} else {
+		l.IssueID = sql.NullString{
+			Valid: false,
+		}
+	}
+
+	if aux.TraceID != nil {
+		l.TraceID = sql.NullString{
+			String: *aux.TraceID,
+			Valid:  true,
+		}
+	} else {
+		l.TraceID = sql.NullString{
+			Valid: false,
+		}
+	}
+
+	if aux.SpanID != nil {
+		l.SpanID = sql.NullString{
+			String: *aux.SpanID,
+			Valid:  true,
+		}
+	} else {
+		l.SpanID = sql.NullString{
+			Valid: false,
+		}
+	}
+
 	return nil
 }
 
@@ -196,6 +342,10 @@ type AppLogInput struct {
 	Timestamp   interface{}    `json:"timestamp,omitempty"`
 	Environment string         `json:"environment,omitempty"`
 	Host        string         `json:"host,omitempty"`
+	Exception   *Exception     `json:"exception,omitempty"`
+	// Trace context, extracted from common Fields names when omitted
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
 }
 
 func (a AppLogInput) ValidateAndCreate() (*AppLog, error) {
@@ -231,6 +381,13 @@ func (a AppLogInput) ValidateAndCreate() (*AppLog, error) {
 		validation.Field(&a.Host,
 			validation.Length(0, 255),
 		),
+		validation.Field(&a.Exception),
+		validation.Field(&a.TraceID,
+			validation.By(validateTraceID),
+		),
+		validation.Field(&a.SpanID,
+			validation.By(validateSpanID),
+		),
 	); err != nil {
 		return nil, err
 	}
@@ -294,6 +451,16 @@ func (a AppLogInput) ValidateAndCreate() (*AppLog, error) {
 		return nil, err
 	}
 
+	var exception JSONB
+	if a.Exception != nil {
+		exception = ConvertToJSONB(a.Exception)
+	}
+
+	traceID, spanID := NormalizeTraceID(a.TraceID), NormalizeSpanID(a.SpanID)
+	if traceID == "" {
+		traceID, spanID = TraceContextFromFields(a.Fields)
+	}
+
 	return &AppLog{
 		ID:          id.String(),
 		ProjectID:   a.ProjectID,
@@ -307,6 +474,9 @@ func (a AppLogInput) ValidateAndCreate() (*AppLog, error) {
 		Environment: environment,
 		Host:        host,
 		Timestamp:   timestamp,
+		Exception:   exception,
+		TraceID:     sql.NullString{String: traceID, Valid: traceID != ""},
+		SpanID:      sql.NullString{String: spanID, Valid: spanID != ""},
 	}, nil
 }
 
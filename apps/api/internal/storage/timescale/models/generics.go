@@ -3,6 +3,7 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -18,16 +19,24 @@ func ParseTimestamp(timestamp interface{}) (time.Time, error) {
 	}
 
 	switch v := timestamp.(type) {
+	case time.Time:
+		return v, nil
 	case string:
 		// Parse RFC3339 or similar string formats
 		return time.Parse(time.RFC3339, v)
 	case float64:
-		// Handle Unix timestamp (either seconds or milliseconds)
-		sec := int64(v)
-		if sec > 1e11 { // Assuming milliseconds if very large
-			sec /= 1000
+		// Handle Unix timestamp in seconds, milliseconds, microseconds or
+		// nanoseconds, told apart by magnitude
+		switch {
+		case v > 1e17:
+			return time.Unix(0, int64(v)), nil
+		case v > 1e14:
+			return time.UnixMicro(int64(v)), nil
+		case v > 1e11:
+			return time.UnixMilli(int64(v)), nil
 		}
-		return time.Unix(sec, 0), nil
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
 	default:
 		return time.Time{}, fmt.Errorf("unsupported timestamp format")
 	}
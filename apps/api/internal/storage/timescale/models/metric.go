@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation"
@@ -44,6 +45,8 @@ type Metric struct {
 	// Common fields
 	Value     float64   `json:"value"`
 	Timestamp time.Time `json:"timestamp"`
+	// Start of the interval a cumulative or delta point covers
+	StartTime *time.Time `json:"start_time,omitempty"`
 
 	// For Sum metrics
 	IsMonotonic bool `json:"is_monotonic,omitempty"`
@@ -67,6 +70,38 @@ type Metric struct {
 
 	// Aggregation
 	AggregationTemporality AggregationTemporality `json:"aggregation_temporality"`
+
+	// Sample measurements linking the point to traces, a list of Exemplar
+	Exemplars JSONB `json:"exemplars,omitempty"`
+}
+
+// Maximum number of exemplars accepted per metric
+const maxExemplars = 100
+
+// Exemplar is a sample measurement recorded while a metric was aggregated,
+// linking a data point to the trace it was observed in
+type Exemplar struct {
+	Value      float64        `json:"value"`
+	Timestamp  time.Time      `json:"timestamp"`
+	TraceID    string         `json:"trace_id,omitempty"`
+	SpanID     string         `json:"span_id,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// ExemplarInput validation struct
+type ExemplarInput struct {
+	Value      float64        `json:"value"`
+	Timestamp  interface{}    `json:"timestamp,omitempty"`
+	TraceID    string         `json:"trace_id,omitempty"`
+	SpanID     string         `json:"span_id,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func (e ExemplarInput) Validate() error {
+	return validation.ValidateStruct(&e,
+		validation.Field(&e.TraceID, validation.By(validateTraceID)),
+		validation.Field(&e.SpanID, validation.By(validateSpanID)),
+	)
 }
 
 func (m *Metric) GetLogType() string {
@@ -103,9 +138,13 @@ type MetricInput struct {
 	ResourceAttributes map[string]any `json:"resource_attributes,omitempty"`
 
 	AggregationTemporality string `json:"aggregation_temporality"`
-}
 
-// TODO: Allow timestamp to be part of input
+	// Time the point was observed, defaults to now
+	Timestamp interface{} `json:"timestamp,omitempty"`
+	// Start of the interval the point covers, for cumulative and delta series
+	StartTime interface{}     `json:"start_time,omitempty"`
+	Exemplars []ExemplarInput `json:"exemplars,omitempty"`
+}
 
 func (m MetricInput) ValidateAndCreate() (*Metric, error) {
 	if err := validation.ValidateStruct(&m,
@@ -125,10 +164,49 @@ func (m MetricInput) ValidateAndCreate() (*Metric, error) {
 				string(AggregationTemporalityDelta),
 				string(AggregationTemporalityCumulative)),
 		),
+		validation.Field(&m.Exemplars, validation.Length(0, maxExemplars)),
 	); err != nil {
 		return nil, err
 	}
 
+	timestamp, err := ParseTimestamp(m.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	var startTime *time.Time
+	if m.StartTime != nil {
+		start, err := ParseTimestamp(m.StartTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start_time: %w", err)
+		}
+		if start.After(timestamp) {
+			return nil, fmt.Errorf("start_time must not be after timestamp")
+		}
+		startTime = &start
+	}
+
+	var exemplars JSONB
+	if len(m.Exemplars) > 0 {
+		list := make([]Exemplar, 0, len(m.Exemplars))
+		for i, e := range m.Exemplars {
+			exemplarTime := timestamp
+			if e.Timestamp != nil {
+				if exemplarTime, err = ParseTimestamp(e.Timestamp); err != nil {
+					return nil, fmt.Errorf("exemplars: (%d) invalid timestamp: %w", i, err)
+				}
+			}
+			list = append(list, Exemplar{
+				Value:      e.Value,
+				Timestamp:  exemplarTime,
+				TraceID:    NormalizeTraceID(e.TraceID),
+				SpanID:     NormalizeSpanID(e.SpanID),
+				Attributes: e.Attributes,
+			})
+		}
+		exemplars = ConvertToJSONB(list)
+	}
+
 	id, err := typeid.New[MetricID]()
 	if err != nil {
 		return nil, err
@@ -153,6 +231,8 @@ func (m MetricInput) ValidateAndCreate() (*Metric, error) {
 		Attributes:             ConvertToJSONB(m.Attributes),
 		ResourceAttributes:     ConvertToJSONB(m.ResourceAttributes),
 		AggregationTemporality: AggregationTemporality(m.AggregationTemporality),
-		Timestamp:              time.Now(),
+		Timestamp:              timestamp,
+		StartTime:              startTime,
+		Exemplars:              exemplars,
 	}, nil
 }
@@ -67,6 +67,8 @@ type RequestLog struct {
 	Protocol     string       `json:"protocol,omitempty"` // Added protocol (HTTP/1.1, HTTP/2, etc.)
 	Host         string       `json:"host,omitempty"`     // Added host
 	Error        string       `json:"error,omitempty"`    // Added error field
+	TraceID      string       `json:"trace_id,omitempty"` // Lowercase hex trace context
+	SpanID       string       `json:"span_id,omitempty"`
 	Timestamp    time.Time    `json:"timestamp"`
 }
 
@@ -78,6 +80,14 @@ func (l *RequestLog) GetProjectID() string {
 	return l.ProjectID
 }
 
+// StripPayloads removes the request and response bodies and the headers,
+// which carry cookies and tokens, for readers that may not view them
+func (l *RequestLog) StripPayloads() {
+	l.RequestBody = nil
+	l.ResponseBody = nil
+	l.Headers = nil
+}
+
 type RequestLevel string
 
 const (
@@ -123,6 +133,9 @@ type RequestLogInput struct {
 	Host         string         `json:"host,omitempty"`
 	Error        string         `json:"error,omitempty"`
 	Timestamp    interface{}    `json:"timestamp,omitempty"`
+	// Trace context, extracted from propagation Headers when omitted
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
 }
 
 func (r RequestLogInput) ValidateAndCreate() (*RequestLog, error) {
@@ -160,6 +173,12 @@ func (r RequestLogInput) ValidateAndCreate() (*RequestLog, error) {
 		validation.Field(&r.Host,
 			validation.Length(0, 255),
 		),
+		validation.Field(&r.TraceID,
+			validation.By(validateTraceID),
+		),
+		validation.Field(&r.SpanID,
+			validation.By(validateSpanID),
+		),
 	); err != nil {
 		return nil, err
 	}
@@ -187,6 +206,11 @@ func (r RequestLogInput) ValidateAndCreate() (*RequestLog, error) {
 		return nil, err
 	}
 
+	traceID, spanID := NormalizeTraceID(r.TraceID), NormalizeSpanID(r.SpanID)
+	if traceID == "" {
+		traceID, spanID = TraceContextFromHeaders(r.Headers)
+	}
+
 	return &RequestLog{
 		ID:           id.String(),
 		ProjectID:    r.ProjectID,
@@ -204,6 +228,8 @@ func (r RequestLogInput) ValidateAndCreate() (*RequestLog, error) {
 		Protocol:     r.Protocol,
 		Host:         r.Host,
 		Error:        r.Error,
+		TraceID:      traceID,
+		SpanID:       spanID,
 		Timestamp:    timestamp,
 	}, nil
 }
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	traceIDPattern = regexp.MustCompile(`^[0-9a-f]{16}([0-9a-f]{16})?$`)
+	spanIDPattern  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// Field names loggers commonly use for trace context, checked in order
+var (
+	traceIDFields = []string{"trace_id", "traceId", "traceID", "trace.id", "otelTraceID", "dd.trace_id"}
+	spanIDFields  = []string{"span_id", "spanId", "spanID", "span.id", "otelSpanID", "dd.span_id"}
+)
+
+// NormalizeTraceID lowercases a hex trace ID, returning "" when it is not a
+// valid 64 or 128 bit ID
+func NormalizeTraceID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if !traceIDPattern.MatchString(id) || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+// NormalizeSpanID lowercases a hex span ID, returning "" when it is not a
+// valid 64 bit ID
+func NormalizeSpanID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if !spanIDPattern.MatchString(id) || strings.Trim(id, "0") == "" {
+		return ""
+	}
+	return id
+}
+
+// PadTraceID left pads a hex trace ID with zeros to 64 or 128 bits. Jaeger
+// and Zipkin clients may drop leading zeros.
+func PadTraceID(id string) string {
+	if len(id) < 16 {
+		return strings.Repeat("0", 16-len(id)) + id
+	}
+	if len(id) < 32 && len(id) > 16 {
+		return strings.Repeat("0", 32-len(id)) + id
+	}
+	return id
+}
+
+// PadSpanID left pads a hex span ID with zeros to 64 bits
+func PadSpanID(id string) string {
+	if len(id) < 16 {
+		return strings.Repeat("0", 16-len(id)) + id
+	}
+	return id
+}
+
+func validateTraceID(value interface{}) error {
+	if s, _ := value.(string); s != "" && NormalizeTraceID(s) == "" {
+		return fmt.Errorf("must be 16 or 32 hex characters")
+	}
+	return nil
+}
+
+func validateSpanID(value interface{}) error {
+	if s, _ := value.(string); s != "" && NormalizeSpanID(s) == "" {
+		return fmt.Errorf("must be 16 hex characters")
+	}
+	return nil
+}
+
+// lookupField finds a field by its flat name, e.g. "trace.id", or by the
+// same path through nested objects
+func lookupField(fields map[string]any, name string) (any, bool) {
+	if value, ok := fields[name]; ok {
+		return value, true
+	}
+	head, rest, found := strings.Cut(name, ".")
+	if !found {
+		return nil, false
+	}
+	nested, ok := fields[head].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	return lookupField(nested, rest)
+}
+
+// idString converts a field value to a hex ID. Datadog IDs are decimal
+// 64 bit integers and are converted to hex.
+func idString(value any, decimal bool) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case uint64:
+		s = strconv.FormatUint(v, 10)
+	default:
+		return ""
+	}
+	if decimal {
+		if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return fmt.Sprintf("%016x", n)
+		}
+	}
+	return s
+}
+
+// TraceContextFromFields extracts trace and span IDs from structured log
+// fields. Invalid IDs are ignored.
+func TraceContextFromFields(fields map[string]any) (traceID, spanID string) {
+	for _, name := range traceIDFields {
+		if value, ok := lookupField(fields, name); ok {
+			if traceID = NormalizeTraceID(idString(value, strings.HasPrefix(name, "dd."))); traceID != "" {
+				break
+			}
+		}
+	}
+	for _, name := range spanIDFields {
+		if value, ok := lookupField(fields, name); ok {
+			if spanID = NormalizeSpanID(idString(value, strings.HasPrefix(name, "dd."))); spanID != "" {
+				break
+			}
+		}
+	}
+	return traceID, spanID
+}
+
+// headerValue returns the first value of a header by case-insensitive name.
+// Values may be strings or lists of strings.
+func headerValue(headers map[string]any, name string) string {
+	for key, value := range headers {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		switch v := value.(type) {
+		case string:
+			return v
+		case []any:
+			if len(v) > 0 {
+				s, _ := v[0].(string)
+				return s
+			}
+		case []string:
+			if len(v) > 0 {
+				return v[0]
+			}
+		}
+	}
+	return ""
+}
+
+// TraceContextFromHeaders extracts trace and span IDs from propagation
+// headers: W3C traceparent, B3 single and multi header, and Jaeger
+// uber-trace-id
+func TraceContextFromHeaders(headers map[string]any) (traceID, spanID string) {
+	// traceparent: version-traceid-parentid-flags
+	if parts := strings.Split(headerValue(headers, "traceparent"), "-"); len(parts) >= 4 && parts[0] != "ff" {
+		if traceID = NormalizeTraceID(parts[1]); traceID != "" && len(traceID) == 32 {
+			return traceID, NormalizeSpanID(parts[2])
+		}
+	}
+
+	// b3: traceid-spanid[-sampled[-parentspanid]]
+	if parts := strings.Split(headerValue(headers, "b3"), "-"); len(parts) >= 2 {
+		if traceID = NormalizeTraceID(parts[0]); traceID != "" {
+			return traceID, NormalizeSpanID(parts[1])
+		}
+	}
+	if traceID = NormalizeTraceID(headerValue(headers, "x-b3-traceid")); traceID != "" {
+		return traceID, NormalizeSpanID(headerValue(headers, "x-b3-spanid"))
+	}
+
+	// uber-trace-id: traceid:spanid:parentspanid:flags, IDs may be unpadded
+	if parts := strings.Split(headerValue(headers, "uber-trace-id"), ":"); len(parts) == 4 {
+		if traceID = NormalizeTraceID(PadTraceID(parts[0])); traceID != "" {
+			return traceID, NormalizeSpanID(PadSpanID(parts[1]))
+		}
+	}
+
+	return "", ""
+}
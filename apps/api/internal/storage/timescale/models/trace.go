@@ -91,6 +91,7 @@ type TraceLink struct {
 type TraceInput struct {
 	ProjectID          string         `json:"project_id"`
 	TraceID            string         `json:"trace_id"`
+	SpanID             string         `json:"span_id,omitempty"` // Hex span ID, generated when omitted
 	ParentID           string         `json:"parent_id,omitempty"`
 	Name               string         `json:"name"`
 	Kind               string         `json:"kind"`
@@ -115,6 +116,9 @@ func (t TraceInput) ValidateAndCreate() (*Trace, error) {
 			validation.Required,
 			validation.Length(16, 32), // Typical trace ID length
 		),
+		validation.Field(&t.SpanID,
+			validation.By(validateSpanID),
+		),
 		validation.Field(&t.Name,
 			validation.Required,
 			validation.Length(1, 255),
@@ -142,9 +146,14 @@ func (t TraceInput) ValidateAndCreate() (*Trace, error) {
 		return nil, err
 	}
 
-	id, err := typeid.New[TraceID]()
-	if err != nil {
-		return nil, err
+	// Client span IDs let logs and child spans reference the span
+	spanID := NormalizeSpanID(t.SpanID)
+	if spanID == "" {
+		id, err := typeid.New[TraceID]()
+		if err != nil {
+			return nil, err
+		}
+		spanID = id.String()
 	}
 
 	// Calculate duration in milliseconds
@@ -173,7 +182,7 @@ func (t TraceInput) ValidateAndCreate() (*Trace, error) {
 	}
 
 	return &Trace{
-		ID:                 id.String(),
+		ID:                 spanID,
 		TraceID:            t.TraceID,
 		ParentID:           parentID,
 		ProjectID:          t.ProjectID,
@@ -0,0 +1,257 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+// Message is a parsed syslog message in either RFC 5424 or RFC 3164 format
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+// facilityNames maps facility codes to their conventional names
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// FacilityName returns the conventional name for the message facility
+func (m *Message) FacilityName() string {
+	if m.Facility >= 0 && m.Facility < len(facilityNames) {
+		return facilityNames[m.Facility]
+	}
+	return strconv.Itoa(m.Facility)
+}
+
+// Level maps the syslog severity onto a log level
+func (m *Message) Level() models.LogLevel {
+	switch m.Severity {
+	case 0, 1, 2: // emergency, alert, critical
+		return models.LogLevelFatal
+	case 3:
+		return models.LogLevelError
+	case 4:
+		return models.LogLevelWarning
+	case 5, 6: // notice, informational
+		return models.LogLevelInfo
+	default:
+		return models.LogLevelDebug
+	}
+}
+
+// Param looks up a structured data param across all SD elements
+func (m *Message) Param(name string) (string, bool) {
+	for _, params := range m.StructuredData {
+		if value, ok := params[name]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Parse parses a single syslog message, detecting RFC 5424 vs RFC 3164
+func Parse(data []byte) (*Message, error) {
+	line := strings.TrimRight(string(data), "\r\n\x00")
+	if len(line) == 0 || line[0] != '<' {
+		return nil, fmt.Errorf("missing priority")
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return nil, fmt.Errorf("invalid priority")
+	}
+
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, fmt.Errorf("invalid priority: %s", line[1:end])
+	}
+
+	msg := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+	}
+	rest := line[end+1:]
+
+	// RFC 5424 messages carry a version number directly after the priority
+	if strings.HasPrefix(rest, "1 ") {
+		if err := parseRFC5424(msg, rest[2:]); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	parseRFC3164(msg, rest)
+	return msg, nil
+}
+
+// nextField splits off the next space-delimited header field
+func nextField(s string) (string, string) {
+	idx := strings.IndexByte(s, ' ')
+	if idx < 0 {
+		return s, ""
+	}
+	return s[:idx], s[idx+1:]
+}
+
+// nilValue converts the RFC 5424 NILVALUE into an empty string
+func nilValue(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+func parseRFC5424(msg *Message, s string) error {
+	var timestamp string
+	timestamp, s = nextField(s)
+	msg.Hostname, s = nextField(s)
+	msg.AppName, s = nextField(s)
+	msg.ProcID, s = nextField(s)
+	msg.MsgID, s = nextField(s)
+
+	msg.Hostname = nilValue(msg.Hostname)
+	msg.AppName = nilValue(msg.AppName)
+	msg.ProcID = nilValue(msg.ProcID)
+	msg.MsgID = nilValue(msg.MsgID)
+
+	if timestamp == "-" {
+		msg.Timestamp = time.Now()
+	} else {
+		ts, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp: %w", err)
+		}
+		msg.Timestamp = ts
+	}
+
+	if strings.HasPrefix(s, "-") {
+		s = strings.TrimPrefix(s[1:], " ")
+	} else if strings.HasPrefix(s, "[") {
+		sd, rest, err := parseStructuredData(s)
+		if err != nil {
+			return err
+		}
+		msg.StructuredData = sd
+		s = strings.TrimPrefix(rest, " ")
+	} else if s != "" {
+		return fmt.Errorf("invalid structured data")
+	}
+
+	// Strip the UTF-8 byte order mark if present
+	msg.Message = strings.TrimPrefix(s, "\ufeff")
+	return nil
+}
+
+// parseStructuredData parses one or more [id param="value" ...] elements
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := make(map[string]map[string]string)
+
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		// SD-ID runs until the first space or closing bracket
+		idEnd := strings.IndexAny(s, " ]")
+		if idEnd <= 0 {
+			return nil, "", fmt.Errorf("invalid structured data element")
+		}
+		id := s[:idEnd]
+		s = s[idEnd:]
+		params := make(map[string]string)
+
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+
+			eq := strings.Index(s, "=\"")
+			if eq <= 0 {
+				return nil, "", fmt.Errorf("invalid structured data param in %s", id)
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+
+			// Values are quoted, with \" \\ and \] escaped
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					value.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if s[i] == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, "", fmt.Errorf("unterminated structured data param in %s", id)
+			}
+			params[name] = value.String()
+		}
+
+		sd[id] = params
+	}
+
+	return sd, s, nil
+}
+
+func parseRFC3164(msg *Message, s string) {
+	// Timestamp has the form "Jan _2 15:04:05" and carries no year or zone
+	msg.Timestamp = time.Now()
+	if len(s) >= len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			now := time.Now()
+			ts = ts.AddDate(now.Year(), 0, 0)
+			// Messages from late December arriving in January belong to last year
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			msg.Timestamp = ts
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+
+			msg.Hostname, s = nextField(s)
+		}
+	}
+
+	// TAG is alphanumeric and terminated by "[pid]:" or ":"
+	tagEnd := strings.IndexAny(s, "[: ")
+	if tagEnd > 0 && tagEnd <= 48 {
+		tag := s[:tagEnd]
+		rest := s[tagEnd:]
+
+		if strings.HasPrefix(rest, "[") {
+			if pidEnd := strings.Index(rest, "]"); pidEnd > 0 {
+				msg.ProcID = rest[1:pidEnd]
+				rest = rest[pidEnd+1:]
+			}
+		}
+
+		if strings.HasPrefix(rest, ":") {
+			msg.AppName = tag
+			s = strings.TrimPrefix(rest[1:], " ")
+		} else {
+			msg.ProcID = ""
+		}
+	}
+
+	msg.Message = s
+}
@@ -0,0 +1,379 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ted-too/logsicle/internal/config"
+	"github.com/ted-too/logsicle/internal/queue"
+	"github.com/ted-too/logsicle/internal/storage/timescale/models"
+)
+
+const (
+	// Maximum accepted size of a single syslog message
+	maxMessageSize = 64 * 1024
+	// Maximum number of digits in an octet count prefix
+	maxOctetCountDigits = 10
+	// Service name used when the message carries no app-name
+	defaultServiceName = "syslog"
+	// Longest message accepted by AppLogInput validation
+	maxAppLogMessageLength = 10000
+	// How long an idle TCP connection is kept open
+	idleTimeout = 5 * time.Minute
+)
+
+type Server struct {
+	cfg       *config.Config
+	qs        *queue.QueueService
+	listeners []net.Listener
+	conns     []net.PacketConn
+	wg        sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	streams map[net.Conn]struct{}
+}
+
+func NewServer(cfg *config.Config, qs *queue.QueueService) *Server {
+	return &Server{
+		cfg:     cfg,
+		qs:      qs,
+		streams: make(map[net.Conn]struct{}),
+	}
+}
+
+// Start binds all configured listeners and serves them until ctx is done
+func (s *Server) Start(ctx context.Context) error {
+	sc := s.cfg.Syslog
+
+	if sc.UDPAddr != "" {
+		conn, err := net.ListenPacket("udp", sc.UDPAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on udp %s: %w", sc.UDPAddr, err)
+		}
+		s.conns = append(s.conns, conn)
+		s.wg.Add(1)
+		go s.serveUDP(ctx, conn)
+		log.Printf("Syslog listening on udp %s", sc.UDPAddr)
+		if sc.AllowUnauthenticatedUDP {
+			log.Printf("Warning: syslog accepts udp messages without a token, senders can be spoofed")
+		}
+	}
+
+	if sc.TCPAddr != "" {
+		ln, err := net.Listen("tcp", sc.TCPAddr)
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("failed to listen on tcp %s: %w", sc.TCPAddr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		s.wg.Add(1)
+		go s.serveStream(ctx, ln)
+		log.Printf("Syslog listening on tcp %s", sc.TCPAddr)
+	}
+
+	if sc.TLSAddr != "" {
+		cert, err := tls.LoadX509KeyPair(sc.TLSCertFile, sc.TLSKeyFile)
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("failed to load syslog TLS certificate: %w", err)
+		}
+		ln, err := tls.Listen("tcp", sc.TLSAddr, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			s.Close()
+			return fmt.Errorf("failed to listen on tls %s: %w", sc.TLSAddr, err)
+		}
+		s.listeners = append(s.listeners, ln)
+		s.wg.Add(1)
+		go s.serveStream(ctx, ln)
+		log.Printf("Syslog listening on tls %s", sc.TLSAddr)
+	}
+
+	go func() {
+		<-ctx.Done()
+		s.Close()
+	}()
+
+	return nil
+}
+
+// Close stops all listeners, closes open connections and waits for them to
+// exit
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	for conn := range s.streams {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// track registers an accepted connection so Close can close it, reporting
+// false when the server is already closing
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.streams[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.streams, conn)
+	s.mu.Unlock()
+}
+
+func (s *Server) serveUDP(ctx context.Context, conn net.PacketConn) {
+	defer s.wg.Done()
+
+	port := localPort(conn.LocalAddr())
+	buf := make([]byte, maxMessageSize)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error reading syslog datagram: %v", err)
+			continue
+		}
+
+		s.handleMessage(ctx, port, buf[:n], true)
+	}
+}
+
+func (s *Server) serveStream(ctx context.Context, ln net.Listener) {
+	defer s.wg.Done()
+
+	port := localPort(ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Error accepting syslog connection: %v", err)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return
+		}
+		s.wg.Add(1)
+		go s.handleConn(ctx, port, conn)
+	}
+}
+
+func (s *Server) handleConn(ctx context.Context, port string, conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	reader := bufio.NewReaderSize(conn, maxMessageSize)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		frame, err := readFrame(reader)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error reading syslog frame from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		if len(frame) > 0 {
+			s.handleMessage(ctx, port, frame, false)
+		}
+	}
+}
+
+// readFrame reads one message using octet counting (RFC 6587 3.4.1) when the
+// frame starts with a digit, otherwise falls back to newline-delimited framing
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		lengthStr, err := readOctetCount(r)
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil || length <= 0 || length > maxMessageSize {
+			return nil, fmt.Errorf("invalid octet count: %q", lengthStr)
+		}
+
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+	}
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, err
+	}
+
+	frame := make([]byte, len(line))
+	copy(frame, line)
+	return frame, nil
+}
+
+// readOctetCount reads the digits of an octet count prefix up to the space
+// that ends it, refusing prefixes longer than maxOctetCountDigits
+func readOctetCount(r *bufio.Reader) (string, error) {
+	digits := make([]byte, 0, maxOctetCountDigits)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == ' ' {
+			return string(digits), nil
+		}
+		if len(digits) == maxOctetCountDigits {
+			return "", fmt.Errorf("octet count exceeds %d digits", maxOctetCountDigits)
+		}
+		digits = append(digits, b)
+	}
+}
+
+func (s *Server) handleMessage(ctx context.Context, port string, data []byte, datagram bool) {
+	msg, err := Parse(data)
+	if err != nil {
+		log.Printf("Error parsing syslog message: %v", err)
+		return
+	}
+
+	projectID := s.resolveProject(port, msg, datagram)
+	if projectID == "" {
+		log.Printf("Dropping syslog message on port %s: no project mapping", port)
+		return
+	}
+
+	appLog, err := toAppLogInput(projectID, msg).ValidateAndCreate()
+	if err != nil {
+		log.Printf("Error validating syslog message: %v", err)
+		return
+	}
+
+	if err := s.qs.EnqueueAppLog(ctx, appLog); err != nil {
+		log.Printf("Error enqueuing syslog message: %v", err)
+	}
+}
+
+// resolveProject picks the project for a message, preferring a structured
+// data token, then the per-port mapping, then the default project. The
+// source of a datagram can be spoofed, so UDP messages need a token unless
+// unauthenticated UDP is allowed.
+func (s *Server) resolveProject(port string, msg *Message, datagram bool) string {
+	sc := s.cfg.Syslog
+
+	if token, ok := msg.Param("token"); ok {
+		if projectID, ok := sc.Tokens[token]; ok {
+			return projectID
+		}
+		// An unknown token must not fall through to another project
+		return ""
+	}
+
+	if datagram && !sc.AllowUnauthenticatedUDP {
+		return ""
+	}
+
+	if projectID, ok := sc.PortProjects[port]; ok {
+		return projectID
+	}
+
+	return sc.DefaultProjectID
+}
+
+func toAppLogInput(projectID string, msg *Message) models.AppLogInput {
+	serviceName := msg.AppName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	fields := map[string]any{
+		"facility": msg.FacilityName(),
+		"severity": msg.Severity,
+	}
+	if msg.ProcID != "" {
+		fields["proc_id"] = msg.ProcID
+	}
+	if msg.MsgID != "" {
+		fields["msg_id"] = msg.MsgID
+	}
+	for id, params := range msg.StructuredData {
+		// Never persist the routing token alongside the log
+		clean := make(map[string]string, len(params))
+		for k, v := range params {
+			if k != "token" {
+				clean[k] = v
+			}
+		}
+		if len(clean) > 0 {
+			fields[id] = clean
+		}
+	}
+
+	message := msg.Message
+	if message == "" {
+		message = "-"
+	}
+	if runes := []rune(message); len(runes) > maxAppLogMessageLength {
+		message = string(runes[:maxAppLogMessageLength])
+	}
+
+	return models.AppLogInput{
+		ProjectID:   projectID,
+		Level:       string(msg.Level()),
+		Message:     message,
+		Fields:      fields,
+		ServiceName: serviceName,
+		Timestamp:   msg.Timestamp.Format(time.RFC3339Nano),
+		Host:        msg.Hostname,
+	}
+}
+
+func localPort(addr net.Addr) string {
+	_, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return ""
+	}
+	return port
+}